@@ -1,27 +1,74 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/certs"
+	"github.com/mdeckert/sourdough/internal/config"
 	"github.com/mdeckert/sourdough/internal/qr"
 )
 
+func printUsage() {
+	fmt.Println("Usage: qrgen [options] [server-url]")
+	fmt.Println("Example: qrgen http://192.168.1.100:8080")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --config FILE   Read settings from FILE (default: $SOURDOUGH_CONFIG or ./sourdough.toml)")
+	fmt.Println("  --output DIR    Write the codes to DIR (default: qr.output_dir, ./qrcodes)")
+	fmt.Println("  --rotate        Replace the signing key first; every previously printed code stops working")
+	fmt.Println("  --expires AGE   Make the codes expire after this long, e.g. 90d (default: never)")
+	fmt.Println("  --user NAME     Log events as baker NAME; the sheet goes to <output>/NAME/")
+	fmt.Println("  --scheme S      https, http, or auto: https when the server has TLS set up (default)")
+	fmt.Println("\nThe server URL can also be set as qr.server_url in the config file.")
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: qrgen <server-url>")
-		fmt.Println("Example: qrgen http://192.168.1.100:8080")
+	fs := flag.NewFlagSet("qrgen", flag.ExitOnError)
+	fs.Usage = printUsage
+	configPath := fs.String("config", "", "Config file")
+	output := fs.String("output", "", "Output directory")
+	rotate := fs.Bool("rotate", false, "Replace the signing key before generating")
+	expires := fs.String("expires", "", "Expire the codes after this long")
+	user := fs.String("user", "", "User the codes log events as")
+	scheme := fs.String("scheme", "", "URL scheme: auto, https or http")
+	fs.Parse(os.Args[1:])
+
+	// Flags and the argument override the config file and environment
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	overrides := []struct{ key, value, source string }{
+		{"qr.output_dir", *output, "--output"},
+		{"qr.expires", *expires, "--expires"},
+		{"qr.scheme", *scheme, "--scheme"},
+		{"qr.server_url", fs.Arg(0), "argument"},
+	}
+	for _, o := range overrides {
+		if o.value == "" {
+			continue
+		}
+		if err := cfg.Set(o.key, o.value, o.source); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	serverURL := os.Args[1]
-	outputDir := "./qrcodes"
-
-	// Validate URL
-	if serverURL == "--help" || serverURL == "-h" {
-		fmt.Println("Usage: qrgen <server-url>")
-		fmt.Println("Example: qrgen http://192.168.1.100:8080")
-		os.Exit(0)
+	serverURL := cfg.QR.ServerURL
+	outputDir := cfg.QR.OutputDir
+	dataDir := cfg.Server.DataDir
+	if serverURL == "" {
+		printUsage()
+		os.Exit(1)
 	}
 
 	// Check for invalid URLs
@@ -32,17 +79,57 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Match the codes to how the server listens; an https server doesn't answer http
+	if cfg.QR.Scheme == "auto" {
+		serverURL = qr.WithScheme(serverURL, tlsConfigured(cfg))
+	} else {
+		serverURL = qr.WithScheme(serverURL, cfg.QR.Scheme == "https")
+	}
+
+	var expiry time.Time
+	if cfg.QR.Expires > 0 {
+		expiry = time.Now().Add(time.Duration(cfg.QR.Expires))
+	}
+	if *user != "" {
+		if err := auth.ValidUser(*user); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		// Each baker gets their own sheet, served at /qrcodes.pdf?user=<name>
+		outputDir = filepath.Join(outputDir, *user)
+	}
+
+	// Sign the links so they keep working when the server has a PIN set
+	// or requires confirmation for unsigned links
+	if *rotate {
+		if err := auth.RotateSecret(dataDir); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Rotated the signing key: old QR codes and browser logins no longer work")
+	}
+	a, err := auth.New(dataDir, "")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 	fmt.Printf("Generating QR codes for server: %s\n", serverURL)
-	fmt.Printf("Output directory: %s\n\n", outputDir)
+	fmt.Printf("Output directory: %s\n", outputDir)
+	fmt.Printf("Signing links with the key in %s\n", filepath.Join(dataDir, auth.Dir))
+	if !expiry.IsZero() {
+		fmt.Printf("Codes expire: %s\n", expiry.Format("2006-01-02 15:04"))
+	}
+	fmt.Println()
+	sign := func(path string) string { return a.SignPath(path, *user, expiry) }
 
-	if err := qr.GenerateAll(serverURL, outputDir); err != nil {
+	if err := qr.GenerateSigned(serverURL, outputDir, sign); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	fmt.Println("\n✓ QR code generation complete!")
 	fmt.Println("\nNext steps:")
-	fmt.Println("1. Print qrcodes/sheet.png")
+	fmt.Printf("1. Print %s\n", filepath.Join(outputDir, "sheet.png"))
 	fmt.Println("2. Cut out QR codes and label them")
 	fmt.Println("3. Stick on fridge for easy access")
 	fmt.Println("\nQR codes to include:")
@@ -50,3 +137,17 @@ func main() {
 	fmt.Println("  - Temperature codes: 70°F, 72°F, 74°F, 76°F, 78°F")
 	fmt.Println("\nTip: Test each QR code with your phone to ensure it works!")
 }
+
+// tlsConfigured reports whether the server serves HTTPS, going by the same
+// settings it reads or a local CA certificate in the data directory
+func tlsConfigured(cfg *config.Config) bool {
+	if cfg.TLSEnabled() {
+		return true
+	}
+	if cfg.Source("tls.mode") != "" {
+		// Explicitly set to off
+		return false
+	}
+	_, err := os.Stat(filepath.Join(cfg.Server.DataDir, certs.Dir, certs.ServerCertFile))
+	return err == nil
+}
@@ -1,62 +1,282 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/backup"
+	"github.com/mdeckert/sourdough/internal/certs"
+	"github.com/mdeckert/sourdough/internal/config"
 	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/homeassistant"
+	"github.com/mdeckert/sourdough/internal/profiles"
+	"github.com/mdeckert/sourdough/internal/replica"
 	"github.com/mdeckert/sourdough/internal/server"
 	"github.com/mdeckert/sourdough/internal/storage"
+	"github.com/mdeckert/sourdough/internal/webhook"
 )
 
 func main() {
-	// Get configuration from environment variables
-	port := os.Getenv("SOURDOUGH_PORT")
-	if port == "" {
-		port = "8080"
+	// Settings come from defaults, then sourdough.toml, then environment, then flags
+	configPath := flag.String("config", "", "Config file (default: $SOURDOUGH_CONFIG or ./sourdough.toml)")
+	portFlag := flag.String("port", "", "Port to listen on")
+	dataDirFlag := flag.String("data-dir", "", "Data directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sourdough-server [--config file] [--port port] [--data-dir dir]\n\n")
+		fmt.Fprintf(os.Stderr, "Settings come from sourdough.toml and environment variables; flags override both.\n")
+		fmt.Fprintf(os.Stderr, "See sourdough.example.toml for every setting.\n\n")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	dataDir := os.Getenv("SOURDOUGH_DATA_DIR")
-	if dataDir == "" {
-		dataDir = "./data"
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if *portFlag != "" {
+		if err := cfg.Set("server.port", *portFlag, "--port"); err != nil {
+			log.Fatalf("Invalid flag: %v", err)
+		}
+	}
+	if *dataDirFlag != "" {
+		if err := cfg.Set("server.data_dir", *dataDirFlag, "--data-dir"); err != nil {
+			log.Fatalf("Invalid flag: %v", err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Request logs are structured; JSON suits Loki or other log collectors
+	if cfg.Server.LogFormat == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+	if cfg.Path != "" {
+		log.Printf("Loaded configuration from %s", cfg.Path)
 	}
 
-	// Ecobee configuration via Home Assistant (optional)
-	haURL := os.Getenv("HA_URL")
-	haToken := os.Getenv("HA_TOKEN")
-	ecobeeEntity := os.Getenv("ECOBEE_ENTITY")
+	port := cfg.Server.Port
+	dataDir := cfg.Server.DataDir
 
 	// Initialize storage
-	store, err := storage.New(dataDir)
+	store, err := storage.Open(cfg.Storage.Backend, dataDir)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
-	// Initialize Ecobee client (can be disabled)
-	ecobeeClient := ecobee.New(haURL, haToken, ecobeeEntity)
+	// Fsync policy for the JSONL backend: always (default) or none
+	syncPolicy, err := storage.ParseSyncPolicy(cfg.Storage.Fsync)
+	if err != nil {
+		log.Fatalf("Invalid storage.fsync: %v", err)
+	}
+	if jsonlStore, ok := store.(*storage.Storage); ok {
+		jsonlStore.SetSyncPolicy(syncPolicy)
+	}
+
+	// Report corruption left by an earlier crash; `sourdough fsck --repair` fixes it
+	if checker, ok := store.(storage.IntegrityChecker); ok {
+		if issues, err := checker.IntegrityIssues(); err == nil {
+			for _, issue := range issues {
+				log.Printf("Warning: data integrity: %s", issue)
+			}
+		}
+	}
+
+	// Initialize Ecobee client via Home Assistant (can be disabled)
+	ecobeeClient := ecobee.New(cfg.HomeAssistant.URL, cfg.HomeAssistant.Token, cfg.Sensors.Kitchen)
+	ecobeeClient.SetStaleAfter(time.Duration(cfg.HomeAssistant.StaleAfter))
 	if ecobeeClient.IsEnabled() {
-		log.Printf("Ecobee integration enabled via Home Assistant: %s", ecobeeEntity)
+		log.Printf("Ecobee integration enabled via Home Assistant: %s", cfg.Sensors.Kitchen)
 	} else {
-		log.Printf("Ecobee integration disabled (set HA_URL, HA_TOKEN, and ECOBEE_ENTITY to enable)")
+		log.Printf("Ecobee integration disabled (set home_assistant.url, home_assistant.token and sensors.kitchen to enable)")
 	}
 
 	// Create server
 	srv := server.New(store, ecobeeClient, port)
 
-	// Handle graceful shutdown
+	// How long after logging an event the one-tap undo still works
+	srv.SetUndoWindow(time.Duration(cfg.Server.UndoWindow))
+	if err := srv.LoadUndoJournal(dataDir); err != nil {
+		log.Fatalf("Failed to load undo journal: %v", err)
+	}
+
+	// How long shutdown waits for in-flight requests
+	srv.SetShutdownTimeout(time.Duration(cfg.Server.ShutdownTimeout))
+
+	// The fridge sensor is read instead of the kitchen during cold retard
+	fridge := ecobee.New(cfg.HomeAssistant.URL, cfg.HomeAssistant.Token, cfg.Sensors.Fridge)
+	fridge.SetStaleAfter(time.Duration(cfg.HomeAssistant.StaleAfter))
+	if fridge.IsEnabled() {
+		log.Printf("Fridge sensor enabled via Home Assistant: %s", cfg.Sensors.Fridge)
+	}
+	srv.SetFridgeSensor(fridge)
+
+	// Scheduled temperature readings, with a schedule per bake stage
+	autoLog := server.AutoLog{Schedule: cfg.AutoLog.Schedule()}
+	if !cfg.AutoLog.Enabled {
+		autoLog.Schedule = nil
+	}
+	srv.SetAutoLog(autoLog)
+
+	// Bake stage, folds and the next reminder as Home Assistant entities
+	srv.SetReminders(server.Reminders{
+		FoldInterval: time.Duration(cfg.Reminders.FoldInterval),
+		Folds:        cfg.Reminders.Folds,
+	})
+	if cfg.HomeAssistant.Publish {
+		log.Printf("Publishing bake state to Home Assistant at %s", cfg.HomeAssistant.URL)
+		srv.SetPublisher(homeassistant.New(cfg.HomeAssistant.URL, cfg.HomeAssistant.Token))
+	}
+
+	// Zigbee buttons and scales log over MQTT; events are published back
+	if cfg.MQTT.Broker != "" {
+		srv.SetMQTT(server.MQTTConfig{
+			Broker:   cfg.MQTT.Broker,
+			Prefix:   cfg.MQTT.TopicPrefix,
+			ClientID: cfg.MQTT.ClientID,
+			Username: cfg.MQTT.Username,
+			Password: cfg.MQTT.Password,
+		})
+	}
+
+	// Where qrgen writes the sheets served at /qrcodes.pdf
+	srv.SetQRDir(cfg.QR.OutputDir)
+
+	// Scheduled backups are enabled by setting a backup directory
+	var schedule *backup.Schedule
+	if cfg.Backup.Dir != "" {
+		schedule = &backup.Schedule{
+			Dir:      cfg.Backup.Dir,
+			Interval: time.Duration(cfg.Backup.Interval),
+			Keep:     cfg.Backup.Keep,
+			MaxAge:   time.Duration(cfg.Backup.MaxAge),
+		}
+	}
+	srv.ConfigureBackup(dataDir, schedule)
+
+	// Signed webhooks for bake changes, queued in the data directory
+	if len(cfg.Webhooks.URLs) > 0 {
+		hooks, err := webhook.New(store, dataDir, webhook.Config{
+			URLs:        cfg.Webhooks.URLs,
+			Secret:      cfg.Webhooks.Secret,
+			Types:       cfg.Webhooks.Events,
+			MaxAttempts: cfg.Webhooks.MaxAttempts,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize webhooks: %v", err)
+		}
+		log.Printf("Webhooks enabled: %s", strings.Join(cfg.Webhooks.URLs, ", "))
+		srv.SetWebhooks(hooks)
+	}
+
+	// Setting a household PIN turns on authentication
+	a, err := auth.New(dataDir, cfg.Auth.PIN)
+	if err != nil {
+		log.Fatalf("Failed to initialize auth: %v", err)
+	}
+	if a.Enabled() {
+		log.Printf("Authentication enabled (PIN login, API tokens and signed QR links)")
+	} else {
+		log.Printf("Authentication disabled (set auth.pin to enable)")
+	}
+	srv.EnableAuth(a)
+
+	// Let other sourdough servers sync with this one, only behind the PIN
+	if cfg.Sync.Enabled {
+		if !a.Enabled() {
+			log.Fatalf("sync.enabled needs auth.pin")
+		}
+		node, err := replica.New(store, dataDir)
+		if err != nil {
+			log.Fatalf("Failed to initialize sync: %v", err)
+		}
+		node.SetToken(cfg.Auth.SyncToken)
+		srv.EnableSync(node, cfg.Sync.Peers)
+		log.Printf("Sync enabled; peers: %s", strings.Join(cfg.Sync.Peers, ", "))
+	}
+
+	// Bakers in the household, each with their own starter and recipe
+	srv.SetProfiles(profiles.New(dataDir))
+
+	// What unsigned GETs to logging URLs do: log (open) or ask first (confirm)
+	linkMode, err := server.ParseLinkMode(cfg.Server.QRLinks)
+	if err != nil {
+		log.Fatalf("Invalid server.qr_links: %v", err)
+	}
+	srv.SetLinkMode(linkMode)
+
+	// HTTPS with a provided certificate, or one signed by a local CA (tls.mode = "auto")
+	if tlsConfig := configureTLS(cfg); tlsConfig != nil {
+		srv.EnableTLS(*tlsConfig)
+	}
+
+	// SIGINT or SIGTERM starts a graceful shutdown; a second one exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		<-sigChan
-		log.Println("Shutting down server...")
-		os.Exit(0)
+		<-ctx.Done()
+		stop()
 	}()
 
 	// Start server
 	log.Printf("Starting Sourdough Server on port %s, data directory: %s", port, dataDir)
-	if err := srv.Start(); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	runErr := srv.Run(ctx)
+
+	// Requests and workers have finished; flush storage before exiting
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Error: Failed to close storage: %v", err)
+		}
+	}
+	if runErr != nil {
+		log.Fatalf("Server failed: %v", runErr)
+	}
+	log.Println("Server stopped")
+}
+
+// configureTLS turns the TLS settings into a server config, generating the
+// local CA and server certificate in auto mode. It returns nil for plain HTTP.
+func configureTLS(cfg *config.Config) *server.TLSConfig {
+	if !cfg.TLSEnabled() {
+		return nil
+	}
+	tlsConfig := &server.TLSConfig{
+		CertFile:     cfg.TLS.Cert,
+		KeyFile:      cfg.TLS.Key,
+		RedirectPort: cfg.TLS.RedirectPort,
+	}
+
+	if cfg.TLS.Cert != "" {
+		for _, path := range []string{cfg.TLS.Cert, cfg.TLS.Key} {
+			if _, err := os.Stat(path); err != nil {
+				log.Fatalf("Failed to read TLS certificate: %v", err)
+			}
+		}
+		log.Printf("HTTPS enabled with certificate %s", cfg.TLS.Cert)
+		return tlsConfig
+	}
+
+	hosts := append(certs.LocalHosts(), cfg.TLS.Hosts...)
+	local, err := certs.EnsureLocal(cfg.Server.DataDir, hosts)
+	if err != nil {
+		log.Fatalf("Failed to set up local CA: %v", err)
+	}
+	tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.CAFile = local.CertFile, local.KeyFile, local.CAFile
+	log.Printf("HTTPS enabled with local CA certificate for %s", strings.Join(hosts, ", "))
+	if local.NewCA {
+		log.Printf("Created a new local CA; phones that trusted an older one must install it again from /ca")
+	} else {
+		log.Printf("Install the CA on phones from /ca")
 	}
+	return tlsConfig
 }
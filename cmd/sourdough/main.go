@@ -3,31 +3,57 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/backup"
+	"github.com/mdeckert/sourdough/internal/certs"
+	"github.com/mdeckert/sourdough/internal/config"
+	"github.com/mdeckert/sourdough/internal/export"
+	"github.com/mdeckert/sourdough/internal/importer"
 	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/profiles"
+	"github.com/mdeckert/sourdough/internal/replica"
+	"github.com/mdeckert/sourdough/internal/search"
 	"github.com/mdeckert/sourdough/internal/storage"
 )
 
+// Settings from sourdough.toml and the environment, set by loadConfig
 var (
-	serverURL = getEnv("SOURDOUGH_SERVER_URL", "http://localhost:8080")
-	dataDir   = getEnv("SOURDOUGH_DATA_DIR", "./data")
+	cfg       *config.Config
+	serverURL string
+	dataDir   string
+	backend   string
+	apiToken  string
 )
 
 func main() {
+	// A config file can be named before the command: sourdough --config file <command>
+	configPath := ""
+	if len(os.Args) > 2 && os.Args[1] == "--config" {
+		configPath = os.Args[2]
+		os.Args = append(os.Args[:1], os.Args[3:]...)
+	}
+
 	if len(os.Args) < 2 {
 		printUsage()
 		os.Exit(1)
 	}
 
 	command := os.Args[1]
+	loadConfig(configPath, command != "config")
 
 	switch command {
 	case "start":
@@ -44,6 +70,30 @@ func main() {
 		handleHistory()
 	case "review":
 		handleReview()
+	case "search":
+		handleSearch()
+	case "export":
+		handleExport()
+	case "import":
+		handleImport()
+	case "migrate":
+		handleMigrate()
+	case "fsck":
+		handleFsck()
+	case "backup":
+		handleBackup()
+	case "restore":
+		handleRestore()
+	case "sync":
+		handleSync()
+	case "token":
+		handleToken()
+	case "profile":
+		handleProfile()
+	case "trash":
+		handleTrash()
+	case "config":
+		handleConfig()
 	case "help", "--help", "-h":
 		printUsage()
 	default:
@@ -61,8 +111,23 @@ func printUsage() {
 	fmt.Println("  sourdough temp <value>             Log temperature")
 	fmt.Println("  sourdough status                   Show current bake status")
 	fmt.Println("  sourdough complete                 Complete bake with assessment")
-	fmt.Println("  sourdough history [n]              Show recent bakes (default: 10)")
+	fmt.Println("  sourdough history [n] [--user name]  Show recent bakes, optionally by one baker (default: 10)")
 	fmt.Println("  sourdough review <date>            Review a specific bake")
+	fmt.Println("  sourdough search <terms> [filters] Search notes, events and assessments")
+	fmt.Println("  sourdough export <date|all> [format] [file]  Export as csv, json or pdf")
+	fmt.Println("  sourdough import [--format csv|jsonl] [--dry-run] <file>...  Import past bakes")
+	fmt.Println("  sourdough migrate <from> <to>      Copy all bakes between storage backends (jsonl, sqlite)")
+	fmt.Println("  sourdough fsck [--repair]          Check data files; --repair quarantines corrupt lines")
+	fmt.Println("  sourdough trash [list|restore <id>|purge [--older-than 30d]]  Manage deleted bakes")
+	fmt.Println("  sourdough sync <peer-url>          Exchange bakes and photos with another sourdough server")
+	fmt.Println("  sourdough token [create <user>|list|revoke <user>]  Manage API tokens for servers with a PIN")
+	fmt.Println("  sourdough profile [list|add <name> [--starter s] [--recipe r]|remove <name>]  Manage bakers")
+	fmt.Println("  sourdough backup [file|dir]        Write a verified tar.gz of the data directory")
+	fmt.Println("  sourdough backup verify <file>     Check a backup against its manifest")
+	fmt.Println("  sourdough restore [--force] <file> Replace the data directory from a backup (stop the server first)")
+	fmt.Println("  sourdough config show              Print the effective settings and where each came from")
+	fmt.Println("\nGlobal options:")
+	fmt.Println("  --config <file>                    Read settings from file (default: $SOURDOUGH_CONFIG or ./sourdough.toml)")
 	fmt.Println("\nEvents:")
 	fmt.Println("  starter-out, fed, levain-ready, mixed, fold, shaped,")
 	fmt.Println("  fridge-in, fridge-out, oven-in, oven-out, loaf-complete")
@@ -74,11 +139,27 @@ func printUsage() {
 	fmt.Println("  sourdough status")
 	fmt.Println("  sourdough complete")
 	fmt.Println("  sourdough history 5")
+	fmt.Println("  sourdough history --user alice")
 	fmt.Println("  sourdough review 2025-10-07")
+	fmt.Println("  sourdough search hydration score>=8 after=2025-01-01")
+	fmt.Println("  sourdough export 2025-10-07 pdf")
+	fmt.Println("  sourdough export all csv history.csv")
+	fmt.Println("  sourdough import --dry-run spreadsheet.csv")
+	fmt.Println("  sourdough migrate jsonl sqlite")
+	fmt.Println("  sourdough fsck --repair")
+	fmt.Println("  sourdough trash restore 2025-10-07_19-13-49@20251018-101500.123456789")
+	fmt.Println("  sourdough sync http://kitchen.local:8080")
+	fmt.Println("  sourdough token create alice")
+	fmt.Println("  sourdough profile add alice --starter Clint --recipe \"75% country loaf\"")
+	fmt.Println("  sourdough backup /mnt/nas/sourdough/")
+	fmt.Println("  sourdough restore --force sourdough-backup-20251018-101500.tar.gz")
+	fmt.Println("  sourdough --config /etc/sourdough.toml config show")
+	fmt.Println("\nSearch filters:")
+	fmt.Println("  score>=N, score<=N, score=N, after=DATE, before=DATE, event=TYPE, proof=LEVEL, limit=N")
 }
 
 func handleStart() {
-	resp, err := http.Post(serverURL+"/loaf/start", "application/json", nil)
+	resp, err := callAPI(http.MethodPost, "/loaf/start", nil)
 	if err != nil {
 		fmt.Printf("Error: Failed to connect to server: %v\n", err)
 		fmt.Printf("Make sure the server is running on %s\n", serverURL)
@@ -105,10 +186,7 @@ func handleLog() {
 
 	event := os.Args[2]
 
-	// Build URL
-	url := fmt.Sprintf("%s/log/%s", serverURL, event)
-
-	resp, err := http.Post(url, "application/json", nil)
+	resp, err := callAPI(http.MethodPost, "/log/"+event, nil)
 	if err != nil {
 		fmt.Printf("Error: Failed to connect to server: %v\n", err)
 		os.Exit(1)
@@ -143,9 +221,7 @@ func handleTemp() {
 		os.Exit(1)
 	}
 
-	url := fmt.Sprintf("%s/log/temp/%s", serverURL, temp)
-
-	resp, err := http.Post(url, "application/json", nil)
+	resp, err := callAPI(http.MethodPost, "/log/temp/"+temp, nil)
 	if err != nil {
 		fmt.Printf("Error: Failed to connect to server: %v\n", err)
 		os.Exit(1)
@@ -163,13 +239,19 @@ func handleTemp() {
 }
 
 func handleStatus() {
-	resp, err := http.Get(serverURL + "/status")
+	resp, err := callAPI(http.MethodGet, "/status", nil)
 	if err != nil {
 		fmt.Printf("Error: Failed to connect to server: %v\n", err)
 		os.Exit(1)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Error: %s\n", strings.TrimSpace(string(body)))
+		os.Exit(1)
+	}
+
 	var bake models.Bake
 	if err := json.NewDecoder(resp.Body).Decode(&bake); err != nil {
 		fmt.Printf("Error: Failed to decode response: %v\n", err)
@@ -203,6 +285,9 @@ func handleStatus() {
 		if event.DoughTempF != nil {
 			info += fmt.Sprintf(" [dough: %.1f°F]", *event.DoughTempF)
 		}
+		if event.FridgeTempF != nil {
+			info += fmt.Sprintf(" [fridge: %.1f°F]", *event.FridgeTempF)
+		}
 		if event.FoldCount != nil {
 			info += fmt.Sprintf(" #%d", *event.FoldCount)
 		}
@@ -223,7 +308,7 @@ func handleStatus() {
 
 func handleComplete() {
 	// First, get current bake to ensure there is one
-	store, err := storage.New(dataDir)
+	store, err := storage.Open(backend, dataDir)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
@@ -337,13 +422,18 @@ func handleComplete() {
 
 func handleHistory() {
 	limit := 10
-	if len(os.Args) >= 3 {
-		if n, err := strconv.Atoi(os.Args[2]); err == nil {
+	user := ""
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--user" && i+1 < len(args) {
+			user = args[i+1]
+			i++
+		} else if n, err := strconv.Atoi(args[i]); err == nil {
 			limit = n
 		}
 	}
 
-	store, err := storage.New(dataDir)
+	store, err := storage.Open(backend, dataDir)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
@@ -355,24 +445,38 @@ func handleHistory() {
 		os.Exit(1)
 	}
 
-	if len(dates) == 0 {
+	// Keep only the baker's bakes when filtering by user
+	var ids []string
+	var bakes []*models.Bake
+	for _, date := range dates {
+		bake, err := store.ReadBake(date)
+		if err != nil {
+			continue
+		}
+		if user != "" && bake.Baker() != user {
+			continue
+		}
+		ids = append(ids, date)
+		bakes = append(bakes, bake)
+	}
+
+	if len(bakes) == 0 {
 		fmt.Println("No bakes found.")
 		return
 	}
 
-	fmt.Println("Recent Bakes")
+	if user != "" {
+		fmt.Printf("Recent Bakes by %s\n", user)
+	} else {
+		fmt.Println("Recent Bakes")
+	}
 	fmt.Println(strings.Repeat("=", 70))
 
-	for i, date := range dates {
+	for i, bake := range bakes {
 		if i >= limit {
 			break
 		}
 
-		bake, err := store.ReadBake(date)
-		if err != nil {
-			continue
-		}
-
 		// Format output
 		status := "In progress"
 		if bake.Assessment != nil {
@@ -382,12 +486,17 @@ func handleHistory() {
 				bake.Assessment.CrumbQuality)
 		}
 
+		baker := ""
+		if user == "" && bake.Baker() != "" {
+			baker = "  (" + bake.Baker() + ")"
+		}
+
 		eventCount := len(bake.Events)
-		fmt.Printf("%s  %d events  %s\n", date, eventCount, status)
+		fmt.Printf("%s  %d events  %s%s\n", ids[i], eventCount, status, baker)
 	}
 
 	fmt.Println(strings.Repeat("-", 70))
-	fmt.Printf("Showing %d of %d bakes\n", min(limit, len(dates)), len(dates))
+	fmt.Printf("Showing %d of %d bakes\n", min(limit, len(bakes)), len(bakes))
 }
 
 func handleReview() {
@@ -400,7 +509,7 @@ func handleReview() {
 
 	date := os.Args[2]
 
-	store, err := storage.New(dataDir)
+	store, err := storage.Open(backend, dataDir)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
@@ -436,6 +545,9 @@ func handleReview() {
 		if event.DoughTempF != nil {
 			info += fmt.Sprintf(" [dough: %.1f°F]", *event.DoughTempF)
 		}
+		if event.FridgeTempF != nil {
+			info += fmt.Sprintf(" [fridge: %.1f°F]", *event.FridgeTempF)
+		}
 		if event.FoldCount != nil {
 			info += fmt.Sprintf(" #%d", *event.FoldCount)
 		}
@@ -465,13 +577,728 @@ func handleReview() {
 	}
 }
 
+func handleSearch() {
+	if len(os.Args) < 3 {
+		fmt.Println("Error: Search terms or filters required")
+		fmt.Println("Usage: sourdough search <terms> [filters]")
+		fmt.Println("Example: sourdough search hydration score>=8")
+		os.Exit(1)
+	}
+
+	// Arguments containing "=" are filters (same syntax as /api/search), the rest is search text
+	values := url.Values{}
+	var terms []string
+	for _, arg := range os.Args[2:] {
+		if strings.Contains(arg, "=") {
+			filter, err := url.ParseQuery(arg)
+			if err != nil {
+				fmt.Printf("Error: Invalid filter: %s\n", arg)
+				os.Exit(1)
+			}
+			for key, vals := range filter {
+				values[key] = vals
+			}
+			continue
+		}
+		terms = append(terms, arg)
+	}
+	values.Set("q", strings.Join(terms, " "))
+
+	query, err := search.ParseQuery(values)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store, err := storage.Open(backend, dataDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	index, err := search.Build(store)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	results := index.Search(query)
+	if results.Total == 0 {
+		fmt.Println("No matching bakes found.")
+		return
+	}
+
+	fmt.Printf("Search Results - %q\n", query.Text)
+	fmt.Println(strings.Repeat("=", 70))
+
+	for _, result := range results.Results {
+		status := "In progress"
+		if result.Assessment != nil {
+			status = fmt.Sprintf("Score: %d/10 | Proof: %s", result.Assessment.Score, result.Assessment.ProofLevel)
+		} else if result.Completed {
+			status = "Completed"
+		}
+
+		fmt.Printf("%s  %d events  %s\n", result.Date, result.EventCount, status)
+		for _, snippet := range result.Snippets {
+			fmt.Printf("    %s\n", snippet)
+		}
+	}
+
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("Showing %d of %d matching bakes\n", len(results.Results), results.Total)
+}
+
+func handleExport() {
+	if len(os.Args) < 3 {
+		fmt.Println("Error: Date required")
+		fmt.Println("Usage: sourdough export <date|all> [csv|json|pdf] [file]")
+		fmt.Println("Example: sourdough export 2025-10-07 pdf")
+		os.Exit(1)
+	}
+
+	target := os.Args[2]
+
+	formatName := ""
+	if len(os.Args) >= 4 {
+		formatName = os.Args[3]
+	}
+	format, err := export.ParseFormat(formatName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store, err := storage.Open(backend, dataDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Default to stdout for text formats, and a file named after the bake for PDFs
+	outputPath := ""
+	if len(os.Args) >= 5 {
+		outputPath = os.Args[4]
+	} else if format == export.FormatPDF {
+		outputPath = fmt.Sprintf("bake_%s.pdf", target)
+	}
+
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if target == "all" {
+		if format == export.FormatPDF {
+			fmt.Println("Error: History export supports csv or json")
+			os.Exit(1)
+		}
+
+		dates, err := store.ListBakes()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var bakes []*models.Bake
+		for _, date := range dates {
+			bake, err := store.ReadBake(date)
+			if err != nil || len(bake.Events) == 0 {
+				continue
+			}
+			bakes = append(bakes, bake)
+		}
+
+		if format == export.FormatCSV {
+			err = export.WriteHistoryCSV(out, bakes)
+		} else {
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(bakes)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		bake, err := store.ReadBake(target)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(bake.Events) == 0 {
+			fmt.Printf("No bake found for %s\n", target)
+			os.Exit(1)
+		}
+
+		switch format {
+		case export.FormatCSV:
+			err = export.WriteBakeCSV(out, bake)
+		case export.FormatPDF:
+			err = export.WriteBakePDF(out, bake, func(filename string) string {
+				return store.GetImagePath(target, filename)
+			})
+		default:
+			err = export.WriteBakeJSON(out, bake)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if outputPath != "" {
+		fmt.Printf("✓ Exported to %s\n", outputPath)
+	}
+}
+
+func handleImport() {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	formatName := flags.String("format", "", "input format: csv or jsonl (default: from file extension)")
+	dryRun := flags.Bool("dry-run", false, "validate and report without writing bakes")
+	flags.Parse(os.Args[2:])
+
+	if flags.NArg() == 0 {
+		fmt.Println("Error: File required")
+		fmt.Println("Usage: sourdough import [--format csv|jsonl] [--dry-run] <file>...")
+		os.Exit(1)
+	}
+
+	parsed := &importer.Parsed{}
+	for _, path := range flags.Args() {
+		format := importer.Format(*formatName)
+		if format == "" {
+			format = importer.Format(strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."))
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var fileParsed *importer.Parsed
+		switch format {
+		case importer.FormatCSV:
+			fileParsed = importer.ParseCSV(f, filepath.Base(path))
+		case importer.FormatJSONL:
+			fileParsed = importer.ParseJSONL(f, filepath.Base(path))
+		default:
+			f.Close()
+			fmt.Printf("Error: Unknown format for %s (use --format csv or --format jsonl)\n", path)
+			os.Exit(1)
+		}
+		f.Close()
+
+		parsed.Candidates = append(parsed.Candidates, fileParsed.Candidates...)
+		parsed.Errors = append(parsed.Errors, fileParsed.Errors...)
+	}
+
+	store, err := storage.Open(backend, dataDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	report, err := importer.Import(store, parsed, *dryRun)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if report.DryRun {
+		fmt.Println("Import Dry Run (nothing written)")
+	} else {
+		fmt.Println("Import Results")
+	}
+	fmt.Println(strings.Repeat("=", 70))
+
+	for _, id := range report.Imported {
+		fmt.Printf("✓ %s\n", id)
+	}
+	for _, duplicate := range report.Duplicates {
+		fmt.Printf("= Skipped duplicate: %s\n", duplicate)
+	}
+	for _, rowErr := range report.Errors {
+		fmt.Printf("✗ %s\n", rowErr.Error())
+	}
+
+	fmt.Println(strings.Repeat("-", 70))
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d bakes, %d duplicates, %d errors\n", verb, len(report.Imported), len(report.Duplicates), len(report.Errors))
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+func handleMigrate() {
+	if len(os.Args) < 4 {
+		fmt.Println("Usage: sourdough migrate <from> <to>")
+		fmt.Println("Backends: jsonl, sqlite")
+		fmt.Println("Then set SOURDOUGH_STORAGE=<to> for the server and CLI")
+		os.Exit(1)
+	}
+
+	from, to := os.Args[2], os.Args[3]
+	if from == to {
+		fmt.Println("Error: Source and destination backends must differ")
+		os.Exit(1)
+	}
+
+	src, err := storage.Open(from, dataDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	dst, err := storage.Open(to, dataDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	report, err := storage.Migrate(src, dst)
+	if report != nil {
+		fmt.Printf("Copied %d bakes from %s to %s, skipped %d already present\n",
+			len(report.Copied), from, to, len(report.Skipped))
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Set SOURDOUGH_STORAGE=%s to use the new backend\n", to)
+}
+
+func handleFsck() {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "Move corrupt lines to the quarantine directory and rewrite affected files")
+	fs.Parse(os.Args[2:])
+
+	if backend == storage.BackendSQLite {
+		store, err := storage.Open(backend, dataDir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		issues, err := store.(storage.IntegrityChecker).IntegrityIssues()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, issue := range issues {
+			fmt.Printf("✗ %s\n", issue)
+		}
+		if len(issues) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("✓ Database OK")
+		return
+	}
+
+	policy, err := storage.ParseSyncPolicy(cfg.Storage.Fsync)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	report, err := storage.Fsck(dataDir, policy, *repair)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, issue := range report.Issues {
+		fmt.Printf("✗ %s\n", issue)
+	}
+	for _, name := range report.Repaired {
+		fmt.Printf("✓ Repaired %s\n", name)
+	}
+	for _, path := range report.Quarantined {
+		fmt.Printf("  Corrupt lines saved to %s\n", path)
+	}
+
+	fmt.Printf("Checked %d files, %d events, %d issues\n", report.Files, report.Events, len(report.Issues))
+	if len(report.Issues) > 0 && !*repair {
+		fmt.Println("Stop the server and run 'sourdough fsck --repair' to fix")
+		os.Exit(1)
+	}
+}
+
+func handleTrash() {
+	subcommand := "list"
+	if len(os.Args) > 2 {
+		subcommand = os.Args[2]
+	}
+
+	store, err := storage.Open(backend, dataDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch subcommand {
+	case "list":
+		entries, err := store.ListTrash()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Trash is empty")
+			return
+		}
+
+		fmt.Println("Trash")
+		fmt.Println(strings.Repeat("=", 70))
+		for _, entry := range entries {
+			photos := ""
+			if entry.Images > 0 {
+				photos = fmt.Sprintf(", %d photos", entry.Images)
+			}
+			fmt.Printf("%s\n  deleted %s, %d events%s\n",
+				entry.ID, entry.DeletedAt.Local().Format("2006-01-02 15:04"), entry.Events, photos)
+		}
+		fmt.Println(strings.Repeat("-", 70))
+		fmt.Println("Restore with: sourdough trash restore <id>")
+
+	case "restore":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: sourdough trash restore <id>")
+			os.Exit(1)
+		}
+		date, err := store.RestoreBake(os.Args[3])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Restored bake %s\n", date)
+
+	case "purge":
+		fs := flag.NewFlagSet("trash purge", flag.ExitOnError)
+		olderThan := fs.String("older-than", "30d", "Only purge entries deleted longer ago than this (e.g. 30d, 12h, 0 for all)")
+		fs.Parse(os.Args[3:])
+
+		age, err := storage.ParseAge(*olderThan)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		purged, err := store.PurgeTrash(age)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, id := range purged {
+			fmt.Printf("✗ Permanently deleted %s\n", id)
+		}
+		fmt.Printf("Purged %d bakes\n", len(purged))
+
+	default:
+		fmt.Printf("Unknown trash command: %s\n", subcommand)
+		fmt.Println("Usage: sourdough trash [list|restore <id>|purge [--older-than 30d]]")
+		os.Exit(1)
+	}
+}
+
+func handleSync() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: sourdough sync <peer-url>")
+		fmt.Println("Example: sourdough sync http://kitchen.local:8080")
+		os.Exit(1)
+	}
+
+	resp, err := callAPI("POST", "/api/sync", map[string]string{"peer": os.Args[2]})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Error: %s\n", strings.TrimSpace(string(body)))
+		os.Exit(1)
+	}
+
+	var report replica.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Synced with %s\n", report.Peer)
+	fmt.Printf("  Bakes: %d updated here, %d sent\n", report.Pulled, report.Pushed)
+	fmt.Printf("  Photos: %d received, %d sent\n", report.ImagesPulled, report.ImagesPushed)
+}
+
+func handleToken() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: sourdough token [create <user>|list|revoke <user>]")
+		os.Exit(1)
+	}
+
+	a, err := auth.New(dataDir, "")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "create":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: sourdough token create <user>")
+			os.Exit(1)
+		}
+		token, err := a.CreateToken(os.Args[3])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Created API token for %s (it is not shown again):\n\n  %s\n\n", os.Args[3], token)
+		fmt.Println("Use it with: export SOURDOUGH_API_TOKEN=<token>")
+
+	case "list":
+		tokens, err := a.Tokens()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No API tokens")
+			return
+		}
+		for _, t := range tokens {
+			fmt.Printf("%-20s created %s\n", t.User, t.Created.Local().Format("2006-01-02 15:04"))
+		}
+
+	case "revoke":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: sourdough token revoke <user>")
+			os.Exit(1)
+		}
+		n, err := a.RevokeTokens(os.Args[3])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Revoked %d token(s) for %s\n", n, os.Args[3])
+
+	default:
+		fmt.Printf("Unknown token command: %s\n", os.Args[2])
+		os.Exit(1)
+	}
+}
+
+func handleProfile() {
+	subcommand := "list"
+	if len(os.Args) > 2 {
+		subcommand = os.Args[2]
+	}
+
+	registry := profiles.New(dataDir)
+
+	switch subcommand {
+	case "list":
+		list, err := registry.List()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(list) == 0 {
+			fmt.Println("No profiles. Add one with: sourdough profile add <name>")
+			return
+		}
+		for _, p := range list {
+			fmt.Printf("%-20s starter: %-15s recipe: %s\n", p.Name, orDash(p.Starter), orDash(p.Recipe))
+		}
+
+	case "add":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: sourdough profile add <name> [--starter s] [--recipe r]")
+			os.Exit(1)
+		}
+		fs := flag.NewFlagSet("profile add", flag.ExitOnError)
+		starter := fs.String("starter", "", "Name of the baker's starter")
+		recipe := fs.String("recipe", "", "The baker's usual recipe")
+		fs.Parse(os.Args[4:])
+
+		p, err := registry.Save(profiles.Profile{Name: os.Args[3], Starter: *starter, Recipe: *recipe})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Saved profile %s\n", p.Name)
+		fmt.Printf("  Print their QR codes with: qrgen --user %s <server-url>\n", p.Name)
+
+	case "remove":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: sourdough profile remove <name>")
+			os.Exit(1)
+		}
+		if err := registry.Remove(os.Args[3]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Removed profile %s (their bakes are kept)\n", os.Args[3])
+
+	default:
+		fmt.Printf("Unknown profile command: %s\n", subcommand)
+		os.Exit(1)
+	}
+}
+
+// orDash shows "-" for empty values in tables
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func handleBackup() {
+	if len(os.Args) >= 3 && os.Args[2] == "verify" {
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: sourdough backup verify <file>")
+			os.Exit(1)
+		}
+		f, err := os.Open(os.Args[3])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		manifest, err := backup.Verify(f)
+		if err != nil {
+			fmt.Printf("✗ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ %d files OK (format version %d, created %s)\n",
+			len(manifest.Files), manifest.Version, manifest.CreatedAt.Local().Format("2006-01-02 15:04"))
+		return
+	}
+
+	// Default to a timestamped file in the current directory, or in the given directory
+	outputPath := backup.FileName(time.Now())
+	if len(os.Args) >= 3 {
+		outputPath = os.Args[2]
+		if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
+			outputPath = filepath.Join(outputPath, backup.FileName(time.Now()))
+		}
+	}
+
+	var opts backup.Options
+	if backend == storage.BackendSQLite {
+		store, err := storage.NewSQLite(dataDir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer store.Close()
+		opts.Snapshot = store
+	}
+	// Don't archive the backup into itself when writing inside the data directory
+	opts.Exclude = []string{outputPath, filepath.Dir(outputPath), filepath.Join(dataDir, replica.Dir, replica.NodeIDFile)}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	manifest, err := backup.Create(f, dataDir, opts)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = backup.VerifyFile(outputPath)
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Backed up %d files (%d KB) to %s\n", len(manifest.Files), manifest.TotalSize()/1024, outputPath)
+}
+
+func handleRestore() {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := fs.Bool("force", false, "Replace a non-empty data directory (the current data is kept alongside)")
+	fs.Parse(os.Args[2:])
+
+	if fs.NArg() < 1 {
+		fmt.Println("Usage: sourdough restore [--force] <file>")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	result, err := backup.Restore(f, dataDir, *force)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Restored %d files from backup taken %s\n",
+		len(result.Manifest.Files), result.Manifest.CreatedAt.Local().Format("2006-01-02 15:04"))
+	if result.PreviousDir != "" {
+		fmt.Printf("  Previous data kept in %s\n", result.PreviousDir)
+	}
+}
+
 // Helper functions
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// loadConfig reads the settings, exiting on errors unless only reporting them
+func loadConfig(path string, strict bool) {
+	var err error
+	cfg, err = config.Load(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if strict {
+		if err := cfg.Validate(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fmt.Println("Run `sourdough config show` to see the effective settings")
+			os.Exit(1)
+		}
+	}
+
+	serverURL = cfg.CLI.ServerURL
+	dataDir = cfg.Server.DataDir
+	backend = cfg.Storage.Backend
+	apiToken = cfg.CLI.APIToken
+}
+
+// handleConfig prints the effective settings and checks them
+func handleConfig() {
+	if len(os.Args) < 3 || os.Args[2] != "show" {
+		fmt.Println("Usage: sourdough config show")
+		os.Exit(1)
+	}
+
+	cfg.Show(os.Stdout)
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("\n%v\n", err)
+		os.Exit(1)
 	}
-	return defaultValue
 }
 
 func formatDuration(d time.Duration) string {
@@ -512,6 +1339,25 @@ func callAPI(method, path string, body interface{}) (*http.Response, error) {
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	// Servers with a PIN set need an API token (see `sourdough token create`)
+	if apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+apiToken)
+	}
 
-	return http.DefaultClient.Do(req)
+	return apiClient().Do(req)
+}
+
+// apiClient trusts the server's local CA from the data directory, if there is
+// one, besides the system roots
+func apiClient() *http.Client {
+	caPEM, err := os.ReadFile(filepath.Join(dataDir, certs.Dir, certs.CAFile))
+	if err != nil {
+		return http.DefaultClient
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	roots.AppendCertsFromPEM(caPEM)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
 }
@@ -0,0 +1,462 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dir holds the signing secret and API tokens, relative to the data directory
+const Dir = "auth"
+
+const (
+	secretFile = "secret"
+	tokensFile = "tokens.json"
+)
+
+// SessionCookie is the browser session cookie set after logging in with the PIN
+const SessionCookie = "sourdough_session"
+
+// SessionLifetime is how long a PIN login lasts
+const SessionLifetime = 90 * 24 * time.Hour
+
+// LogSessionCookie is set when a signed QR link is opened, so the page it
+// opens can submit its form. It only lets the browser log events, not use
+// the rest of the server.
+const LogSessionCookie = "sourdough_log_session"
+
+// LinkSessionLifetime is how long opening a signed QR link lets the browser log events
+const LinkSessionLifetime = time.Hour
+
+// SignatureParam is the query parameter carrying a link signature
+const SignatureParam = "sig"
+
+// UserParam is the optional query parameter naming who a signed link belongs to
+const UserParam = "u"
+
+// ExpiresParam is the optional query parameter with a signed link's expiry (Unix seconds)
+const ExpiresParam = "exp"
+
+// Link errors returned by CheckLink
+var (
+	ErrUnsigned     = errors.New("link is not signed")
+	ErrBadSignature = errors.New("link signature is not valid (the QR key may have been rotated)")
+	ErrLinkExpired  = errors.New("link has expired")
+)
+
+// validUser limits user names to something safe to show and store
+var validUser = regexp.MustCompile(`^[A-Za-z0-9 _.-]{1,32}$`)
+
+// ValidUser checks a user name
+func ValidUser(user string) error {
+	if !validUser.MatchString(user) {
+		return fmt.Errorf("invalid user name %q (use up to 32 letters, digits, spaces, dots, dashes or underscores)", user)
+	}
+	return nil
+}
+
+// Token is a stored API token; only its hash is kept
+type Token struct {
+	User    string    `json:"user"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// Auth checks the household PIN, sessions, API tokens and signed links
+type Auth struct {
+	pin string
+	dir string
+
+	keyMu     sync.Mutex
+	secret    []byte
+	secretMod time.Time // Modification time of the secret file when last read
+
+	mu         sync.Mutex
+	tokens     []Token
+	tokensMod  time.Time // Modification time of the tokens file when last read
+	tokensSize int64     // Size of the tokens file when last read
+}
+
+// New loads the signing secret for dataDir, creating it on first use.
+// Authentication is only enforced when pin is set.
+func New(dataDir, pin string) (*Auth, error) {
+	dir := filepath.Join(dataDir, Dir)
+	if _, err := os.Stat(filepath.Join(dir, secretFile)); os.IsNotExist(err) {
+		if err := writeSecret(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	a := &Auth{pin: pin, dir: dir}
+	if err := a.loadSecret(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// RotateSecret replaces the signing secret for dataDir. Every signed link and
+// browser session made with the old secret stops working; API tokens are kept.
+func RotateSecret(dataDir string) error {
+	return writeSecret(filepath.Join(dataDir, Dir))
+}
+
+// writeSecret atomically writes a new random signing secret
+func writeSecret(dir string) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate secret: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create auth directory: %w", err)
+	}
+
+	path := filepath.Join(dir, secretFile)
+	if err := os.WriteFile(path+".tmp", []byte(hex.EncodeToString(secret)+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	return nil
+}
+
+// loadSecret reads the signing secret if the file changed since it was last
+// read, so a rotation by another process takes effect without a restart.
+// The caller holds a.keyMu, or has the only reference to a.
+func (a *Auth) loadSecret() error {
+	path := filepath.Join(a.dir, secretFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read secret: %w", err)
+	}
+	if a.secret != nil && info.ModTime().Equal(a.secretMod) {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read secret: %w", err)
+	}
+	secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(secret) < 16 {
+		return fmt.Errorf("invalid secret in %s", path)
+	}
+	a.secret, a.secretMod = secret, info.ModTime()
+	return nil
+}
+
+// Enabled reports whether requests must be authenticated
+func (a *Auth) Enabled() bool {
+	return a.pin != ""
+}
+
+// CheckPIN compares a PIN in constant time
+func (a *Auth) CheckPIN(pin string) bool {
+	return a.pin != "" && subtle.ConstantTimeCompare([]byte(pin), []byte(a.pin)) == 1
+}
+
+// mac signs a message with the secret
+func (a *Auth) mac(parts ...string) []byte {
+	a.keyMu.Lock()
+	// Keep using the last good secret if the file can't be read
+	a.loadSecret()
+	secret := a.secret
+	a.keyMu.Unlock()
+
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(strings.Join(parts, "|")))
+	return h.Sum(nil)
+}
+
+// NewSession returns a signed session cookie value for user
+func (a *Auth) NewSession(user string, lifetime time.Duration) string {
+	return a.newSession("session", user, lifetime)
+}
+
+// NewLogSession returns a signed log-only session cookie value for user
+func (a *Auth) NewLogSession(user string, lifetime time.Duration) string {
+	return a.newSession("log-session", user, lifetime)
+}
+
+// newSession signs a session of a kind, so one kind can't pass for another
+func (a *Auth) newSession(kind, user string, lifetime time.Duration) string {
+	exp := strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10)
+	name := base64.RawURLEncoding.EncodeToString([]byte(user))
+	sig := base64.RawURLEncoding.EncodeToString(a.mac(kind, user, exp))
+	return name + "." + exp + "." + sig
+}
+
+// SessionUser returns the user of a valid, unexpired session cookie value
+func (a *Auth) SessionUser(value string) (string, bool) {
+	return a.sessionUser("session", value)
+}
+
+// LogSessionUser returns the user of a valid, unexpired log-only session cookie value
+func (a *Auth) LogSessionUser(value string) (string, bool) {
+	return a.sessionUser("log-session", value)
+}
+
+// sessionUser checks a session of a kind
+func (a *Auth) sessionUser(kind, value string) (string, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	name, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, a.mac(kind, string(name), parts[1])) {
+		return "", false
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", false
+	}
+	return string(name), true
+}
+
+// SignPath returns path with a signature added to its query, along with the
+// user and expiry when set. A zero expires makes a link that never expires.
+func (a *Auth) SignPath(path, user string, expires time.Time) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	q := u.Query()
+	q.Del(SignatureParam)
+	if user != "" {
+		q.Set(UserParam, user)
+	}
+	if !expires.IsZero() {
+		q.Set(ExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	}
+	q.Set(SignatureParam, a.linkSignature(u.Path, q))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// linkSignature signs a path and its query, minus the signature itself
+func (a *Auth) linkSignature(path string, q url.Values) string {
+	signed := url.Values{}
+	for k, v := range q {
+		if k != SignatureParam {
+			signed[k] = v
+		}
+	}
+	// 16 bytes keep QR codes small and are plenty for an HMAC
+	return base64.RawURLEncoding.EncodeToString(a.mac("link", path, signed.Encode())[:16])
+}
+
+// CheckLink checks a link's signature and expiry and returns the user it names, if any
+func (a *Auth) CheckLink(u *url.URL) (string, error) {
+	q := u.Query()
+	sig := q.Get(SignatureParam)
+	if sig == "" {
+		return "", ErrUnsigned
+	}
+	if subtle.ConstantTimeCompare([]byte(sig), []byte(a.linkSignature(u.Path, q))) != 1 {
+		return "", ErrBadSignature
+	}
+	if exp := q.Get(ExpiresParam); exp != "" {
+		unix, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil || time.Now().Unix() > unix {
+			return "", ErrLinkExpired
+		}
+	}
+	return q.Get(UserParam), nil
+}
+
+// VerifyLink reports whether a link is validly signed and unexpired, and returns the user it names
+func (a *Auth) VerifyLink(u *url.URL) (string, bool) {
+	user, err := a.CheckLink(u)
+	return user, err == nil
+}
+
+// Method is how a request was authenticated
+type Method string
+
+const (
+	MethodNone       Method = ""
+	MethodSession    Method = "session"
+	MethodToken      Method = "token"
+	MethodLink       Method = "link"
+	MethodLogSession Method = "log-session" // Only good for logging events
+)
+
+// Authenticate identifies the user of a request by API token, session cookie,
+// log-only session cookie or, for GET requests, a signed link. Callers must
+// limit log-only sessions to the paths that log events.
+func (a *Auth) Authenticate(r *http.Request) (string, Method) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		if user, ok := a.TokenUser(strings.TrimPrefix(header, "Bearer ")); ok {
+			return user, MethodToken
+		}
+		return "", MethodNone
+	}
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		if user, ok := a.SessionUser(cookie.Value); ok {
+			return user, MethodSession
+		}
+	}
+
+	if r.Method == http.MethodGet {
+		if user, ok := a.VerifyLink(r.URL); ok {
+			return user, MethodLink
+		}
+	}
+
+	if cookie, err := r.Cookie(LogSessionCookie); err == nil {
+		if user, ok := a.LogSessionUser(cookie.Value); ok {
+			return user, MethodLogSession
+		}
+	}
+	return "", MethodNone
+}
+
+// hashToken hashes an API token for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadTokens re-reads the tokens file if it changed; the caller holds a.mu
+func (a *Auth) loadTokens() error {
+	path := filepath.Join(a.dir, tokensFile)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		a.tokens, a.tokensMod, a.tokensSize = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tokens: %w", err)
+	}
+	if a.tokens != nil && info.ModTime().Equal(a.tokensMod) && info.Size() == a.tokensSize {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens: %w", err)
+	}
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("failed to parse tokens: %w", err)
+	}
+	if tokens == nil {
+		tokens = []Token{}
+	}
+	a.tokens, a.tokensMod, a.tokensSize = tokens, info.ModTime(), info.Size()
+	return nil
+}
+
+// saveTokens writes the tokens file atomically; the caller holds a.mu
+func (a *Auth) saveTokens(tokens []Token) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tokens: %w", err)
+	}
+	path := filepath.Join(a.dir, tokensFile)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write tokens: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write tokens: %w", err)
+	}
+	// Force a re-read so the new modification time is picked up
+	a.tokens = nil
+	return nil
+}
+
+// TokenUser returns the user an API token belongs to
+func (a *Auth) TokenUser(token string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if token == "" || a.loadTokens() != nil {
+		return "", false
+	}
+	hash := hashToken(token)
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			return t.User, true
+		}
+	}
+	return "", false
+}
+
+// CreateToken issues a new API token for user. The token itself is only
+// returned here; just its hash is stored.
+func (a *Auth) CreateToken(user string) (string, error) {
+	if err := ValidUser(user); err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.loadTokens(); err != nil {
+		return "", err
+	}
+	tokens := append(append([]Token{}, a.tokens...), Token{User: user, Hash: hashToken(token), Created: time.Now()})
+	if err := a.saveTokens(tokens); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Tokens lists the issued API tokens
+func (a *Auth) Tokens() ([]Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.loadTokens(); err != nil {
+		return nil, err
+	}
+	return append([]Token{}, a.tokens...), nil
+}
+
+// RevokeTokens deletes all API tokens of user and returns how many were removed
+func (a *Auth) RevokeTokens(user string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.loadTokens(); err != nil {
+		return 0, err
+	}
+
+	var kept []Token
+	for _, t := range a.tokens {
+		if t.User != user {
+			kept = append(kept, t)
+		}
+	}
+	removed := len(a.tokens) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	if kept == nil {
+		kept = []Token{}
+	}
+	return removed, a.saveTokens(kept)
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupTestAuth(t *testing.T, pin string) (*Auth, string) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-auth-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	a, err := New(tmpDir, pin)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+	return a, tmpDir
+}
+
+func TestSecretPersists(t *testing.T) {
+	a, tmpDir := setupTestAuth(t, "1234")
+	defer os.RemoveAll(tmpDir)
+
+	link := a.SignPath("/log/fold", "", time.Time{})
+	reloaded, err := New(tmpDir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload auth: %v", err)
+	}
+	u, _ := url.Parse(link)
+	if _, ok := reloaded.VerifyLink(u); !ok {
+		t.Error("Expected link signed before a restart to stay valid")
+	}
+	if reloaded.Enabled() {
+		t.Error("Expected auth disabled without a PIN")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	a, tmpDir := setupTestAuth(t, "1234")
+	defer os.RemoveAll(tmpDir)
+
+	if !a.CheckPIN("1234") || a.CheckPIN("4321") || a.CheckPIN("") {
+		t.Error("Expected only the right PIN accepted")
+	}
+
+	session := a.NewSession("alice", time.Hour)
+	if user, ok := a.SessionUser(session); !ok || user != "alice" {
+		t.Errorf("Expected alice's session valid, got %q %v", user, ok)
+	}
+
+	// Swapping in another name breaks the signature
+	forged := "Ym9i" + session[strings.Index(session, "."):]
+	if _, ok := a.SessionUser(forged); ok {
+		t.Error("Expected forged session rejected")
+	}
+	if _, ok := a.SessionUser(a.NewSession("alice", -time.Minute)); ok {
+		t.Error("Expected expired session rejected")
+	}
+}
+
+func TestSignedLinks(t *testing.T) {
+	a, tmpDir := setupTestAuth(t, "1234")
+	defer os.RemoveAll(tmpDir)
+
+	link := a.SignPath("/log/temp/76?type=dough", "bob", time.Time{})
+	u, _ := url.Parse(link)
+	if user, ok := a.VerifyLink(u); !ok || user != "bob" {
+		t.Errorf("Expected signed link valid for bob, got %q %v", user, ok)
+	}
+
+	// Changing the path, a parameter or the user invalidates the link
+	for _, tampered := range []string{
+		strings.Replace(link, "/76", "/99", 1),
+		strings.Replace(link, "type=dough", "type=oven", 1),
+		strings.Replace(link, "u=bob", "u=eve", 1),
+		"/log/temp/76?type=dough",
+	} {
+		u, _ := url.Parse(tampered)
+		if _, ok := a.VerifyLink(u); ok {
+			t.Errorf("Expected %s rejected", tampered)
+		}
+	}
+
+	// Links only authenticate GET requests
+	r := httptest.NewRequest(http.MethodPost, link, nil)
+	if _, method := a.Authenticate(r); method != MethodNone {
+		t.Error("Expected signed link ignored for POST")
+	}
+	r = httptest.NewRequest(http.MethodGet, link, nil)
+	if _, method := a.Authenticate(r); method != MethodLink {
+		t.Errorf("Expected GET authenticated by link, got %q", method)
+	}
+}
+
+func TestLinkExpiryAndRotation(t *testing.T) {
+	a, tmpDir := setupTestAuth(t, "")
+	defer os.RemoveAll(tmpDir)
+
+	fresh, _ := url.Parse(a.SignPath("/log/fold", "", time.Now().Add(time.Hour)))
+	if _, err := a.CheckLink(fresh); err != nil {
+		t.Errorf("Expected unexpired link valid, got %v", err)
+	}
+	stale, _ := url.Parse(a.SignPath("/log/fold", "", time.Now().Add(-time.Hour)))
+	if _, err := a.CheckLink(stale); err != ErrLinkExpired {
+		t.Errorf("Expected ErrLinkExpired, got %v", err)
+	}
+
+	// Pushing the expiry out breaks the signature
+	extended, _ := url.Parse(strings.Replace(fresh.String(), "exp=", "exp=9", 1))
+	if _, err := a.CheckLink(extended); err != ErrBadSignature {
+		t.Errorf("Expected ErrBadSignature, got %v", err)
+	}
+	if _, err := a.CheckLink(&url.URL{Path: "/log/fold"}); err != ErrUnsigned {
+		t.Errorf("Expected ErrUnsigned, got %v", err)
+	}
+
+	// A rotation by another process (qrgen --rotate) is picked up without a restart
+	session := a.NewSession("alice", time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	if err := RotateSecret(tmpDir); err != nil {
+		t.Fatalf("RotateSecret failed: %v", err)
+	}
+	if _, err := a.CheckLink(fresh); err != ErrBadSignature {
+		t.Errorf("Expected old link rejected after rotation, got %v", err)
+	}
+	if _, ok := a.SessionUser(session); ok {
+		t.Error("Expected old session rejected after rotation")
+	}
+	rotated, _ := url.Parse(a.SignPath("/log/fold", "", time.Time{}))
+	if _, err := a.CheckLink(rotated); err != nil {
+		t.Errorf("Expected link signed with the new key valid, got %v", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	a, tmpDir := setupTestAuth(t, "1234")
+	defer os.RemoveAll(tmpDir)
+
+	if _, err := a.CreateToken("bad/name"); err == nil {
+		t.Error("Expected invalid user name rejected")
+	}
+
+	token, err := a.CreateToken("alice")
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if user, ok := a.TokenUser(token); !ok || user != "alice" {
+		t.Errorf("Expected token for alice, got %q %v", user, ok)
+	}
+	if _, ok := a.TokenUser("wrong"); ok {
+		t.Error("Expected unknown token rejected")
+	}
+
+	// Only the hash is written to disk
+	data, _ := os.ReadFile(tmpDir + "/" + Dir + "/" + tokensFile)
+	if strings.Contains(string(data), token) {
+		t.Error("Expected token stored hashed")
+	}
+
+	// Tokens created by another process (the CLI) are picked up
+	other, _ := New(tmpDir, "")
+	bobToken, _ := other.CreateToken("bob")
+	if user, ok := a.TokenUser(bobToken); !ok || user != "bob" {
+		t.Errorf("Expected token created elsewhere accepted, got %q %v", user, ok)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/bake/x", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if user, method := a.Authenticate(r); method != MethodToken || user != "alice" {
+		t.Errorf("Expected bearer token accepted, got %q %q", user, method)
+	}
+
+	if n, err := a.RevokeTokens("alice"); err != nil || n != 1 {
+		t.Fatalf("Expected one token revoked, got %d (err %v)", n, err)
+	}
+	if _, ok := a.TokenUser(token); ok {
+		t.Error("Expected revoked token rejected")
+	}
+	if tokens, _ := a.Tokens(); len(tokens) != 1 || tokens[0].User != "bob" {
+		t.Errorf("Expected only bob's token left, got %+v", tokens)
+	}
+}
@@ -0,0 +1,392 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// FormatVersion is the archive layout version written to the manifest.
+// Restore refuses archives from a newer version.
+const FormatVersion = 1
+
+// ManifestName is the manifest's name inside the archive; it is written last
+const ManifestName = "manifest.json"
+
+// Manifest describes every file in a backup archive
+type Manifest struct {
+	Version   int         `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Files     []FileEntry `json:"files"`
+}
+
+// FileEntry is one data file in a backup, with its path relative to the data directory
+type FileEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// TotalSize returns the uncompressed size of all files in the backup
+func (m *Manifest) TotalSize() int64 {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// Options controls what goes into a backup
+type Options struct {
+	// Snapshot, when set, supplies a consistent copy of the SQLite database
+	// instead of copying the live file and its write-ahead log
+	Snapshot storage.Snapshotter
+	// Exclude lists files or directories inside the data directory to
+	// leave out, such as a backup directory kept there
+	Exclude []string
+}
+
+// Create writes a gzipped tar of dataDir to w and returns its manifest
+func Create(w io.Writer, dataDir string, opts Options) (*Manifest, error) {
+	files, err := collectFiles(dataDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// A database snapshot is taken into a temp dir and archived under the live name
+	sources := make(map[string]string)
+	if opts.Snapshot != nil {
+		if _, err := os.Stat(filepath.Join(dataDir, storage.SQLiteFile)); err == nil {
+			tmpDir, err := os.MkdirTemp("", "sourdough-backup-*")
+			if err != nil {
+				return nil, fmt.Errorf("failed to create temp directory: %w", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			snapshot := filepath.Join(tmpDir, storage.SQLiteFile)
+			if err := opts.Snapshot.Snapshot(snapshot); err != nil {
+				return nil, err
+			}
+			sources[storage.SQLiteFile] = snapshot
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{Version: FormatVersion, CreatedAt: time.Now().UTC()}
+
+	for _, rel := range files {
+		src, ok := sources[rel]
+		if !ok {
+			src = filepath.Join(dataDir, filepath.FromSlash(rel))
+		}
+		entry, err := addFile(tw, rel, src)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, *entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// collectFiles lists the regular files to back up, as sorted slash-separated relative paths
+func collectFiles(dataDir string, opts Options) ([]string, error) {
+	excluded := make(map[string]bool)
+	for _, dir := range opts.Exclude {
+		if abs, err := filepath.Abs(dir); err == nil {
+			excluded[abs] = true
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(dataDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if abs, err := filepath.Abs(p); err == nil && excluded[abs] && p != dataDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dataDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		// The snapshot already contains everything in the write-ahead log
+		if opts.Snapshot != nil && (rel == storage.SQLiteFile+"-wal" || rel == storage.SQLiteFile+"-shm") {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list data directory: %w", err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// addFile copies one file into the archive, hashing it on the way
+func addFile(tw *tar.Writer, rel, src string) (*FileEntry, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", rel, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", rel, err)
+	}
+
+	hdr := &tar.Header{Name: rel, Mode: 0644, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", rel, err)
+	}
+
+	// Copy exactly the size in the header even if the file grows meanwhile
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, h), f, info.Size()); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", rel, err)
+	}
+
+	return &FileEntry{
+		Path:    rel,
+		Size:    info.Size(),
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+		ModTime: info.ModTime().UTC(),
+	}, nil
+}
+
+// Verify reads a whole archive and checks every file against the manifest
+func Verify(r io.Reader) (*Manifest, error) {
+	return read(r, nil)
+}
+
+// read walks an archive, hashing each file and handing it to extract (if set),
+// then checks the hashes against the manifest
+func read(r io.Reader, extract func(rel string, hdr *tar.Header, body io.Reader) error) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	sums := make(map[string]string)
+	var manifest *Manifest
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if hdr.Name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest: %w", err)
+			}
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry in archive: %s", hdr.Name)
+		}
+		if err := validPath(hdr.Name); err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		body := io.TeeReader(tr, h)
+		if extract != nil {
+			if err := extract(hdr.Name, hdr, body); err != nil {
+				return nil, err
+			}
+		}
+		// Drain whatever extract didn't read so the hash covers the whole file
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", hdr.Name, err)
+		}
+		sums[hdr.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("archive has no %s", ManifestName)
+	}
+	if manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("backup format version %d is newer than supported version %d", manifest.Version, FormatVersion)
+	}
+
+	for _, f := range manifest.Files {
+		sum, ok := sums[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("file missing from archive: %s", f.Path)
+		}
+		if sum != f.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", f.Path)
+		}
+		delete(sums, f.Path)
+	}
+	for name := range sums {
+		return nil, fmt.Errorf("file not in manifest: %s", name)
+	}
+	return manifest, nil
+}
+
+// validPath rejects archive paths that would land outside the data directory
+func validPath(name string) error {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(name) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(name, `\`) {
+		return fmt.Errorf("unsafe path in archive: %q", name)
+	}
+	return nil
+}
+
+// RestoreResult reports what a restore did
+type RestoreResult struct {
+	Manifest *Manifest
+	// PreviousDir holds the data that was replaced, if the data directory was not empty
+	PreviousDir string
+}
+
+// Restore unpacks and verifies an archive, then swaps it in as dataDir.
+// A non-empty dataDir is only replaced when force is set, and is kept
+// next to it as <dataDir>.pre-restore-<time>. Nothing changes if the
+// archive fails verification.
+func Restore(r io.Reader, dataDir string, force bool) (*RestoreResult, error) {
+	dataDir = filepath.Clean(dataDir)
+	empty, err := isEmptyDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if !empty && !force {
+		return nil, fmt.Errorf("data directory %s is not empty (use --force to replace it; the current data is kept)", dataDir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dataDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create parent directory: %w", err)
+	}
+	stagingDir, err := os.MkdirTemp(filepath.Dir(dataDir), filepath.Base(dataDir)+".restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	type modTime struct {
+		path string
+		time time.Time
+	}
+	var modTimes []modTime
+
+	manifest, err := read(r, func(rel string, hdr *tar.Header, body io.Reader) error {
+		dst := filepath.Join(stagingDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		f, err := os.Create(dst)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", rel, err)
+		}
+		if _, err := io.Copy(f, body); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to sync %s: %w", rel, err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to close %s: %w", rel, err)
+		}
+		modTimes = append(modTimes, modTime{dst, hdr.ModTime})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Bake files are ordered by modification time, so keep the originals
+	for _, mt := range modTimes {
+		os.Chtimes(mt.path, mt.time, mt.time)
+	}
+
+	result := &RestoreResult{Manifest: manifest}
+	if _, err := os.Stat(dataDir); err == nil {
+		if empty {
+			if err := os.Remove(dataDir); err != nil {
+				return nil, fmt.Errorf("failed to replace data directory: %w", err)
+			}
+		} else {
+			result.PreviousDir = dataDir + ".pre-restore-" + time.Now().Format("20060102-150405")
+			if err := os.Rename(dataDir, result.PreviousDir); err != nil {
+				return nil, fmt.Errorf("failed to move current data aside: %w", err)
+			}
+		}
+	}
+	if err := os.Rename(stagingDir, dataDir); err != nil {
+		if result.PreviousDir != "" {
+			os.Rename(result.PreviousDir, dataDir)
+		}
+		return nil, fmt.Errorf("failed to move restored data into place: %w", err)
+	}
+	return result, nil
+}
+
+// isEmptyDir reports whether dir is missing or has no entries
+func isEmptyDir(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	return len(entries) == 0, nil
+}
@@ -0,0 +1,220 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+func setupDataDir(t *testing.T) string {
+	tmpDir, err := os.MkdirTemp("", "sourdough-backup-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	dataDir := filepath.Join(tmpDir, "data")
+	os.MkdirAll(filepath.Join(dataDir, "images", "bake_2024-03-02_08-00-00"), 0755)
+	os.WriteFile(filepath.Join(dataDir, "bake_2024-03-02_08-00-00.jsonl"),
+		[]byte(`{"timestamp":"2024-03-02T08:00:00Z","event":"starter-out"}`+"\n"), 0644)
+	os.WriteFile(filepath.Join(dataDir, "images", "bake_2024-03-02_08-00-00", "1.jpg"), []byte("jpeg"), 0644)
+	os.WriteFile(filepath.Join(dataDir, "bake_2024-03-02_08-00-00.jsonl.tmp"), []byte("partial"), 0644)
+
+	modTime := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(dataDir, "bake_2024-03-02_08-00-00.jsonl"), modTime, modTime)
+	return tmpDir
+}
+
+func TestCreateVerifyRestore(t *testing.T) {
+	tmpDir := setupDataDir(t)
+	defer os.RemoveAll(tmpDir)
+	dataDir := filepath.Join(tmpDir, "data")
+
+	var buf bytes.Buffer
+	manifest, err := Create(&buf, dataDir, Options{})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Version != FormatVersion {
+		t.Fatalf("Expected 2 files without the temp file, got %+v", manifest)
+	}
+
+	if _, err := Verify(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// Restoring over existing data needs force and keeps the old copy
+	if _, err := Restore(bytes.NewReader(buf.Bytes()), dataDir, false); err == nil {
+		t.Fatal("Expected error restoring over non-empty data directory")
+	}
+	os.WriteFile(filepath.Join(dataDir, "bake_2030-01-01_08-00-00.jsonl"), []byte("{}\n"), 0644)
+
+	result, err := Restore(bytes.NewReader(buf.Bytes()), dataDir, true)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(result.PreviousDir, "bake_2030-01-01_08-00-00.jsonl")); err != nil {
+		t.Errorf("Expected replaced data kept in %s", result.PreviousDir)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "bake_2030-01-01_08-00-00.jsonl")); !os.IsNotExist(err) {
+		t.Error("Expected data directory to match the backup")
+	}
+
+	store, _ := storage.New(dataDir)
+	bakes, _ := store.ListBakes()
+	if len(bakes) != 1 || bakes[0] != "2024-03-02_08-00-00" {
+		t.Errorf("Expected restored bake, got %v", bakes)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dataDir, "images", "bake_2024-03-02_08-00-00", "1.jpg")); string(data) != "jpeg" {
+		t.Error("Expected image restored")
+	}
+	info, _ := os.Stat(filepath.Join(dataDir, "bake_2024-03-02_08-00-00.jsonl"))
+	if !info.ModTime().Equal(time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected modification time restored, got %s", info.ModTime())
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tmpDir := setupDataDir(t)
+	defer os.RemoveAll(tmpDir)
+	dataDir := filepath.Join(tmpDir, "data")
+
+	var buf bytes.Buffer
+	if _, err := Create(&buf, dataDir, Options{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Rewrite the archive with one file's contents changed
+	gz, _ := gzip.NewReader(&buf)
+	tr := tar.NewReader(gz)
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		body, _ := io.ReadAll(tr)
+		if strings.HasSuffix(hdr.Name, "1.jpg") {
+			body = []byte("JPEG")
+		}
+		tw.WriteHeader(hdr)
+		tw.Write(body)
+	}
+	tw.Close()
+	gw.Close()
+
+	if _, err := Verify(bytes.NewReader(out.Bytes())); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Expected checksum mismatch, got %v", err)
+	}
+
+	// A failed restore leaves the target untouched
+	target := filepath.Join(tmpDir, "restored")
+	if _, err := Restore(bytes.NewReader(out.Bytes()), target, false); err == nil {
+		t.Fatal("Expected restore of tampered archive to fail")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("Expected no data directory after failed restore")
+	}
+}
+
+func TestSQLiteSnapshot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-backup-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dataDir := filepath.Join(tmpDir, "data")
+
+	store, err := storage.NewSQLite(dataDir)
+	if err != nil {
+		t.Fatalf("NewSQLite failed: %v", err)
+	}
+	store.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	var buf bytes.Buffer
+	manifest, err := Create(&buf, dataDir, Options{Snapshot: store})
+	store.Close()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for _, f := range manifest.Files {
+		if strings.HasSuffix(f.Path, "-wal") || strings.HasSuffix(f.Path, "-shm") {
+			t.Errorf("Expected write-ahead log left out, got %s", f.Path)
+		}
+	}
+
+	target := filepath.Join(tmpDir, "restored")
+	if _, err := Restore(&buf, target, false); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	restored, err := storage.NewSQLite(target)
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	defer restored.Close()
+	if has, _ := restored.HasCurrentBake(); !has {
+		t.Error("Expected current bake in restored database")
+	}
+}
+
+func TestWriteFileAndPrune(t *testing.T) {
+	tmpDir := setupDataDir(t)
+	defer os.RemoveAll(tmpDir)
+	dataDir := filepath.Join(tmpDir, "data")
+
+	// A backup directory inside the data directory is not archived into itself
+	backupDir := filepath.Join(dataDir, "backups")
+	path, manifest, err := WriteFile(backupDir, dataDir, Options{})
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	for _, f := range manifest.Files {
+		if strings.HasPrefix(f.Path, "backups/") {
+			t.Errorf("Expected backup directory excluded, got %s", f.Path)
+		}
+	}
+	if err := VerifyFile(path); err != nil {
+		t.Errorf("VerifyFile failed: %v", err)
+	}
+
+	now := time.Now()
+	for _, age := range []time.Duration{time.Hour, 48 * time.Hour, 72 * time.Hour, 40 * 24 * time.Hour} {
+		os.WriteFile(filepath.Join(backupDir, FileName(now.Add(-age))), []byte("old"), 0644)
+	}
+	os.WriteFile(filepath.Join(backupDir, "notes.txt"), []byte("keep me"), 0644)
+
+	deleted, err := Prune(backupDir, 3, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("Expected the 2 oldest archives deleted, got %v", deleted)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("Expected newest archive kept")
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "notes.txt")); err != nil {
+		t.Error("Expected unrelated files kept")
+	}
+
+	sched := &Schedule{Dir: backupDir, Interval: 24 * time.Hour}
+	if wait := sched.NextRun(now); wait < 23*time.Hour {
+		t.Errorf("Expected next run about a day after the fresh backup, got %s", wait)
+	}
+
+	// The newest archive survives even when everything is too old
+	deleted, _ = Prune(backupDir, 0, time.Nanosecond)
+	if len(deleted) != 2 {
+		t.Errorf("Expected all but the newest deleted, got %v", deleted)
+	}
+}
@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File names are sourdough-backup-<UTC time>.tar.gz so they sort by age
+const (
+	filePrefix  = "sourdough-backup-"
+	fileSuffix  = ".tar.gz"
+	stampFormat = "20060102-150405"
+)
+
+// FileName returns the archive name for a backup taken at t
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format(stampFormat) + fileSuffix
+}
+
+// Schedule configures periodic backups in the server
+type Schedule struct {
+	Dir      string        // Where archives are written (local or mounted path)
+	Interval time.Duration // Time between backups
+	Keep     int           // Newest archives to keep (0 = no limit)
+	MaxAge   time.Duration // Delete archives older than this (0 = no limit)
+}
+
+// WriteFile creates a backup archive in dir and returns its path. The archive
+// is verified after writing and only then given its final name.
+func WriteFile(dir, dataDir string, opts Options) (string, *Manifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, FileName(time.Now()))
+	tempPath := path + ".tmp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tempPath)
+
+	// Never archive the backup directory into itself
+	opts.Exclude = append(opts.Exclude, dir)
+	manifest, err := Create(f, dataDir, opts)
+	if err != nil {
+		f.Close()
+		return "", nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", nil, fmt.Errorf("failed to sync backup file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", nil, fmt.Errorf("failed to close backup file: %w", err)
+	}
+
+	if err := VerifyFile(tempPath); err != nil {
+		return "", nil, err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return "", nil, fmt.Errorf("failed to rename backup file: %w", err)
+	}
+	return path, manifest, nil
+}
+
+// VerifyFile checks an archive on disk against its manifest
+func VerifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := Verify(f); err != nil {
+		return fmt.Errorf("backup failed verification: %w", err)
+	}
+	return nil
+}
+
+// archive is a backup file found in a backup directory
+type archive struct {
+	name  string
+	taken time.Time
+}
+
+// listArchives returns the backups in dir, newest first
+func listArchives(dir string) ([]archive, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var archives []archive
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix)
+		taken, err := time.Parse(stampFormat, stamp)
+		if err != nil {
+			continue // Not one of ours
+		}
+		archives = append(archives, archive{name, taken})
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].taken.After(archives[j].taken)
+	})
+	return archives, nil
+}
+
+// NextRun returns how long to wait before the next scheduled backup, so a
+// restarted server doesn't postpone backups by a whole interval
+func (s *Schedule) NextRun(now time.Time) time.Duration {
+	archives, err := listArchives(s.Dir)
+	if err != nil || len(archives) == 0 {
+		return 0
+	}
+	wait := s.Interval - now.Sub(archives[0].taken)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Prune deletes archives in dir beyond the newest keep, and any older than
+// maxAge. The newest archive is always kept. Returns the deleted paths.
+func Prune(dir string, keep int, maxAge time.Duration) ([]string, error) {
+	archives, err := listArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for i, a := range archives {
+		if i == 0 {
+			continue
+		}
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && time.Since(a.taken) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		path := filepath.Join(dir, a.name)
+		if err := os.Remove(path); err != nil {
+			return deleted, fmt.Errorf("failed to delete old backup: %w", err)
+		}
+		deleted = append(deleted, path)
+	}
+	return deleted, nil
+}
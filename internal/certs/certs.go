@@ -0,0 +1,410 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Dir holds the local CA and server certificate, relative to the data directory
+const Dir = "tls"
+
+// File names inside Dir
+const (
+	CAFile         = "ca.pem"
+	caKeyFile      = "ca-key.pem"
+	ServerCertFile = "server.pem"
+	ServerKeyFile  = "server-key.pem"
+)
+
+const (
+	caLifetime = 10 * 365 * 24 * time.Hour
+
+	// Apple rejects TLS server certificates valid for more than 825 days
+	serverLifetime = 825 * 24 * time.Hour
+
+	// renewBefore regenerates the server certificate this long before it expires
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// Local is a certificate authority kept in the data directory, with a server
+// certificate it signed
+type Local struct {
+	Dir      string
+	CertFile string // Server certificate
+	KeyFile  string // Server key
+	CAFile   string // CA certificate, to install on phones
+	NewCA    bool   // The CA was created or replaced, so phones must install it again
+}
+
+// lanRanges are the private and loopback networks the CA may always issue
+// for, so a new DHCP address doesn't need a new CA
+var lanRanges = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "::1/128", "fc00::/7"}
+
+// EnsureLocal creates the local CA on first use and a server certificate for
+// hosts (host names or IPs). The server certificate is replaced when it is
+// close to expiring or doesn't cover every host.
+func EnsureLocal(dataDir string, hosts []string) (*Local, error) {
+	dir := filepath.Join(dataDir, Dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	l := &Local{
+		Dir:      dir,
+		CertFile: filepath.Join(dir, ServerCertFile),
+		KeyFile:  filepath.Join(dir, ServerKeyFile),
+		CAFile:   filepath.Join(dir, CAFile),
+	}
+
+	caCert, caKey, err := l.loadOrCreateCA(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert, err := readCert(l.CertFile); err == nil && covers(cert, hosts) &&
+		time.Until(cert.NotAfter) > renewBefore && cert.CheckSignatureFrom(caCert) == nil {
+		return l, nil
+	}
+	if err := l.createServerCert(caCert, caKey, hosts); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadOrCreateCA reads the CA, generating it if missing or if its name
+// constraints don't cover hosts. CAs from before name constraints are replaced.
+func (l *Local) loadOrCreateCA(hosts []string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	keyPath := filepath.Join(l.Dir, caKeyFile)
+	cert, certErr := readCert(l.CAFile)
+	key, keyErr := readKey(keyPath)
+	if certErr == nil && keyErr == nil && permits(cert, hosts) {
+		return cert, key, nil
+	}
+	if !os.IsNotExist(certErr) && certErr != nil {
+		return nil, nil, certErr
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	dnsNames, ipRanges := nameConstraints(hosts)
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "Sourdough Local CA " + hostname, Organization: []string{"Sourdough"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		// Phones trust this CA as a root, so limit it to this server: a leaked
+		// key can't be used to impersonate other sites
+		ExtKeyUsage:                 []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         dnsNames,
+		PermittedIPRanges:           ipRanges,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	if err := writeKey(keyPath, key); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(l.CAFile, "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	l.NewCA = true
+	return cert, key, nil
+}
+
+// nameConstraints returns the names and networks the CA may issue for: each
+// host name and its subdomains, the LAN ranges and any other IPs in hosts.
+// Both lists are non-empty, since an empty list would permit anything.
+func nameConstraints(hosts []string) ([]string, []*net.IPNet) {
+	dnsNames := []string{"localhost"}
+	var ipRanges []*net.IPNet
+	for _, cidr := range lanRanges {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		ipRanges = append(ipRanges, ipNet)
+	}
+
+	seen := map[string]bool{"localhost": true}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			if !inRanges(ip, ipRanges) {
+				bits := 8 * len(ip)
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 32
+				}
+				ipRanges = append(ipRanges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+		} else if name := strings.ToLower(strings.TrimSuffix(h, ".")); name != "" && !seen[name] {
+			seen[name] = true
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	return dnsNames, ipRanges
+}
+
+// permits reports whether the CA's name constraints cover every host. A CA
+// without constraints covers nothing, so it gets replaced.
+func permits(ca *x509.Certificate, hosts []string) bool {
+	if len(ca.PermittedDNSDomains) == 0 || len(ca.PermittedIPRanges) == 0 {
+		return false
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			if !inRanges(ip, ca.PermittedIPRanges) {
+				return false
+			}
+		} else if h != "" && !inDomains(h, ca.PermittedDNSDomains) {
+			return false
+		}
+	}
+	return true
+}
+
+// inRanges reports whether ip is in any of ranges
+func inRanges(ip net.IP, ranges []*net.IPNet) bool {
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDomains reports whether name is one of domains or a subdomain of one
+func inDomains(name string, domains []string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// createServerCert issues a server certificate for hosts
+func (l *Local) createServerCert(caCert *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate server key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: "sourdough", Organization: []string{"Sourdough"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(serverLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if h != "" {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return fmt.Errorf("failed to create server certificate: %w", err)
+	}
+	if err := writeKey(l.KeyFile, key); err != nil {
+		return err
+	}
+	return writePEM(l.CertFile, "CERTIFICATE", der, 0644)
+}
+
+// covers reports whether cert is valid for every host
+func covers(cert *x509.Certificate, hosts []string) bool {
+	for _, h := range hosts {
+		if h != "" && cert.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// LocalHosts returns the names and addresses phones on the LAN may use to reach
+// this machine: its host name, host name .local, localhost and every interface IP
+func LocalHosts() []string {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		name = strings.TrimSuffix(name, ".local")
+		hosts = append(hosts, name, name+".local")
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// MobileConfig wraps a CA certificate in an iOS configuration profile. After
+// installing it, enable full trust under Settings → General → About →
+// Certificate Trust Settings.
+func MobileConfig(caPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(caPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("invalid CA certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	// Stable identifiers so reinstalling replaces the old profile
+	sum := sha256.Sum256(block.Bytes)
+	id := hex.EncodeToString(sum[:16])
+	uuid := func(prefix byte) string {
+		u := id
+		u = string(prefix) + u[1:]
+		return strings.ToUpper(u[0:8] + "-" + u[8:12] + "-" + u[12:16] + "-" + u[16:20] + "-" + u[20:32])
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, mobileConfigTemplate,
+		base64.StdEncoding.EncodeToString(block.Bytes),
+		xmlEscape(cert.Subject.CommonName), id, uuid('a'),
+		xmlEscape(cert.Subject.CommonName), id, uuid('b'))
+	return b.Bytes(), nil
+}
+
+// xmlEscape escapes text for the profile's plist
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// mobileConfigTemplate is an iOS profile with a single root certificate payload
+const mobileConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>PayloadContent</key>
+			<data>%s</data>
+			<key>PayloadDisplayName</key>
+			<string>%s</string>
+			<key>PayloadIdentifier</key>
+			<string>local.sourdough.ca.%s</string>
+			<key>PayloadType</key>
+			<string>com.apple.security.root</string>
+			<key>PayloadUUID</key>
+			<string>%s</string>
+			<key>PayloadVersion</key>
+			<integer>1</integer>
+		</dict>
+	</array>
+	<key>PayloadDisplayName</key>
+	<string>%s</string>
+	<key>PayloadIdentifier</key>
+	<string>local.sourdough.profile.%s</string>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadUUID</key>
+	<string>%s</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+// readCert reads a PEM certificate
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// readKey reads a PEM EC private key
+func readKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no key in %s", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// writeKey writes an EC private key readable only by the owner
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	return writePEM(path, "EC PRIVATE KEY", der, 0600)
+}
+
+// writePEM writes a PEM block atomically
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path+".tmp", data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnsureLocal(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-certs-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	local, err := EnsureLocal(tmpDir, []string{"localhost", "kitchen.local", "192.168.1.50"})
+	if err != nil {
+		t.Fatalf("EnsureLocal failed: %v", err)
+	}
+
+	ca, err := readCert(local.CAFile)
+	if err != nil {
+		t.Fatalf("Failed to read CA: %v", err)
+	}
+	server, err := readCert(local.CertFile)
+	if err != nil {
+		t.Fatalf("Failed to read server certificate: %v", err)
+	}
+	if !ca.IsCA {
+		t.Error("Expected the CA certificate to be a CA")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, host := range []string{"kitchen.local", "192.168.1.50", "localhost"} {
+		if _, err := server.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Server certificate not valid for %s: %v", host, err)
+		}
+	}
+	if server.NotAfter.Sub(server.NotBefore) > serverLifetime+2*renewBefore {
+		t.Errorf("Server certificate valid for too long: %v", server.NotAfter.Sub(server.NotBefore))
+	}
+
+	if info, err := os.Stat(local.KeyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected private key with mode 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	// A second run keeps both certificates
+	caPEM, _ := os.ReadFile(local.CAFile)
+	serverPEM, _ := os.ReadFile(local.CertFile)
+	if _, err := EnsureLocal(tmpDir, []string{"kitchen.local"}); err != nil {
+		t.Fatalf("EnsureLocal failed: %v", err)
+	}
+	if data, _ := os.ReadFile(local.CertFile); !bytes.Equal(data, serverPEM) {
+		t.Error("Expected the server certificate to be kept")
+	}
+
+	// A new LAN address reissues the server certificate from the same CA
+	again, err := EnsureLocal(tmpDir, []string{"kitchen.local", "10.0.0.7"})
+	if err != nil {
+		t.Fatalf("EnsureLocal failed: %v", err)
+	}
+	if data, _ := os.ReadFile(local.CAFile); !bytes.Equal(data, caPEM) || again.NewCA {
+		t.Error("Expected the CA to be kept")
+	}
+	server, _ = readCert(local.CertFile)
+	if _, err := server.Verify(x509.VerifyOptions{DNSName: "10.0.0.7", Roots: roots}); err != nil {
+		t.Errorf("Reissued certificate not valid for new address: %v", err)
+	}
+
+	// A host name outside the CA's constraints needs a new CA
+	again, err = EnsureLocal(tmpDir, []string{"sourdough.lan"})
+	if err != nil {
+		t.Fatalf("EnsureLocal failed: %v", err)
+	}
+	if data, _ := os.ReadFile(local.CAFile); bytes.Equal(data, caPEM) || !again.NewCA {
+		t.Error("Expected a new CA")
+	}
+	ca, _ = readCert(local.CAFile)
+	roots = x509.NewCertPool()
+	roots.AddCert(ca)
+	server, _ = readCert(local.CertFile)
+	if _, err := server.Verify(x509.VerifyOptions{DNSName: "sourdough.lan", Roots: roots}); err != nil {
+		t.Errorf("Reissued certificate not valid for new host: %v", err)
+	}
+}
+
+func TestCANameConstraints(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-certs-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	local, err := EnsureLocal(tmpDir, []string{"localhost", "kitchen.local", "192.168.1.50", "203.0.113.9"})
+	if err != nil {
+		t.Fatalf("EnsureLocal failed: %v", err)
+	}
+	ca, _ := readCert(local.CAFile)
+	caKey, err := readKey(filepath.Join(local.Dir, caKeyFile))
+	if err != nil {
+		t.Fatalf("Failed to read CA key: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	// Whoever holds the CA key can only issue for this server's names and the LAN
+	tests := []struct {
+		host string
+		ok   bool
+	}{
+		{"kitchen.local", true},
+		{"oven.kitchen.local", true},
+		{"192.168.7.7", true},
+		{"203.0.113.9", true},
+		{"example.com", false},
+		{"local", false},
+		{"8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: randomSerial(),
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if ip := net.ParseIP(tt.host); ip != nil {
+			template.IPAddresses = []net.IP{ip}
+		} else {
+			template.DNSNames = []string{tt.host}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("%s: failed to create certificate: %v", tt.host, err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: tt.host, Roots: roots})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: expected valid=%v, got %v", tt.host, tt.ok, err)
+		}
+	}
+}
+
+func TestMobileConfig(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-certs-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	local, err := EnsureLocal(tmpDir, []string{"localhost"})
+	if err != nil {
+		t.Fatalf("EnsureLocal failed: %v", err)
+	}
+	caPEM, _ := os.ReadFile(local.CAFile)
+
+	profile, err := MobileConfig(caPEM)
+	if err != nil {
+		t.Fatalf("MobileConfig failed: %v", err)
+	}
+	for _, want := range []string{"com.apple.security.root", "Sourdough Local CA", "<data>"} {
+		if !strings.Contains(string(profile), want) {
+			t.Errorf("Expected profile to contain %q", want)
+		}
+	}
+
+	// Reinstalling the same CA must replace the profile, not add another
+	again, _ := MobileConfig(caPEM)
+	if !bytes.Equal(profile, again) {
+		t.Error("Expected a stable profile for the same CA")
+	}
+
+	if _, err := MobileConfig([]byte("not a certificate")); err == nil {
+		t.Error("Expected an error for invalid PEM")
+	}
+}
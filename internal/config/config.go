@@ -0,0 +1,659 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/mqtt"
+	"github.com/mdeckert/sourdough/internal/storage"
+	"github.com/mdeckert/sourdough/internal/webhook"
+)
+
+// FileName is the config file looked for in the working directory
+const FileName = "sourdough.toml"
+
+// EnvFile names the config file to read instead of the default locations
+const EnvFile = "SOURDOUGH_CONFIG"
+
+// Config holds the settings of the server, CLI and QR generator. Each setting
+// comes from, in increasing precedence: the default, the config file, its
+// environment variable (the env tag), and a command-line flag.
+type Config struct {
+	Server        Server        `toml:"server"`
+	Storage       Storage       `toml:"storage"`
+	Auth          Auth          `toml:"auth"`
+	TLS           TLS           `toml:"tls"`
+	Backup        Backup        `toml:"backup"`
+	Sync          Sync          `toml:"sync"`
+	HomeAssistant HomeAssistant `toml:"home_assistant"`
+	Sensors       Sensors       `toml:"sensors"`
+	AutoLog       AutoLog       `toml:"autolog"`
+	Reminders     Reminders     `toml:"reminders"`
+	MQTT          MQTT          `toml:"mqtt"`
+	Webhooks      Webhooks      `toml:"webhooks"`
+	CLI           CLI           `toml:"cli"`
+	QR            QR            `toml:"qr"`
+
+	// Path is the file the settings were read from, "" if there was none
+	Path string `toml:"-"`
+
+	// sources records where each setting that isn't a default came from
+	sources map[string]string
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port            string   `toml:"port" env:"SOURDOUGH_PORT"`
+	DataDir         string   `toml:"data_dir" env:"SOURDOUGH_DATA_DIR"`
+	UndoWindow      Duration `toml:"undo_window" env:"SOURDOUGH_UNDO_WINDOW"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout" env:"SOURDOUGH_SHUTDOWN_TIMEOUT"`
+	QRLinks         string   `toml:"qr_links" env:"SOURDOUGH_QR_LINKS"`
+	LogFormat       string   `toml:"log_format" env:"SOURDOUGH_LOG_FORMAT"`
+}
+
+// Storage selects the storage backend
+type Storage struct {
+	Backend string `toml:"backend" env:"SOURDOUGH_STORAGE"`
+	Fsync   string `toml:"fsync" env:"SOURDOUGH_FSYNC"`
+}
+
+// Auth configures the household PIN and sync credentials
+type Auth struct {
+	PIN       string `toml:"pin" env:"SOURDOUGH_PIN" secret:"true"`
+	SyncToken string `toml:"sync_token" env:"SOURDOUGH_SYNC_TOKEN" secret:"true"`
+}
+
+// TLS configures HTTPS
+type TLS struct {
+	Mode         string   `toml:"mode" env:"SOURDOUGH_TLS"`
+	Cert         string   `toml:"cert" env:"SOURDOUGH_TLS_CERT"`
+	Key          string   `toml:"key" env:"SOURDOUGH_TLS_KEY"`
+	Hosts        []string `toml:"hosts" env:"SOURDOUGH_TLS_HOSTS"`
+	RedirectPort string   `toml:"redirect_port" env:"SOURDOUGH_HTTP_REDIRECT_PORT"`
+}
+
+// Backup configures scheduled backups; they are off while Dir is empty
+type Backup struct {
+	Dir      string   `toml:"dir" env:"SOURDOUGH_BACKUP_DIR"`
+	Interval Duration `toml:"interval" env:"SOURDOUGH_BACKUP_INTERVAL"`
+	Keep     int      `toml:"keep" env:"SOURDOUGH_BACKUP_KEEP"`
+	MaxAge   Duration `toml:"max_age" env:"SOURDOUGH_BACKUP_MAX_AGE"`
+}
+
+// Sync lets other sourdough servers sync with this one; it needs auth.pin
+type Sync struct {
+	Enabled bool     `toml:"enabled" env:"SOURDOUGH_SYNC"`
+	Peers   []string `toml:"peers" env:"SOURDOUGH_SYNC_PEERS"`
+}
+
+// HomeAssistant is where sensor readings come from and bake state is published to
+type HomeAssistant struct {
+	URL        string   `toml:"url" env:"HA_URL"`
+	Token      string   `toml:"token" env:"HA_TOKEN" secret:"true"`
+	StaleAfter Duration `toml:"stale_after" env:"HA_STALE_AFTER"`
+	Publish    bool     `toml:"publish" env:"HA_PUBLISH"`
+}
+
+// Sensors are Home Assistant entity IDs
+type Sensors struct {
+	Kitchen string `toml:"kitchen" env:"ECOBEE_ENTITY"`
+	Fridge  string `toml:"fridge" env:"FRIDGE_ENTITY"`
+}
+
+// AutoLog configures automatic temperature logging, with a schedule per bake stage
+type AutoLog struct {
+	Enabled bool     `toml:"enabled" env:"SOURDOUGH_AUTOLOG"`
+	Starter Interval `toml:"starter" env:"SOURDOUGH_AUTOLOG_STARTER"`
+	Bulk    Interval `toml:"bulk" env:"SOURDOUGH_AUTOLOG_BULK"`
+	Shaped  Interval `toml:"shaped" env:"SOURDOUGH_AUTOLOG_SHAPED"`
+	Retard  Interval `toml:"retard" env:"SOURDOUGH_AUTOLOG_RETARD"`
+	Proof   Interval `toml:"proof" env:"SOURDOUGH_AUTOLOG_PROOF"`
+	Bake    Interval `toml:"bake" env:"SOURDOUGH_AUTOLOG_BAKE"`
+}
+
+// Schedule returns the time between readings in each stage, 0 where it's off
+func (a AutoLog) Schedule() map[models.Stage]time.Duration {
+	return map[models.Stage]time.Duration{
+		models.StageStarter: time.Duration(a.Starter),
+		models.StageBulk:    time.Duration(a.Bulk),
+		models.StageShaped:  time.Duration(a.Shaped),
+		models.StageRetard:  time.Duration(a.Retard),
+		models.StageProof:   time.Duration(a.Proof),
+		models.StageBake:    time.Duration(a.Bake),
+	}
+}
+
+// Reminders configures when the next step of a bake is due
+type Reminders struct {
+	FoldInterval Interval `toml:"fold_interval" env:"SOURDOUGH_FOLD_INTERVAL"`
+	Folds        int      `toml:"folds" env:"SOURDOUGH_FOLDS"`
+}
+
+// MQTT connects the server to a broker; it's off while Broker is empty
+type MQTT struct {
+	Broker      string `toml:"broker" env:"SOURDOUGH_MQTT_BROKER"`
+	TopicPrefix string `toml:"topic_prefix" env:"SOURDOUGH_MQTT_PREFIX"`
+	ClientID    string `toml:"client_id" env:"SOURDOUGH_MQTT_CLIENT_ID"`
+	Username    string `toml:"username" env:"SOURDOUGH_MQTT_USERNAME"`
+	Password    string `toml:"password" env:"SOURDOUGH_MQTT_PASSWORD" secret:"true"`
+}
+
+// Webhooks sends signed deliveries of bake changes; they're off while URLs is empty
+type Webhooks struct {
+	URLs        []string `toml:"urls" env:"SOURDOUGH_WEBHOOK_URLS"`
+	Secret      string   `toml:"secret" env:"SOURDOUGH_WEBHOOK_SECRET" secret:"true"`
+	Events      []string `toml:"events" env:"SOURDOUGH_WEBHOOK_EVENTS"`
+	MaxAttempts int      `toml:"max_attempts" env:"SOURDOUGH_WEBHOOK_MAX_ATTEMPTS"`
+}
+
+// CLI configures the sourdough command
+type CLI struct {
+	ServerURL string `toml:"server_url" env:"SOURDOUGH_SERVER_URL"`
+	APIToken  string `toml:"api_token" env:"SOURDOUGH_API_TOKEN" secret:"true"`
+}
+
+// QR configures qrgen
+type QR struct {
+	ServerURL string   `toml:"server_url" env:"SOURDOUGH_QR_URL"`
+	OutputDir string   `toml:"output_dir" env:"SOURDOUGH_QR_DIR"`
+	Scheme    string   `toml:"scheme" env:"SOURDOUGH_QR_SCHEME"`
+	Expires   Duration `toml:"expires" env:"SOURDOUGH_QR_EXPIRES"`
+}
+
+// Duration is a time.Duration written like "10m", "12h" or "30d"
+type Duration time.Duration
+
+// UnmarshalText parses a duration, accepting days
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := storage.ParseAge(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText formats a duration the way it would be written in the file
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Interval is a Duration where "off" (or "0") turns a schedule off
+type Interval Duration
+
+// UnmarshalText parses "off" or a duration
+func (i *Interval) UnmarshalText(text []byte) error {
+	if strings.EqualFold(string(text), "off") {
+		*i = 0
+		return nil
+	}
+	return (*Duration)(i).UnmarshalText(text)
+}
+
+// MarshalText formats an interval the way it would be written in the file
+func (i Interval) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// String formats an interval like a Duration, or "off"
+func (i Interval) String() string {
+	if i == 0 {
+		return "off"
+	}
+	return Duration(i).String()
+}
+
+// String formats whole days as "7d" and anything else like "1h30m"
+func (d Duration) String() string {
+	v := time.Duration(d)
+	if v == 0 {
+		return "0"
+	}
+	if day := 24 * time.Hour; v%day == 0 {
+		return fmt.Sprintf("%dd", v/day)
+	}
+	s := v.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// Defaults returns the settings used when nothing else is configured
+func Defaults() *Config {
+	return &Config{
+		Server: Server{
+			Port:            "8080",
+			DataDir:         "./data",
+			UndoWindow:      Duration(10 * time.Minute),
+			ShutdownTimeout: Duration(15 * time.Second),
+			QRLinks:         "open",
+			LogFormat:       "text",
+		},
+		Storage:       Storage{Backend: storage.BackendJSONL, Fsync: string(storage.SyncAlways)},
+		TLS:           TLS{Mode: "off"},
+		Backup:        Backup{Interval: Duration(24 * time.Hour), Keep: 7},
+		HomeAssistant: HomeAssistant{StaleAfter: Duration(2 * time.Hour)},
+		AutoLog: AutoLog{
+			Enabled: true,
+			Starter: Interval(4 * time.Hour),
+			Bulk:    Interval(4 * time.Hour),
+			Shaped:  Interval(4 * time.Hour),
+			Retard:  Interval(time.Hour),
+		},
+		Reminders: Reminders{FoldInterval: Interval(30 * time.Minute), Folds: 4},
+		MQTT:      MQTT{TopicPrefix: "sourdough", ClientID: "sourdough-server"},
+		Webhooks:  Webhooks{MaxAttempts: webhook.DefaultMaxAttempts},
+		CLI:       CLI{ServerURL: "http://localhost:8080"},
+		QR:        QR{OutputDir: "./qrcodes", Scheme: "auto"},
+	}
+}
+
+// Load reads the config file and applies environment overrides. With an empty
+// path it uses $SOURDOUGH_CONFIG, else ./sourdough.toml or
+// ~/.config/sourdough/sourdough.toml if one exists, else only defaults and
+// environment. Call Validate after applying flags with Set.
+func Load(path string) (*Config, error) {
+	cfg := Defaults()
+	cfg.sources = make(map[string]string)
+
+	if path == "" {
+		path = findFile()
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// findFile returns the first default config file that exists
+func findFile() string {
+	if path := os.Getenv(EnvFile); path != "" {
+		return path
+	}
+	candidates := []string{FileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "sourdough", FileName))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadFile decodes path over the defaults and rejects unknown keys
+func (c *Config) loadFile(path string) error {
+	md, err := toml.DecodeFile(path, c)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return fmt.Errorf("failed to parse %s:\n%s", path, perr.ErrorWithPosition())
+		}
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	c.Path = path
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return fmt.Errorf("unknown settings in %s: %s (see sourdough.example.toml)", path, strings.Join(keys, ", "))
+	}
+	for _, key := range md.Keys() {
+		c.sources[key.String()] = path
+	}
+	return nil
+}
+
+// loadEnv applies every environment variable that is set
+func (c *Config) loadEnv() error {
+	var problems []string
+	c.walk(func(key string, field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		env := os.Getenv(name)
+		if env == "" {
+			return
+		}
+		if err := setValue(value, env); err != nil {
+			problems = append(problems, fmt.Sprintf("%s=%q: %v", name, env, err))
+			return
+		}
+		c.sources[key] = name
+	})
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid environment:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// Set overrides a setting by key (e.g. "server.port"), typically from a
+// command-line flag named by source
+func (c *Config) Set(key, value, source string) error {
+	found := false
+	var err error
+	c.walk(func(k string, field reflect.StructField, v reflect.Value) {
+		if k != key {
+			return
+		}
+		found = true
+		if err = setValue(v, value); err == nil {
+			c.sources[key] = source
+		}
+	})
+	if !found {
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", source, value, err)
+	}
+	return nil
+}
+
+// Source returns where a setting came from: a file path, an environment
+// variable or a flag, or "" for the default
+func (c *Config) Source(key string) string {
+	return c.sources[key]
+}
+
+// walk calls fn for every setting with its "section.key" name
+func (c *Config) walk(fn func(key string, field reflect.StructField, value reflect.Value)) {
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		sectionName := section.Tag.Get("toml")
+		if sectionName == "" || sectionName == "-" {
+			continue
+		}
+		sv := root.Field(i)
+		for j := 0; j < sv.NumField(); j++ {
+			field := sv.Type().Field(j)
+			fn(sectionName+"."+field.Tag.Get("toml"), field, sv.Field(j))
+		}
+	}
+}
+
+// setValue parses s into a setting of any supported type
+func setValue(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case Duration:
+		var d Duration
+		if err := d.UnmarshalText([]byte(s)); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(d))
+	case Interval:
+		var i Interval
+		if err := i.UnmarshalText([]byte(s)); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(i))
+	case string:
+		v.SetString(s)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("not a whole number")
+		}
+		v.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("not true or false")
+		}
+		v.SetBool(b)
+	case []string:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// Validate checks every setting and reports all problems at once
+func (c *Config) Validate() error {
+	var problems []string
+	bad := func(key, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if src := c.sources[key]; src != "" {
+			msg += fmt.Sprintf(" (set by %s)", src)
+		}
+		problems = append(problems, key+": "+msg)
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		bad(key, "%q must be one of %s", value, strings.Join(allowed, ", "))
+	}
+
+	if !validPort(c.Server.Port) {
+		bad("server.port", "%q is not a port number (1-65535)", c.Server.Port)
+	}
+	if c.Server.DataDir == "" {
+		bad("server.data_dir", "must not be empty")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		bad("server.shutdown_timeout", "must be positive")
+	}
+	oneOf("server.qr_links", c.Server.QRLinks, "open", "confirm")
+	oneOf("server.log_format", c.Server.LogFormat, "text", "json")
+
+	oneOf("storage.backend", c.Storage.Backend, storage.BackendJSONL, storage.BackendSQLite)
+	oneOf("storage.fsync", c.Storage.Fsync, string(storage.SyncAlways), string(storage.SyncNone))
+
+	oneOf("tls.mode", c.TLS.Mode, "off", "auto")
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		bad("tls.cert", "set both tls.cert and tls.key, or neither")
+	}
+	if c.TLS.Cert != "" && c.TLS.Mode == "auto" {
+		bad("tls.mode", "auto generates a certificate; remove it or tls.cert and tls.key")
+	}
+	if c.TLS.RedirectPort != "" {
+		if !validPort(c.TLS.RedirectPort) {
+			bad("tls.redirect_port", "%q is not a port number (1-65535)", c.TLS.RedirectPort)
+		} else if c.TLS.RedirectPort == c.Server.Port {
+			bad("tls.redirect_port", "must differ from server.port")
+		}
+		if !c.TLSEnabled() {
+			bad("tls.redirect_port", "needs HTTPS: set tls.mode = \"auto\" or tls.cert and tls.key")
+		}
+	}
+
+	if c.Backup.Dir != "" && c.Backup.Interval <= 0 {
+		bad("backup.interval", "must be positive")
+	}
+	if c.Backup.Keep < 0 {
+		bad("backup.keep", "must be 0 (keep all) or more")
+	}
+
+	// Peers can replace and delete bakes, so sync is only served behind a PIN
+	if c.Sync.Enabled && c.Auth.PIN == "" {
+		bad("sync.enabled", "needs auth.pin; peers can replace and delete bakes")
+	}
+	for _, u := range c.Sync.Peers {
+		if !validHTTPURL(u) {
+			bad("sync.peers", "%q is not an http(s) URL", u)
+		}
+	}
+
+	// Home Assistant needs a URL, a token and something to do; a partial setup is almost always a typo
+	hasSensor := c.Sensors.Kitchen != "" || c.Sensors.Fridge != ""
+	if c.HomeAssistant.URL != "" || c.HomeAssistant.Token != "" || hasSensor || c.HomeAssistant.Publish {
+		ha := map[string]string{
+			"home_assistant.url":   c.HomeAssistant.URL,
+			"home_assistant.token": c.HomeAssistant.Token,
+		}
+		for _, key := range []string{"home_assistant.url", "home_assistant.token"} {
+			if ha[key] == "" {
+				bad(key, "missing; Home Assistant needs home_assistant.url, home_assistant.token and a sensor or home_assistant.publish")
+			}
+		}
+		if !hasSensor && !c.HomeAssistant.Publish {
+			bad("sensors.kitchen", "missing; set sensors.kitchen or sensors.fridge, or home_assistant.publish, to use Home Assistant")
+		}
+	}
+	if c.HomeAssistant.URL != "" && !validHTTPURL(c.HomeAssistant.URL) {
+		bad("home_assistant.url", "%q is not an http(s) URL", c.HomeAssistant.URL)
+	}
+	if c.Sensors.Kitchen != "" && !strings.Contains(c.Sensors.Kitchen, ".") {
+		bad("sensors.kitchen", "%q is not an entity ID like sensor.kitchen_temperature", c.Sensors.Kitchen)
+	}
+	if c.Sensors.Fridge != "" && !strings.Contains(c.Sensors.Fridge, ".") {
+		bad("sensors.fridge", "%q is not an entity ID like sensor.fridge_temperature", c.Sensors.Fridge)
+	}
+
+	for _, stage := range models.Stages {
+		interval := c.AutoLog.Schedule()[stage]
+		if interval != 0 && (interval < 15*time.Minute || interval > 24*time.Hour) {
+			bad("autolog."+string(stage), "%s must be \"off\" or between 15m and 1d", Interval(interval))
+		}
+	}
+
+	if fold := time.Duration(c.Reminders.FoldInterval); fold != 0 && (fold < 5*time.Minute || fold > 4*time.Hour) {
+		bad("reminders.fold_interval", "%s must be \"off\" or between 5m and 4h", c.Reminders.FoldInterval)
+	}
+	if c.Reminders.Folds < 0 {
+		bad("reminders.folds", "must be 0 or more")
+	}
+
+	if c.MQTT.Broker != "" {
+		if _, err := mqtt.ParseBroker(c.MQTT.Broker); err != nil {
+			bad("mqtt.broker", "%v", err)
+		}
+	}
+	if p := c.MQTT.TopicPrefix; p == "" || strings.ContainsAny(p, "+#") || strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") {
+		bad("mqtt.topic_prefix", "%q must be a topic like \"sourdough\" without wildcards or leading or trailing slashes", p)
+	}
+	if c.MQTT.ClientID == "" {
+		bad("mqtt.client_id", "must not be empty")
+	}
+
+	for _, u := range c.Webhooks.URLs {
+		if !validHTTPURL(u) {
+			bad("webhooks.urls", "%q is not an http(s) URL", u)
+		}
+	}
+	if len(c.Webhooks.URLs) > 0 && c.Webhooks.Secret == "" {
+		bad("webhooks.secret", "missing; webhooks.urls needs a secret to sign deliveries")
+	}
+	for _, e := range c.Webhooks.Events {
+		oneOf("webhooks.events", e, webhook.Types...)
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		bad("webhooks.max_attempts", "%d must be at least 1", c.Webhooks.MaxAttempts)
+	}
+
+	if !validHTTPURL(c.CLI.ServerURL) {
+		bad("cli.server_url", "%q is not an http(s) URL", c.CLI.ServerURL)
+	}
+	oneOf("qr.scheme", c.QR.Scheme, "auto", "https", "http")
+	if c.QR.OutputDir == "" {
+		bad("qr.output_dir", "must not be empty")
+	}
+
+	if len(problems) > 0 {
+		where := "configuration"
+		if c.Path != "" {
+			where = c.Path
+		}
+		return fmt.Errorf("invalid %s:\n  - %s", where, strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// TLSEnabled reports whether the server serves HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLS.Mode == "auto" || c.TLS.Cert != ""
+}
+
+// validPort reports whether s is a TCP port number
+func validPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n < 65536
+}
+
+// validHTTPURL reports whether s is an absolute http or https URL
+func validHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Show writes the effective settings as TOML, with secrets hidden and a
+// comment naming where each non-default setting came from
+func (c *Config) Show(w io.Writer) {
+	if c.Path != "" {
+		fmt.Fprintf(w, "# Config file: %s\n", c.Path)
+	} else {
+		fmt.Fprintf(w, "# No config file found (looked for $%s, ./%s, ~/.config/sourdough/%s)\n", EnvFile, FileName, FileName)
+	}
+
+	section := ""
+	c.walk(func(key string, field reflect.StructField, value reflect.Value) {
+		name, _, _ := strings.Cut(key, ".")
+		if name != section {
+			section = name
+			fmt.Fprintf(w, "\n[%s]\n", section)
+		}
+
+		line := fmt.Sprintf("%s = %s", field.Tag.Get("toml"), formatValue(value, field.Tag.Get("secret") == "true"))
+		if src := c.sources[key]; src != "" {
+			line = fmt.Sprintf("%-40s # %s", line, src)
+		}
+		fmt.Fprintln(w, line)
+	})
+}
+
+// formatValue renders a setting as a TOML value
+func formatValue(v reflect.Value, secret bool) string {
+	switch val := v.Interface().(type) {
+	case Duration, Interval:
+		return strconv.Quote(val.(fmt.Stringer).String())
+	case string:
+		if secret && val != "" {
+			return `"********"`
+		}
+		return strconv.Quote(val)
+	case []string:
+		quoted := make([]string, len(val))
+		for i, s := range val {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return fmt.Sprint(val)
+	}
+}
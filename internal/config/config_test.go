@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// writeConfig writes a config file into a temp dir and returns its path
+func writeConfig(t *testing.T, content string) (string, string) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	path := filepath.Join(tmpDir, FileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path, tmpDir
+}
+
+func TestExampleMatchesDefaults(t *testing.T) {
+	cfg, err := Load("../../sourdough.example.toml")
+	if err != nil {
+		t.Fatalf("Failed to load example: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Example is invalid: %v", err)
+	}
+
+	// The documented values must be the real defaults
+	defaults := Defaults()
+	if len(cfg.TLS.Hosts) == 0 {
+		cfg.TLS.Hosts = nil
+	}
+	if len(cfg.Sync.Peers) == 0 {
+		cfg.Sync.Peers = nil
+	}
+	if len(cfg.Webhooks.URLs) == 0 {
+		cfg.Webhooks.URLs = nil
+	}
+	if len(cfg.Webhooks.Events) == 0 {
+		cfg.Webhooks.Events = nil
+	}
+	cfg.Path, cfg.sources = "", nil
+	if !reflect.DeepEqual(cfg, defaults) {
+		t.Errorf("Example differs from defaults:\n%+v\n%+v", cfg, defaults)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	path, tmpDir := writeConfig(t, "[server]\nport = \"9000\"\ndata_dir = \"/srv/sourdough\"\n\n[autolog]\nbulk = \"30m\"\nretard = \"off\"\n")
+	defer os.RemoveAll(tmpDir)
+
+	t.Setenv("SOURDOUGH_PORT", "9100")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// File beats the default, environment beats the file
+	if cfg.Server.DataDir != "/srv/sourdough" || cfg.Source("server.data_dir") != path {
+		t.Errorf("Expected data_dir from file, got %q from %q", cfg.Server.DataDir, cfg.Source("server.data_dir"))
+	}
+	if cfg.Server.Port != "9100" || cfg.Source("server.port") != "SOURDOUGH_PORT" {
+		t.Errorf("Expected port from environment, got %q from %q", cfg.Server.Port, cfg.Source("server.port"))
+	}
+	schedule := cfg.AutoLog.Schedule()
+	if schedule[models.StageBulk] != 30*time.Minute || schedule[models.StageRetard] != 0 || schedule[models.StageStarter] != 4*time.Hour {
+		t.Errorf("Unexpected autolog schedule %v", schedule)
+	}
+	if cfg.Source("storage.backend") != "" {
+		t.Errorf("Expected backend to be a default, got source %q", cfg.Source("storage.backend"))
+	}
+
+	// A flag beats everything
+	if err := cfg.Set("server.port", "9200", "--port"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if cfg.Server.Port != "9200" || cfg.Source("server.port") != "--port" {
+		t.Errorf("Expected port from flag, got %q", cfg.Server.Port)
+	}
+	if err := cfg.Set("server.prot", "1", "--prot"); err == nil {
+		t.Error("Expected error for unknown setting")
+	}
+}
+
+func TestEnvironmentTypes(t *testing.T) {
+	t.Setenv(EnvFile, filepath.Join(os.TempDir(), "does-not-matter-"+time.Now().Format("150405.000")))
+	t.Setenv("SOURDOUGH_TLS_HOSTS", "kitchen.lan, 10.0.0.5")
+	t.Setenv("SOURDOUGH_BACKUP_KEEP", "3")
+	t.Setenv("SOURDOUGH_AUTOLOG", "false")
+
+	cfg, err := Load("")
+	if err == nil {
+		t.Fatal("Expected error for a missing SOURDOUGH_CONFIG file")
+	}
+
+	os.Unsetenv(EnvFile)
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.TLS.Hosts, []string{"kitchen.lan", "10.0.0.5"}) {
+		t.Errorf("Unexpected hosts: %v", cfg.TLS.Hosts)
+	}
+	if cfg.Backup.Keep != 3 || cfg.AutoLog.Enabled {
+		t.Errorf("Expected keep=3 and autolog off, got %d and %v", cfg.Backup.Keep, cfg.AutoLog.Enabled)
+	}
+
+	t.Setenv("SOURDOUGH_BACKUP_KEEP", "seven")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "SOURDOUGH_BACKUP_KEEP") {
+		t.Errorf("Expected error naming SOURDOUGH_BACKUP_KEEP, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path, tmpDir := writeConfig(t, `
+[server]
+port = "80800"
+
+[home_assistant]
+url = "homeassistant.local:8123"
+
+[autolog]
+bulk = "5m"
+
+[tls]
+redirect_port = "8081"
+
+[webhooks]
+urls = ["https://example.com/hook", "ftp://example.com"]
+events = ["event.logged", "bake.started"]
+
+[sync]
+enabled = true
+peers = ["kitchen.local:8080"]
+`)
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	// Every problem is reported at once, with where it was set
+	for _, want := range []string{
+		"server.port", "home_assistant.token: missing", "sensors.kitchen: missing",
+		"not an http(s) URL", "autolog.bulk: 5m must be", "tls.redirect_port: needs HTTPS", "set by " + path,
+		"webhooks.urls: \"ftp://example.com\"", "webhooks.events: \"bake.started\"", "webhooks.secret: missing",
+		"sync.enabled: needs auth.pin", "sync.peers: \"kitchen.local:8080\"",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestUnknownAndMalformed(t *testing.T) {
+	path, tmpDir := writeConfig(t, "[server]\nprot = \"9000\"\n")
+	defer os.RemoveAll(tmpDir)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "server.prot") {
+		t.Errorf("Expected unknown key error, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("[server\nport = 1\n"), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "At line") {
+		t.Errorf("Expected parse error with position, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("[backup]\ninterval = \"often\"\n"), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "often") {
+		t.Errorf("Expected invalid duration error, got %v", err)
+	}
+}
+
+func TestShow(t *testing.T) {
+	path, tmpDir := writeConfig(t, "[auth]\npin = \"4821\"\n\n[backup]\nmax_age = \"90d\"\n")
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var buf bytes.Buffer
+	cfg.Show(&buf)
+	out := buf.String()
+
+	if strings.Contains(out, "4821") {
+		t.Error("Expected the PIN to be hidden")
+	}
+	for _, want := range []string{"# Config file: " + path, "[auth]", `pin = "********"`, `max_age = "90d"`, `undo_window = "10m"`, `proof = "off"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+
+	// The output is itself a valid config file
+	shown, showDir := writeConfig(t, strings.ReplaceAll(out, `"********"`, `""`))
+	defer os.RemoveAll(showDir)
+	if _, err := Load(shown); err != nil {
+		t.Errorf("Shown config doesn't load: %v", err)
+	}
+}
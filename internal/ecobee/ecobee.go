@@ -1,13 +1,44 @@
 package ecobee
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Fetching, caching and circuit breaking
+const (
+	requestTimeout = 5 * time.Second
+	maxAttempts    = 3                      // Tries per fetch while Home Assistant errors or times out
+	initialBackoff = 250 * time.Millisecond // Delay before the first retry, doubled after each
+
+	// CacheTTL is how long a reading is reused without asking Home Assistant again
+	CacheTTL = time.Minute
+	// MaxCacheAge is the oldest reading returned in place of a failed fetch
+	MaxCacheAge = 15 * time.Minute
+	// DefaultStaleAfter is how long a sensor may go without reporting before its state isn't trusted
+	DefaultStaleAfter = 2 * time.Hour
+
+	breakerThreshold = 3           // Failed fetches in a row that open the circuit
+	breakerCooldown  = time.Minute // How long an open circuit skips Home Assistant
+)
+
+var (
+	// ErrUnavailable means Home Assistant has no value for the sensor, e.g. it's offline
+	ErrUnavailable = errors.New("sensor unavailable")
+	// ErrStale means the sensor hasn't reported for longer than the stale limit
+	ErrStale = errors.New("sensor reading is stale")
+	// ErrCircuitOpen means recent fetches failed and Home Assistant isn't being asked for now
+	ErrCircuitOpen = errors.New("home assistant is unreachable")
+)
+
 // Client handles fetching temperature from Ecobee via Home Assistant
 type Client struct {
 	baseURL    string
@@ -15,13 +46,43 @@ type Client struct {
 	entityID   string
 	client     *http.Client
 	enabled    bool
+	staleAfter time.Duration
+	backoff    time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	last      *Reading // Last good reading
+	lastErr   error    // Error of the last fetch, nil after a success
+	lastErrAt time.Time
+	failures  int       // Fetches in a row that failed because Home Assistant was down
+	openUntil time.Time // Circuit breaker: skip Home Assistant until then
 }
 
 // HAStateResponse represents the Home Assistant API state response
 type HAStateResponse struct {
-	State string `json:"state"`
+	State      string `json:"state"`
+	Attributes struct {
+		UnitOfMeasurement string `json:"unit_of_measurement"`
+	} `json:"attributes"`
+	LastUpdated  time.Time `json:"last_updated"`
+	LastReported time.Time `json:"last_reported"` // Home Assistant 2024.3+, set even when the value is unchanged
 }
 
+// Reading is a temperature reported by the sensor
+type Reading struct {
+	TempF     float64   `json:"temp_f"`
+	Unit      string    `json:"unit,omitempty"`    // Unit Home Assistant reported, converted to °F
+	Updated   time.Time `json:"updated,omitempty"` // When the sensor last reported
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// outageError marks failures that mean Home Assistant itself is down or
+// overloaded; they are retried and count toward the circuit breaker
+type outageError struct{ err error }
+
+func (e *outageError) Error() string { return e.err.Error() }
+func (e *outageError) Unwrap() error { return e.err }
+
 // New creates a new Ecobee client
 // baseURL: Home Assistant base URL (e.g., "http://localhost:8123")
 // token: Home Assistant long-lived access token
@@ -30,13 +91,16 @@ func New(baseURL, token, entityID string) *Client {
 	enabled := baseURL != "" && token != "" && entityID != ""
 
 	return &Client{
-		baseURL:  baseURL,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
 		token:    token,
 		entityID: entityID,
 		client: &http.Client{
-			Timeout: 5 * time.Second,
+			Timeout: requestTimeout,
 		},
-		enabled: enabled,
+		enabled:    enabled,
+		staleAfter: DefaultStaleAfter,
+		backoff:    initialBackoff,
+		now:        time.Now,
 	}
 }
 
@@ -45,50 +109,229 @@ func (c *Client) IsEnabled() bool {
 	return c.enabled
 }
 
+// SetStaleAfter sets how long the sensor may go without reporting; 0 disables the check
+func (c *Client) SetStaleAfter(d time.Duration) {
+	c.staleAfter = d
+}
+
 // GetTemperature fetches the current temperature from Ecobee via Home Assistant
-// Returns 0 if disabled or on error (caller should handle gracefully)
-func (c *Client) GetTemperature() (float64, error) {
+// Returns 0 if disabled or on error (caller should handle gracefully).
+// Cancelling ctx abandons the request.
+func (c *Client) GetTemperature(ctx context.Context) (float64, error) {
 	if !c.enabled {
 		return 0, nil
 	}
+	reading, err := c.Read(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return reading.TempF, nil
+}
+
+// Read returns the sensor's temperature. A reading younger than CacheTTL is
+// reused; otherwise Home Assistant is asked, with retries. When that fails,
+// a reading up to MaxCacheAge old is returned instead; check its FetchedAt.
+func (c *Client) Read(ctx context.Context) (Reading, error) {
+	if !c.enabled {
+		return Reading{}, fmt.Errorf("sensor not configured")
+	}
+
+	c.mu.Lock()
+	now := c.now()
+	if c.last != nil && now.Sub(c.last.FetchedAt) < CacheTTL {
+		reading := *c.last
+		c.mu.Unlock()
+		return reading, nil
+	}
+	if now.Before(c.openUntil) {
+		defer c.mu.Unlock()
+		return c.fallbackLocked(now, fmt.Errorf("%w (retrying after %s)", ErrCircuitOpen, c.openUntil.Format("3:04:05 PM")))
+	}
+	c.mu.Unlock()
+
+	reading, err := c.fetchWithRetry(ctx)
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now = c.now()
+	if err == nil {
+		c.last, c.lastErr, c.failures, c.openUntil = &reading, nil, 0, time.Time{}
+		return reading, nil
+	}
+
+	c.lastErr, c.lastErrAt = err, now
+	var outage *outageError
+	if errors.As(err, &outage) {
+		c.failures++
+		if c.failures >= breakerThreshold {
+			c.openUntil = now.Add(breakerCooldown)
+		}
+	}
+	return c.fallbackLocked(now, err)
+}
+
+// fallbackLocked returns the last good reading if it is recent enough, else err
+func (c *Client) fallbackLocked(now time.Time, err error) (Reading, error) {
+	if c.last != nil && now.Sub(c.last.FetchedAt) <= MaxCacheAge {
+		return *c.last, nil
+	}
+	return Reading{}, err
+}
+
+// fetchWithRetry asks Home Assistant up to maxAttempts times while it is down
+func (c *Client) fetchWithRetry(ctx context.Context) (Reading, error) {
+	delay := c.backoff
+	for attempt := 1; ; attempt++ {
+		reading, err := c.fetch(ctx)
+		var outage *outageError
+		if err == nil || !errors.As(err, &outage) || attempt == maxAttempts || ctx.Err() != nil {
+			return reading, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Reading{}, err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// fetch makes one request for the sensor's state
+func (c *Client) fetch(ctx context.Context) (Reading, error) {
 	// Construct URL for Home Assistant API
 	url := fmt.Sprintf("%s/api/states/%s", c.baseURL, c.entityID)
 
 	// Create request with authorization header
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		return Reading{}, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch temperature: %w", err)
+		return Reading{}, &outageError{fmt.Errorf("failed to fetch temperature: %w", err)}
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return Reading{}, fmt.Errorf("home assistant rejected the token (status %d)", resp.StatusCode)
+	case resp.StatusCode == http.StatusNotFound:
+		return Reading{}, fmt.Errorf("entity %s not found in home assistant", c.entityID)
+	case resp.StatusCode >= 500:
+		return Reading{}, &outageError{fmt.Errorf("unexpected status code: %d", resp.StatusCode)}
+	case resp.StatusCode != http.StatusOK:
+		return Reading{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response: %w", err)
+		return Reading{}, &outageError{fmt.Errorf("failed to read response: %w", err)}
 	}
 
 	var stateResp HAStateResponse
 	if err := json.Unmarshal(body, &stateResp); err != nil {
-		return 0, fmt.Errorf("failed to parse response: %w", err)
+		return Reading{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return c.parseState(stateResp)
+}
+
+// parseState turns a state into a reading in °F, rejecting unavailable and stale sensors
+func (c *Client) parseState(state HAStateResponse) (Reading, error) {
+	switch strings.ToLower(state.State) {
+	case "", "unavailable", "unknown":
+		return Reading{}, fmt.Errorf("%w: %s is %q", ErrUnavailable, c.entityID, state.State)
 	}
 
 	// Parse temperature from state string
-	var temp float64
-	if _, err := fmt.Sscanf(stateResp.State, "%f", &temp); err != nil {
-		return 0, fmt.Errorf("failed to parse temperature: %w", err)
+	value, err := strconv.ParseFloat(strings.TrimSpace(state.State), 64)
+	if err != nil {
+		return Reading{}, fmt.Errorf("failed to parse temperature %q: %w", state.State, err)
+	}
+
+	unit := state.Attributes.UnitOfMeasurement
+	tempF, err := toFahrenheit(value, unit)
+	if err != nil {
+		return Reading{}, err
+	}
+
+	// last_updated only moves when the value changes; last_reported is set on every report
+	updated := state.LastReported
+	if updated.IsZero() {
+		updated = state.LastUpdated
+	}
+	now := c.now()
+	if c.staleAfter > 0 && !updated.IsZero() && now.Sub(updated) > c.staleAfter {
+		return Reading{}, fmt.Errorf("%w: %s last reported %s ago", ErrStale, c.entityID, now.Sub(updated).Round(time.Minute))
 	}
 
-	// Temperature is already in Fahrenheit from Home Assistant
-	return temp, nil
+	return Reading{TempF: tempF, Unit: unit, Updated: updated, FetchedAt: now}, nil
+}
+
+// toFahrenheit converts a value in a Home Assistant temperature unit. Sensors
+// without a unit are assumed to report °F, as this client always did.
+func toFahrenheit(value float64, unit string) (float64, error) {
+	switch strings.TrimPrefix(unit, "°") {
+	case "", "F":
+		return value, nil
+	case "C":
+		return value*9/5 + 32, nil
+	case "K":
+		return (value-273.15)*9/5 + 32, nil
+	}
+	return 0, fmt.Errorf("unsupported unit of measurement %q", unit)
+}
+
+// Status describes the sensor's health for /api/sensors
+type Status struct {
+	Entity      string     `json:"entity,omitempty"`
+	State       string     `json:"state"` // ok, cached, circuit-open, error, unknown or disabled
+	Healthy     bool       `json:"healthy"`
+	Reading     *Reading   `json:"reading,omitempty"`
+	AgeSeconds  float64    `json:"age_seconds,omitempty"` // Since the reading was fetched
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Failures    int        `json:"consecutive_failures"`
+	RetryAt     *time.Time `json:"retry_at,omitempty"` // When an open circuit lets a request through
+}
+
+// Status reports the result of recent fetches without contacting Home Assistant
+func (c *Client) Status() Status {
+	if !c.enabled {
+		return Status{State: "disabled"}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	status := Status{Entity: c.entityID, Failures: c.failures}
+	if c.last != nil {
+		reading := *c.last
+		status.Reading = &reading
+		status.AgeSeconds = now.Sub(reading.FetchedAt).Seconds()
+	}
+	if c.lastErr != nil {
+		errAt := c.lastErrAt
+		status.LastError, status.LastErrorAt = c.lastErr.Error(), &errAt
+	}
+
+	switch {
+	case now.Before(c.openUntil):
+		retryAt := c.openUntil
+		status.State, status.RetryAt = "circuit-open", &retryAt
+	case c.lastErr != nil && c.last != nil && now.Sub(c.last.FetchedAt) <= MaxCacheAge:
+		status.State = "cached"
+	case c.lastErr != nil:
+		status.State = "error"
+	case c.last != nil:
+		status.State, status.Healthy = "ok", true
+	default:
+		status.State = "unknown"
+	}
+	return status
 }
@@ -0,0 +1,232 @@
+package ecobee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHA serves /api/states/<entity> from a queue of responses, repeating the last one
+type fakeHA struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []fakeResponse
+	requests  int
+}
+
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// state is a 200 response with the given state, unit and last_reported time
+func state(value, unit string, reported time.Time) fakeResponse {
+	return fakeResponse{http.StatusOK, fmt.Sprintf(`{"entity_id": "sensor.kitchen", "state": %q, "attributes": {"unit_of_measurement": %q}, "last_updated": %q, "last_reported": %q}`,
+		value, unit, reported.Add(-time.Hour).Format(time.RFC3339), reported.Format(time.RFC3339))}
+}
+
+func newFakeHA(t *testing.T, responses ...fakeResponse) *fakeHA {
+	ha := &fakeHA{responses: responses}
+	ha.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/states/sensor.kitchen" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		ha.mu.Lock()
+		resp := ha.responses[0]
+		if len(ha.responses) > 1 {
+			ha.responses = ha.responses[1:]
+		}
+		ha.requests++
+		ha.mu.Unlock()
+
+		w.WriteHeader(resp.status)
+		fmt.Fprint(w, resp.body)
+	}))
+	t.Cleanup(ha.Close)
+	return ha
+}
+
+// respond replaces the queue of responses
+func (ha *fakeHA) respond(responses ...fakeResponse) {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	ha.responses = responses
+}
+
+func (ha *fakeHA) count() int {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	return ha.requests
+}
+
+// newTestClient points a client at the fake with a controllable clock and fast retries
+func newTestClient(ha *fakeHA) (*Client, *time.Time) {
+	now := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+	c := New(ha.URL, "token", "sensor.kitchen")
+	c.backoff = time.Millisecond
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestUnitsAndStates(t *testing.T) {
+	reported := time.Date(2026, 3, 14, 8, 55, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		resp    fakeResponse
+		want    float64
+		wantErr error
+	}{
+		{"fahrenheit", state("71.5", "°F", reported), 71.5, nil},
+		{"celsius", state("20", "°C", reported), 68, nil},
+		{"kelvin", state("293.15", "K", reported), 68, nil},
+		{"no unit", state("70", "", reported), 70, nil},
+		{"unavailable", state("unavailable", "°F", reported), 0, ErrUnavailable},
+		{"unknown", state("unknown", "°F", reported), 0, ErrUnavailable},
+		{"stale", state("70", "°F", reported.Add(-3*time.Hour)), 0, ErrStale},
+		{"bad unit", state("70", "%", reported), 0, nil},
+		{"not a number", state("warm", "°F", reported), 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(newFakeHA(t, tt.resp))
+			temp, err := c.GetTemperature(context.Background())
+
+			if tt.want != 0 {
+				if err != nil || temp < tt.want-0.01 || temp > tt.want+0.01 {
+					t.Errorf("Expected %.1f°F, got %.2f (%v)", tt.want, temp, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected an error, got %.1f", temp)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	ha := newFakeHA(t,
+		fakeResponse{http.StatusBadGateway, "bad gateway"},
+		fakeResponse{http.StatusServiceUnavailable, "starting"},
+		state("72", "°F", time.Date(2026, 3, 14, 8, 59, 0, 0, time.UTC)),
+	)
+	c, _ := newTestClient(ha)
+
+	temp, err := c.GetTemperature(context.Background())
+	if err != nil || temp != 72 {
+		t.Fatalf("Expected 72 after retries, got %.1f (%v)", temp, err)
+	}
+	if ha.count() != 3 {
+		t.Errorf("Expected 3 requests, got %d", ha.count())
+	}
+
+	// A rejected token won't get better by asking again
+	ha2 := newFakeHA(t, fakeResponse{http.StatusUnauthorized, "401: Unauthorized"})
+	c2, _ := newTestClient(ha2)
+	if _, err := c2.GetTemperature(context.Background()); err == nil {
+		t.Error("Expected an error for a rejected token")
+	}
+	if ha2.count() != 1 {
+		t.Errorf("Expected no retries for 401, got %d requests", ha2.count())
+	}
+}
+
+func TestCacheAndFallback(t *testing.T) {
+	ha := newFakeHA(t, state("70", "°F", time.Date(2026, 3, 14, 8, 59, 0, 0, time.UTC)))
+	c, now := newTestClient(ha)
+
+	// Readings are reused for CacheTTL
+	for i := 0; i < 3; i++ {
+		if temp, err := c.GetTemperature(context.Background()); err != nil || temp != 70 {
+			t.Fatalf("Expected 70, got %.1f (%v)", temp, err)
+		}
+	}
+	if ha.count() != 1 {
+		t.Errorf("Expected 1 request while cached, got %d", ha.count())
+	}
+
+	// Once Home Assistant fails, the last reading stands in until MaxCacheAge
+	ha.respond(fakeResponse{http.StatusInternalServerError, "boom"})
+	*now = now.Add(5 * time.Minute)
+	reading, err := c.Read(context.Background())
+	if err != nil || reading.TempF != 70 {
+		t.Fatalf("Expected the cached 70, got %+v (%v)", reading, err)
+	}
+	status := c.Status()
+	if status.State != "cached" || status.Healthy || status.AgeSeconds != 300 || status.LastError == "" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	*now = now.Add(MaxCacheAge)
+	if _, err := c.GetTemperature(context.Background()); err == nil {
+		t.Error("Expected an error once the cached reading is too old")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ha := newFakeHA(t, fakeResponse{http.StatusBadGateway, "down"})
+	c, now := newTestClient(ha)
+
+	for i := 0; i < breakerThreshold; i++ {
+		if _, err := c.GetTemperature(context.Background()); err == nil {
+			t.Fatal("Expected an error while Home Assistant is down")
+		}
+	}
+	if ha.count() != breakerThreshold*maxAttempts {
+		t.Errorf("Expected %d requests, got %d", breakerThreshold*maxAttempts, ha.count())
+	}
+
+	// The open circuit answers without contacting Home Assistant
+	_, err := c.GetTemperature(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if ha.count() != breakerThreshold*maxAttempts {
+		t.Errorf("Expected no requests while open, got %d", ha.count())
+	}
+	if status := c.Status(); status.State != "circuit-open" || status.RetryAt == nil || status.Failures != breakerThreshold {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// After the cooldown a request goes through, and success closes the circuit
+	ha.respond(state("68", "°F", now.Add(breakerCooldown)))
+	*now = now.Add(breakerCooldown)
+	if temp, err := c.GetTemperature(context.Background()); err != nil || temp != 68 {
+		t.Fatalf("Expected 68 after the cooldown, got %.1f (%v)", temp, err)
+	}
+	if status := c.Status(); status.State != "ok" || !status.Healthy || status.Failures != 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	ha := newFakeHA(t, fakeResponse{http.StatusOK, "{}"})
+	c, _ := newTestClient(ha)
+	ha.Close()
+
+	if _, err := c.GetTemperature(context.Background()); err == nil {
+		t.Fatal("Expected an error for an unreachable server")
+	}
+	if status := c.Status(); status.State != "error" || status.Failures != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Disabled clients stay quiet
+	disabled := New("", "", "")
+	if temp, err := disabled.GetTemperature(context.Background()); temp != 0 || err != nil {
+		t.Errorf("Expected 0 and no error when disabled, got %.1f (%v)", temp, err)
+	}
+	if status := disabled.Status(); status.State != "disabled" {
+		t.Errorf("Expected disabled, got %+v", status)
+	}
+}
@@ -0,0 +1,271 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// Format identifies an export file format
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+	FormatPDF  Format = "pdf"
+)
+
+// ParseFormat validates a format name, defaulting to JSON when empty
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "":
+		return FormatJSON, nil
+	case FormatCSV, FormatJSON, FormatPDF:
+		return Format(name), nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s (use csv, json or pdf)", name)
+	}
+}
+
+// ContentType returns the MIME type for a format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatPDF:
+		return "application/pdf"
+	default:
+		return "application/json"
+	}
+}
+
+// Span is the time between two workflow events, used for duration columns
+type Span struct {
+	Name string
+	From models.EventType
+	To   []models.EventType // First of these after From ends the span
+}
+
+// Spans are the workflow spans reported in summaries, in bake order
+var Spans = []Span{
+	{"levain", models.EventFed, []models.EventType{models.EventLevainReady}},
+	{"bulk", models.EventMixed, []models.EventType{models.EventShaped}},
+	{"proof", models.EventShaped, []models.EventType{models.EventFridgeIn, models.EventOvenIn}},
+	{"cold_retard", models.EventFridgeIn, []models.EventType{models.EventFridgeOut, models.EventOvenIn}},
+	{"bake", models.EventOvenIn, []models.EventType{models.EventOvenOut}},
+}
+
+// Summary is a one-row overview of a bake
+type Summary struct {
+	Date          string
+	Start         time.Time
+	End           time.Time // Zero if the bake is not complete
+	Total         time.Duration
+	SpanDurations map[string]time.Duration
+	EventCount    int
+	FoldCount     int
+	MinTempF      *float64
+	MaxTempF      *float64
+	AvgTempF      *float64
+	Assessment    *models.Assessment
+}
+
+// Summarize computes span durations and temperature statistics for a bake
+func Summarize(bake *models.Bake) Summary {
+	summary := Summary{
+		Date:          bake.Date,
+		SpanDurations: make(map[string]time.Duration),
+		EventCount:    len(bake.Events),
+		Assessment:    bake.Assessment,
+	}
+	if bake.Filename != "" {
+		summary.Date = strings.TrimPrefix(bake.Filename, "bake_")
+	}
+
+	if len(bake.Events) == 0 {
+		return summary
+	}
+
+	first := bake.Events[0]
+	last := bake.Events[len(bake.Events)-1]
+	summary.Start = first.Timestamp
+	summary.Total = last.Timestamp.Sub(first.Timestamp)
+	if last.Event == models.EventLoafComplete {
+		summary.End = last.Timestamp
+	}
+
+	for _, span := range Spans {
+		if d, ok := spanDuration(bake.Events, span); ok {
+			summary.SpanDurations[span.Name] = d
+		}
+	}
+
+	var sum float64
+	var count int
+	for _, event := range bake.Events {
+		if event.Event == models.EventFold {
+			summary.FoldCount++
+		}
+		if event.TempF == nil {
+			continue
+		}
+		temp := *event.TempF
+		if summary.MinTempF == nil || temp < *summary.MinTempF {
+			summary.MinTempF = &temp
+		}
+		if summary.MaxTempF == nil || temp > *summary.MaxTempF {
+			summary.MaxTempF = &temp
+		}
+		sum += temp
+		count++
+	}
+	if count > 0 {
+		avg := sum / float64(count)
+		summary.AvgTempF = &avg
+	}
+
+	return summary
+}
+
+// spanDuration finds the first From event and the first matching To event after it
+func spanDuration(events []models.Event, span Span) (time.Duration, bool) {
+	for i, event := range events {
+		if event.Event != span.From {
+			continue
+		}
+		for _, later := range events[i+1:] {
+			for _, to := range span.To {
+				if later.Event == to {
+					return later.Timestamp.Sub(event.Timestamp), true
+				}
+			}
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// WriteBakeJSON writes a single bake as indented JSON
+func WriteBakeJSON(w io.Writer, bake *models.Bake) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bake)
+}
+
+// WriteBakeCSV writes a single bake as CSV with one row per event
+func WriteBakeCSV(w io.Writer, bake *models.Bake) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"timestamp", "event", "elapsed_minutes", "temp_f", "dough_temp_f", "oven_temp_f", "fold_count", "note", "image"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, event := range bake.Events {
+		elapsed := strconv.FormatFloat(event.Timestamp.Sub(bake.Events[0].Timestamp).Minutes(), 'f', 0, 64)
+
+		fold := ""
+		if event.FoldCount != nil {
+			fold = strconv.Itoa(*event.FoldCount)
+		}
+
+		record := []string{
+			event.Timestamp.Format(time.RFC3339),
+			string(event.Event),
+			elapsed,
+			formatTemp(event.TempF),
+			formatTemp(event.DoughTempF),
+			formatTemp(event.OvenTempF),
+			fold,
+			event.Note,
+			event.Image,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteHistoryCSV writes one row per bake with span durations and the assessment
+func WriteHistoryCSV(w io.Writer, bakes []*models.Bake) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"date", "start", "end", "completed", "total_hours"}
+	for _, span := range Spans {
+		header = append(header, span.Name+"_hours")
+	}
+	header = append(header, "event_count", "fold_count", "min_temp_f", "max_temp_f", "avg_temp_f",
+		"score", "proof_level", "crumb_quality", "browning", "assessment_notes")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, bake := range bakes {
+		summary := Summarize(bake)
+		if summary.EventCount == 0 {
+			continue
+		}
+
+		end := ""
+		if !summary.End.IsZero() {
+			end = summary.End.Format(time.RFC3339)
+		}
+
+		record := []string{
+			summary.Date,
+			summary.Start.Format(time.RFC3339),
+			end,
+			strconv.FormatBool(!summary.End.IsZero()),
+			formatHours(summary.Total),
+		}
+		for _, span := range Spans {
+			if d, ok := summary.SpanDurations[span.Name]; ok {
+				record = append(record, formatHours(d))
+			} else {
+				record = append(record, "")
+			}
+		}
+		record = append(record,
+			strconv.Itoa(summary.EventCount),
+			strconv.Itoa(summary.FoldCount),
+			formatTemp(summary.MinTempF),
+			formatTemp(summary.MaxTempF),
+			formatTemp(summary.AvgTempF),
+		)
+
+		if a := summary.Assessment; a != nil {
+			record = append(record, strconv.Itoa(a.Score), string(a.ProofLevel), strconv.Itoa(a.CrumbQuality), string(a.Browning), a.Notes)
+		} else {
+			record = append(record, "", "", "", "", "")
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatTemp formats an optional temperature with one decimal place
+func formatTemp(temp *float64) string {
+	if temp == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*temp, 'f', 1, 64)
+}
+
+// formatHours formats a duration as decimal hours
+func formatHours(d time.Duration) string {
+	return strconv.FormatFloat(d.Hours(), 'f', 2, 64)
+}
@@ -0,0 +1,173 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+func testBake() *models.Bake {
+	start := time.Date(2025, 10, 7, 8, 0, 0, 0, time.UTC)
+	temp := func(v float64) *float64 { return &v }
+	fold := func(n int) *int { return &n }
+
+	return &models.Bake{
+		Date:     "2025-10-07",
+		Filename: "bake_2025-10-07_08-00-00",
+		Events: []models.Event{
+			{Timestamp: start, Event: models.EventStarterOut, TempF: temp(70)},
+			{Timestamp: start.Add(1 * time.Hour), Event: models.EventFed, TempF: temp(72)},
+			{Timestamp: start.Add(5 * time.Hour), Event: models.EventLevainReady},
+			{Timestamp: start.Add(6 * time.Hour), Event: models.EventMixed, DoughTempF: temp(78)},
+			{Timestamp: start.Add(7 * time.Hour), Event: models.EventFold, FoldCount: fold(1)},
+			{Timestamp: start.Add(8 * time.Hour), Event: models.EventFold, FoldCount: fold(2)},
+			{Timestamp: start.Add(10 * time.Hour), Event: models.EventShaped, TempF: temp(74)},
+			{Timestamp: start.Add(11 * time.Hour), Event: models.EventFridgeIn},
+			{Timestamp: start.Add(23 * time.Hour), Event: models.EventOvenIn, OvenTempF: temp(500)},
+			{Timestamp: start.Add(24 * time.Hour), Event: models.EventOvenOut, Note: "Great ear", Image: "crumb.png"},
+			{Timestamp: start.Add(26 * time.Hour), Event: models.EventLoafComplete},
+		},
+		Assessment: &models.Assessment{ProofLevel: models.ProofGood, CrumbQuality: 8, Browning: models.BrowningGood, Score: 9, Notes: "Open crumb"},
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := Summarize(testBake())
+
+	if summary.Date != "2025-10-07_08-00-00" {
+		t.Errorf("Expected date from filename, got %s", summary.Date)
+	}
+	if summary.FoldCount != 2 {
+		t.Errorf("Expected 2 folds, got %d", summary.FoldCount)
+	}
+	if summary.End.IsZero() {
+		t.Error("Expected completed bake to have an end time")
+	}
+
+	wantSpans := map[string]time.Duration{
+		"levain":      4 * time.Hour,
+		"bulk":        4 * time.Hour,
+		"proof":       1 * time.Hour,
+		"cold_retard": 12 * time.Hour,
+		"bake":        1 * time.Hour,
+	}
+	for name, want := range wantSpans {
+		if got := summary.SpanDurations[name]; got != want {
+			t.Errorf("Span %s: expected %s, got %s", name, want, got)
+		}
+	}
+
+	if summary.MinTempF == nil || *summary.MinTempF != 70 || *summary.MaxTempF != 74 {
+		t.Errorf("Unexpected kitchen temperature range: %v-%v", summary.MinTempF, summary.MaxTempF)
+	}
+}
+
+func TestWriteHistoryCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHistoryCSV(&buf, []*models.Bake{testBake(), {Date: "empty"}}); err != nil {
+		t.Fatalf("WriteHistoryCSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	// Header plus one row; bakes without events are skipped
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(records))
+	}
+
+	row := map[string]string{}
+	for i, column := range records[0] {
+		row[column] = records[1][i]
+	}
+
+	if row["bulk_hours"] != "4.00" {
+		t.Errorf("Expected bulk_hours 4.00, got %s", row["bulk_hours"])
+	}
+	if row["score"] != "9" || row["proof_level"] != "good" {
+		t.Errorf("Expected assessment columns, got score=%s proof=%s", row["score"], row["proof_level"])
+	}
+}
+
+func TestWriteBakeCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBakeCSV(&buf, testBake()); err != nil {
+		t.Fatalf("WriteBakeCSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	if len(records) != 12 {
+		t.Errorf("Expected header plus 11 events, got %d rows", len(records))
+	}
+}
+
+func TestWriteBakePDF(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-export-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Write a small photo for the oven-out event
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for x := 0; x < 40; x++ {
+		img.Set(x, 15, color.RGBA{200, 120, 40, 255})
+	}
+	f, err := os.Create(filepath.Join(tmpDir, "crumb.png"))
+	if err != nil {
+		t.Fatalf("Failed to create image: %v", err)
+	}
+	png.Encode(f, img)
+	f.Close()
+
+	var buf bytes.Buffer
+	err = WriteBakePDF(&buf, testBake(), func(filename string) string {
+		return filepath.Join(tmpDir, filename)
+	})
+	if err != nil {
+		t.Fatalf("WriteBakePDF failed: %v", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "%PDF") {
+		t.Error("Expected PDF output")
+	}
+	if !strings.Contains(buf.String(), "/Subtype /Image") {
+		t.Error("Expected photo to be embedded in PDF")
+	}
+
+	// An image name can't reach outside the bake's image directory
+	bake := testBake()
+	bake.Events[len(bake.Events)-2].Image = "../outside/crumb.png"
+	var asked []string
+	WriteBakePDF(&bytes.Buffer{}, bake, func(filename string) string {
+		asked = append(asked, filename)
+		return filepath.Join(tmpDir, filename)
+	})
+	if len(asked) != 1 || asked[0] != "crumb.png" {
+		t.Errorf("Expected only the file name looked up, got %v", asked)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatJSON {
+		t.Errorf("Expected empty format to default to json, got %s (%v)", f, err)
+	}
+	if _, err := ParseFormat("xlsx"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
@@ -0,0 +1,326 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// WriteBakePDF writes a printable bake report with the timeline, a temperature
+// chart, the assessment and any photos. imagePath maps an event's image
+// filename to its location on disk.
+func WriteBakePDF(w io.Writer, bake *models.Bake, imagePath func(filename string) string) error {
+	pdf := gofpdf.New("P", "mm", "Letter", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.SetAutoPageBreak(true, 15)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.AddPage()
+
+	summary := Summarize(bake)
+
+	// Title
+	pdf.SetFont("Arial", "B", 16)
+	pdf.Cell(0, 8, fmt.Sprintf("Sourdough Bake Report - %s", summary.Date))
+	pdf.Ln(10)
+
+	// Overview
+	pdf.SetFont("Arial", "", 10)
+	if !summary.Start.IsZero() {
+		pdf.Cell(0, 5, "Started: "+summary.Start.Format("Mon Jan 2, 2006 3:04 PM"))
+		pdf.Ln(5)
+	}
+	if !summary.End.IsZero() {
+		pdf.Cell(0, 5, "Completed: "+summary.End.Format("Mon Jan 2, 2006 3:04 PM"))
+		pdf.Ln(5)
+	}
+	pdf.Cell(0, 5, fmt.Sprintf("Total time: %s  |  Events: %d  |  Folds: %d", formatDuration(summary.Total), summary.EventCount, summary.FoldCount))
+	pdf.Ln(5)
+	for _, span := range Spans {
+		if d, ok := summary.SpanDurations[span.Name]; ok {
+			pdf.Cell(0, 5, fmt.Sprintf("%s: %s", spanLabel(span.Name), formatDuration(d)))
+			pdf.Ln(5)
+		}
+	}
+	pdf.Ln(3)
+
+	// Assessment
+	if a := bake.Assessment; a != nil {
+		sectionHeading(pdf, "Assessment")
+		pdf.SetFont("Arial", "", 10)
+		pdf.Cell(0, 5, fmt.Sprintf("Score: %d/10  |  Proof: %s  |  Crumb: %d/10  |  Browning: %s", a.Score, a.ProofLevel, a.CrumbQuality, a.Browning))
+		pdf.Ln(5)
+		if a.Notes != "" {
+			pdf.MultiCell(0, 5, tr("Notes: "+a.Notes), "", "L", false)
+		}
+		pdf.Ln(3)
+	}
+
+	// Temperatures
+	if hasTemperatures(bake) {
+		sectionHeading(pdf, "Temperatures")
+		drawTemperatureChart(pdf, bake, tr)
+		pdf.Ln(3)
+	}
+
+	// Timeline
+	sectionHeading(pdf, "Timeline")
+	pdf.SetFont("Arial", "B", 8)
+	pdf.SetFillColor(230, 230, 230)
+	pdf.CellFormat(32, 5, "Time", "1", 0, "C", true, 0, "")
+	pdf.CellFormat(16, 5, "Elapsed", "1", 0, "C", true, 0, "")
+	pdf.CellFormat(28, 5, "Event", "1", 0, "C", true, 0, "")
+	pdf.CellFormat(40, 5, "Temperatures", "1", 0, "C", true, 0, "")
+	pdf.CellFormat(80, 5, "Note", "1", 0, "C", true, 0, "")
+	pdf.Ln(-1)
+
+	pdf.SetFont("Arial", "", 7)
+	for _, event := range bake.Events {
+		note := event.Note
+		if runes := []rune(note); len(runes) > 70 {
+			note = string(runes[:67]) + "..."
+		}
+		pdf.CellFormat(32, 5, event.Timestamp.Format("Jan 2 3:04 PM"), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(16, 5, formatDuration(event.Timestamp.Sub(summary.Start)), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(28, 5, eventLabel(event), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(40, 5, tr(eventTemps(event)), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(80, 5, tr(note), "1", 0, "L", false, 0, "")
+		pdf.Ln(-1)
+	}
+
+	// Photos
+	photos := 0
+	for _, event := range bake.Events {
+		if event.Image == "" {
+			continue
+		}
+		// Only ever the bake's own image directory, whatever the event says
+		data, err := os.ReadFile(imagePath(filepath.Base(event.Image)))
+		if err != nil {
+			continue
+		}
+		imageType := imageTypeFor(data)
+		if imageType == "" {
+			continue
+		}
+
+		if photos == 0 {
+			pdf.AddPage()
+			sectionHeading(pdf, "Photos")
+		}
+		photos++
+
+		name := event.Image
+		info := pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+		if pdf.Err() {
+			// Skip images gofpdf can't decode rather than failing the whole report
+			pdf.ClearError()
+			continue
+		}
+
+		// Scale to fit a 120x100mm box, one photo per row
+		width := 120.0
+		height := width * info.Height() / info.Width()
+		if height > 100 {
+			height = 100
+			width = height * info.Width() / info.Height()
+		}
+
+		if pdf.GetY()+height+10 > 265 {
+			pdf.AddPage()
+		}
+		y := pdf.GetY()
+
+		pdf.ImageOptions(name, 10, y, width, height, false, gofpdf.ImageOptions{ImageType: imageType}, 0, "")
+		pdf.SetXY(10, y+height+1)
+		pdf.SetFont("Arial", "", 8)
+		pdf.CellFormat(0, 4, tr(event.Timestamp.Format("Jan 2 3:04 PM")+"  "+event.Note), "", 0, "L", false, 0, "")
+		pdf.SetXY(10, y+height+8)
+	}
+
+	return pdf.Output(w)
+}
+
+// sectionHeading writes a bold section title
+func sectionHeading(pdf *gofpdf.Fpdf, title string) {
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 7, title)
+	pdf.Ln(8)
+}
+
+// drawTemperatureChart plots kitchen and dough readings over the bake
+func drawTemperatureChart(pdf *gofpdf.Fpdf, bake *models.Bake, tr func(string) string) {
+	const (
+		chartX = 20.0
+		chartW = 180.0
+		chartH = 50.0
+	)
+	chartY := pdf.GetY()
+
+	series := []struct {
+		label   string
+		r, g, b int
+		value   func(models.Event) *float64
+	}{
+		{"Kitchen", 59, 130, 246, func(e models.Event) *float64 { return e.TempF }},
+		{"Dough", 234, 88, 12, func(e models.Event) *float64 { return e.DoughTempF }},
+	}
+
+	// Determine the value and time ranges
+	start := bake.Events[0].Timestamp
+	span := bake.Events[len(bake.Events)-1].Timestamp.Sub(start)
+	if span <= 0 {
+		span = time.Minute
+	}
+	minTemp, maxTemp := 1000.0, -1000.0
+	for _, event := range bake.Events {
+		for _, s := range series {
+			if v := s.value(event); v != nil {
+				if *v < minTemp {
+					minTemp = *v
+				}
+				if *v > maxTemp {
+					maxTemp = *v
+				}
+			}
+		}
+	}
+	if maxTemp-minTemp < 4 {
+		minTemp -= 2
+		maxTemp += 2
+	}
+
+	// Axes and labels
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.Rect(chartX, chartY, chartW, chartH, "D")
+	pdf.SetFont("Arial", "", 7)
+	pdf.SetXY(chartX-12, chartY-2)
+	pdf.CellFormat(11, 4, tr(fmt.Sprintf("%.0f°F", maxTemp)), "", 0, "R", false, 0, "")
+	pdf.SetXY(chartX-12, chartY+chartH-2)
+	pdf.CellFormat(11, 4, tr(fmt.Sprintf("%.0f°F", minTemp)), "", 0, "R", false, 0, "")
+	pdf.SetXY(chartX, chartY+chartH+1)
+	pdf.CellFormat(chartW/2, 4, start.Format("Jan 2 3:04 PM"), "", 0, "L", false, 0, "")
+	pdf.CellFormat(chartW/2, 4, start.Add(span).Format("Jan 2 3:04 PM"), "", 0, "R", false, 0, "")
+
+	point := func(t time.Time, v float64) (float64, float64) {
+		x := chartX + chartW*float64(t.Sub(start))/float64(span)
+		y := chartY + chartH - chartH*(v-minTemp)/(maxTemp-minTemp)
+		return x, y
+	}
+
+	legendX := chartX
+	for _, s := range series {
+		pdf.SetDrawColor(s.r, s.g, s.b)
+		pdf.SetFillColor(s.r, s.g, s.b)
+		pdf.SetLineWidth(0.5)
+
+		var prevX, prevY float64
+		havePrev := false
+		for _, event := range bake.Events {
+			v := s.value(event)
+			if v == nil {
+				continue
+			}
+			x, y := point(event.Timestamp, *v)
+			if havePrev {
+				pdf.Line(prevX, prevY, x, y)
+			}
+			pdf.Circle(x, y, 0.8, "F")
+			prevX, prevY, havePrev = x, y, true
+		}
+
+		// Legend entry
+		pdf.Rect(legendX, chartY+chartH+6, 3, 3, "F")
+		pdf.SetXY(legendX+4, chartY+chartH+5.5)
+		pdf.CellFormat(20, 4, s.label, "", 0, "L", false, 0, "")
+		legendX += 25
+	}
+
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetXY(10, chartY+chartH+11)
+}
+
+// hasTemperatures reports whether the bake has any kitchen or dough readings
+func hasTemperatures(bake *models.Bake) bool {
+	for _, event := range bake.Events {
+		if event.TempF != nil || event.DoughTempF != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// eventLabel returns the event name with fold count when present
+func eventLabel(event models.Event) string {
+	if event.FoldCount != nil {
+		return fmt.Sprintf("%s #%d", event.Event, *event.FoldCount)
+	}
+	return string(event.Event)
+}
+
+// eventTemps formats the temperatures recorded on an event
+func eventTemps(event models.Event) string {
+	temps := ""
+	if event.TempF != nil {
+		temps += fmt.Sprintf("kitchen %.1f°F ", *event.TempF)
+	}
+	if event.DoughTempF != nil {
+		temps += fmt.Sprintf("dough %.1f°F ", *event.DoughTempF)
+	}
+	if event.OvenTempF != nil {
+		temps += fmt.Sprintf("oven %.0f°F ", *event.OvenTempF)
+	}
+	if event.FridgeTempF != nil {
+		temps += fmt.Sprintf("fridge %.1f°F", *event.FridgeTempF)
+	}
+	return temps
+}
+
+// spanLabel turns a span name into a heading
+func spanLabel(name string) string {
+	switch name {
+	case "levain":
+		return "Levain"
+	case "bulk":
+		return "Bulk ferment"
+	case "proof":
+		return "Proof"
+	case "cold_retard":
+		return "Cold retard"
+	case "bake":
+		return "Bake"
+	default:
+		return name
+	}
+}
+
+// imageTypeFor returns the gofpdf image type for JPEG and PNG data, or "" if unsupported
+func imageTypeFor(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return "JPG"
+	case "image/png":
+		return "PNG"
+	default:
+		return ""
+	}
+}
+
+// formatDuration formats a duration as "XhYm"
+func formatDuration(d time.Duration) string {
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
@@ -0,0 +1,81 @@
+// Package homeassistant publishes entity states to Home Assistant's REST API
+package homeassistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 5 * time.Second
+
+// State is an entity's state and attributes, as shown in Home Assistant
+type State struct {
+	State      string                 `json:"state"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Client sets entity states through POST /api/states/<entity_id>. States set
+// this way aren't saved by Home Assistant, so publish again after it restarts.
+type Client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+	enabled bool
+}
+
+// New creates a client; it is disabled unless both baseURL and token are set
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: requestTimeout},
+		enabled: baseURL != "" && token != "",
+	}
+}
+
+// IsEnabled returns whether Home Assistant is configured
+func (c *Client) IsEnabled() bool {
+	return c.enabled
+}
+
+// SetState creates or updates an entity such as sensor.sourdough_stage
+func (c *Client) SetState(ctx context.Context, entityID string, state State) error {
+	if !c.enabled {
+		return nil
+	}
+
+	body, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/states/%s", c.baseURL, entityID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %w", entityID, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	// 201 when the entity is new, 200 when it was updated
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("home assistant rejected the token (status %d)", resp.StatusCode)
+	}
+	return fmt.Errorf("failed to set %s: unexpected status code: %d", entityID, resp.StatusCode)
+}
@@ -0,0 +1,58 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetState(t *testing.T) {
+	var got State
+	var path, auth string
+	ha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ha.Close()
+
+	c := New(ha.URL+"/", "token")
+	err := c.SetState(context.Background(), "sensor.sourdough_stage", State{
+		State:      "bulk",
+		Attributes: map[string]interface{}{"friendly_name": "Sourdough stage"},
+	})
+	if err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	if path != "/api/states/sensor.sourdough_stage" || auth != "Bearer token" {
+		t.Errorf("Unexpected request to %s with %q", path, auth)
+	}
+	if got.State != "bulk" || got.Attributes["friendly_name"] != "Sourdough stage" {
+		t.Errorf("Unexpected state %+v", got)
+	}
+}
+
+func TestSetStateErrors(t *testing.T) {
+	ha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "401: Unauthorized", http.StatusUnauthorized)
+	}))
+	defer ha.Close()
+
+	if err := New(ha.URL, "bad").SetState(context.Background(), "sensor.x", State{State: "1"}); err == nil {
+		t.Error("Expected an error for a rejected token")
+	}
+
+	// Disabled clients do nothing
+	c := New("", "")
+	if c.IsEnabled() {
+		t.Error("Expected a client without a URL to be disabled")
+	}
+	if err := c.SetState(context.Background(), "sensor.x", State{State: "1"}); err != nil {
+		t.Errorf("Expected no error when disabled, got %v", err)
+	}
+}
@@ -0,0 +1,446 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// dateTimeLayouts are the full timestamp formats accepted in CSV cells
+var dateTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02 3:04 PM",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"1/2/2006 3:04 PM",
+	"1/2/2006 3:04:05 PM",
+}
+
+// dateLayouts are the formats accepted in a separate date column
+var dateLayouts = []string{
+	"2006-01-02",
+	"1/2/2006",
+	"1/2/06",
+}
+
+// timeLayouts are the time-of-day formats accepted when a date column is present
+var timeLayouts = []string{
+	"15:04",
+	"15:04:05",
+	"3:04 PM",
+	"3:04PM",
+	"3:04 pm",
+	"3:04pm",
+}
+
+// columnAliases maps common spreadsheet headings to canonical column names
+var columnAliases = map[string]string{
+	"time":             "timestamp",
+	"datetime":         "timestamp",
+	"type":             "event",
+	"bake-id":          "bake",
+	"loaf":             "bake",
+	"temp":             "temp-f",
+	"kitchen-temp":     "temp-f",
+	"kitchen-temp-f":   "temp-f",
+	"dough-temp":       "dough-temp-f",
+	"oven-temp":        "oven-temp-f",
+	"notes":            "note",
+	"proof":            "proof-level",
+	"crumb":            "crumb-quality",
+	"rating":           "score",
+	"assessment-notes": "assessment-note",
+	"tasting-notes":    "assessment-note",
+}
+
+// ParseCSV reads bakes from a spreadsheet export. Two layouts are supported:
+//
+//   - One row per event, with an "event" column plus "timestamp" (or "date" and
+//     "time"), optional temp_f, dough_temp_f, oven_temp_f and note columns, and an
+//     optional "bake" column to group rows. Without it, loaf-complete ends a bake.
+//   - One row per bake, with a column per event type ("fed", "mixed", "Oven In",
+//     ...) holding its timestamp, or a time of day when a "date" column is present.
+//     Several times can be separated by ";" (e.g. for folds).
+//
+// Either layout may carry score, proof_level, crumb_quality, browning and
+// assessment_notes columns; in the event layout they belong on the loaf-complete row.
+func ParseCSV(r io.Reader, source string) *Parsed {
+	parsed := &Parsed{}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: 1, Err: fmt.Sprintf("failed to read header: %v", err)})
+		return parsed
+	}
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = normalizeColumn(name)
+	}
+
+	var rows []csvRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: line, Err: err.Error()})
+			continue
+		}
+
+		row := csvRow{line: line, values: make(map[string]string)}
+		empty := true
+		for i, value := range record {
+			if i >= len(columns) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			if value != "" {
+				row.values[columns[i]] = value
+				empty = false
+			}
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+
+	if contains(columns, "event") {
+		parseEventRows(parsed, source, rows)
+	} else {
+		parseBakeRows(parsed, source, columns, rows)
+	}
+
+	return parsed
+}
+
+// csvRow is a non-empty CSV record keyed by normalized column name
+type csvRow struct {
+	line   int
+	values map[string]string
+}
+
+// parseEventRows handles the one-row-per-event layout
+func parseEventRows(parsed *Parsed, source string, rows []csvRow) {
+	type group struct {
+		row  int
+		bake *models.Bake
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	var current *group
+
+	for _, row := range rows {
+		event, err := eventFromRow(row)
+		if err != nil {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: row.line, Err: err.Error()})
+			continue
+		}
+
+		assessment, err := assessmentFromRow(row)
+		if err != nil {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: row.line, Err: err.Error()})
+			continue
+		}
+
+		// Pick the bake this row belongs to
+		var g *group
+		if key := row.values["bake"]; key != "" {
+			g = byKey[key]
+			if g == nil {
+				g = &group{row: row.line, bake: &models.Bake{}}
+				byKey[key] = g
+				groups = append(groups, g)
+			}
+		} else {
+			if current == nil {
+				current = &group{row: row.line, bake: &models.Bake{}}
+				groups = append(groups, current)
+			}
+			g = current
+		}
+
+		g.bake.Events = append(g.bake.Events, *event)
+		if assessment != nil {
+			g.bake.Assessment = assessment
+		}
+
+		if event.Event == models.EventLoafComplete && row.values["bake"] == "" {
+			current = nil
+		}
+	}
+
+	for _, g := range groups {
+		sortEvents(g.bake)
+		parsed.Candidates = append(parsed.Candidates, Candidate{Source: source, Row: g.row, Bake: g.bake})
+	}
+}
+
+// eventFromRow builds an event from the event layout's columns
+func eventFromRow(row csvRow) (*models.Event, error) {
+	eventType := normalizeEventType(row.values["event"])
+	if !validEventTypes[eventType] {
+		return nil, fmt.Errorf("unknown event type: %q", row.values["event"])
+	}
+
+	var base time.Time
+	if dateStr := row.values["date"]; dateStr != "" {
+		d, err := parseDate(dateStr)
+		if err != nil {
+			return nil, err
+		}
+		base = d
+	}
+
+	value := row.values["timestamp"]
+	if value == "" {
+		return nil, fmt.Errorf("missing timestamp")
+	}
+	timestamp, err := parseTimestamp(value, base, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	event := &models.Event{Timestamp: timestamp, Event: eventType, Note: row.values["note"]}
+	if err := applyTemps(event, row); err != nil {
+		return nil, err
+	}
+
+	if eventType == models.EventFold {
+		if count := row.values["fold-count"]; count != "" {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fold count: %q", count)
+			}
+			event.FoldCount = &n
+		}
+	}
+
+	return event, nil
+}
+
+// parseBakeRows handles the one-row-per-bake layout
+func parseBakeRows(parsed *Parsed, source string, columns []string, rows []csvRow) {
+	var eventColumns []string
+	for _, column := range columns {
+		if validEventTypes[normalizeEventType(column)] && column != "note" && column != "temperature" {
+			eventColumns = append(eventColumns, column)
+		}
+	}
+
+	if len(eventColumns) == 0 {
+		parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: 1, Err: "no event or event-type columns found in header"})
+		return
+	}
+
+	for _, row := range rows {
+		bake, err := bakeFromRow(row, eventColumns)
+		if err != nil {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: row.line, Err: err.Error()})
+			continue
+		}
+		parsed.Candidates = append(parsed.Candidates, Candidate{Source: source, Row: row.line, Bake: bake})
+	}
+}
+
+// bakeFromRow builds a whole bake from one row of the bake layout
+func bakeFromRow(row csvRow, eventColumns []string) (*models.Bake, error) {
+	var base time.Time
+	if dateStr := row.values["date"]; dateStr != "" {
+		d, err := parseDate(dateStr)
+		if err != nil {
+			return nil, err
+		}
+		base = d
+	}
+
+	bake := &models.Bake{}
+	var prev time.Time
+	folds := 0
+	for _, column := range eventColumns {
+		value := row.values[column]
+		if value == "" {
+			continue
+		}
+
+		eventType := normalizeEventType(column)
+		for _, part := range strings.Split(value, ";") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			timestamp, err := parseTimestamp(part, base, prev)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", column, err)
+			}
+			prev = timestamp
+
+			event := models.Event{Timestamp: timestamp, Event: eventType}
+			if eventType == models.EventFold {
+				folds++
+				count := folds
+				event.FoldCount = &count
+			}
+			bake.Events = append(bake.Events, event)
+		}
+	}
+
+	if len(bake.Events) == 0 {
+		return nil, fmt.Errorf("no event timestamps")
+	}
+
+	sortEvents(bake)
+
+	// Bake-level temperatures and notes go on the first event
+	if err := applyTemps(&bake.Events[0], row); err != nil {
+		return nil, err
+	}
+	bake.Events[0].Note = row.values["note"]
+
+	assessment, err := assessmentFromRow(row)
+	if err != nil {
+		return nil, err
+	}
+	bake.Assessment = assessment
+
+	return bake, nil
+}
+
+// assessmentFromRow reads the optional assessment columns; nil if there is no score
+func assessmentFromRow(row csvRow) (*models.Assessment, error) {
+	scoreStr := row.values["score"]
+	if scoreStr == "" {
+		return nil, nil
+	}
+
+	score, err := strconv.Atoi(scoreStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid score: %q", scoreStr)
+	}
+
+	assessment := &models.Assessment{
+		Score:      score,
+		ProofLevel: models.ProofLevel(strings.ToLower(row.values["proof-level"])),
+		Browning:   models.BrowningLevel(strings.ToLower(row.values["browning"])),
+		Notes:      row.values["assessment-note"],
+	}
+
+	if crumb := row.values["crumb-quality"]; crumb != "" {
+		assessment.CrumbQuality, err = strconv.Atoi(crumb)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crumb quality: %q", crumb)
+		}
+	}
+
+	if err := validateAssessment(assessment); err != nil {
+		return nil, err
+	}
+	return assessment, nil
+}
+
+// applyTemps copies the optional temperature columns onto an event
+func applyTemps(event *models.Event, row csvRow) error {
+	fields := []struct {
+		column string
+		dst    **float64
+	}{
+		{"temp-f", &event.TempF},
+		{"dough-temp-f", &event.DoughTempF},
+		{"oven-temp-f", &event.OvenTempF},
+	}
+
+	for _, field := range fields {
+		value := row.values[field.column]
+		if value == "" {
+			continue
+		}
+		temp, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSuffix(value, "F"), "°"), 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q", strings.ReplaceAll(field.column, "-", "_"), value)
+		}
+		*field.dst = &temp
+	}
+	return nil
+}
+
+// parseTimestamp parses a full timestamp, or a time of day on the base date.
+// Times of day that fall before prev roll over to the next day, so overnight
+// bakes can be entered as plain times.
+func parseTimestamp(value string, base, prev time.Time) (time.Time, error) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	if base.IsZero() {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %q", value)
+	}
+
+	for _, layout := range timeLayouts {
+		clock, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		t := time.Date(base.Year(), base.Month(), base.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.Local)
+		for !prev.IsZero() && t.Before(prev) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time: %q", value)
+}
+
+// parseDate parses a date column value
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %q", value)
+}
+
+// normalizeColumn lowercases a heading, joins words with "-" and applies aliases
+func normalizeColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	name = strings.NewReplacer(" ", "-", "_", "-", "(", "", ")", "", "°", "").Replace(name)
+	if alias, ok := columnAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// sortEvents orders a bake's events by timestamp
+func sortEvents(bake *models.Bake) {
+	sort.SliceStable(bake.Events, func(i, j int) bool {
+		return bake.Events[i].Timestamp.Before(bake.Events[j].Timestamp)
+	})
+}
+
+// contains reports whether list includes value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
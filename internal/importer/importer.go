@@ -0,0 +1,171 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// Format identifies an import file format
+type Format string
+
+const (
+	FormatCSV   Format = "csv"
+	FormatJSONL Format = "jsonl"
+)
+
+// RowError is a validation problem with a single input row
+type RowError struct {
+	Source string `json:"source"`
+	Row    int    `json:"row"` // 1-based line number in the source file, header included
+	Err    string `json:"error"`
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("%s row %d: %s", e.Source, e.Row, e.Err)
+}
+
+// Candidate is a bake parsed from an import file, before it is written
+type Candidate struct {
+	Source string       `json:"source"`
+	Row    int          `json:"row"` // First row the bake was read from
+	Bake   *models.Bake `json:"-"`
+}
+
+// ID returns the bake ID the candidate would be written as
+func (c Candidate) ID() string {
+	return c.Bake.Events[0].Timestamp.Format("2006-01-02_15-04-05")
+}
+
+// Parsed is the result of reading one or more import files
+type Parsed struct {
+	Candidates []Candidate
+	Errors     []RowError
+}
+
+// Report summarizes what an import did (or would do, for a dry run)
+type Report struct {
+	DryRun     bool       `json:"dry_run"`
+	Imported   []string   `json:"imported"`   // IDs of bakes written (or that would be written)
+	Duplicates []string   `json:"duplicates"` // Descriptions of skipped bakes that already exist
+	Errors     []RowError `json:"errors"`
+}
+
+// Import writes parsed bakes to storage, skipping any that duplicate an existing
+// bake (same start minute) or each other. With dryRun set, nothing is written.
+func Import(store storage.Store, parsed *Parsed, dryRun bool) (*Report, error) {
+	report := &Report{
+		DryRun: dryRun,
+		Errors: parsed.Errors,
+	}
+
+	existing, err := existingStarts(store)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range parsed.Candidates {
+		key := startKey(candidate.Bake.Events[0].Timestamp)
+		if id, ok := existing[key]; ok {
+			report.Duplicates = append(report.Duplicates,
+				fmt.Sprintf("%s row %d: bake starting %s already exists (%s)", candidate.Source, candidate.Row, key, id))
+			continue
+		}
+
+		id := candidate.ID()
+		if !dryRun {
+			id, err = store.ImportBake(candidate.Bake)
+			if err != nil {
+				report.Errors = append(report.Errors, RowError{Source: candidate.Source, Row: candidate.Row, Err: err.Error()})
+				continue
+			}
+		}
+
+		existing[key] = id
+		report.Imported = append(report.Imported, id)
+	}
+
+	return report, nil
+}
+
+// existingStarts maps the start minute of every stored bake to its ID
+func existingStarts(store storage.Store) (map[string]string, error) {
+	dates, err := store.ListBakes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bakes: %w", err)
+	}
+
+	starts := make(map[string]string, len(dates))
+	for _, date := range dates {
+		bake, err := store.ReadBake(date)
+		if err != nil || len(bake.Events) == 0 {
+			continue
+		}
+		starts[startKey(bake.Events[0].Timestamp)] = date
+	}
+	return starts, nil
+}
+
+// startKey identifies a bake by its start time to the minute in local time
+func startKey(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// validEventTypes are the event types accepted from import files
+var validEventTypes = map[models.EventType]bool{
+	models.EventStarterOut:   true,
+	models.EventFed:          true,
+	models.EventLevainReady:  true,
+	models.EventMixed:        true,
+	models.EventKnead:        true,
+	models.EventFold:         true,
+	models.EventShaped:       true,
+	models.EventFridgeIn:     true,
+	models.EventFridgeOut:    true,
+	models.EventOvenIn:       true,
+	models.EventRemoveLid:    true,
+	models.EventOvenOut:      true,
+	models.EventLoafComplete: true,
+	models.EventTemperature:  true,
+	models.EventNote:         true,
+}
+
+// normalizeEventType maps spreadsheet-style names ("Oven In", "oven_in") to event types
+func normalizeEventType(name string) models.EventType {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(" ", "-", "_", "-").Replace(name)
+
+	switch name {
+	case "start", "starter":
+		return models.EventStarterOut
+	case "complete", "done":
+		return models.EventLoafComplete
+	case "temp":
+		return models.EventTemperature
+	}
+	return models.EventType(name)
+}
+
+// validateAssessment checks the ranges and enum values of an assessment
+func validateAssessment(a *models.Assessment) error {
+	if a.Score < 1 || a.Score > 10 {
+		return fmt.Errorf("score must be 1-10, got %d", a.Score)
+	}
+	if a.CrumbQuality != 0 && (a.CrumbQuality < 1 || a.CrumbQuality > 10) {
+		return fmt.Errorf("crumb quality must be 1-10, got %d", a.CrumbQuality)
+	}
+	switch a.ProofLevel {
+	case "", models.ProofUnder, models.ProofGood, models.ProofOver:
+	default:
+		return fmt.Errorf("invalid proof level: %s", a.ProofLevel)
+	}
+	switch a.Browning {
+	case "", models.BrowningNone, models.BrowningSlight, models.BrowningGood, models.BrowningOver:
+	default:
+		return fmt.Errorf("invalid browning: %s", a.Browning)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+func setupTestStorage(t *testing.T) (*storage.Storage, string) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-import-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	store, err := storage.New(tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	return store, tmpDir
+}
+
+func TestParseCSVBakeRows(t *testing.T) {
+	input := `Date,Fed,Mixed,Fold,Shaped,Fridge In,Oven In,Oven Out,Score,Proof,Crumb,Browning,Notes
+2024-03-02,8:00,13:30,14:00;14:30;15:00,18:00,19:00,9:00,9:45,8,good,7,good,80% hydration
+2024-03-09,8:00,13:30,,18:00,,,,11,good,7,good,bad score
+2024-03-16,8:00,soon,,,,,,,,,,bad time
+`
+	parsed := ParseCSV(strings.NewReader(input), "bakes.csv")
+
+	if len(parsed.Candidates) != 1 {
+		t.Fatalf("Expected 1 valid bake, got %d", len(parsed.Candidates))
+	}
+	if len(parsed.Errors) != 2 {
+		t.Fatalf("Expected 2 row errors, got %d: %v", len(parsed.Errors), parsed.Errors)
+	}
+	if parsed.Errors[0].Row != 3 || parsed.Errors[1].Row != 4 {
+		t.Errorf("Expected errors on rows 3 and 4, got %d and %d", parsed.Errors[0].Row, parsed.Errors[1].Row)
+	}
+
+	bake := parsed.Candidates[0].Bake
+	if len(bake.Events) != 9 {
+		t.Fatalf("Expected 9 events, got %d", len(bake.Events))
+	}
+
+	// Oven-in at 9:00 follows fridge-in at 19:00, so it rolls over to the next day
+	last := bake.Events[len(bake.Events)-1]
+	if last.Event != models.EventOvenOut || last.Timestamp.Day() != 3 {
+		t.Errorf("Expected oven-out on the next day, got %s at %s", last.Event, last.Timestamp)
+	}
+
+	if bake.Events[4].FoldCount == nil || *bake.Events[4].FoldCount != 3 {
+		t.Errorf("Expected third fold to have count 3")
+	}
+
+	if bake.Assessment == nil || bake.Assessment.Score != 8 || bake.Assessment.ProofLevel != models.ProofGood {
+		t.Errorf("Expected assessment with score 8, got %+v", bake.Assessment)
+	}
+}
+
+func TestParseCSVEventRows(t *testing.T) {
+	input := `bake,timestamp,event,temp_f,note,score,proof_level
+a,2024-03-02 08:00,starter-out,70,,,
+a,2024-03-02 13:30,mixed,72,first try,,
+b,2024-03-05 08:00,starter-out,,,,
+a,2024-03-03 10:00,loaf-complete,,,7,overproofed
+b,2024-03-05 09:00,levain,,,,
+`
+	parsed := ParseCSV(strings.NewReader(input), "events.csv")
+
+	if len(parsed.Candidates) != 2 {
+		t.Fatalf("Expected 2 bakes, got %d", len(parsed.Candidates))
+	}
+	if len(parsed.Errors) != 1 || parsed.Errors[0].Row != 6 {
+		t.Errorf("Expected unknown event error on row 6, got %v", parsed.Errors)
+	}
+
+	first := parsed.Candidates[0].Bake
+	if len(first.Events) != 3 || first.Assessment == nil || first.Assessment.ProofLevel != models.ProofOver {
+		t.Errorf("Expected first bake with 3 events and assessment, got %d events, %+v", len(first.Events), first.Assessment)
+	}
+	if first.Events[0].TempF == nil || *first.Events[0].TempF != 70 {
+		t.Error("Expected kitchen temperature on first event")
+	}
+}
+
+func TestParseJSONL(t *testing.T) {
+	input := `{"timestamp":"2024-03-02T08:00:00Z","event":"starter-out"}
+{"timestamp":"2024-03-02T13:00:00Z","event":"mixed"}
+not json
+{"timestamp":"2024-03-02T20:00:00Z","event":"oven-out","image":"../../../etc/passwd"}
+{"timestamp":"2024-03-03T10:00:00Z","event":"loaf-complete","data":{"assessment":{"proof_level":"good","crumb_quality":8,"browning":"good","score":9}}}
+{"timestamp":"2024-03-09T08:00:00Z","event":"starter-out"}
+`
+	parsed := ParseJSONL(strings.NewReader(input), "old.jsonl")
+
+	if len(parsed.Candidates) != 2 {
+		t.Fatalf("Expected 2 bakes, got %d", len(parsed.Candidates))
+	}
+	if len(parsed.Errors) != 2 || parsed.Errors[0].Row != 3 || parsed.Errors[1].Row != 4 {
+		t.Errorf("Expected a JSON error on row 3 and a bad image name on row 4, got %v", parsed.Errors)
+	}
+	if parsed.Candidates[0].Bake.Assessment == nil || parsed.Candidates[0].Bake.Assessment.Score != 9 {
+		t.Error("Expected assessment on first bake")
+	}
+}
+
+func TestImportDryRunAndDuplicates(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer os.RemoveAll(tmpDir)
+
+	input := `Date,Mixed,Shaped,Oven Out,Score
+2024-03-02,13:30,18:00,9:45,8
+2024-03-09,13:30,18:00,9:45,6
+`
+	parsed := ParseCSV(strings.NewReader(input), "bakes.csv")
+
+	// Dry run writes nothing
+	report, err := Import(store, parsed, true)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(report.Imported) != 2 {
+		t.Errorf("Expected 2 bakes in dry run, got %d", len(report.Imported))
+	}
+	if dates, _ := store.ListBakes(); len(dates) != 0 {
+		t.Errorf("Dry run should not write bakes, found %d", len(dates))
+	}
+
+	// Real import writes completed bakes with assessments
+	report, err = Import(store, parsed, false)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(report.Imported) != 2 {
+		t.Fatalf("Expected 2 imported bakes, got %d", len(report.Imported))
+	}
+
+	bake, err := store.ReadBake(report.Imported[0])
+	if err != nil {
+		t.Fatalf("ReadBake failed: %v", err)
+	}
+	if bake.Assessment == nil || bake.Assessment.Score != 8 {
+		t.Errorf("Expected imported assessment, got %+v", bake.Assessment)
+	}
+
+	// Imported history never becomes the active bake
+	if hasBake, _ := store.HasCurrentBake(); hasBake {
+		t.Error("Imported bakes should not be active")
+	}
+
+	// Importing again only reports duplicates
+	report, err = Import(store, parsed, false)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(report.Imported) != 0 || len(report.Duplicates) != 2 {
+		t.Errorf("Expected 2 duplicates and no imports, got %d imported, %d duplicates", len(report.Imported), len(report.Duplicates))
+	}
+}
+
+func TestImportDoesNotHijackActiveBake(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer os.RemoveAll(tmpDir)
+
+	store.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	parsed := &Parsed{Candidates: []Candidate{{
+		Source: "test",
+		Row:    2,
+		Bake: &models.Bake{Events: []models.Event{
+			{Timestamp: time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local), Event: models.EventMixed},
+		}},
+	}}}
+	if _, err := Import(store, parsed, false); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	store.AppendEvent(models.NewEvent(models.EventFed))
+
+	bake, err := store.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("ReadCurrentBake failed: %v", err)
+	}
+	if len(bake.Events) != 2 || bake.Events[0].Event != models.EventStarterOut {
+		t.Errorf("Expected active bake to keep its events, got %d events", len(bake.Events))
+	}
+}
@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// ParseJSONL reads bakes in this tool's own format: one models.Event per line.
+// A loaf-complete event ends a bake, so files holding several bakes are split.
+func ParseJSONL(r io.Reader, source string) *Parsed {
+	parsed := &Parsed{}
+
+	var current *models.Bake
+	startRow := 0
+
+	flush := func() {
+		if current != nil && len(current.Events) > 0 {
+			sortEvents(current)
+			parsed.Candidates = append(parsed.Candidates, Candidate{Source: source, Row: startRow, Bake: current})
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var event models.Event
+		if err := json.Unmarshal([]byte(text), &event); err != nil {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: line, Err: fmt.Sprintf("invalid JSON: %v", err)})
+			continue
+		}
+		if event.Timestamp.IsZero() {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: line, Err: "missing timestamp"})
+			continue
+		}
+		if !validEventTypes[event.Event] {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: line, Err: fmt.Sprintf("unknown event type: %q", event.Event)})
+			continue
+		}
+		if event.Image != "" && !storage.ValidName(event.Image) {
+			parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: line, Err: fmt.Sprintf("invalid image name: %q", event.Image)})
+			continue
+		}
+
+		var assessment *models.Assessment
+		if event.Event == models.EventLoafComplete && event.Data != nil {
+			if data, ok := event.Data["assessment"]; ok {
+				assessmentJSON, _ := json.Marshal(data)
+				var a models.Assessment
+				if err := json.Unmarshal(assessmentJSON, &a); err != nil {
+					parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: line, Err: fmt.Sprintf("invalid assessment: %v", err)})
+					continue
+				}
+				if err := validateAssessment(&a); err != nil {
+					parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: line, Err: err.Error()})
+					continue
+				}
+				assessment = &a
+			}
+		}
+
+		if current == nil {
+			current = &models.Bake{}
+			startRow = line
+		}
+		current.Events = append(current.Events, event)
+
+		if event.Event == models.EventLoafComplete {
+			current.Assessment = assessment
+			flush()
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		parsed.Errors = append(parsed.Errors, RowError{Source: source, Row: 0, Err: fmt.Sprintf("error reading file: %v", err)})
+	}
+	flush()
+
+	return parsed
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("test_requests_total", "Requests served.", "method", "status")
+	temp := r.Gauge("test_temperature", "Last reading.\nIn Fahrenheit.", "sensor")
+	latency := r.Histogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+	r.GaugeFunc("test_age_seconds", "Computed.", func() float64 { return 90 })
+	r.GaugeFunc("test_missing", "Left out.", func() float64 { return math.NaN() })
+
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Add(-5, "GET", "200")
+	requests.Inc("POST", "500")
+	temp.Set(74.5, `kitchen "main"`)
+	latency.Observe(0.05, "read")
+	latency.Observe(0.5, "read")
+	latency.Observe(3, "read")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# HELP test_requests_total Requests served.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{method="GET",status="200"} 2` + "\n",
+		`test_requests_total{method="POST",status="500"} 1` + "\n",
+		`# HELP test_temperature Last reading.\nIn Fahrenheit.` + "\n",
+		`test_temperature{sensor="kitchen \"main\""} 74.5` + "\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{op="read",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{op="read",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{op="read",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{op="read"} 3.55` + "\n",
+		`test_latency_seconds_count{op="read"} 3` + "\n",
+		"test_age_seconds 90\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "test_missing") {
+		t.Errorf("Expected NaN gauge to be left out:\n%s", out)
+	}
+
+	// Families keep their registration order
+	if strings.Index(out, "test_requests_total") > strings.Index(out, "test_age_seconds") {
+		t.Errorf("Expected registration order:\n%s", out)
+	}
+}
+
+func TestDuplicateAndLabelMismatch(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("test_total", "Test.", "result")
+
+	for name, fn := range map[string]func(){
+		"duplicate name": func() { r.Gauge("test_total", "Again.") },
+		"missing label":  func() { c.Inc() },
+		"extra label":    func() { c.Inc("ok", "extra") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for %s", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
 
 // EventType represents the type of baking event
 type EventType string
@@ -30,10 +35,13 @@ type Event struct {
 	TempF       *float64               `json:"temp_f,omitempty"`
 	DoughTempF  *float64               `json:"dough_temp_f,omitempty"`
 	OvenTempF   *float64               `json:"oven_temp_f,omitempty"`
+	FridgeTempF *float64               `json:"fridge_temp_f,omitempty"` // Fridge sensor during cold retard
 	FoldCount   *int                   `json:"fold_count,omitempty"`
 	Note        string                 `json:"note,omitempty"`
 	Image       string                 `json:"image,omitempty"`       // Image filename (stored in data/images/BAKE_DATE/)
 	Data        map[string]interface{} `json:"data,omitempty"`
+	ID          string                 `json:"id,omitempty"`          // Unique across devices, used by sync
+	User        string                 `json:"user,omitempty"`        // Who logged it, when auth is enabled
 }
 
 // ProofLevel represents how well the dough was proofed
@@ -72,14 +80,43 @@ type Bake struct {
 	Assessment *Assessment  `json:"assessment,omitempty"`
 }
 
-// NewEvent creates a new event with the current timestamp
+// Baker returns the first user to log to a bake (normally whoever started it),
+// or "" for bakes logged without a user
+func (b *Bake) Baker() string {
+	for _, e := range b.Events {
+		if e.User != "" {
+			return e.User
+		}
+	}
+	return ""
+}
+
+// NewEvent creates a new event with the current timestamp and a fresh ID
 func NewEvent(eventType EventType) *Event {
 	return &Event{
 		Timestamp: time.Now(),
 		Event:     eventType,
+		ID:        NewEventID(),
 	}
 }
 
+// NewEventID returns a random event ID
+func NewEventID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Key identifies an event across devices. Events logged before IDs existed
+// get a stable key derived from their timestamp and type.
+func (e *Event) Key() string {
+	if e.ID != "" {
+		return e.ID
+	}
+	sum := sha256.Sum256([]byte(e.Timestamp.UTC().Format(time.RFC3339Nano) + "|" + string(e.Event)))
+	return "legacy-" + hex.EncodeToString(sum[:8])
+}
+
 // WithTemp adds kitchen temperature to an event
 func (e *Event) WithTemp(temp float64) *Event {
 	e.TempF = &temp
@@ -98,6 +135,12 @@ func (e *Event) WithOvenTemp(temp float64) *Event {
 	return e
 }
 
+// WithFridgeTemp adds fridge temperature to an event
+func (e *Event) WithFridgeTemp(temp float64) *Event {
+	e.FridgeTempF = &temp
+	return e
+}
+
 // WithFoldCount adds fold count to an event
 func (e *Event) WithFoldCount(count int) *Event {
 	e.FoldCount = &count
@@ -115,3 +158,9 @@ func (e *Event) WithImage(imageFilename string) *Event {
 	e.Image = imageFilename
 	return e
 }
+
+// WithUser records who logged an event
+func (e *Event) WithUser(user string) *Event {
+	e.User = user
+	return e
+}
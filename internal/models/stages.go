@@ -0,0 +1,47 @@
+package models
+
+// Stage is a phase of a bake, named after what the dough is doing
+type Stage string
+
+const (
+	StageStarter Stage = "starter" // Starter out, fed, levain building
+	StageBulk    Stage = "bulk"    // Mixed, through kneading and folds
+	StageShaped  Stage = "shaped"  // Shaped, proofing at room temperature
+	StageRetard  Stage = "retard"  // Cold retard in the fridge
+	StageProof   Stage = "proof"   // Out of the fridge, warming up
+	StageBake    Stage = "bake"    // In the oven
+)
+
+// Stages lists every stage in bake order
+var Stages = []Stage{StageStarter, StageBulk, StageShaped, StageRetard, StageProof, StageBake}
+
+// StageOf returns the stage a workflow event starts, or "" for events that
+// don't move the bake along (temperatures, notes, loaf-complete)
+func StageOf(event EventType) Stage {
+	switch event {
+	case EventStarterOut, EventFed, EventLevainReady:
+		return StageStarter
+	case EventMixed, EventKnead, EventFold:
+		return StageBulk
+	case EventShaped:
+		return StageShaped
+	case EventFridgeIn:
+		return StageRetard
+	case EventFridgeOut:
+		return StageProof
+	case EventOvenIn, EventRemoveLid, EventOvenOut:
+		return StageBake
+	}
+	return ""
+}
+
+// CurrentStage returns the stage of the latest workflow event, or starter
+// for a bake that has none yet
+func (b *Bake) CurrentStage() Stage {
+	for i := len(b.Events) - 1; i >= 0; i-- {
+		if stage := StageOf(b.Events[i].Event); stage != "" {
+			return stage
+		}
+	}
+	return StageStarter
+}
@@ -0,0 +1,323 @@
+// Package mqtt is a small MQTT 3.1.1 client: it connects, subscribes at QoS 1,
+// publishes at QoS 0 and keeps the connection alive. Reconnecting is left to
+// the caller; wait on Done and dial again.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPort is the broker port used when the address doesn't name one
+const DefaultPort = "1883"
+
+// maxPacket is the largest packet accepted from the broker
+const maxPacket = 1 << 20
+
+// Message is a message received on a subscribed topic
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Options configures a connection
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration // Default 30s
+	// OnMessage is called for each message, one at a time, in the order received
+	OnMessage func(Message)
+}
+
+// Client is a connection to a broker
+type Client struct {
+	conn      net.Conn
+	opts      Options
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	nextID    uint16
+	pending   map[uint16]chan []byte // SUBACK return codes by packet ID
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+// ParseBroker turns "mqtt://host:port", "tcp://host:port", "host:port" or
+// "host" into a dialable address
+func ParseBroker(broker string) (string, error) {
+	hostport := broker
+	if strings.Contains(broker, "://") {
+		u, err := url.Parse(broker)
+		if err != nil {
+			return "", fmt.Errorf("invalid broker %q: %w", broker, err)
+		}
+		if u.Scheme != "mqtt" && u.Scheme != "tcp" {
+			return "", fmt.Errorf("invalid broker %q: use mqtt://host:port", broker)
+		}
+		hostport = u.Host
+	}
+	if hostport == "" {
+		return "", fmt.Errorf("invalid broker %q: missing host", broker)
+	}
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		hostport = net.JoinHostPort(hostport, DefaultPort)
+	}
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		return "", fmt.Errorf("invalid broker %q: %w", broker, err)
+	}
+	return hostport, nil
+}
+
+// Dial connects to the broker and waits for it to accept the session
+func Dial(ctx context.Context, broker string, opts Options) (*Client, error) {
+	addr, err := ParseBroker(broker)
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	// The handshake shares the dial deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	reader := bufio.NewReader(conn)
+	if _, err := conn.Write(connectPacket(opts).Bytes()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send connect: %w", err)
+	}
+	ack, err := ReadPacket(reader, maxPacket)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read connack: %w", err)
+	}
+	if ack.Type != TypeConnack || len(ack.Body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("expected connack, got packet type %d", ack.Type)
+	}
+	if code := ack.Body[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused connection: %s", connackReason(code))
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &Client{
+		conn:    conn,
+		opts:    opts,
+		pending: make(map[uint16]chan []byte),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(reader)
+	go c.keepAlive()
+	return c, nil
+}
+
+// connectPacket builds a CONNECT with a clean session
+func connectPacket(opts Options) Packet {
+	body := AppendString(nil, "MQTT")
+	flags := byte(0x02) // Clean session
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+	body = append(body, 4, flags) // Protocol level 4 is 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = AppendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = AppendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = AppendString(body, opts.Password)
+	}
+	return Packet{Type: TypeConnect, Body: body}
+}
+
+// connackReason describes a CONNACK return code
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client ID rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
+
+// Subscribe subscribes to topic filters at QoS 1 and waits for the broker to confirm
+func (c *Client) Subscribe(ctx context.Context, filters ...string) error {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	ack := make(chan []byte, 1)
+	c.pending[id] = ack
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, filter := range filters {
+		body = append(AppendString(body, filter), 1)
+	}
+	if err := c.write(Packet{Type: TypeSubscribe, Flags: 0x02, Body: body}); err != nil {
+		return err
+	}
+
+	select {
+	case codes := <-ack:
+		for i, code := range codes {
+			if code == 0x80 && i < len(filters) {
+				return fmt.Errorf("broker refused subscription to %s", filters[i])
+			}
+		}
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Publish sends a message at QoS 0
+func (c *Client) Publish(topic string, payload []byte) error {
+	return c.write(PublishPacket(topic, payload, 0, 0, false))
+}
+
+// Done is closed when the connection is lost or closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, or nil while it's up
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects cleanly
+func (c *Client) Close() error {
+	c.write(Packet{Type: TypeDisconnect})
+	c.shutdown(errors.New("connection closed"))
+	return nil
+}
+
+// shutdown records the first error and closes the connection
+func (c *Client) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+// write sends one packet; writes from several goroutines don't interleave
+func (c *Client) write(p Packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.KeepAlive))
+	if _, err := c.conn.Write(p.Bytes()); err != nil {
+		c.shutdown(fmt.Errorf("failed to write: %w", err))
+		return err
+	}
+	return nil
+}
+
+// readLoop handles packets from the broker until the connection ends. A
+// broker that goes quiet for 1.5 keep-alive periods is considered gone.
+func (c *Client) readLoop(reader *bufio.Reader) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+		p, err := ReadPacket(reader, maxPacket)
+		if err != nil {
+			c.shutdown(fmt.Errorf("connection lost: %w", err))
+			return
+		}
+
+		switch p.Type {
+		case TypePublish:
+			msg, qos, id, err := ParsePublish(p)
+			if err != nil {
+				c.shutdown(fmt.Errorf("malformed publish: %w", err))
+				return
+			}
+			if qos > 0 {
+				c.write(Packet{Type: TypePuback, Body: binary.BigEndian.AppendUint16(nil, id)})
+			}
+			if c.opts.OnMessage != nil {
+				c.opts.OnMessage(msg)
+			}
+		case TypeSuback:
+			if len(p.Body) < 2 {
+				continue
+			}
+			id := binary.BigEndian.Uint16(p.Body)
+			c.mu.Lock()
+			ack := c.pending[id]
+			c.mu.Unlock()
+			if ack != nil {
+				ack <- p.Body[2:]
+			}
+		}
+	}
+}
+
+// keepAlive pings the broker so it doesn't drop an idle connection
+func (c *Client) keepAlive() {
+	ticker := time.NewTicker(c.opts.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(Packet{Type: TypePingreq})
+		}
+	}
+}
+
+// Match reports whether a topic matches a filter with + and # wildcards
+func Match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -0,0 +1,67 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseBroker(t *testing.T) {
+	tests := []struct {
+		broker string
+		want   string
+		ok     bool
+	}{
+		{"mqtt://broker.local:1884", "broker.local:1884", true},
+		{"tcp://10.0.0.5:1883", "10.0.0.5:1883", true},
+		{"broker.local:1883", "broker.local:1883", true},
+		{"broker.local", "broker.local:1883", true},
+		{"http://broker.local", "", false},
+		{"mqtt://", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseBroker(tt.broker)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseBroker(%q) = %q, %v; expected %q", tt.broker, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"sourdough/log/+", "sourdough/log/fold", true},
+		{"sourdough/log/+", "sourdough/log", false},
+		{"sourdough/log/+", "sourdough/log/fold/extra", false},
+		{"sourdough/#", "sourdough/temp/dough", true},
+		{"sourdough/temp/dough", "sourdough/temp/dough", true},
+		{"sourdough/temp/dough", "sourdough/temp/oven", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, expected %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	// Long enough to need a two-byte remaining length
+	payload := []byte(strings.Repeat("x", 300))
+	sent := PublishPacket("sourdough/events", payload, 1, 42, false)
+
+	p, err := ReadPacket(bufio.NewReader(bytes.NewReader(sent.Bytes())), maxPacket)
+	if err != nil {
+		t.Fatalf("ReadPacket failed: %v", err)
+	}
+	msg, qos, id, err := ParsePublish(p)
+	if err != nil || msg.Topic != "sourdough/events" || !bytes.Equal(msg.Payload, payload) || qos != 1 || id != 42 {
+		t.Errorf("Unexpected publish %q (%d bytes), qos %d, id %d, %v", msg.Topic, len(msg.Payload), qos, id, err)
+	}
+
+	if _, err := ReadPacket(bufio.NewReader(bytes.NewReader(sent.Bytes())), 100); err == nil {
+		t.Error("Expected an error for a packet over the limit")
+	}
+}
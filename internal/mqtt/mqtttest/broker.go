@@ -0,0 +1,201 @@
+// Package mqtttest provides an in-process MQTT broker for tests, in the
+// spirit of httptest. It speaks enough MQTT 3.1.1 for the mqtt package:
+// connect, subscribe with wildcards, publish at QoS 0 and 1, and ping.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/mdeckert/sourdough/internal/mqtt"
+)
+
+// Broker is a broker listening on a local port
+type Broker struct {
+	// Addr is the broker's host:port
+	Addr string
+
+	ln       net.Listener
+	mu       sync.Mutex
+	sessions map[*session]bool
+	nextID   uint16
+	wg       sync.WaitGroup
+}
+
+// session is one connected client
+type session struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters map[string]byte // Subscribed filters and their granted QoS
+}
+
+// NewBroker starts a broker on 127.0.0.1; call Close when done
+func NewBroker() *Broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mqtttest: failed to listen: " + err.Error())
+	}
+	b := &Broker{Addr: ln.Addr().String(), ln: ln, sessions: make(map[*session]bool)}
+	b.wg.Add(1)
+	go b.accept()
+	return b
+}
+
+// URL is the broker address as an mqtt:// URL
+func (b *Broker) URL() string {
+	return "mqtt://" + b.Addr
+}
+
+// Close stops the broker and drops every client
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.DropClients()
+	b.wg.Wait()
+}
+
+// DropClients disconnects every client without a DISCONNECT, like a broker restart
+func (b *Broker) DropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+// Subscriptions returns how many clients are subscribed to exactly this filter
+func (b *Broker) Subscriptions(filter string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for s := range b.sessions {
+		if _, ok := s.filters[filter]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Publish delivers a message to matching subscribers at up to qos
+func (b *Broker) Publish(topic string, payload []byte, qos byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		granted, ok := s.match(topic)
+		if !ok {
+			continue
+		}
+		if granted > qos {
+			granted = qos
+		}
+		b.nextID++
+		if b.nextID == 0 {
+			b.nextID = 1
+		}
+		s.write(mqtt.PublishPacket(topic, payload, granted, b.nextID, false))
+	}
+}
+
+func (b *Broker) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.serve(conn)
+		}()
+	}
+}
+
+// serve runs one client's session until it disconnects
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	s := &session{conn: conn, filters: make(map[string]byte)}
+
+	p, err := mqtt.ReadPacket(reader, 1<<20)
+	if err != nil || p.Type != mqtt.TypeConnect {
+		return
+	}
+	s.write(mqtt.Packet{Type: mqtt.TypeConnack, Body: []byte{0, 0}})
+
+	b.mu.Lock()
+	b.sessions[s] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+	}()
+
+	for {
+		p, err := mqtt.ReadPacket(reader, 1<<20)
+		if err != nil {
+			return
+		}
+		switch p.Type {
+		case mqtt.TypeSubscribe:
+			if len(p.Body) < 2 {
+				return
+			}
+			id, rest := p.Body[:2], p.Body[2:]
+			codes := []byte{}
+			b.mu.Lock()
+			for len(rest) > 0 {
+				filter, tail, err := mqtt.ReadString(rest)
+				if err != nil || len(tail) < 1 {
+					b.mu.Unlock()
+					return
+				}
+				qos := tail[0]
+				if qos > 1 {
+					qos = 1
+				}
+				s.filters[filter] = qos
+				codes = append(codes, qos)
+				rest = tail[1:]
+			}
+			b.mu.Unlock()
+			s.write(mqtt.Packet{Type: mqtt.TypeSuback, Body: append(append([]byte{}, id...), codes...)})
+		case mqtt.TypePublish:
+			msg, qos, id, err := mqtt.ParsePublish(p)
+			if err != nil {
+				return
+			}
+			if qos > 0 {
+				s.write(mqtt.Packet{Type: mqtt.TypePuback, Body: binary.BigEndian.AppendUint16(nil, id)})
+			}
+			b.Publish(msg.Topic, msg.Payload, qos)
+		case mqtt.TypePingreq:
+			s.write(mqtt.Packet{Type: mqtt.TypePingresp})
+		case mqtt.TypeDisconnect:
+			return
+		}
+	}
+}
+
+// match returns the highest QoS granted by a filter matching topic
+func (s *session) match(topic string) (byte, bool) {
+	var granted byte
+	matched := false
+	for filter, qos := range s.filters {
+		if mqtt.Match(filter, topic) {
+			matched = true
+			if qos > granted {
+				granted = qos
+			}
+		}
+	}
+	return granted, matched
+}
+
+func (s *session) write(p mqtt.Packet) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.Write(p.Bytes())
+}
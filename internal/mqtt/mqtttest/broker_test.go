@@ -0,0 +1,72 @@
+package mqtttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/mqtt"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	broker := NewBroker()
+	defer broker.Close()
+
+	received := make(chan mqtt.Message, 10)
+	sub, err := mqtt.Dial(context.Background(), broker.URL(), mqtt.Options{
+		ClientID:  "sub",
+		OnMessage: func(m mqtt.Message) { received <- m },
+	})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer sub.Close()
+	if err := sub.Subscribe(context.Background(), "sourdough/log/+"); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	pub, err := mqtt.Dial(context.Background(), broker.Addr, mqtt.Options{ClientID: "pub", Username: "baker", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer pub.Close()
+	pub.Publish("sourdough/temp/dough", []byte("78"))
+	pub.Publish("sourdough/log/fold", []byte(""))
+
+	// QoS 1 deliveries are acknowledged by the client
+	broker.Publish("sourdough/log/shaped", []byte("{}"), 1)
+
+	// The two publishers race, so only the set of topics is certain
+	topics := map[string]bool{}
+	for len(topics) < 2 {
+		select {
+		case m := <-received:
+			topics[m.Topic] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for messages, got %v", topics)
+		}
+	}
+	if !topics["sourdough/log/fold"] || !topics["sourdough/log/shaped"] {
+		t.Errorf("Expected fold and shaped, got %v", topics)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	broker := NewBroker()
+	defer broker.Close()
+
+	c, err := mqtt.Dial(context.Background(), broker.URL(), mqtt.Options{ClientID: "c"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	broker.DropClients()
+
+	select {
+	case <-c.Done():
+		if c.Err() == nil {
+			t.Error("Expected a reason for the lost connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Client didn't notice the broker dropping it")
+	}
+}
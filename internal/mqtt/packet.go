@@ -0,0 +1,129 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types of MQTT 3.1.1
+const (
+	TypeConnect    byte = 1
+	TypeConnack    byte = 2
+	TypePublish    byte = 3
+	TypePuback     byte = 4
+	TypeSubscribe  byte = 8
+	TypeSuback     byte = 9
+	TypePingreq    byte = 12
+	TypePingresp   byte = 13
+	TypeDisconnect byte = 14
+)
+
+// Packet is one MQTT control packet: the fixed header's type and flags, and
+// everything after the remaining length
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// ReadPacket reads the next packet, rejecting bodies larger than maxBody
+func ReadPacket(r *bufio.Reader, maxBody int) (Packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return Packet{}, err
+	}
+
+	// Remaining length: 7 bits per byte, high bit set while more follow
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return Packet{}, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxBody {
+		return Packet{}, fmt.Errorf("packet of %d bytes is too large", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Packet{}, err
+	}
+	return Packet{Type: first >> 4, Flags: first & 0x0f, Body: body}, nil
+}
+
+// Bytes encodes the packet for the wire
+func (p Packet) Bytes() []byte {
+	out := []byte{p.Type<<4 | p.Flags}
+	n := len(p.Body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, p.Body...)
+}
+
+// AppendString appends a length-prefixed UTF-8 string
+func AppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// ReadString reads a length-prefixed string from the start of b and returns the rest
+func ReadString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("truncated string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// PublishPacket builds a PUBLISH; id is only sent for QoS 1
+func PublishPacket(topic string, payload []byte, qos byte, id uint16, retain bool) Packet {
+	body := AppendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	flags := qos << 1
+	if retain {
+		flags |= 1
+	}
+	return Packet{Type: TypePublish, Flags: flags, Body: append(body, payload...)}
+}
+
+// ParsePublish splits a PUBLISH into its message and, for QoS 1, packet ID
+func ParsePublish(p Packet) (msg Message, qos byte, id uint16, err error) {
+	qos = (p.Flags >> 1) & 0x03
+	topic, rest, err := ReadString(p.Body)
+	if err != nil {
+		return Message{}, 0, 0, err
+	}
+	if qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, 0, errors.New("truncated packet id")
+		}
+		id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest}, qos, id, nil
+}
@@ -0,0 +1,131 @@
+package profiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+)
+
+// fileName holds the household's profiles, relative to the data directory
+const fileName = "profiles.json"
+
+// Profile is one baker in the household, with the starter and recipe they use
+type Profile struct {
+	Name    string    `json:"name"`
+	Starter string    `json:"starter,omitempty"`
+	Recipe  string    `json:"recipe,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Registry reads and writes the profiles of a data directory
+type Registry struct {
+	path string
+	mu   sync.Mutex
+}
+
+// New returns the registry for dataDir; the file is created on the first save
+func New(dataDir string) *Registry {
+	return &Registry{path: filepath.Join(dataDir, fileName)}
+}
+
+// load reads all profiles; the caller holds r.mu
+func (r *Registry) load() ([]Profile, error) {
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return []Profile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	var list []Profile
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %w", err)
+	}
+	return list, nil
+}
+
+// write saves all profiles atomically, sorted by name; the caller holds r.mu
+func (r *Registry) write(list []Profile) error {
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profiles: %w", err)
+	}
+	if err := os.WriteFile(r.path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write profiles: %w", err)
+	}
+	if err := os.Rename(r.path+".tmp", r.path); err != nil {
+		return fmt.Errorf("failed to write profiles: %w", err)
+	}
+	return nil
+}
+
+// List returns all profiles sorted by name
+func (r *Registry) List() ([]Profile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+// Get returns a profile by name, or nil if there is none
+func (r *Registry) Get(name string) (*Profile, error) {
+	list, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p.Name == name {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// Save adds a profile or updates the starter and recipe of an existing one
+func (r *Registry) Save(p Profile) (*Profile, error) {
+	if err := auth.ValidUser(p.Name); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Name == p.Name {
+			list[i].Starter, list[i].Recipe = p.Starter, p.Recipe
+			saved := list[i]
+			return &saved, r.write(list)
+		}
+	}
+
+	p.Created = time.Now()
+	return &p, r.write(append(list, p))
+}
+
+// Remove deletes a profile. The baker's bakes are kept.
+func (r *Registry) Remove(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].Name == name {
+			return r.write(append(list[:i], list[i+1:]...))
+		}
+	}
+	return fmt.Errorf("profile not found: %s", name)
+}
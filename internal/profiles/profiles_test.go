@@ -0,0 +1,51 @@
+package profiles
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSaveListRemove(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-profiles-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg := New(tmpDir)
+	if list, err := reg.List(); err != nil || len(list) != 0 {
+		t.Fatalf("Expected no profiles, got %v (err %v)", list, err)
+	}
+
+	if _, err := reg.Save(Profile{Name: "../evil"}); err == nil {
+		t.Error("Expected invalid name rejected")
+	}
+
+	reg.Save(Profile{Name: "bob", Starter: "Audrey"})
+	first, _ := reg.Save(Profile{Name: "alice", Starter: "Clint", Recipe: "Country loaf"})
+
+	// Saving again updates the starter and recipe but keeps the creation time
+	updated, err := reg.Save(Profile{Name: "alice", Starter: "Clint II"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if updated.Starter != "Clint II" || updated.Recipe != "" || !updated.Created.Equal(first.Created) {
+		t.Errorf("Expected alice updated in place, got %+v", updated)
+	}
+
+	// A new registry on the same directory sees the saved profiles, sorted by name
+	list, _ := New(tmpDir).List()
+	if len(list) != 2 || list[0].Name != "alice" || list[1].Name != "bob" {
+		t.Fatalf("Expected alice and bob, got %+v", list)
+	}
+
+	if err := reg.Remove("bob"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if p, _ := reg.Get("bob"); p != nil {
+		t.Error("Expected bob removed")
+	}
+	if err := reg.Remove("bob"); err == nil {
+		t.Error("Expected error removing a missing profile")
+	}
+}
@@ -23,6 +23,31 @@ type EventQR struct {
 
 // GenerateAll generates QR codes for all common events
 func GenerateAll(serverURL, outputDir string) error {
+	return GenerateSigned(serverURL, outputDir, nil)
+}
+
+// WithScheme returns serverURL using https or plain http, adding the scheme
+// when it is missing so the codes match how the server listens
+func WithScheme(serverURL string, https bool) string {
+	scheme := "http://"
+	if https {
+		scheme = "https://"
+	}
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	for _, prefix := range []string{"https://", "http://"} {
+		if strings.HasPrefix(serverURL, prefix) {
+			return scheme + strings.TrimPrefix(serverURL, prefix)
+		}
+	}
+	return scheme + serverURL
+}
+
+// Signer adds a signature to a link path so it works on servers with auth enabled
+type Signer func(path string) string
+
+// GenerateSigned generates QR codes like GenerateAll, passing each link path
+// through sign (if set) first
+func GenerateSigned(serverURL, outputDir string, sign Signer) error {
 	// Validate server URL - reject localhost addresses
 	if isLocalhostURL(serverURL) {
 		return fmt.Errorf("server URL cannot be localhost/127.0.0.1 - QR codes must be accessible from mobile devices. Use your server's IP address (e.g., http://192.168.1.50:8080)")
@@ -35,24 +60,33 @@ func GenerateAll(serverURL, outputDir string) error {
 
 	events := []EventQR{
 		// Workflow stages (in order with numbers)
-		{"start", "1. Set out starter", fmt.Sprintf("%s/loaf/start", serverURL)},
-		{"fed", "2. Fed", fmt.Sprintf("%s/log/fed", serverURL)},
-		{"levain-ready", "3. Levain Ready", fmt.Sprintf("%s/log/levain-ready", serverURL)},
-		{"mixed", "4. Mixed", fmt.Sprintf("%s/log/mixed", serverURL)},
-		{"knead", "5. Knead", fmt.Sprintf("%s/log/knead", serverURL)},
-		{"fold", "6. Fold", fmt.Sprintf("%s/log/fold", serverURL)},
-		{"shaped", "7. Shaped", fmt.Sprintf("%s/log/shaped", serverURL)},
-		{"fridge-in", "8. Fridge In", fmt.Sprintf("%s/log/fridge-in", serverURL)},
-		{"oven-in", "9. Oven In", fmt.Sprintf("%s/log/oven-in", serverURL)},
-		{"remove-lid", "10. Remove Lid", fmt.Sprintf("%s/log/remove-lid", serverURL)},
-		{"oven-out", "11. Oven Out", fmt.Sprintf("%s/log/oven-out", serverURL)},
-		{"complete", "12. Tasting", fmt.Sprintf("%s/complete", serverURL)},
+		{"start", "1. Set out starter", "/loaf/start"},
+		{"fed", "2. Fed", "/log/fed"},
+		{"levain-ready", "3. Levain Ready", "/log/levain-ready"},
+		{"mixed", "4. Mixed", "/log/mixed"},
+		{"knead", "5. Knead", "/log/knead"},
+		{"fold", "6. Fold", "/log/fold"},
+		{"shaped", "7. Shaped", "/log/shaped"},
+		{"fridge-in", "8. Fridge In", "/log/fridge-in"},
+		{"oven-in", "9. Oven In", "/log/oven-in"},
+		{"remove-lid", "10. Remove Lid", "/log/remove-lid"},
+		{"oven-out", "11. Oven Out", "/log/oven-out"},
+		{"complete", "12. Tasting", "/complete"},
 		// Anytime actions
-		{"temp", "LOG TEMP", fmt.Sprintf("%s/temp", serverURL)},
-		{"notes", "ADD NOTE", fmt.Sprintf("%s/notes", serverURL)},
+		{"temp", "LOG TEMP", "/temp"},
+		{"notes", "ADD NOTE", "/notes"},
 		// View actions
-		{"status", "VIEW STATUS", fmt.Sprintf("%s/view/status", serverURL)},
-		{"qr-pdf", "GET QR CODES", fmt.Sprintf("%s/qrcodes.pdf", serverURL)},
+		{"status", "VIEW STATUS", "/view/status"},
+		{"qr-pdf", "GET QR CODES", "/qrcodes.pdf"},
+	}
+
+	// Turn paths into full links, signing them if needed
+	for i := range events {
+		path := events[i].URL
+		if sign != nil {
+			path = sign(path)
+		}
+		events[i].URL = serverURL + path
 	}
 
 	// Generate individual QR codes
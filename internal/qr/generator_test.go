@@ -144,3 +144,22 @@ func TestEventQRStructure(t *testing.T) {
 		t.Errorf("START LOAF should use /loaf/start, got: %s", events[0].URL)
 	}
 }
+
+func TestWithScheme(t *testing.T) {
+	tests := []struct {
+		url   string
+		https bool
+		want  string
+	}{
+		{"http://192.168.1.50:8080", true, "https://192.168.1.50:8080"},
+		{"https://192.168.1.50:8080/", true, "https://192.168.1.50:8080"},
+		{"192.168.1.50:8080", true, "https://192.168.1.50:8080"},
+		{"192.168.1.50:8080", false, "http://192.168.1.50:8080"},
+		{"https://kitchen.local:8080", false, "http://kitchen.local:8080"},
+	}
+	for _, tt := range tests {
+		if got := WithScheme(tt.url, tt.https); got != tt.want {
+			t.Errorf("WithScheme(%q, %v) = %q, want %q", tt.url, tt.https, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package replica
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// Report summarises one sync with a peer
+type Report struct {
+	Peer         string `json:"peer"`
+	PeerNodeID   string `json:"peer_node_id"`
+	Pulled       int    `json:"pulled"`        // Local bakes changed
+	Pushed       int    `json:"pushed"`        // Bakes sent to the peer
+	ImagesPulled int    `json:"images_pulled"` // Images fetched from the peer
+	ImagesPushed int    `json:"images_pushed"` // Images sent to the peer
+}
+
+// client talks to a peer's /api/sync endpoints
+type client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// BakePayload is the body of GET and PUT /api/sync/bake/{id}
+type BakePayload struct {
+	ID     string         `json:"id"`
+	Events []models.Event `json:"events"`
+}
+
+// do sends a request and decodes a JSON response into out (if set)
+func (c *client) do(method, path string, body io.Reader, contentType string, out interface{}) error {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach peer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("peer returned %s for %s %s: %s", resp.Status, method, path, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode peer response: %w", err)
+	}
+	return nil
+}
+
+// sendJSON sends a JSON body
+func (c *client) sendJSON(method, path string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return c.do(method, path, bytes.NewReader(data), "application/json", out)
+}
+
+// imagePath is the sync URL path of an image
+func imagePath(bakeID, name string) string {
+	return "/api/sync/image/" + url.PathEscape(bakeID) + "/" + url.PathEscape(name)
+}
+
+// SetToken sets the API token sent to peers, for servers with auth enabled
+func (n *Node) SetToken(token string) {
+	n.token = token
+}
+
+// SyncWith exchanges changes with the peer server at peerURL in both directions
+func (n *Node) SyncWith(peerURL string) (*Report, error) {
+	n.runMu.Lock()
+	defer n.runMu.Unlock()
+
+	peerURL = strings.TrimSuffix(peerURL, "/")
+	c := &client{base: peerURL, token: n.token, http: &http.Client{Timeout: 60 * time.Second}}
+	report := &Report{Peer: peerURL}
+
+	var remote Snapshot
+	if err := c.do(http.MethodGet, "/api/sync", nil, "", &remote); err != nil {
+		return nil, err
+	}
+	if remote.NodeID == n.NodeID() {
+		return nil, fmt.Errorf("peer %s is this server", peerURL)
+	}
+	report.PeerNodeID = remote.NodeID
+
+	// Deletes and restores first, so neither side re-sends deleted events
+	if err := n.mergeRegisters(remote.Registers); err != nil {
+		return nil, err
+	}
+	if err := c.sendJSON(http.MethodPost, "/api/sync/registers", n.registers(), nil); err != nil {
+		return nil, err
+	}
+
+	local, err := n.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	remoteBakes := make(map[string]BakeSummary)
+	for _, b := range remote.Bakes {
+		remoteBakes[b.ID] = b
+	}
+	localBakes := make(map[string]BakeSummary)
+	for _, b := range local.Bakes {
+		localBakes[b.ID] = b
+	}
+
+	// Pull bakes that differ, then push the merged result back
+	for _, rb := range remote.Bakes {
+		if lb, ok := localBakes[rb.ID]; ok && lb.Digest == rb.Digest {
+			continue
+		}
+		var payload BakePayload
+		if err := c.do(http.MethodGet, "/api/sync/bake/"+url.PathEscape(rb.ID), nil, "", &payload); err != nil {
+			return nil, err
+		}
+		changed, err := n.mergeBake(rb.ID, payload.Events)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			report.Pulled++
+		}
+	}
+
+	for _, lb := range local.Bakes {
+		if rb, ok := remoteBakes[lb.ID]; ok && rb.Digest == lb.Digest {
+			continue
+		}
+		events, err := n.Events(lb.ID)
+		if err != nil || len(events) == 0 {
+			continue
+		}
+		if err := c.sendJSON(http.MethodPut, "/api/sync/bake/"+url.PathEscape(lb.ID), BakePayload{ID: lb.ID, Events: events}, nil); err != nil {
+			return nil, err
+		}
+		report.Pushed++
+	}
+
+	if err := n.syncImages(c, remote.Bakes, local.Bakes, report); err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	n.state.Peers[peerURL] = time.Now()
+	n.mu.Unlock()
+	if err := n.save(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// syncImages copies images each side is missing
+func (n *Node) syncImages(c *client, remote, local []BakeSummary, report *Report) error {
+	has := func(bakes []BakeSummary) map[string]bool {
+		set := make(map[string]bool)
+		for _, b := range bakes {
+			for _, name := range b.Images {
+				set[b.ID+"/"+name] = true
+			}
+		}
+		return set
+	}
+	remoteHas, localHas := has(remote), has(local)
+
+	for _, b := range remote {
+		if n.registers().Bakes[b.ID].Deleted {
+			continue
+		}
+		for _, name := range b.Images {
+			if localHas[b.ID+"/"+name] {
+				continue
+			}
+			if err := n.pullImage(c, b.ID, name); err != nil {
+				return err
+			}
+			report.ImagesPulled++
+		}
+	}
+
+	for _, b := range local {
+		for _, name := range b.Images {
+			if remoteHas[b.ID+"/"+name] {
+				continue
+			}
+			f, err := n.OpenImage(b.ID, name)
+			if err != nil {
+				return fmt.Errorf("failed to open image: %w", err)
+			}
+			err = c.do(http.MethodPut, imagePath(b.ID, name), f, "application/octet-stream", nil)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			report.ImagesPushed++
+		}
+	}
+	return nil
+}
+
+// pullImage downloads one image from the peer
+func (n *Node) pullImage(c *client, bakeID, name string) error {
+	req, err := http.NewRequest(http.MethodGet, c.base+imagePath(bakeID, name), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach peer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer returned %s for image %s/%s", resp.Status, bakeID, name)
+	}
+	return n.SaveImage(bakeID, name, resp.Body)
+}
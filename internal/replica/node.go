@@ -0,0 +1,388 @@
+package replica
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// Node keeps one server's data in sync with peers. Events are identified by
+// ID and never change, so bakes merge as the union of their events; deletes
+// and restores of events and bakes are last-writer-wins registers.
+type Node struct {
+	store   storage.Store
+	dataDir string
+
+	mu    sync.Mutex // Guards state
+	state *state
+
+	runMu sync.Mutex // One sync or merge at a time
+
+	token string // API token sent to peers that require authentication
+}
+
+// New loads the sync state for dataDir and starts recording local deletes and restores
+func New(store storage.Store, dataDir string) (*Node, error) {
+	st, err := loadState(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{store: store, dataDir: dataDir, state: st}
+	if err := n.save(); err != nil {
+		return nil, err
+	}
+	store.Subscribe(n.watch)
+	return n, nil
+}
+
+// NodeID returns this server's sync identity
+func (n *Node) NodeID() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state.NodeID
+}
+
+// save persists the state; the caller must not hold n.mu
+func (n *Node) save() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state.save(n.dataDir)
+}
+
+// watch records local deletes and restores in the registers
+func (n *Node) watch(change storage.Change) {
+	now := time.Now()
+	n.mu.Lock()
+	regs := &n.state.Registers
+	changed := false
+	switch change.Op {
+	case storage.OpDeleteEvent:
+		// Deletes applied by sync already have their register
+		if key := change.Event.Key(); !regs.Events[key].Deleted {
+			regs.Events[key] = Register{Deleted: true, At: now}
+			changed = true
+		}
+	case storage.OpInsertEvent:
+		if key := change.Event.Key(); regs.Events[key].Deleted {
+			regs.Events[key] = Register{Deleted: false, At: now}
+			changed = true
+		}
+	case storage.OpDeleteBake:
+		if !regs.Bakes[change.BakeID].Deleted {
+			regs.Bakes[change.BakeID] = Register{Deleted: true, At: now}
+			changed = true
+		}
+	case storage.OpRestore:
+		if regs.Bakes[change.BakeID].Deleted {
+			regs.Bakes[change.BakeID] = Register{Deleted: false, At: now}
+			changed = true
+		}
+	}
+	n.mu.Unlock()
+
+	if changed {
+		if err := n.save(); err != nil {
+			log.Printf("Warning: Failed to save sync state: %v", err)
+		}
+	}
+}
+
+// registers returns a copy of the current registers
+func (n *Node) registers() Registers {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	regs := Registers{Events: map[string]Register{}, Bakes: map[string]Register{}}
+	regs.merge(n.state.Registers)
+	return regs
+}
+
+// BakeSummary describes one bake in a snapshot
+type BakeSummary struct {
+	ID     string   `json:"id"`
+	Digest string   `json:"digest"` // Hash of the event keys, equal when both sides hold the same events
+	Images []string `json:"images,omitempty"`
+}
+
+// Snapshot is what a node tells its peers about its data
+type Snapshot struct {
+	NodeID    string        `json:"node_id"`
+	Bakes     []BakeSummary `json:"bakes"`
+	Registers Registers     `json:"registers"`
+}
+
+// Snapshot summarises the local bakes and registers
+func (n *Node) Snapshot() (*Snapshot, error) {
+	ids, err := n.store.ListBakes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bakes: %w", err)
+	}
+
+	snap := &Snapshot{NodeID: n.NodeID(), Bakes: []BakeSummary{}, Registers: n.registers()}
+	for _, id := range ids {
+		bake, err := n.store.ReadBake(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bake %s: %w", id, err)
+		}
+		if len(bake.Events) == 0 {
+			continue
+		}
+		snap.Bakes = append(snap.Bakes, BakeSummary{ID: id, Digest: digest(bake.Events), Images: n.images(id)})
+	}
+	return snap, nil
+}
+
+// digest hashes the sorted event keys of a bake
+func digest(events []models.Event) string {
+	keys := make([]string, len(events))
+	for i := range events {
+		keys[i] = events[i].Key()
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// images lists a bake's image files
+func (n *Node) images(bakeID string) []string {
+	entries, err := os.ReadDir(filepath.Dir(n.store.GetImagePath(bakeID, "x")))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// Events returns a bake's events for a peer, or nil if the bake doesn't exist
+func (n *Node) Events(bakeID string) ([]models.Event, error) {
+	bake, err := n.store.ReadBake(bakeID)
+	if err != nil {
+		return nil, nil
+	}
+	return bake.Events, nil
+}
+
+// mergeEvents returns the union of two event lists by key, without deleted
+// events, in timestamp order
+func mergeEvents(local, remote []models.Event, regs *Registers) []models.Event {
+	seen := make(map[string]bool)
+	var merged []models.Event
+	for _, list := range [][]models.Event{local, remote} {
+		for _, event := range list {
+			key := event.Key()
+			if seen[key] || regs.eventDeleted(&event) {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, event)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	return merged
+}
+
+// sameEvents reports whether two lists hold the same events in the same order
+func sameEvents(a, b []models.Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key() != b[i].Key() {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeBake merges a peer's copy of a bake into the local one and reports
+// whether the local bake changed
+func (n *Node) MergeBake(bakeID string, events []models.Event) (bool, error) {
+	n.runMu.Lock()
+	defer n.runMu.Unlock()
+	return n.mergeBake(bakeID, events)
+}
+
+// mergeBake merges remote events into a bake; the caller holds runMu. The
+// store holds its lock from reading the local events to writing the merge, so
+// events logged meanwhile aren't lost.
+func (n *Node) mergeBake(bakeID string, remote []models.Event) (bool, error) {
+	if err := validName(bakeID); err != nil {
+		return false, err
+	}
+	for _, event := range remote {
+		if event.Image == "" {
+			continue
+		}
+		if err := validName(event.Image); err != nil {
+			return false, err
+		}
+	}
+
+	regs := n.registers()
+	if regs.Bakes[bakeID].Deleted {
+		return false, nil
+	}
+
+	changed, err := n.store.UpdateBake(bakeID, func(local []models.Event) []models.Event {
+		merged := mergeEvents(local, remote, &regs)
+		if sameEvents(local, merged) {
+			return nil
+		}
+		return merged
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update bake %s: %w", bakeID, err)
+	}
+	return changed, nil
+}
+
+// MergeRegisters takes a peer's registers and applies any deletes or
+// restores that are newer than the local ones
+func (n *Node) MergeRegisters(regs Registers) error {
+	n.runMu.Lock()
+	defer n.runMu.Unlock()
+	return n.mergeRegisters(regs)
+}
+
+// mergeRegisters merges and enforces registers; the caller holds runMu
+func (n *Node) mergeRegisters(regs Registers) error {
+	n.mu.Lock()
+	changed := n.state.Registers.merge(regs)
+	n.mu.Unlock()
+
+	if changed {
+		if err := n.save(); err != nil {
+			return err
+		}
+	}
+	return n.enforce()
+}
+
+// enforce removes local events and bakes that the registers say are deleted.
+// A deleted bake that has events logged after the delete comes back instead.
+func (n *Node) enforce() error {
+	regs := n.registers()
+	ids, err := n.store.ListBakes()
+	if err != nil {
+		return fmt.Errorf("failed to list bakes: %w", err)
+	}
+
+	for _, id := range ids {
+		bake, err := n.store.ReadBake(id)
+		if err != nil || len(bake.Events) == 0 {
+			continue
+		}
+
+		if reg := regs.Bakes[id]; reg.Deleted {
+			last := bake.Events[len(bake.Events)-1].Timestamp
+			if last.After(reg.At) {
+				n.mu.Lock()
+				n.state.Registers.Bakes[id] = Register{Deleted: false, At: last}
+				n.mu.Unlock()
+				if err := n.save(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := n.store.DeleteBake(id); err != nil {
+				return fmt.Errorf("failed to delete bake %s: %w", id, err)
+			}
+			continue
+		}
+
+		// Apply deletes to the bake as stored now, not as read above
+		emptied := false
+		_, err = n.store.UpdateBake(id, func(events []models.Event) []models.Event {
+			kept := mergeEvents(events, nil, &regs)
+			if sameEvents(events, kept) {
+				return nil
+			}
+			emptied = len(kept) == 0
+			return kept
+		})
+		if err == nil && emptied {
+			err = n.store.DeleteBake(id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply deletes to bake %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// ErrInvalidName is returned for bake IDs and image names that could escape their directory
+var ErrInvalidName = errors.New("invalid name")
+
+// validName rejects bake IDs and image names that could escape their directory
+func validName(name string) error {
+	if !storage.ValidName(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// OpenImage opens a bake's image for a peer
+func (n *Node) OpenImage(bakeID, name string) (*os.File, error) {
+	if err := validName(bakeID); err != nil {
+		return nil, err
+	}
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	return os.Open(n.store.GetImagePath(bakeID, name))
+}
+
+// SaveImage stores an image received from a peer unless it already exists
+func (n *Node) SaveImage(bakeID, name string, data io.Reader) error {
+	if err := validName(bakeID); err != nil {
+		return err
+	}
+	if err := validName(name); err != nil {
+		return err
+	}
+
+	path := n.store.GetImagePath(bakeID, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	tempPath := path + ".tmp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create image file: %w", err)
+	}
+	if _, err := io.Copy(f, data); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write image data: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write image data: %w", err)
+	}
+	return os.Rename(tempPath, path)
+}
@@ -0,0 +1,139 @@
+package replica
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+func setupTestNode(t *testing.T) (*Node, storage.Store, string) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-replica-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	store, err := storage.New(tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	node, err := New(store, tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	return node, store, tmpDir
+}
+
+func TestRegisterLastWriterWins(t *testing.T) {
+	now := time.Now()
+	deleted := Register{Deleted: true, At: now}
+	restored := Register{Deleted: false, At: now.Add(time.Minute)}
+
+	if !restored.newer(deleted) || deleted.newer(restored) {
+		t.Error("Expected the later register to win")
+	}
+	if !deleted.newer(Register{Deleted: false, At: now}) {
+		t.Error("Expected delete to win a tie")
+	}
+
+	regs := Registers{Events: map[string]Register{"e1": deleted}, Bakes: map[string]Register{}}
+	if !regs.merge(Registers{Events: map[string]Register{"e1": restored}}) || regs.Events["e1"].Deleted {
+		t.Error("Expected newer restore merged")
+	}
+	if regs.merge(Registers{Events: map[string]Register{"e1": deleted}}) {
+		t.Error("Expected older delete ignored")
+	}
+}
+
+func TestWatchRecordsDeletesAndState(t *testing.T) {
+	node, store, tmpDir := setupTestNode(t)
+	defer os.RemoveAll(tmpDir)
+
+	store.AppendEvent(models.NewEvent(models.EventStarterOut))
+	fed := models.NewEvent(models.EventFed)
+	store.AppendEvent(fed)
+
+	store.DeleteEvent(1, fed.Timestamp.Format(time.RFC3339Nano))
+	if !node.registers().Events[fed.ID].Deleted {
+		t.Fatal("Expected delete recorded")
+	}
+
+	// Undoing the delete revives the event
+	store.InsertEvent(1, fed)
+	if node.registers().Events[fed.ID].Deleted {
+		t.Error("Expected insert to revive the event")
+	}
+
+	// State, including the node ID, survives a restart
+	reloaded, err := New(store, tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to reload node: %v", err)
+	}
+	if reloaded.NodeID() != node.NodeID() {
+		t.Error("Expected node ID to persist")
+	}
+	if _, ok := reloaded.registers().Events[fed.ID]; !ok {
+		t.Error("Expected registers to persist")
+	}
+}
+
+func TestEnforceRevivesBakeWithNewerEvents(t *testing.T) {
+	node, store, tmpDir := setupTestNode(t)
+	defer os.RemoveAll(tmpDir)
+
+	start := time.Now().Add(-time.Hour)
+	store.WriteBake("b1", []models.Event{
+		{Timestamp: start, Event: models.EventStarterOut, ID: "x1"},
+		{Timestamp: start.Add(30 * time.Minute), Event: models.EventFed, ID: "x2"},
+	})
+	store.WriteBake("b2", []models.Event{
+		{Timestamp: start, Event: models.EventStarterOut, ID: "y1"},
+	})
+
+	// A peer deleted b1 before its last event was logged, and b2 after
+	err := node.MergeRegisters(Registers{
+		Events: map[string]Register{},
+		Bakes: map[string]Register{
+			"b1": {Deleted: true, At: start.Add(10 * time.Minute)},
+			"b2": {Deleted: true, At: start.Add(10 * time.Minute)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("MergeRegisters failed: %v", err)
+	}
+
+	bakes, _ := store.ListBakes()
+	if len(bakes) != 1 || bakes[0] != "b1" {
+		t.Errorf("Expected only b1 kept, got %v", bakes)
+	}
+	if node.registers().Bakes["b1"].Deleted {
+		t.Error("Expected b1 revived in the registers")
+	}
+}
+
+func TestMergeBakeRejectsBadID(t *testing.T) {
+	node, store, tmpDir := setupTestNode(t)
+	defer os.RemoveAll(tmpDir)
+
+	events := []models.Event{*models.NewEvent(models.EventStarterOut)}
+	for _, id := range []string{"../../escape", "a/b", ""} {
+		if _, err := node.MergeBake(id, events); err == nil {
+			t.Errorf("Expected %q rejected", id)
+		}
+	}
+	photo := *models.NewEvent(models.EventOvenOut)
+	photo.Image = "../../../etc/passwd"
+	if _, err := node.MergeBake("2025-10-07_19-13-49", append(events, photo)); err == nil {
+		t.Error("Expected an image name outside the images directory rejected")
+	}
+	if ids, _ := store.ListBakes(); len(ids) != 0 {
+		t.Errorf("Expected nothing written, got %v", ids)
+	}
+	if _, err := os.Stat(tmpDir + "/escape.jsonl"); !os.IsNotExist(err) {
+		t.Errorf("Expected no file outside the bakes directory, got %v", err)
+	}
+}
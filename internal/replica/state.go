@@ -0,0 +1,140 @@
+package replica
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// Dir holds sync state, relative to the data directory
+const Dir = "sync"
+
+// stateFile is the sync state inside Dir
+const stateFile = "state.json"
+
+// NodeIDFile holds this server's sync identity inside Dir. It is left out of
+// backups so a server restored from another's backup gets its own identity.
+const NodeIDFile = "node_id"
+
+// Register is a last-writer-wins record of whether an event or bake was deleted.
+// Only items that have been deleted (or restored after a delete) have one.
+type Register struct {
+	Deleted bool      `json:"deleted"`
+	At      time.Time `json:"at"`
+}
+
+// newer reports whether r should replace other; on a tie the delete wins
+func (r Register) newer(other Register) bool {
+	if r.At.Equal(other.At) {
+		return r.Deleted && !other.Deleted
+	}
+	return r.At.After(other.At)
+}
+
+// Registers holds the deletion registers for events (by event key) and bakes (by ID)
+type Registers struct {
+	Events map[string]Register `json:"events"`
+	Bakes  map[string]Register `json:"bakes"`
+}
+
+// merge takes the newer register for every key and reports whether anything changed
+func (r *Registers) merge(other Registers) bool {
+	changed := mergeMap(r.Events, other.Events)
+	return mergeMap(r.Bakes, other.Bakes) || changed
+}
+
+// mergeMap copies newer registers from src into dst
+func mergeMap(dst, src map[string]Register) bool {
+	changed := false
+	for key, reg := range src {
+		if cur, ok := dst[key]; !ok || reg.newer(cur) {
+			dst[key] = reg
+			changed = true
+		}
+	}
+	return changed
+}
+
+// eventDeleted reports whether an event is deleted according to the registers
+func (r *Registers) eventDeleted(event *models.Event) bool {
+	return r.Events[event.Key()].Deleted
+}
+
+// state is persisted between runs
+type state struct {
+	NodeID    string               `json:"-"`
+	Registers Registers            `json:"registers"`
+	Peers     map[string]time.Time `json:"peers"` // Last successful sync per peer URL
+}
+
+// loadState reads the sync state, creating a node ID on first use
+func loadState(dataDir string) (*state, error) {
+	st := &state{
+		Registers: Registers{Events: map[string]Register{}, Bakes: map[string]Register{}},
+		Peers:     map[string]time.Time{},
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, Dir, stateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, st); err != nil {
+			return nil, fmt.Errorf("failed to parse sync state: %w", err)
+		}
+	}
+
+	// Maps may be missing from older or hand-edited files
+	if st.Registers.Events == nil {
+		st.Registers.Events = map[string]Register{}
+	}
+	if st.Registers.Bakes == nil {
+		st.Registers.Bakes = map[string]Register{}
+	}
+	if st.Peers == nil {
+		st.Peers = map[string]time.Time{}
+	}
+
+	id, err := os.ReadFile(filepath.Join(dataDir, Dir, NodeIDFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read node ID: %w", err)
+	}
+	st.NodeID = strings.TrimSpace(string(id))
+	if st.NodeID == "" {
+		st.NodeID = models.NewEventID()
+		if err := os.MkdirAll(filepath.Join(dataDir, Dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create sync directory: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dataDir, Dir, NodeIDFile), []byte(st.NodeID+"\n"), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write node ID: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// save writes the sync state atomically
+func (st *state) save(dataDir string) error {
+	dir := filepath.Join(dataDir, Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create sync directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync state: %w", err)
+	}
+
+	path := filepath.Join(dir, stateFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,455 @@
+package search
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// Index is an in-memory inverted index over bake history.
+// It covers event notes, assessment notes, event types and any free-form
+// strings stored in event data (such as recipe names and tags).
+type Index struct {
+	mu    sync.RWMutex
+	docs  map[string]*document
+	terms map[string]map[string]int // term -> bake ID -> occurrences
+}
+
+// document holds the indexed fields of a single bake
+type document struct {
+	id         string
+	start      time.Time
+	completed  bool
+	eventCount int
+	assessment *models.Assessment
+	events     map[models.EventType]bool
+	texts      []string // Original text fragments, used for result snippets
+	terms      map[string]int
+}
+
+// Query describes a search request. Zero values mean "no filter".
+type Query struct {
+	Text     string
+	MinScore int
+	MaxScore int
+	After    time.Time
+	Before   time.Time
+	Event    models.EventType
+	Proof    models.ProofLevel
+	Limit    int
+}
+
+// Result is a single matching bake
+type Result struct {
+	Date       string             `json:"date"`
+	StartTime  string             `json:"start_time"`
+	EventCount int                `json:"event_count"`
+	Completed  bool               `json:"completed"`
+	Assessment *models.Assessment `json:"assessment,omitempty"`
+	Snippets   []string           `json:"snippets,omitempty"`
+	Rank       int                `json:"rank"`
+}
+
+// Results is the response to a search, including facet counts over all matches
+type Results struct {
+	Query   string                    `json:"query"`
+	Total   int                       `json:"total"`
+	Results []Result                  `json:"results"`
+	Facets  map[string]map[string]int `json:"facets"`
+}
+
+// New creates an empty index
+func New() *Index {
+	return &Index{
+		docs:  make(map[string]*document),
+		terms: make(map[string]map[string]int),
+	}
+}
+
+// Build creates an index from every bake in storage
+func Build(store storage.Store) (*Index, error) {
+	idx := New()
+
+	dates, err := store.ListBakes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bakes: %w", err)
+	}
+
+	for _, date := range dates {
+		bake, err := store.ReadBake(date)
+		if err != nil {
+			continue
+		}
+		idx.Add(date, bake)
+	}
+
+	return idx, nil
+}
+
+// Watch keeps the index up to date with changes written to storage
+func (idx *Index) Watch(store storage.Store) {
+	store.Subscribe(func(change storage.Change) {
+		if change.Op == storage.OpDeleteBake {
+			idx.Remove(change.BakeID)
+			return
+		}
+
+		bake, err := store.ReadBake(change.BakeID)
+		if err != nil {
+			return
+		}
+		idx.Add(change.BakeID, bake)
+	})
+}
+
+// Add indexes a bake, replacing any previous entry with the same ID
+func (idx *Index) Add(id string, bake *models.Bake) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+
+	if len(bake.Events) == 0 {
+		return
+	}
+
+	doc := &document{
+		id:         id,
+		start:      bake.Events[0].Timestamp,
+		completed:  bake.Events[len(bake.Events)-1].Event == models.EventLoafComplete,
+		eventCount: len(bake.Events),
+		assessment: bake.Assessment,
+		events:     make(map[models.EventType]bool),
+		terms:      make(map[string]int),
+	}
+
+	for _, event := range bake.Events {
+		doc.events[event.Event] = true
+		doc.addTerms(string(event.Event))
+		doc.addText(event.Note)
+		for key, value := range event.Data {
+			if key == "assessment" {
+				continue
+			}
+			collectStrings(value, doc.addText)
+		}
+	}
+
+	if bake.Assessment != nil {
+		doc.addText(bake.Assessment.Notes)
+		doc.addTerms(string(bake.Assessment.ProofLevel))
+	}
+
+	idx.docs[id] = doc
+	for term, count := range doc.terms {
+		if idx.terms[term] == nil {
+			idx.terms[term] = make(map[string]int)
+		}
+		idx.terms[term][id] = count
+	}
+}
+
+// Remove drops a bake from the index
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+// remove drops a bake from the index; caller must hold the write lock
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+
+	for term := range doc.terms {
+		delete(idx.terms[term], id)
+		if len(idx.terms[term]) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// Len returns the number of indexed bakes
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Search returns bakes matching every term in the query text and all filters,
+// ordered by relevance and then most recent first
+func (idx *Index) Search(q Query) *Results {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	queryTerms := Tokenize(q.Text)
+
+	var matches []Result
+	for id, doc := range idx.docs {
+		if !doc.matchesFilters(q) {
+			continue
+		}
+
+		rank, ok := idx.rank(id, queryTerms)
+		if !ok {
+			continue
+		}
+
+		matches = append(matches, Result{
+			Date:       id,
+			StartTime:  doc.start.Format("2006-01-02 15:04"),
+			EventCount: doc.eventCount,
+			Completed:  doc.completed,
+			Assessment: doc.assessment,
+			Snippets:   doc.snippets(queryTerms),
+			Rank:       rank,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank > matches[j].Rank
+		}
+		return matches[i].Date > matches[j].Date
+	})
+
+	results := &Results{
+		Query:   q.Text,
+		Total:   len(matches),
+		Results: matches,
+		Facets:  idx.facets(matches),
+	}
+
+	if q.Limit > 0 && len(results.Results) > q.Limit {
+		results.Results = results.Results[:q.Limit]
+	}
+	if results.Results == nil {
+		results.Results = []Result{}
+	}
+
+	return results
+}
+
+// rank scores a document against the query terms. The last term is matched
+// as a prefix so results appear while the user is still typing.
+func (idx *Index) rank(id string, queryTerms []string) (int, bool) {
+	rank := 0
+	for i, term := range queryTerms {
+		count := idx.terms[term][id]
+		if count == 0 && i == len(queryTerms)-1 {
+			for indexed, postings := range idx.terms {
+				if strings.HasPrefix(indexed, term) {
+					count += postings[id]
+				}
+			}
+		}
+		if count == 0 {
+			return 0, false
+		}
+		rank += count
+	}
+	return rank, true
+}
+
+// facets counts proof levels, scores and event types across all matches
+func (idx *Index) facets(matches []Result) map[string]map[string]int {
+	facets := map[string]map[string]int{
+		"proof_level": {},
+		"score":       {},
+		"event":       {},
+		"status":      {},
+	}
+
+	for _, m := range matches {
+		doc := idx.docs[m.Date]
+		if doc.assessment != nil {
+			if doc.assessment.ProofLevel != "" {
+				facets["proof_level"][string(doc.assessment.ProofLevel)]++
+			}
+			if doc.assessment.Score > 0 {
+				facets["score"][strconv.Itoa(doc.assessment.Score)]++
+			}
+		}
+		for eventType := range doc.events {
+			facets["event"][string(eventType)]++
+		}
+		if doc.completed {
+			facets["status"]["completed"]++
+		} else {
+			facets["status"]["in-progress"]++
+		}
+	}
+
+	return facets
+}
+
+// matchesFilters checks the structured (non-text) parts of a query
+func (d *document) matchesFilters(q Query) bool {
+	score := 0
+	if d.assessment != nil {
+		score = d.assessment.Score
+	}
+
+	if q.MinScore > 0 && score < q.MinScore {
+		return false
+	}
+	if q.MaxScore > 0 && (score == 0 || score > q.MaxScore) {
+		return false
+	}
+	if !q.After.IsZero() && d.start.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !d.start.Before(q.Before) {
+		return false
+	}
+	if q.Event != "" && !d.events[q.Event] {
+		return false
+	}
+	if q.Proof != "" && (d.assessment == nil || d.assessment.ProofLevel != q.Proof) {
+		return false
+	}
+	return true
+}
+
+// addText indexes a free-text fragment and keeps it for snippets
+func (d *document) addText(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	d.texts = append(d.texts, text)
+	d.addTerms(text)
+}
+
+// addTerms indexes the tokens of a string without keeping it for snippets
+func (d *document) addTerms(text string) {
+	for _, term := range Tokenize(text) {
+		d.terms[term]++
+	}
+}
+
+// snippets returns the text fragments that contain any query term
+func (d *document) snippets(queryTerms []string) []string {
+	if len(queryTerms) == 0 {
+		return nil
+	}
+
+	var snippets []string
+	for _, text := range d.texts {
+		for _, textTerm := range Tokenize(text) {
+			if containsPrefix(queryTerms, textTerm) {
+				snippets = append(snippets, text)
+				break
+			}
+		}
+	}
+	return snippets
+}
+
+// containsPrefix reports whether term starts with any of the query terms
+func containsPrefix(queryTerms []string, term string) bool {
+	for _, q := range queryTerms {
+		if strings.HasPrefix(term, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectStrings walks decoded JSON data and passes every string value to fn
+func collectStrings(value interface{}, fn func(string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case []interface{}:
+		for _, item := range v {
+			collectStrings(item, fn)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			collectStrings(item, fn)
+		}
+	}
+}
+
+// Tokenize splits text into lowercase search terms.
+// Letters and digits form terms; everything else (including "%" and "-") separates them.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ParseQuery builds a Query from URL parameters.
+// Supported parameters: q, score (exact), score>=N, score<=N, min_score, max_score,
+// after and before (YYYY-MM-DD), event, proof and limit.
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{
+		Text:  values.Get("q"),
+		Event: models.EventType(values.Get("event")),
+		Proof: models.ProofLevel(values.Get("proof")),
+	}
+
+	var err error
+
+	// "score>=8" arrives as key "score>" with value "8"
+	if q.MinScore, err = intParam(values, "score>", "min_score", "score"); err != nil {
+		return Query{}, err
+	}
+	if q.MaxScore, err = intParam(values, "score<", "max_score", "score"); err != nil {
+		return Query{}, err
+	}
+	if q.Limit, err = intParam(values, "limit"); err != nil {
+		return Query{}, err
+	}
+	if q.After, err = dateParam(values, "after"); err != nil {
+		return Query{}, err
+	}
+	if q.Before, err = dateParam(values, "before"); err != nil {
+		return Query{}, err
+	}
+
+	return q, nil
+}
+
+// intParam returns the first non-empty integer value among the given keys
+func intParam(values url.Values, keys ...string) (int, error) {
+	for _, key := range keys {
+		raw := values.Get(key)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s value: %s", strings.TrimRight(key, "<>"), raw)
+		}
+		return n, nil
+	}
+	return 0, nil
+}
+
+// dateParam parses a YYYY-MM-DD value in local time
+func dateParam(values url.Values, key string) (time.Time, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s date (expected YYYY-MM-DD): %s", key, raw)
+	}
+	return t, nil
+}
@@ -0,0 +1,140 @@
+package search
+
+import (
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+func testBake(start time.Time, note string, score int, proof models.ProofLevel) *models.Bake {
+	bake := &models.Bake{
+		Events: []models.Event{
+			{Timestamp: start, Event: models.EventStarterOut},
+			{Timestamp: start.Add(time.Hour), Event: models.EventMixed, Note: note},
+			{Timestamp: start.Add(2 * time.Hour), Event: models.EventFold},
+			{Timestamp: start.Add(20 * time.Hour), Event: models.EventLoafComplete},
+		},
+	}
+	if score > 0 {
+		bake.Assessment = &models.Assessment{ProofLevel: proof, Score: score, Notes: "crumb was open"}
+	}
+	return bake
+}
+
+func TestSearchText(t *testing.T) {
+	idx := New()
+	day := time.Date(2025, 10, 1, 8, 0, 0, 0, time.Local)
+
+	idx.Add("2025-10-01_08-00-00", testBake(day, "Tried 80% hydration", 8, models.ProofGood))
+	idx.Add("2025-10-05_08-00-00", testBake(day.AddDate(0, 0, 4), "75% hydration, rye", 6, models.ProofUnder))
+	idx.Add("2025-10-09_08-00-00", testBake(day.AddDate(0, 0, 8), "Whole wheat", 9, models.ProofGood))
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"Single term", "hydration", []string{"2025-10-05_08-00-00", "2025-10-01_08-00-00"}},
+		{"All terms must match", "80 hydration", []string{"2025-10-01_08-00-00"}},
+		{"Prefix on last term", "hydra", []string{"2025-10-05_08-00-00", "2025-10-01_08-00-00"}},
+		{"Assessment notes", "crumb", []string{"2025-10-09_08-00-00", "2025-10-05_08-00-00", "2025-10-01_08-00-00"}},
+		{"Event type", "fold", []string{"2025-10-09_08-00-00", "2025-10-05_08-00-00", "2025-10-01_08-00-00"}},
+		{"No match", "spelt", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := idx.Search(Query{Text: tt.query})
+			if len(results.Results) != len(tt.want) {
+				t.Fatalf("Expected %d results, got %d", len(tt.want), len(results.Results))
+			}
+			for i, id := range tt.want {
+				if results.Results[i].Date != id {
+					t.Errorf("Result %d: expected %s, got %s", i, id, results.Results[i].Date)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	idx := New()
+	day := time.Date(2025, 10, 1, 8, 0, 0, 0, time.Local)
+
+	idx.Add("2025-10-01_08-00-00", testBake(day, "first", 8, models.ProofGood))
+	idx.Add("2025-10-05_08-00-00", testBake(day.AddDate(0, 0, 4), "second", 6, models.ProofUnder))
+	idx.Add("2025-10-09_08-00-00", testBake(day.AddDate(0, 0, 8), "third", 0, ""))
+
+	values, _ := url.ParseQuery("score>=8")
+	q, err := ParseQuery(values)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if results := idx.Search(q); results.Total != 1 || results.Results[0].Date != "2025-10-01_08-00-00" {
+		t.Errorf("score>=8: expected only first bake, got %+v", results.Results)
+	}
+
+	values, _ = url.ParseQuery("after=2025-10-03")
+	q, _ = ParseQuery(values)
+	if results := idx.Search(q); results.Total != 2 {
+		t.Errorf("after: expected 2 results, got %d", results.Total)
+	}
+
+	values, _ = url.ParseQuery("proof=underproofed")
+	q, _ = ParseQuery(values)
+	results := idx.Search(q)
+	if results.Total != 1 || results.Results[0].Date != "2025-10-05_08-00-00" {
+		t.Errorf("proof: expected second bake, got %+v", results.Results)
+	}
+	if results.Facets["proof_level"]["underproofed"] != 1 {
+		t.Errorf("Expected proof_level facet count 1, got %v", results.Facets["proof_level"])
+	}
+
+	if _, err := ParseQuery(url.Values{"after": {"yesterday"}}); err == nil {
+		t.Error("Expected error for invalid date")
+	}
+}
+
+func TestSearchWatchesStorage(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-search-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store, err := storage.New(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	store.AppendEvent(models.NewEvent(models.EventStarterOut).WithNote("existing levain"))
+
+	idx, err := Build(store)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	idx.Watch(store)
+
+	if idx.Len() != 1 {
+		t.Fatalf("Expected 1 indexed bake, got %d", idx.Len())
+	}
+
+	store.AppendEvent(models.NewEvent(models.EventMixed).WithNote("added seeded flour"))
+
+	results := idx.Search(Query{Text: "seeded"})
+	if results.Total != 1 {
+		t.Fatalf("Expected appended note to be searchable, got %d results", results.Total)
+	}
+
+	if err := store.DeleteBake(results.Results[0].Date); err != nil {
+		t.Fatalf("DeleteBake failed: %v", err)
+	}
+
+	if idx.Len() != 0 {
+		t.Errorf("Expected deleted bake to be removed from index, got %d", idx.Len())
+	}
+}
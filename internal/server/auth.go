@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+)
+
+// openPaths are reachable without logging in
+var openPaths = map[string]bool{
+	"/health":       true,
+	"/health/live":  true,
+	"/health/ready": true,
+	"/login":        true,
+	"/logout":       true,
+
+	// Phones need the CA before they can trust the login page
+	"/ca":              true,
+	"/ca.pem":          true,
+	"/ca.mobileconfig": true,
+
+	// Browsers fetch the manifest and icons without cookies; the service
+	// worker and its script must load before login to queue offline events
+	"/manifest.webmanifest": true,
+	"/sw.js":                true,
+	"/pwa.js":               true,
+	"/icon-192.png":         true,
+	"/icon-512.png":         true,
+}
+
+// logPath reports whether a log-only session may reach path: logging an
+// event and undoing it from the page a signed QR link opened
+func logPath(path string) bool {
+	return strings.HasPrefix(path, "/log/") || path == "/loaf/start" || path == "/bake/start" || path == "/undo"
+}
+
+// loginFailureDelay slows down PIN guessing
+const loginFailureDelay = time.Second
+
+// userKey is the request context key for the authenticated user
+type userKey struct{}
+
+// EnableAuth requires a PIN session, API token or signed link for every
+// request except /health, /login, /logout and the CA downloads
+func (s *Server) EnableAuth(a *auth.Auth) {
+	s.auth = a
+}
+
+// withUser returns r carrying the authenticated user, and records the user
+// for the request log
+func withUser(r *http.Request, user string) *http.Request {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.user = user
+	}
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
+
+// requestUser returns who made a request: the authenticated user, else the
+// baker picked on /profile, else ""
+func requestUser(r *http.Request) string {
+	if user, _ := r.Context().Value(userKey{}).(string); user != "" {
+		return user
+	}
+	return validBakerCookie(r)
+}
+
+// authMiddleware identifies the user of each request and, when a PIN is set,
+// rejects requests without a session, token or signed link
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil || openPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !s.auth.Enabled() {
+			// Without a PIN, signed links can still say who they log events for
+			if user, ok := s.auth.VerifyLink(r.URL); ok && r.Method == http.MethodGet {
+				r = withUser(r, user)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, method := s.auth.Authenticate(r)
+		if method == auth.MethodNone || (method == auth.MethodLogSession && !logPath(r.URL.Path)) {
+			s.denyAccess(w, r)
+			return
+		}
+
+		// A signed QR link opens a page whose buttons post back to the server,
+		// so let the phone log events for a little while. The link is no
+		// login: the cookie reaches nothing but the logging paths.
+		if method == auth.MethodLink {
+			setSessionCookie(w, r, auth.LogSessionCookie, s.auth.NewLogSession(user, auth.LinkSessionLifetime), auth.LinkSessionLifetime)
+		}
+
+		next.ServeHTTP(w, withUser(r, user))
+	})
+}
+
+// denyAccess sends browsers to the login page and API clients a 401
+func (s *Server) denyAccess(w http.ResponseWriter, r *http.Request) {
+	isAPI := strings.HasPrefix(r.URL.Path, "/api/") || r.Header.Get("Authorization") != ""
+	if r.Method == http.MethodGet && !isAPI {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="sourdough"`)
+	http.Error(w, "Authentication required", http.StatusUnauthorized)
+}
+
+// setSessionCookie stores a session in the browser
+func setSessionCookie(w http.ResponseWriter, r *http.Request, name, value string, lifetime time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(lifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// safeNext only allows redirects back to this server
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/view/status"
+	}
+	return next
+}
+
+// authEnabled reports whether a PIN is set, so requests are logged in
+func (s *Server) authEnabled() bool {
+	return s.auth != nil && s.auth.Enabled()
+}
+
+// handleLogin shows the PIN form and starts a session
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled() {
+		http.Redirect(w, r, "/view/status", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.renderLogin(w, r.URL.Query().Get("next"), "", "", http.StatusOK)
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+		next := r.FormValue("next")
+		user := strings.TrimSpace(r.FormValue("user"))
+
+		if err := auth.ValidUser(user); err != nil {
+			s.renderLogin(w, next, user, "Enter your name (letters, digits, spaces, dots or dashes)", http.StatusBadRequest)
+			return
+		}
+		if !s.auth.CheckPIN(r.FormValue("pin")) {
+			time.Sleep(loginFailureDelay)
+			s.renderLogin(w, next, user, "Wrong PIN", http.StatusUnauthorized)
+			return
+		}
+
+		setSessionCookie(w, r, auth.SessionCookie, s.auth.NewSession(user, auth.SessionLifetime), auth.SessionLifetime)
+		http.Redirect(w, r, safeNext(next), http.StatusSeeOther)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderLogin writes the login page
+func (s *Server) renderLogin(w http.ResponseWriter, next, user, msg string, status int) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, loginPageHTML, html.EscapeString(msg), html.EscapeString(next), html.EscapeString(user))
+}
+
+// handleLogout ends the browser session
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{auth.SessionCookie, auth.LogSessionCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// loginPageHTML asks for a name and the household PIN
+const loginPageHTML = `<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>Log In</title><style>body{font-family:sans-serif;background:#667eea;color:white;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0;padding:20px;text-align:center;}form{background:white;color:#333;border-radius:20px;padding:30px;max-width:320px;width:100%%;}h1{font-size:32px;margin:0 0 20px 0;}input{display:block;width:100%%;box-sizing:border-box;font-size:20px;padding:12px;margin:0 0 15px 0;border:2px solid #ddd;border-radius:10px;}button{width:100%%;font-size:20px;padding:14px;border:none;border-radius:10px;background:#667eea;color:white;}.error{color:#dc2626;margin:0 0 15px 0;min-height:1em;}</style></head><body><form method="POST" action="/login"><h1>🍞 Sourdough</h1><p class="error">%s</p><input type="hidden" name="next" value="%s"><input name="user" placeholder="Your name" value="%s" autocomplete="username" required><input name="pin" type="password" inputmode="numeric" placeholder="Household PIN" autocomplete="current-password" required><button type="submit">Log In</button></form></body></html>`
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// setupAuthServer returns a server with the household PIN set to 1234
+func setupAuthServer(t *testing.T) (*Server, *auth.Auth, string) {
+	server, tmpDir := setupTestServer(t)
+	a, err := auth.New(tmpDir, "1234")
+	if err != nil {
+		cleanup(tmpDir)
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+	server.EnableAuth(a)
+	return server, a, tmpDir
+}
+
+func TestAuthRequired(t *testing.T) {
+	server, _, tmpDir := setupAuthServer(t)
+	defer cleanup(tmpDir)
+	handler := server.Handler()
+
+	// Health checks stay open
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /health open, got %d", w.Code)
+	}
+
+	// Browsers are sent to the login page
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/view/history", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?next=%2Fview%2Fhistory" {
+		t.Errorf("Expected redirect to login, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	// API clients get a 401
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodDelete, "/api/bake/2025-01-01", nil),
+		httptest.NewRequest(http.MethodPost, "/api/event/delete", nil),
+		httptest.NewRequest(http.MethodPost, "/log/fold", nil),
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %s %s, got %d", req.Method, req.URL.Path, w.Code)
+		}
+	}
+}
+
+func TestLoginAndAttribution(t *testing.T) {
+	server, _, tmpDir := setupAuthServer(t)
+	defer cleanup(tmpDir)
+	handler := server.Handler()
+
+	login := func(pin string) *httptest.ResponseRecorder {
+		form := url.Values{"user": {"alice"}, "pin": {pin}, "next": {"/view/status"}}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := login("0000"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected wrong PIN rejected, got %d", w.Code)
+	}
+
+	w := login("1234")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/view/status" {
+		t.Fatalf("Expected redirect after login, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.SessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Expected session cookie, got %+v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/loaf/start", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected logged-in request allowed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if bake.Events[0].User != "alice" {
+		t.Errorf("Expected event logged by alice, got %q", bake.Events[0].User)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	server, a, tmpDir := setupAuthServer(t)
+	defer cleanup(tmpDir)
+	handler := server.Handler()
+
+	token, _ := a.CreateToken("bob")
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	req := httptest.NewRequest(http.MethodPost, "/log/fed", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected token accepted, got %d", w.Code)
+	}
+
+	last, _ := server.storage.GetLastEvent()
+	if last.User != "bob" {
+		t.Errorf("Expected event logged by bob, got %q", last.User)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/log/fed", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected bad token rejected, got %d", w.Code)
+	}
+}
+
+func TestSignedQRLink(t *testing.T) {
+	server, a, tmpDir := setupAuthServer(t)
+	defer cleanup(tmpDir)
+	handler := server.Handler()
+
+	// A QR code for /loaf/start keeps working with auth enabled
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, a.SignPath("/loaf/start", "", time.Time{}), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected signed link allowed, got %d", w.Code)
+	}
+
+	// The page it opens can post back for a while
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.LogSessionCookie || cookies[0].MaxAge != int(auth.LinkSessionLifetime.Seconds()) {
+		t.Fatalf("Expected short log-only session cookie, got %+v", cookies)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/log/oven-in?temp=475", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected post from QR page allowed, got %d", w.Code)
+	}
+
+	// But a scanned or previewed link is no login for the rest of the server
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/view/history", nil),
+		httptest.NewRequest(http.MethodGet, "/api/backup", nil),
+		httptest.NewRequest(http.MethodPost, "/api/sync", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/bake/2025-01-01", nil),
+	} {
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther && w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s %s denied to a QR link session, got %d", req.Method, req.URL.Path, w.Code)
+		}
+	}
+
+	// Nor can it be passed off as a full session
+	req = httptest.NewRequest(http.MethodGet, "/api/bakes", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: cookies[0].Value})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a log-only session rejected as a full session, got %d", w.Code)
+	}
+
+	// A link signed for another path does not work
+	link := strings.Replace(a.SignPath("/log/fed", "", time.Time{}), "/log/fed", "/log/fold", 1)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("Expected tampered link sent to login, got %d", w.Code)
+	}
+}
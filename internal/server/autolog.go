@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/config"
+	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// AutoLog controls the scheduled temperature log. During cold retard the
+// fridge sensor is read instead of the kitchen one; without a fridge sensor
+// retard readings are skipped.
+type AutoLog struct {
+	// Schedule is the time between readings in each stage, aligned to
+	// midnight. A stage that is missing or 0 is not logged.
+	Schedule map[models.Stage]time.Duration
+}
+
+// DefaultAutoLog logs the kitchen every 4 hours until the dough goes in the
+// fridge, and the fridge hourly during retard if there is a fridge sensor
+var DefaultAutoLog = AutoLog{Schedule: map[models.Stage]time.Duration{
+	models.StageStarter: 4 * time.Hour,
+	models.StageBulk:    4 * time.Hour,
+	models.StageShaped:  4 * time.Hour,
+	models.StageRetard:  time.Hour,
+}}
+
+// String describes the schedule for logs, e.g. "starter 4h, bulk 30m, retard off"
+func (a AutoLog) String() string {
+	parts := make([]string, 0, len(models.Stages))
+	for _, stage := range models.Stages {
+		parts = append(parts, fmt.Sprintf("%s %s", stage, config.Interval(a.Schedule[stage])))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SetAutoLog changes the auto-log schedule
+func (s *Server) SetAutoLog(a AutoLog) {
+	s.autoLog = a
+}
+
+// SetFridgeSensor sets the sensor read during cold retard
+func (s *Server) SetFridgeSensor(c *ecobee.Client) {
+	s.fridge = c
+}
+
+// autoLogEnabled reports whether any stage is scheduled and its sensor configured
+func (s *Server) autoLogEnabled() bool {
+	for stage, interval := range s.autoLog.Schedule {
+		if interval > 0 && s.stageSensor(stage).IsEnabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// stageSensor returns the sensor read in a stage: the fridge during retard, else the kitchen
+func (s *Server) stageSensor(stage models.Stage) *ecobee.Client {
+	if stage == models.StageRetard {
+		return s.fridge
+	}
+	return s.ecobee
+}
+
+// sensorName names the sensor read in a stage
+func sensorName(stage models.Stage) string {
+	if stage == models.StageRetard {
+		return "fridge"
+	}
+	return "kitchen"
+}
+
+// watchStages wakes the scheduler after every write, since a new event may
+// start a stage with a different schedule
+func (s *Server) watchStages(store storage.Store) {
+	store.Subscribe(func(storage.Change) {
+		select {
+		case s.autoLogWake <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// autoLogPlan is the next scheduled reading, or why there is none
+type autoLogPlan struct {
+	Stage    models.Stage
+	Sensor   string // kitchen or fridge
+	Interval time.Duration
+	Next     *time.Time // nil when nothing is scheduled
+	Reason   string     // Why nothing is scheduled
+}
+
+// planAutoLog works out the next reading for the active bake's stage
+func (s *Server) planAutoLog(now time.Time) (autoLogPlan, error) {
+	bake, err := s.storage.ReadCurrentBake()
+	if err != nil {
+		return autoLogPlan{}, fmt.Errorf("failed to read current bake: %w", err)
+	}
+	if len(bake.Events) == 0 {
+		return autoLogPlan{Reason: "no active bake"}, nil
+	}
+
+	stage := bake.CurrentStage()
+	plan := autoLogPlan{Stage: stage, Sensor: sensorName(stage), Interval: s.autoLog.Schedule[stage]}
+	switch {
+	case plan.Interval <= 0:
+		plan.Reason = fmt.Sprintf("off during %s", stage)
+	case !s.stageSensor(stage).IsEnabled():
+		plan.Reason = fmt.Sprintf("no %s sensor configured", plan.Sensor)
+	default:
+		next := getNextLogTime(now, plan.Interval)
+		plan.Next = &next
+	}
+	return plan, nil
+}
+
+// autoLogTemperature logs temperatures on each stage's schedule, aligned to
+// midnight (every 4 hours is 12am, 4am, 8am, 12pm, 4pm, 8pm), until ctx is cancelled
+func (s *Server) autoLogTemperature(ctx context.Context) {
+	log.Printf("Automatic temperature logging enabled (%s)", s.autoLog)
+
+	var announced time.Time
+	for {
+		// Without a scheduled reading, wait for the next write
+		wait := time.Duration(-1)
+		plan, err := s.planAutoLog(time.Now())
+		if err != nil {
+			// Try again shortly rather than waiting for the next write
+			log.Printf("Warning: Failed to plan auto-log: %v", err)
+			wait = time.Minute
+		} else if plan.Next != nil {
+			wait = time.Until(*plan.Next)
+			if !plan.Next.Equal(announced) {
+				log.Printf("Next auto-log of %s temperature (%s, every %s) at %s", plan.Sensor, plan.Stage, config.Interval(plan.Interval), plan.Next.Format("3:04 PM"))
+				announced = *plan.Next
+			}
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-s.autoLogWake:
+			// An event was logged; the stage and schedule may have changed
+		case <-due:
+			if err == nil {
+				s.logTemperature(ctx)
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// getNextLogTime returns the next multiple of interval after midnight, e.g.
+// 00:00, 04:00, 08:00, 12:00, 16:00 or 20:00 for 4 hours
+func getNextLogTime(now time.Time, interval time.Duration) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	elapsed := now.Sub(midnight)
+	return midnight.Add((elapsed/interval + 1) * interval)
+}
+
+// logTemperature reads the current stage's sensor and logs it to the active bake
+func (s *Server) logTemperature(ctx context.Context) {
+	plan, err := s.planAutoLog(time.Now())
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		s.metrics.autoLogRuns.Inc("failed")
+		return
+	}
+	if plan.Next == nil {
+		log.Printf("Skipping auto-log: %s", plan.Reason)
+		s.metrics.autoLogRuns.Inc("skipped")
+		return
+	}
+
+	// Fetch temperature from Home Assistant
+	var temp float64
+	if plan.Stage == models.StageRetard {
+		temp, err = s.fridge.GetTemperature(ctx)
+	} else {
+		temp, err = s.fetchKitchenTemp(ctx)
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to auto-log %s temperature: %v", plan.Sensor, err)
+		s.metrics.autoLogRuns.Inc("failed")
+		return
+	}
+
+	// 0 means the sensor isn't set up; only a fridge can read below zero
+	if temp == 0 || (plan.Stage != models.StageRetard && temp < 0) {
+		log.Printf("Warning: Invalid %s temperature: %.1f", plan.Sensor, temp)
+		s.metrics.autoLogRuns.Inc("failed")
+		return
+	}
+
+	event := models.NewEvent(models.EventTemperature)
+	if plan.Stage == models.StageRetard {
+		event.WithFridgeTemp(temp)
+	} else {
+		event.WithTemp(temp)
+	}
+
+	// Save event
+	if err := s.storage.AppendEvent(event); err != nil {
+		log.Printf("Error: Failed to save auto-logged temperature: %v", err)
+		s.metrics.autoLogRuns.Inc("failed")
+		return
+	}
+
+	log.Printf("Auto-logged %s temperature: %.1f°F", plan.Sensor, temp)
+	s.metrics.autoLogRuns.Inc("logged")
+}
+
+// handleAPIAutoLog returns the auto-log schedule and the next scheduled reading
+func (s *Server) handleAPIAutoLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	plan, err := s.planAutoLog(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error planning auto-log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !s.autoLogEnabled() {
+		plan.Next, plan.Reason = nil, "disabled"
+	}
+
+	schedule := make(map[models.Stage]string, len(models.Stages))
+	for _, stage := range models.Stages {
+		schedule[stage] = config.Interval(s.autoLog.Schedule[stage]).String()
+	}
+
+	response := map[string]interface{}{
+		"enabled":  s.autoLogEnabled(),
+		"schedule": schedule,
+		"sensors": map[string]bool{
+			"kitchen": s.ecobee.IsEnabled(),
+			"fridge":  s.fridge.IsEnabled(),
+		},
+		"stage":    plan.Stage,
+		"sensor":   plan.Sensor,
+		"next_run": plan.Next,
+	}
+	if plan.Interval > 0 {
+		response["interval"] = config.Interval(plan.Interval).String()
+	}
+	if plan.Reason != "" {
+		response["reason"] = plan.Reason
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// fakeSensor is a Home Assistant that reports a fixed temperature for any entity
+func fakeSensor(state string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"state": %q}`, state)
+	}))
+}
+
+func TestAutoLogPerStage(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	kitchen := fakeSensor("71.5")
+	defer kitchen.Close()
+	server.ecobee = ecobee.New(kitchen.URL, "token", "sensor.kitchen")
+	server.SetAutoLog(AutoLog{Schedule: map[models.Stage]time.Duration{
+		models.StageStarter: 2 * time.Hour,
+		models.StageBulk:    30 * time.Minute,
+		models.StageRetard:  time.Hour,
+	}})
+
+	now := time.Date(2026, 3, 14, 10, 20, 0, 0, time.Local)
+	tests := []struct {
+		event  models.EventType
+		stage  models.Stage
+		next   string // "" when nothing is scheduled
+		reason string
+	}{
+		{models.EventStarterOut, models.StageStarter, "12:00", ""},
+		{models.EventMixed, models.StageBulk, "10:30", ""},
+		{models.EventNote, models.StageBulk, "10:30", ""},
+		{models.EventShaped, models.StageShaped, "", "off during shaped"},
+		{models.EventFridgeIn, models.StageRetard, "", "no fridge sensor configured"},
+	}
+	for _, tt := range tests {
+		event := models.NewEvent(tt.event)
+		if tt.event == models.EventNote {
+			event.WithNote("smells great")
+		}
+		server.storage.AppendEvent(event)
+
+		plan, err := server.planAutoLog(now)
+		if err != nil {
+			t.Fatalf("planAutoLog failed: %v", err)
+		}
+		next := ""
+		if plan.Next != nil {
+			next = plan.Next.Format("15:04")
+		}
+		if plan.Stage != tt.stage || next != tt.next || plan.Reason != tt.reason {
+			t.Errorf("After %s: expected %s %q %q, got %s %q %q", tt.event, tt.stage, tt.next, tt.reason, plan.Stage, next, plan.Reason)
+		}
+	}
+
+	// No kitchen reading while the dough is in the fridge
+	server.logTemperature(context.Background())
+	bake, _ := server.storage.ReadCurrentBake()
+	if last := bake.Events[len(bake.Events)-1]; last.Event == models.EventTemperature {
+		t.Errorf("Expected no reading during retard without a fridge sensor, got %+v", last)
+	}
+
+	// With a fridge sensor, retard logs the fridge
+	fridge := fakeSensor("38.2")
+	defer fridge.Close()
+	server.SetFridgeSensor(ecobee.New(fridge.URL, "token", "sensor.fridge"))
+	server.logTemperature(context.Background())
+
+	bake, _ = server.storage.ReadCurrentBake()
+	last := bake.Events[len(bake.Events)-1]
+	if last.Event != models.EventTemperature || last.FridgeTempF == nil || *last.FridgeTempF != 38.2 || last.TempF != nil {
+		t.Errorf("Expected a fridge reading of 38.2, got %+v", last)
+	}
+}
+
+func TestAutoLogFollowsStageChanges(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	kitchen := fakeSensor("72")
+	defer kitchen.Close()
+	server.ecobee = ecobee.New(kitchen.URL, "token", "sensor.kitchen")
+
+	// Nothing during the starter stage, very often during bulk
+	server.SetAutoLog(AutoLog{Schedule: map[models.Stage]time.Duration{models.StageBulk: 20 * time.Millisecond}})
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.autoLogTemperature(ctx)
+		close(done)
+	}()
+
+	readings := func() int {
+		bake, _ := server.storage.ReadCurrentBake()
+		n := 0
+		for _, e := range bake.Events {
+			if e.Event == models.EventTemperature {
+				n++
+			}
+		}
+		return n
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := readings(); n != 0 {
+		t.Fatalf("Expected no readings during starter, got %d", n)
+	}
+
+	// Mixing starts bulk, which the scheduler picks up without a restart
+	server.storage.AppendEvent(models.NewEvent(models.EventMixed))
+	deadline := time.Now().Add(2 * time.Second)
+	for readings() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := readings(); n < 2 {
+		t.Errorf("Expected bulk readings, got %d", n)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Scheduler didn't stop")
+	}
+}
+
+func TestAPIAutoLog(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	kitchen := fakeSensor("72")
+	defer kitchen.Close()
+	server.ecobee = ecobee.New(kitchen.URL, "token", "sensor.kitchen")
+	server.storage.AppendEvent(models.NewEvent(models.EventFold))
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/autolog", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Enabled  bool              `json:"enabled"`
+		Schedule map[string]string `json:"schedule"`
+		Stage    string            `json:"stage"`
+		Sensor   string            `json:"sensor"`
+		Interval string            `json:"interval"`
+		NextRun  *time.Time        `json:"next_run"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !response.Enabled || response.Stage != "bulk" || response.Sensor != "kitchen" || response.Interval != "4h" {
+		t.Errorf("Unexpected response %+v", response)
+	}
+	if response.Schedule["retard"] != "1h" || response.Schedule["bake"] != "off" {
+		t.Errorf("Unexpected schedule %v", response.Schedule)
+	}
+	if response.NextRun == nil || !response.NextRun.After(time.Now()) || response.NextRun.Hour()%4 != 0 {
+		t.Errorf("Expected the next 4-hour slot, got %v", response.NextRun)
+	}
+}
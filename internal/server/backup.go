@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/backup"
+	"github.com/mdeckert/sourdough/internal/certs"
+	"github.com/mdeckert/sourdough/internal/replica"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// ConfigureBackup enables /api/backup for dataDir and, when schedule is
+// non-nil, periodic backups once the server starts
+func (s *Server) ConfigureBackup(dataDir string, schedule *backup.Schedule) {
+	s.dataDir = dataDir
+	s.backupSchedule = schedule
+}
+
+// backupOptions snapshots the database instead of copying it when the store
+// supports it. Without secrets, the local CA key and the auth signing secret
+// are left out, for archives that leave this machine.
+func (s *Server) backupOptions(secrets bool) backup.Options {
+	// A restored copy must not share this server's sync identity
+	opts := backup.Options{Exclude: []string{filepath.Join(s.dataDir, replica.Dir, replica.NodeIDFile)}}
+	if !secrets {
+		opts.Exclude = append(opts.Exclude, filepath.Join(s.dataDir, certs.Dir), filepath.Join(s.dataDir, auth.Dir))
+	}
+	if snapshotter, ok := s.backend().(storage.Snapshotter); ok {
+		opts.Snapshot = snapshotter
+	}
+	return opts
+}
+
+// scheduledBackups writes a backup every interval and applies the retention
+// rules until ctx is cancelled. A backup in progress is finished first.
+func (s *Server) scheduledBackups(ctx context.Context) {
+	sched := s.backupSchedule
+	log.Printf("Scheduled backups enabled: every %s to %s", sched.Interval, sched.Dir)
+
+	// Catch up first if the last backup is older than the interval
+	if !sleepContext(ctx, sched.NextRun(time.Now())) {
+		return
+	}
+	s.runBackup()
+
+	ticker := time.NewTicker(sched.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runBackup()
+		}
+	}
+}
+
+// runBackup writes one scheduled backup and prunes old ones
+func (s *Server) runBackup() (string, *backup.Manifest, error) {
+	sched := s.backupSchedule
+	path, manifest, err := backup.WriteFile(sched.Dir, s.dataDir, s.backupOptions(true))
+	if err != nil {
+		log.Printf("Error: Scheduled backup failed: %v", err)
+		return "", nil, err
+	}
+	log.Printf("Backed up %d files to %s", len(manifest.Files), path)
+
+	deleted, err := backup.Prune(sched.Dir, sched.Keep, sched.MaxAge)
+	if err != nil {
+		log.Printf("Warning: Failed to prune old backups: %v", err)
+	}
+	for _, old := range deleted {
+		log.Printf("Deleted old backup %s", old)
+	}
+	return path, manifest, nil
+}
+
+// handleAPIBackup downloads a backup archive (GET) or, with scheduled
+// backups configured, writes one to the backup directory now (POST)
+func (s *Server) handleAPIBackup(w http.ResponseWriter, r *http.Request) {
+	if s.dataDir == "" {
+		http.Error(w, "Backups not configured", http.StatusServiceUnavailable)
+		return
+	}
+	// Archives hold every note and photo, so never hand them to the whole LAN
+	if !s.authEnabled() {
+		http.Error(w, "Set a PIN (SOURDOUGH_PIN) to use /api/backup", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", backup.FileName(time.Now())))
+		// Headers are already sent once streaming starts, so failures can only be logged
+		if _, err := backup.Create(w, s.dataDir, s.backupOptions(false)); err != nil {
+			log.Printf("Error: Backup download failed: %v", err)
+		}
+
+	case http.MethodPost:
+		if s.backupSchedule == nil {
+			http.Error(w, "No backup directory configured (set SOURDOUGH_BACKUP_DIR)", http.StatusServiceUnavailable)
+			return
+		}
+		path, manifest, err := s.runBackup()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Backup failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "backed up",
+			"path":   path,
+			"files":  len(manifest.Files),
+			"bytes":  manifest.TotalSize(),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
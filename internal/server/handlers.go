@@ -1,42 +1,155 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/backup"
 	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/export"
+	"github.com/mdeckert/sourdough/internal/homeassistant"
 	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/profiles"
+	"github.com/mdeckert/sourdough/internal/replica"
+	"github.com/mdeckert/sourdough/internal/search"
 	"github.com/mdeckert/sourdough/internal/storage"
+	"github.com/mdeckert/sourdough/internal/webhook"
 )
 
 // Server handles HTTP requests
 type Server struct {
-	storage *storage.Storage
+	storage storage.Store
 	ecobee  *ecobee.Client
+	search  *search.Index
 	port    string
+
+	journal    journal       // Recent actions for /undo
+	undoWindow time.Duration // How long an action can be undone
+
+	dataDir        string           // Archived by /api/backup
+	backupSchedule *backup.Schedule // Periodic backups, nil when disabled
+
+	replica   *replica.Node // Sync with other servers, nil when disabled
+	syncPeers []string      // Peers POST /api/sync may start a sync with
+
+	auth     *auth.Auth // PIN, token and signed-link checks, nil when disabled
+	linkMode LinkMode   // What unsigned GETs to logging URLs do
+
+	profiles *profiles.Registry // Bakers in the household, nil when disabled
+
+	tls *TLSConfig // HTTPS certificate, nil for plain HTTP
+
+	autoLog     AutoLog        // Scheduled temperature readings per stage
+	autoLogWake chan struct{}  // Signalled on every write, since the stage may have changed
+	fridge      *ecobee.Client // Fridge sensor read during cold retard
+	qrDir       string         // Where qrgen wrote the QR sheets
+
+	publisher   *homeassistant.Client // Where the bake state is published, disabled by default
+	publishWake chan struct{}         // Signalled on every write to publish the change
+	reminders   Reminders             // When folds are due
+
+	mqtt    *MQTTConfig // MQTT broker for commands and events, nil when disabled
+	mqttOut chan []byte // Appended events waiting to be published
+
+	webhooks *webhook.Dispatcher // Signed deliveries of bake changes, nil when disabled
+
+	replayLocks keyLocks // Serializes /log/* requests that share an idempotency key
+
+	stream *hub // Bake changes for live pages at /api/events/stream
+
+	shutdownTimeout time.Duration // How long Run waits for in-flight requests
+	draining        atomic.Bool   // Set once shutdown starts; /health/ready fails
+
+	metrics *serverMetrics // Served at /metrics
 }
 
 // New creates a new Server instance
-func New(storage *storage.Storage, ecobeeClient *ecobee.Client, port string) *Server {
-	return &Server{
-		storage: storage,
+func New(storage storage.Store, ecobeeClient *ecobee.Client, port string) *Server {
+	// Build the search index from existing bakes and keep it updated on writes
+	index, err := search.Build(storage)
+	if err != nil {
+		log.Printf("Warning: Failed to build search index: %v", err)
+		index = search.New()
+	}
+	index.Watch(storage)
+
+	m := newServerMetrics()
+	s := &Server{
+		storage: &timedStore{Store: storage, metrics: m},
 		ecobee:  ecobeeClient,
+		search:  index,
 		port:    port,
+
+		undoWindow: DefaultUndoWindow,
+		linkMode:   LinkOpen,
+
+		autoLog:     DefaultAutoLog,
+		autoLogWake: make(chan struct{}, 1),
+		fridge:      ecobee.New("", "", ""),
+		qrDir:       DefaultQRDir,
+
+		publisher:   homeassistant.New("", ""),
+		publishWake: make(chan struct{}, 1),
+		reminders:   DefaultReminders,
+
+		mqttOut: make(chan []byte, mqttQueueSize),
+
+		stream: newHub(streamBuffer),
+
+		shutdownTimeout: DefaultShutdownTimeout,
+
+		metrics: m,
 	}
+	s.watchTemperatures(storage)
+	s.watchStages(storage)
+	s.watchBakeState(storage)
+	s.watchEvents(storage)
+	s.watchStream(storage)
+	m.registry.GaugeFunc("sourdough_active_bake_age_seconds", "Time since the active bake started.", s.activeBakeAge)
+	m.registry.GaugeFunc("sourdough_webhook_queue_length", "Webhook deliveries waiting to be sent.", s.webhookQueueLength)
+	m.registry.GaugeFunc("sourdough_stream_clients", "Open live update streams.", s.streamClients)
+	return s
+}
+
+// DefaultQRDir is where qrgen writes the QR sheets by default
+const DefaultQRDir = "./qrcodes"
+
+// SetQRDir sets where /qrcodes.pdf is served from
+func (s *Server) SetQRDir(dir string) {
+	s.qrDir = dir
 }
 
-// Start starts the HTTP server
+// SetUndoWindow sets how long after an action /undo can still revert it
+func (s *Server) SetUndoWindow(d time.Duration) {
+	s.undoWindow = d
+}
+
+// Start serves until the process exits. Use Run to shut down gracefully.
 func (s *Server) Start() error {
+	return s.Run(context.Background())
+}
+
+// Handler returns the server's routes wrapped in auth and logging middleware
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Register handlers
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/health/live", s.handleLiveness)
+	mux.HandleFunc("/health/ready", s.handleReadiness)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 	mux.HandleFunc("/loaf/start", s.handleLoafStart)
 	mux.HandleFunc("/bake/start", s.handleLoafStart) // Legacy support
 	mux.HandleFunc("/log/oven-in", s.handleOvenInLog) // Must be before /log/
@@ -45,145 +158,78 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/status", s.handleStatus)
 	mux.HandleFunc("/view/status", s.handleViewStatus)
 	mux.HandleFunc("/view/history", s.handleViewHistory)
+	mux.HandleFunc("/kiosk", s.handleKiosk)
 	mux.HandleFunc("/api/bake/current", s.handleAPICurrentBake)
 	mux.HandleFunc("/api/bake/", s.handleAPIBake)
 	mux.HandleFunc("/api/bakes", s.handleAPIBakesList)
+	mux.HandleFunc("/api/bakes/export", s.handleAPIBakesExport)
+	mux.HandleFunc("/api/search", s.handleAPISearch)
+	mux.HandleFunc("/api/autolog", s.handleAPIAutoLog)
+	mux.HandleFunc("/api/sensors", s.handleAPISensors)
+	mux.HandleFunc("/api/kiosk", s.handleAPIKiosk)
+	mux.HandleFunc("/api/webhooks", s.handleAPIWebhooks)
 	mux.HandleFunc("/api/event/delete", s.handleDeleteEvent)
+	mux.HandleFunc("/api/events/stream", s.handleEventStream)
+	mux.HandleFunc("/undo", s.handleUndo)
+	mux.HandleFunc("/api/undo", s.handleAPIUndo)
+	mux.HandleFunc("/api/backup", s.handleAPIBackup)
+	mux.HandleFunc("/api/trash", s.handleAPITrash)
+	mux.HandleFunc("/api/trash/", s.handleAPITrash)
 	mux.HandleFunc("/temp", s.handleTempPage)
 	mux.HandleFunc("/notes", s.handleNotesPage)
 	mux.HandleFunc("/complete", s.handleCompletePage)
 	mux.HandleFunc("/ingredients", s.handleIngredientsPage)
 	mux.HandleFunc("/qrcodes.pdf", s.handleQRCodePDF)
 	mux.HandleFunc("/images/", s.handleImage)
-
-	// Start automatic temperature logging if Ecobee is enabled
-	if s.ecobee.IsEnabled() {
-		go s.autoLogTemperature()
-	}
-
-	// Wrap mux with logging middleware
-	handler := s.loggingMiddleware(mux)
-
-	addr := fmt.Sprintf(":%s", s.port)
-	log.Printf("Starting server on %s", addr)
-	return http.ListenAndServe(addr, handler)
+	mux.HandleFunc("/api/sync", s.handleAPISync)
+	mux.HandleFunc("/api/sync/", s.handleAPISync)
+	mux.HandleFunc("/profile", s.handleProfilePage)
+	mux.HandleFunc("/api/profiles", s.handleAPIProfiles)
+	mux.HandleFunc("/api/profiles/", s.handleAPIProfiles)
+	mux.HandleFunc("/login", s.handleLogin)
+	mux.HandleFunc("/logout", s.handleLogout)
+	mux.HandleFunc("/ca", s.handleCAPage)
+	mux.HandleFunc("/ca.pem", s.handleCACert)
+	mux.HandleFunc("/ca.mobileconfig", s.handleCAProfile)
+	mux.HandleFunc("/manifest.webmanifest", s.handleManifest)
+	mux.HandleFunc("/sw.js", s.handleServiceWorker)
+	mux.HandleFunc("/pwa.js", s.handlePWAScript)
+	mux.HandleFunc("/icon-192.png", s.handleIcon)
+	mux.HandleFunc("/icon-512.png", s.handleIcon)
+
+	// Wrap mux with auth and logging middleware
+	return s.loggingMiddleware(mux, s.authMiddleware(mux))
 }
 
-// autoLogTemperature logs kitchen temperature on a fixed schedule (12am, 4am, 8am, 12pm, 4pm, 8pm)
-func (s *Server) autoLogTemperature() {
-	log.Printf("Automatic temperature logging enabled (every 4 hours on fixed schedule)")
-
-	// Calculate time until next scheduled log
-	now := time.Now()
-	nextLog := getNextLogTime(now)
-	duration := nextLog.Sub(now)
-
-	log.Printf("Next auto-log scheduled for: %s (in %s)", nextLog.Format("3:04 PM"), duration.Round(time.Minute))
-
-	// Initial delay to sync with schedule
-	time.Sleep(duration)
-
-	// Log immediately at the scheduled time
-	s.logTemperature()
-
-	// Then log every 4 hours
-	ticker := time.NewTicker(4 * time.Hour)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		s.logTemperature()
-	}
-}
-
-// getNextLogTime returns the next scheduled log time (00:00, 04:00, 08:00, 12:00, 16:00, 20:00)
-func getNextLogTime(now time.Time) time.Time {
-	// Round to next 4-hour boundary
-	hour := now.Hour()
-	nextHour := ((hour / 4) + 1) * 4
-	if nextHour >= 24 {
-		nextHour = 0
-	}
-
-	next := time.Date(now.Year(), now.Month(), now.Day(), nextHour, 0, 0, 0, now.Location())
-	if next.Before(now) {
-		next = next.Add(24 * time.Hour)
-	}
-
-	return next
-}
-
-// logTemperature performs the actual temperature logging
-func (s *Server) logTemperature() {
-	// Check if there's an active bake
-	hasBake, err := s.storage.HasCurrentBake()
-	if err != nil {
-		log.Printf("Warning: Failed to check for active bake: %v", err)
-		return
-	}
-
-	if !hasBake {
-		log.Printf("Skipping auto-log: no active bake")
+// handleHealth returns a simple health check, with any data-integrity warnings
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Check if bake has reached fridge-in stage
-	bake, err := s.storage.ReadCurrentBake()
-	if err != nil {
-		log.Printf("Warning: Failed to read current bake: %v", err)
-		return
+	response := map[string]interface{}{
+		"status": "ok",
 	}
 
-	// Stop auto-logging if fridge-in has been reached
-	for _, event := range bake.Events {
-		if event.Event == models.EventFridgeIn {
-			log.Printf("Skipping auto-log: bake has reached fridge-in stage")
-			return
+	// Data-integrity problems don't make the server unhealthy, but they should be seen
+	if checker, ok := s.backend().(storage.IntegrityChecker); ok {
+		issues, err := checker.IntegrityIssues()
+		if err != nil {
+			response["status"] = "degraded"
+			response["warnings"] = []string{fmt.Sprintf("integrity check failed: %v", err)}
+		} else if len(issues) > 0 {
+			warnings := make([]string, len(issues))
+			for i, issue := range issues {
+				warnings[i] = issue.String()
+			}
+			response["status"] = "degraded"
+			response["warnings"] = warnings
 		}
 	}
 
-	// Fetch temperature from Ecobee
-	temp, err := s.ecobee.GetTemperature()
-	if err != nil {
-		log.Printf("Warning: Failed to auto-log temperature: %v", err)
-		return
-	}
-
-	if temp <= 0 {
-		log.Printf("Warning: Invalid temperature from Ecobee: %.1f", temp)
-		return
-	}
-
-	// Create temperature event
-	event := models.NewEvent(models.EventTemperature).WithTemp(temp)
-
-	// Save event
-	if err := s.storage.AppendEvent(event); err != nil {
-		log.Printf("Error: Failed to save auto-logged temperature: %v", err)
-		return
-	}
-
-	log.Printf("Auto-logged kitchen temperature: %.1f°F", temp)
-}
-
-// loggingMiddleware logs all requests
-func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		next.ServeHTTP(w, r)
-	})
-}
-
-// handleHealth returns a simple health check
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "ok",
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 // handleLoafStart starts a new loaf
@@ -194,7 +240,8 @@ func (s *Server) handleLoafStart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if there's already an active loaf
-	hasBake, err := s.storage.HasCurrentBake()
+	store := s.storeFor(requestUser(r))
+	hasBake, err := store.HasCurrentBake()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error checking current loaf: %v", err), http.StatusInternalServerError)
 		return
@@ -202,7 +249,7 @@ func (s *Server) handleLoafStart(w http.ResponseWriter, r *http.Request) {
 
 	if hasBake {
 		// Show nice message if accessed from browser
-		if r.Method == http.MethodGet {
+		if wantsPage(r) {
 			w.Header().Set("Content-Type", "text/html")
 			w.Write([]byte(`<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>Already Started</title><style>body{font-family:sans-serif;background:#f59e0b;color:white;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0;padding:20px;text-align:center;}h1{font-size:48px;margin:0 0 10px 0;}p{font-size:20px;margin:0;}</style></head><body><div><h1>⚠️</h1><h1>Already Started</h1><p>You already started a loaf!</p></div></body></html>`))
 			return
@@ -211,6 +258,10 @@ func (s *Server) handleLoafStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.checkLogLink(w, r, "Start a new loaf") {
+		return
+	}
+
 	// Create starter-out event to begin the bake
 	event := models.NewEvent(models.EventStarterOut)
 
@@ -221,21 +272,26 @@ func (s *Server) handleLoafStart(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := s.storage.AppendEvent(event); err != nil {
+	event.WithUser(requestUser(r))
+	s.withProfile(event)
+	bakeID, err := store.InsertEventByTime(event)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Error starting loaf: %v", err), http.StatusInternalServerError)
 		return
 	}
+	undoID := s.recordAction(r, actionStart, bakeID, event, 0)
 
 	// Show nice success message if accessed from browser
-	if r.Method == http.MethodGet {
+	if wantsPage(r) {
 		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(`<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>Loaf Started</title><style>body{font-family:sans-serif;background:#10b981;color:white;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0;padding:20px;text-align:center;}h1{font-size:48px;margin:0 0 10px 0;}p{font-size:20px;margin:0;}</style></head><body><div><h1>✅</h1><h1>Loaf Started!</h1><p>Your loaf has been logged</p></div></body></html>`))
+		w.Write([]byte(`<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>Loaf Started</title><style>body{font-family:sans-serif;background:#10b981;color:white;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0;padding:20px;text-align:center;}h1{font-size:48px;margin:0 0 10px 0;}p{font-size:20px;margin:0;}</style></head><body><div><h1>✅</h1><h1>Loaf Started!</h1><p>Your loaf has been logged</p><p><a href="/undo?id=` + strconv.Itoa(undoID) + `" style="color:white;">↩️ Undo</a></p></div></body></html>`))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"status": "loaf started",
+		"status":  "loaf started",
+		"undo_id": strconv.Itoa(undoID),
 	})
 }
 
@@ -256,6 +312,13 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Requests replayed from a phone's offline queue carry a key and the original time
+	rp, done, ok := s.beginReplay(w, r)
+	if !ok {
+		return
+	}
+	defer done()
+
 	var event *models.Event
 
 	// Handle note logging: /log/note (expects multipart form or JSON body)
@@ -300,7 +363,7 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 
 				// Save image with timestamp-based filename
 				imageFilename = fmt.Sprintf("%d.jpg", time.Now().UnixMilli())
-				if err := s.storage.SaveImage(imageFilename, file); err != nil {
+				if err := s.storeFor(requestUser(r)).SaveImage(imageFilename, file); err != nil {
 					http.Error(w, fmt.Sprintf("Failed to save image: %v", err), http.StatusInternalServerError)
 					return
 				}
@@ -338,63 +401,16 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 		if doughTemp != nil {
 			event.WithDoughTemp(*doughTemp)
 		}
-	} else if parts[0] == "temp" {
-		// Handle temperature logging: /log/temp/76
-		if len(parts) < 2 {
-			http.Error(w, "Temperature value required", http.StatusBadRequest)
-			return
-		}
-
-		temp, err := strconv.ParseFloat(parts[1], 64)
-		if err != nil {
-			http.Error(w, "Invalid temperature value", http.StatusBadRequest)
-			return
-		}
-
-		event = models.NewEvent(models.EventTemperature)
-
-		// Check temperature type: dough/loaf, oven, or kitchen
-		tempType := r.URL.Query().Get("type")
-		if tempType == "dough" {
-			// Dough or loaf internal temp (both use dough_temp_f)
-			event.WithDoughTemp(temp)
-		} else if tempType == "oven" {
-			// Oven temperature
-			event.WithOvenTemp(temp)
-		} else {
-			// Kitchen temp (manual, since auto-logged via Ecobee)
-			event.WithTemp(temp)
-		}
 	} else {
-		// Handle regular events
-		eventType := models.EventType(parts[0])
-
-		// Validate event type
-		validEvents := map[models.EventType]bool{
-			models.EventStarterOut:   true,
-			models.EventFed:          true,
-			models.EventLevainReady:  true,
-			models.EventMixed:        true,
-			models.EventKnead:        true,
-			models.EventFold:         true,
-			models.EventShaped:       true,
-			models.EventFridgeIn:     true,
-			models.EventFridgeOut:    true,
-			models.EventOvenIn:       true,
-			models.EventRemoveLid:    true,
-			models.EventOvenOut:      true,
-			models.EventLoafComplete: true,
-		}
-
-		if !validEvents[eventType] {
-			http.Error(w, fmt.Sprintf("Invalid event type: %s", eventType), http.StatusBadRequest)
+		var err error
+		event, err = s.newLogEvent(parts, r.URL.Query(), requestUser(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		event = models.NewEvent(eventType)
-
 		// Handle loaf-complete with assessment data (from web UI)
-		if eventType == models.EventLoafComplete && r.Method == http.MethodPost {
+		if event.Event == models.EventLoafComplete && r.Method == http.MethodPost {
 			var reqData struct {
 				Assessment models.Assessment `json:"assessment"`
 			}
@@ -405,57 +421,24 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 				event.Data["assessment"] = reqData.Assessment
 			}
 		}
-
-		// Handle fold count
-		if eventType == models.EventFold {
-			// Try to get fold count from last event
-			lastEvent, _ := s.storage.GetLastEvent()
-			foldCount := 1
-			if lastEvent != nil && lastEvent.Event == models.EventFold && lastEvent.FoldCount != nil {
-				foldCount = *lastEvent.FoldCount + 1
-			}
-			event.WithFoldCount(foldCount)
-		}
-
-		// Check for temperature in query params
-		if tempStr := r.URL.Query().Get("temp"); tempStr != "" {
-			if temp, err := strconv.ParseFloat(tempStr, 64); err == nil {
-				event.WithTemp(temp)
-			}
-		}
-
-		if doughTempStr := r.URL.Query().Get("dough_temp"); doughTempStr != "" {
-			if temp, err := strconv.ParseFloat(doughTempStr, 64); err == nil {
-				event.WithDoughTemp(temp)
-			}
-		}
-
-		// Check for note
-		if note := r.URL.Query().Get("note"); note != "" {
-			event.WithNote(note)
-		}
 	}
 
-	// Auto-fetch kitchen temp from Ecobee if enabled and no temp already set
-	// Skip for temperature events (to avoid overwriting manual temps), notes (not relevant),
-	// and when dough temp is set (user is logging dough/oven/loaf temp, don't mix with kitchen temp)
-	if s.ecobee.IsEnabled() && event.Event != models.EventTemperature && event.Event != models.EventNote && event.TempF == nil && event.DoughTempF == nil {
-		if temp, err := s.ecobee.GetTemperature(); err == nil && temp > 0 {
-			event.WithTemp(temp)
-			log.Printf("Auto-fetched kitchen temp from Ecobee: %.1f°F", temp)
-		} else if err != nil {
-			log.Printf("Warning: Failed to fetch Ecobee temp: %v", err)
-		}
+	rp.apply(event)
+
+	if !s.checkLogLink(w, r, "Log "+string(event.Event)) {
+		return
 	}
 
 	// Save event
-	if err := s.storage.AppendEvent(event); err != nil {
+	bakeID, err := s.saveLogEvent(r.Context(), event, requestUser(r))
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Error logging event: %v", err), http.StatusInternalServerError)
 		return
 	}
+	undoID := s.recordAction(r, actionLog, bakeID, event, 0)
 
-	// Show nice success message if accessed from browser (GET request)
-	if r.Method == http.MethodGet {
+	// Show nice success message if accessed from browser (GET request or confirm page)
+	if wantsPage(r) {
 		eventName := string(event.Event)
 		w.Header().Set("Content-Type", "text/html")
 
@@ -465,6 +448,7 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Event Logged</title>
     <style>
         body {
@@ -490,6 +474,7 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
         .event-name { color: #333; font-size: 28px; font-weight: 600; margin-bottom: 10px; }
         .success-msg { color: #059669; font-size: 20px; margin-bottom: 10px; }
         .time { color: #666; font-size: 16px; }
+        .undo-link { display: inline-block; margin-top: 10px; color: #666; font-size: 16px; }
     </style>
 </head>
 <body>
@@ -498,22 +483,130 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
         <div class="event-name">%s</div>
         <p class="success-msg">Event logged successfully</p>
         <p class="time">%s</p>
+        <a class="undo-link" href="/undo?id=%d">↩️ Undo</a>
         %s
     </div>
 </body>
 </html>`
-		successHTML := fmt.Sprintf(htmlTemplate, eventName, event.Timestamp.Format("3:04 PM"), navDropdownHTML)
+		successHTML := fmt.Sprintf(htmlTemplate, eventName, event.Timestamp.Format("3:04 PM"), undoID, navDropdownHTML)
 		w.Write([]byte(successHTML))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "logged",
-		"event":  event,
+		"status":  "logged",
+		"event":   event,
+		"undo_id": undoID,
 	})
 }
 
+// loggableEvents are the workflow events accepted by /log/{event}
+var loggableEvents = map[models.EventType]bool{
+	models.EventStarterOut:   true,
+	models.EventFed:          true,
+	models.EventLevainReady:  true,
+	models.EventMixed:        true,
+	models.EventKnead:        true,
+	models.EventFold:         true,
+	models.EventShaped:       true,
+	models.EventFridgeIn:     true,
+	models.EventFridgeOut:    true,
+	models.EventOvenIn:       true,
+	models.EventRemoveLid:    true,
+	models.EventOvenOut:      true,
+	models.EventLoafComplete: true,
+}
+
+// newLogEvent builds the event for /log/{event} or /log/temp/{value} from the
+// path parts and the temp, dough_temp, note and type parameters. Notes are
+// built by the caller. Errors are written for the person logging.
+func (s *Server) newLogEvent(parts []string, params url.Values, user string) (*models.Event, error) {
+	if parts[0] == "temp" {
+		// Handle temperature logging: /log/temp/76
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("Temperature value required")
+		}
+
+		temp, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid temperature value")
+		}
+
+		event := models.NewEvent(models.EventTemperature)
+
+		// Check temperature type: dough/loaf, oven, or kitchen
+		switch params.Get("type") {
+		case "dough":
+			// Dough or loaf internal temp (both use dough_temp_f)
+			event.WithDoughTemp(temp)
+		case "oven":
+			event.WithOvenTemp(temp)
+		default:
+			// Kitchen temp (manual, since auto-logged via Ecobee)
+			event.WithTemp(temp)
+		}
+		return event, nil
+	}
+
+	// Validate event type
+	eventType := models.EventType(parts[0])
+	if !loggableEvents[eventType] {
+		return nil, fmt.Errorf("Invalid event type: %s", eventType)
+	}
+
+	event := models.NewEvent(eventType)
+
+	// Handle fold count
+	if eventType == models.EventFold {
+		// Try to get fold count from last event
+		lastEvent, _ := s.storeFor(user).GetLastEvent()
+		foldCount := 1
+		if lastEvent != nil && lastEvent.Event == models.EventFold && lastEvent.FoldCount != nil {
+			foldCount = *lastEvent.FoldCount + 1
+		}
+		event.WithFoldCount(foldCount)
+	}
+
+	// Check for temperatures and a note in the parameters
+	if tempStr := params.Get("temp"); tempStr != "" {
+		if temp, err := strconv.ParseFloat(tempStr, 64); err == nil {
+			event.WithTemp(temp)
+		}
+	}
+	if doughTempStr := params.Get("dough_temp"); doughTempStr != "" {
+		if temp, err := strconv.ParseFloat(doughTempStr, 64); err == nil {
+			event.WithDoughTemp(temp)
+		}
+	}
+	if note := params.Get("note"); note != "" {
+		event.WithNote(note)
+	}
+	return event, nil
+}
+
+// saveLogEvent fills in the kitchen temperature where it fits and saves the
+// event, returning the ID of its bake
+func (s *Server) saveLogEvent(ctx context.Context, event *models.Event, user string) (string, error) {
+	// Auto-fetch kitchen temp from Ecobee if enabled and no temp already set
+	// Skip for temperature events (to avoid overwriting manual temps), notes (not relevant),
+	// and when dough temp is set (user is logging dough/oven/loaf temp, don't mix with kitchen temp)
+	// Also skip events replayed from an offline queue, since the reading would be from now
+	if s.ecobee.IsEnabled() && event.Event != models.EventTemperature && event.Event != models.EventNote && event.TempF == nil && event.DoughTempF == nil && time.Since(event.Timestamp) < time.Minute {
+		ctx, cancel := context.WithTimeout(ctx, sensorTimeout)
+		if temp, err := s.fetchKitchenTemp(ctx); err == nil && temp > 0 {
+			event.WithTemp(temp)
+			log.Printf("Auto-fetched kitchen temp from Ecobee: %.1f°F", temp)
+		} else if err != nil {
+			log.Printf("Warning: Failed to fetch Ecobee temp: %v", err)
+		}
+		cancel()
+	}
+
+	event.WithUser(user)
+	return s.storeEvent(event)
+}
+
 // handleStatus returns the current bake status
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -521,7 +614,7 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bake, err := s.storage.ReadCurrentBake()
+	bake, err := s.storeFor(requestUser(r)).ReadCurrentBake()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error reading bake: %v", err), http.StatusInternalServerError)
 		return
@@ -594,8 +687,14 @@ func (s *Server) handleOvenInLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rp, done, ok := s.beginReplay(w, r)
+	if !ok {
+		return
+	}
+	defer done()
+
 	// Check if there's an active bake
-	hasBake, err := s.storage.HasCurrentBake()
+	hasBake, err := s.storeFor(requestUser(r)).HasCurrentBake()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error checking current bake: %v", err), http.StatusInternalServerError)
 		return
@@ -606,19 +705,23 @@ func (s *Server) handleOvenInLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create event with oven temperature
-	event := models.NewEvent(models.EventOvenIn).WithOvenTemp(temp)
+	event := models.NewEvent(models.EventOvenIn).WithOvenTemp(temp).WithUser(requestUser(r))
+	rp.apply(event)
 
-	// Append event to current bake
-	if err := s.storage.AppendEvent(event); err != nil {
+	// Add event to current bake
+	bakeID, err := s.storeEvent(event)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to log event: %v", err), http.StatusInternalServerError)
 		return
 	}
+	undoID := s.recordAction(r, actionLog, bakeID, event, 0)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "success",
-		"event":  event,
+		"status":  "success",
+		"event":   event,
+		"undo_id": undoID,
 	})
 }
 
@@ -649,8 +752,14 @@ func (s *Server) handleRemoveLidLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rp, done, ok := s.beginReplay(w, r)
+	if !ok {
+		return
+	}
+	defer done()
+
 	// Check if there's an active bake
-	hasBake, err := s.storage.HasCurrentBake()
+	hasBake, err := s.storeFor(requestUser(r)).HasCurrentBake()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error checking current bake: %v", err), http.StatusInternalServerError)
 		return
@@ -661,25 +770,41 @@ func (s *Server) handleRemoveLidLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create event with oven temperature
-	event := models.NewEvent(models.EventRemoveLid).WithOvenTemp(temp)
+	event := models.NewEvent(models.EventRemoveLid).WithOvenTemp(temp).WithUser(requestUser(r))
+	rp.apply(event)
 
-	// Append event to current bake
-	if err := s.storage.AppendEvent(event); err != nil {
+	// Add event to current bake
+	bakeID, err := s.storeEvent(event)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to log event: %v", err), http.StatusInternalServerError)
 		return
 	}
+	undoID := s.recordAction(r, actionLog, bakeID, event, 0)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "success",
-		"event":  event,
+		"status":  "success",
+		"event":   event,
+		"undo_id": undoID,
 	})
 }
 
 // handleQRCodePDF serves the QR codes PDF file
 func (s *Server) handleQRCodePDF(w http.ResponseWriter, r *http.Request) {
-	pdfPath := "./qrcodes/qrcodes.pdf"
+	pdfPath := filepath.Join(s.qrDir, "qrcodes.pdf")
+
+	// Bakers get their own sheet from `qrgen --user`, if one was made
+	user := r.URL.Query().Get("user")
+	if user == "" {
+		user = requestUser(r)
+	}
+	if user != "" && auth.ValidUser(user) == nil {
+		userPath := filepath.Join(s.qrDir, user, "qrcodes.pdf")
+		if _, err := os.Stat(userPath); err == nil {
+			pdfPath = userPath
+		}
+	}
 
 	// Check if file exists
 	if _, err := os.Stat(pdfPath); os.IsNotExist(err) {
@@ -720,25 +845,34 @@ func (s *Server) handleAPICurrentBake(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Try to get current bake
-	bake, err := s.storage.ReadCurrentBake()
+	user := requestUser(r)
+	bake, err := s.storeFor(user).ReadCurrentBake()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error reading bake: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// If current bake is empty or completed, get the most recent one
+	// If current bake is empty or completed, get the most recent one, which for
+	// a baker with a profile is the most recent one they started
 	if len(bake.Events) == 0 || (len(bake.Events) > 0 && bake.Events[len(bake.Events)-1].Event == models.EventLoafComplete) {
+		ownOnly := s.profileFor(user) != nil
 		dates, err := s.storage.ListBakes()
-		if err == nil && len(dates) > 0 {
-			// Get most recent bake
-			bake, err = s.storage.ReadBake(dates[0])
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Error reading recent bake: %v", err), http.StatusInternalServerError)
-				return
+		if err == nil {
+			for _, date := range dates {
+				recent, err := s.storage.ReadBake(date)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Error reading recent bake: %v", err), http.StatusInternalServerError)
+					return
+				}
+				if !ownOnly || recent.Baker() == user {
+					bake = recent
+					break
+				}
 			}
 		}
 	}
 
+	setRequestBake(r, strings.TrimPrefix(bake.Filename, "bake_"))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(bake)
 }
@@ -752,6 +886,14 @@ func (s *Server) handleAPIBake(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Export: /api/bake/2025-10-07_19-06/export?format=pdf
+	if strings.HasSuffix(path, "/export") {
+		setRequestBake(r, strings.TrimSuffix(path, "/export"))
+		s.handleAPIBakeExport(w, r, strings.TrimSuffix(path, "/export"))
+		return
+	}
+	setRequestBake(r, path)
+
 	switch r.Method {
 	case http.MethodGet:
 		bake, err := s.storage.ReadBake(path)
@@ -785,6 +927,177 @@ func (s *Server) handleAPIBake(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAPITrash lists deleted bakes (GET /api/trash), restores one
+// (POST /api/trash/{id}/restore) or permanently removes old entries
+// (POST /api/trash/purge?older_than=30d)
+func (s *Server) handleAPITrash(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/trash"), "/")
+
+	writeJSONError := func(status int, err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+
+	switch {
+	case path == "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		entries, err := s.storage.ListTrash()
+		if err != nil {
+			writeJSONError(http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+
+	case path == "purge":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		olderThan := r.URL.Query().Get("older_than")
+		if olderThan == "" {
+			olderThan = "30d"
+		}
+		age, err := storage.ParseAge(olderThan)
+		if err != nil {
+			writeJSONError(http.StatusBadRequest, err)
+			return
+		}
+
+		purged, err := s.storage.PurgeTrash(age)
+		if err != nil {
+			writeJSONError(http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "purged", "purged": purged})
+
+	case strings.HasSuffix(path, "/restore"):
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		trashID := strings.TrimSuffix(path, "/restore")
+		date, err := s.storage.RestoreBake(trashID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, storage.ErrInvalidTrashID):
+				status = http.StatusBadRequest
+			case errors.Is(err, storage.ErrTrashNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, storage.ErrBakeExists):
+				status = http.StatusConflict
+			}
+			writeJSONError(status, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "restored", "date": date})
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// handleAPIBakeExport exports a single bake as CSV, JSON or a printable PDF report
+func (s *Server) handleAPIBakeExport(w http.ResponseWriter, r *http.Request, date string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bake, err := s.storage.ReadBake(date)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading bake: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if len(bake.Events) == 0 {
+		http.Error(w, "Bake not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=bake_%s.%s", date, format))
+
+	switch format {
+	case export.FormatCSV:
+		err = export.WriteBakeCSV(w, bake)
+	case export.FormatPDF:
+		err = export.WriteBakePDF(w, bake, func(filename string) string {
+			return s.storage.GetImagePath(date, filename)
+		})
+	default:
+		err = export.WriteBakeJSON(w, bake)
+	}
+
+	if err != nil {
+		log.Printf("Error exporting bake %s as %s: %v", date, format, err)
+	}
+}
+
+// handleAPIBakesExport exports the whole history, one CSV row per bake or a JSON array of bakes
+func (s *Server) handleAPIBakesExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := export.Format(r.URL.Query().Get("format"))
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatJSON {
+		http.Error(w, "History export supports csv or json", http.StatusBadRequest)
+		return
+	}
+
+	dates, err := s.storage.ListBakes()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing bakes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	bakes := make([]*models.Bake, 0, len(dates))
+	for _, date := range dates {
+		bake, err := s.storage.ReadBake(date)
+		if err != nil || len(bake.Events) == 0 {
+			continue
+		}
+		bakes = append(bakes, bake)
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=sourdough-history.%s", format))
+
+	if format == export.FormatCSV {
+		err = export.WriteHistoryCSV(w, bakes)
+	} else {
+		err = json.NewEncoder(w).Encode(bakes)
+	}
+
+	if err != nil {
+		log.Printf("Error exporting history: %v", err)
+	}
+}
+
 // handleAPIBakesList returns list of all bakes with summary info
 func (s *Server) handleAPIBakesList(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -798,8 +1111,12 @@ func (s *Server) handleAPIBakesList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Filter by baker; without one every bake in the household is listed
+	user := r.URL.Query().Get("user")
+
 	type BakeSummary struct {
 		Date       string              `json:"date"`
+		Baker      string              `json:"baker,omitempty"`
 		StartTime  string              `json:"start_time"`
 		EndTime    string              `json:"end_time,omitempty"`
 		EventCount int                 `json:"event_count"`
@@ -815,8 +1132,14 @@ func (s *Server) handleAPIBakesList(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		baker := bake.Baker()
+		if user != "" && baker != user {
+			continue
+		}
+
 		summary := BakeSummary{
 			Date:       date,
+			Baker:      baker,
 			StartTime:  bake.Events[0].Timestamp.Format("2006-01-02 15:04"),
 			EventCount: len(bake.Events),
 			Assessment: bake.Assessment,
@@ -836,6 +1159,24 @@ func (s *Server) handleAPIBakesList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(summaries)
 }
 
+// handleAPISearch searches bake history
+// Supports: /api/search?q=hydration&score>=8&after=2025-01-01&proof=good&event=knead
+func (s *Server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := search.ParseQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.search.Search(query))
+}
+
 // handleImage serves image files for bakes
 // URL format: /images/bake_YYYY-MM-DD_HH-MM/filename.jpg
 func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
@@ -890,11 +1231,22 @@ func (s *Server) handleDeleteEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep a copy of the event so the delete can be undone
+	store := s.storeFor(requestUser(r))
+	var deleted *models.Event
+	bakeID := ""
+	if bake, err := store.ReadCurrentBake(); err == nil && req.Index >= 0 && req.Index < len(bake.Events) {
+		deleted, bakeID = &bake.Events[req.Index], strings.TrimPrefix(bake.Filename, "bake_")
+	}
+
 	// Delete the event
-	if err := s.storage.DeleteEvent(req.Index, req.Timestamp); err != nil {
+	if err := store.DeleteEvent(req.Index, req.Timestamp); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to delete event: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if deleted != nil {
+		s.recordAction(r, actionDelete, bakeID, deleted, req.Index)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -7,9 +7,15 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/backup"
+	"github.com/mdeckert/sourdough/internal/certs"
 	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/models"
 	"github.com/mdeckert/sourdough/internal/storage"
 )
 
@@ -61,6 +67,32 @@ func TestHealthCheck(t *testing.T) {
 	}
 }
 
+func TestHealthCheckIntegrityWarnings(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	os.WriteFile(filepath.Join(tmpDir, "bake_2024-03-02_08-00-00.jsonl"), []byte("garbage\n"), 0644)
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	w := httptest.NewRecorder()
+	server.handleHealth(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Status   string   `json:"status"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != "degraded" || len(response.Warnings) != 1 {
+		t.Errorf("Expected degraded status with 1 warning, got %+v", response)
+	}
+}
+
 func TestBakeStart(t *testing.T) {
 	server, tmpDir := setupTestServer(t)
 	defer cleanup(tmpDir)
@@ -373,3 +405,252 @@ func TestMethodNotAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestAPISearch(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	// Log a note through the handler so the index is updated on append
+	req := httptest.NewRequest(http.MethodPost, "/log/note", bytes.NewBufferString(`{"note":"Tried 80% hydration"}`))
+	w := httptest.NewRecorder()
+	server.handleLog(w, req)
+
+	tests := []struct {
+		name      string
+		path      string
+		wantCode  int
+		wantTotal int
+	}{
+		{"Matching text", "/api/search?q=hydration", http.StatusOK, 1},
+		{"No match", "/api/search?q=rye", http.StatusOK, 0},
+		{"Score filter excludes unscored", "/api/search?q=hydration&score>=8", http.StatusOK, 0},
+		{"Invalid date", "/api/search?after=soon", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.handleAPISearch(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Total int `json:"total"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Total != tt.wantTotal {
+				t.Errorf("Expected %d results, got %d", tt.wantTotal, response.Total)
+			}
+		})
+	}
+}
+
+func TestAPIBakeExport(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut).WithTemp(72))
+	server.storage.AppendEvent(models.NewEvent(models.EventMixed).WithNote("80% hydration"))
+
+	dates, err := server.storage.ListBakes()
+	if err != nil || len(dates) != 1 {
+		t.Fatalf("Expected one bake, got %v (%v)", dates, err)
+	}
+	base := "/api/bake/" + dates[0] + "/export"
+
+	tests := []struct {
+		name        string
+		path        string
+		wantCode    int
+		contentType string
+	}{
+		{"CSV", base + "?format=csv", http.StatusOK, "text/csv"},
+		{"JSON default", base, http.StatusOK, "application/json"},
+		{"PDF", base + "?format=pdf", http.StatusOK, "application/pdf"},
+		{"Unknown format", base + "?format=xlsx", http.StatusBadRequest, ""},
+		{"Missing bake", "/api/bake/1999-01-01/export?format=csv", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.handleAPIBake(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("Expected content type %s, got %s", tt.contentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// Whole-history CSV has a header and one row per bake
+	req := httptest.NewRequest(http.MethodGet, "/api/bakes/export?format=csv", nil)
+	w := httptest.NewRecorder()
+	server.handleAPIBakesExport(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if lines := strings.Count(strings.TrimSpace(w.Body.String()), "\n") + 1; lines != 2 {
+		t.Errorf("Expected 2 CSV lines, got %d", lines)
+	}
+}
+
+func TestAPITrash(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+	dates, _ := server.storage.ListBakes()
+	if err := server.storage.DeleteBake(dates[0]); err != nil {
+		t.Fatalf("DeleteBake failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/trash", nil)
+	w := httptest.NewRecorder()
+	server.handleAPITrash(w, req)
+
+	var entries []storage.TrashEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(entries) != 1 || entries[0].BakeID != dates[0] {
+		t.Fatalf("Expected 1 trash entry for %s, got %+v", dates[0], entries)
+	}
+
+	// Recent entries survive the default 30 day purge
+	req = httptest.NewRequest(http.MethodPost, "/api/trash/purge", nil)
+	w = httptest.NewRecorder()
+	server.handleAPITrash(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), entries[0].ID) {
+		t.Errorf("Expected nothing purged, got %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/trash/purge?older_than=soon", nil)
+	w = httptest.NewRecorder()
+	server.handleAPITrash(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad age, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/trash/"+entries[0].ID+"/restore", nil)
+	w = httptest.NewRecorder()
+	server.handleAPITrash(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if hasBake, _ := server.storage.HasCurrentBake(); !hasBake {
+		t.Error("Expected restored bake to be active again")
+	}
+
+	// Restoring twice fails
+	w = httptest.NewRecorder()
+	server.handleAPITrash(w, httptest.NewRequest(http.MethodPost, "/api/trash/"+entries[0].ID+"/restore", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleAPITrash(w, httptest.NewRequest(http.MethodPost, "/api/trash/..%5Cescape/restore", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid trash ID, got %d", w.Code)
+	}
+}
+
+func TestAPIBackup(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/backup", nil)
+	w := httptest.NewRecorder()
+	server.handleAPIBackup(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before backups are configured, got %d", w.Code)
+	}
+
+	// Without a PIN anyone on the LAN could download everything
+	server.ConfigureBackup(tmpDir, nil)
+	w = httptest.NewRecorder()
+	server.handleAPIBackup(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without a PIN, got %d", w.Code)
+	}
+
+	a, err := auth.New(tmpDir, "1234")
+	if err != nil {
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+	server.EnableAuth(a)
+	if err := os.MkdirAll(filepath.Join(tmpDir, certs.Dir), 0700); err != nil {
+		t.Fatalf("Failed to create TLS dir: %v", err)
+	}
+	os.WriteFile(filepath.Join(tmpDir, certs.Dir, "ca-key.pem"), []byte("key"), 0600)
+
+	w = httptest.NewRecorder()
+	server.handleAPIBackup(w, req)
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "sourdough-backup-") {
+		t.Errorf("Expected backup file name, got %q", w.Header().Get("Content-Disposition"))
+	}
+	manifest, err := backup.Verify(w.Body)
+	if err != nil {
+		t.Fatalf("Downloaded backup failed verification: %v", err)
+	}
+	// The CA key and auth secret stay on the server
+	if len(manifest.Files) != 1 {
+		t.Errorf("Expected 1 bake file in backup, got %+v", manifest.Files)
+	}
+
+	// POST writes to the backup directory, which lives outside the archive
+	backupDir := filepath.Join(tmpDir, "backups")
+	server.ConfigureBackup(tmpDir, &backup.Schedule{Dir: backupDir, Interval: time.Hour, Keep: 2})
+	for i := 0; i < 2; i++ {
+		req = httptest.NewRequest(http.MethodPost, "/api/backup", nil)
+		w = httptest.NewRecorder()
+		server.handleAPIBackup(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	// Local backups keep the secrets, so a restore doesn't invalidate printed
+	// codes or the CA phones trust: the bake, auth secret and CA key
+	if resp["files"] != float64(3) {
+		t.Errorf("Expected backup directory excluded from archive, got %v", resp)
+	}
+}
+
+func TestGetNextLogTime(t *testing.T) {
+	day := time.Date(2025, 10, 7, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		now      time.Duration
+		interval time.Duration
+		want     time.Duration
+	}{
+		{9*time.Hour + 30*time.Minute, 4 * time.Hour, 12 * time.Hour},
+		{8 * time.Hour, 4 * time.Hour, 12 * time.Hour},
+		{23 * time.Hour, 4 * time.Hour, 24 * time.Hour},
+		{9*time.Hour + 10*time.Minute, 30 * time.Minute, 9*time.Hour + 30*time.Minute},
+	}
+	for _, tt := range tests {
+		if got := getNextLogTime(day.Add(tt.now), tt.interval); !got.Equal(day.Add(tt.want)) {
+			t.Errorf("getNextLogTime(%s, %s) = %s, want %s", tt.now, tt.interval, got.Format("Jan 2 15:04"), day.Add(tt.want).Format("Jan 2 15:04"))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// kioskTemp is a temperature shown on the kiosk and where it came from
+type kioskTemp struct {
+	TempF  float64   `json:"temp_f"`
+	Source string    `json:"source"` // "sensor" for a live reading, "logged" for the latest event
+	At     time.Time `json:"at"`
+}
+
+// kioskState is everything the kiosk displays
+type kioskState struct {
+	Active       bool                 `json:"active"`
+	BakeID       string               `json:"bake_id,omitempty"`
+	Baker        string               `json:"baker,omitempty"`
+	Stage        string               `json:"stage"` // A bake stage, or "idle" between bakes
+	StartedAt    *time.Time           `json:"started_at,omitempty"`
+	LastEvent    *models.Event        `json:"last_event,omitempty"`
+	Folds        int                  `json:"folds"`
+	TargetFolds  int                  `json:"target_folds"`
+	NextReminder *kioskReminder       `json:"next_reminder,omitempty"`
+	Temps        map[string]kioskTemp `json:"temperatures"` // kitchen, dough and fridge, when known
+	Now          time.Time            `json:"now"`          // Server time, to correct the tablet's clock
+}
+
+// kioskReminder is the next step due, e.g. "fold 3"
+type kioskReminder struct {
+	Action string    `json:"action"`
+	Due    time.Time `json:"due"`
+}
+
+// handleKiosk serves the always-on kitchen dashboard
+func (s *Server) handleKiosk(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(kioskPageHTML))
+}
+
+// handleAPIKiosk returns the kiosk's view of the active bake, with live
+// sensor readings where sensors are configured
+func (s *Server) handleAPIKiosk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sensorTimeout)
+	defer cancel()
+	state, err := s.kioskState(ctx, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// kioskState describes the active bake. Kitchen and fridge come from their
+// sensors when configured, else from the latest logged reading; dough
+// temperatures are only ever logged.
+func (s *Server) kioskState(ctx context.Context, now time.Time) (*kioskState, error) {
+	bake, err := s.storage.ReadCurrentBake()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current bake: %w", err)
+	}
+
+	state := &kioskState{
+		Stage:       "idle",
+		TargetFolds: s.reminders.Folds,
+		Temps:       make(map[string]kioskTemp),
+		Now:         now,
+	}
+	if len(bake.Events) > 0 {
+		state.Active = true
+		state.BakeID = strings.TrimPrefix(bake.Filename, "bake_")
+		state.Baker = bake.Baker()
+		state.Stage = string(bake.CurrentStage())
+		state.StartedAt = &bake.Events[0].Timestamp
+		state.LastEvent = &bake.Events[len(bake.Events)-1]
+	}
+
+	for _, e := range bake.Events {
+		if e.Event == models.EventFold {
+			state.Folds++
+		}
+		if e.TempF != nil {
+			state.Temps["kitchen"] = kioskTemp{TempF: *e.TempF, Source: "logged", At: e.Timestamp}
+		}
+		if e.DoughTempF != nil {
+			state.Temps["dough"] = kioskTemp{TempF: *e.DoughTempF, Source: "logged", At: e.Timestamp}
+		}
+		if e.FridgeTempF != nil {
+			state.Temps["fridge"] = kioskTemp{TempF: *e.FridgeTempF, Source: "logged", At: e.Timestamp}
+		}
+	}
+	for name, sensor := range map[string]*ecobee.Client{"kitchen": s.ecobee, "fridge": s.fridge} {
+		if !sensor.IsEnabled() {
+			continue
+		}
+		// A failed read leaves the logged value in place
+		if reading, err := sensor.Read(ctx); err == nil {
+			at := reading.Updated
+			if at.IsZero() {
+				at = reading.FetchedAt
+			}
+			state.Temps[name] = kioskTemp{TempF: reading.TempF, Source: "sensor", At: at}
+		}
+	}
+
+	if r := s.reminders.nextReminder(bake); r != nil {
+		state.NextReminder = &kioskReminder{Action: r.Action, Due: r.Due}
+	}
+	return state, nil
+}
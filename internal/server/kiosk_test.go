@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+func TestAPIKiosk(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	get := func() kioskState {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/kiosk", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var state kioskState
+		if err := json.NewDecoder(w.Body).Decode(&state); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return state
+	}
+
+	if state := get(); state.Active || state.Stage != "idle" || state.LastEvent != nil || len(state.Temps) != 0 {
+		t.Errorf("Expected an idle kiosk, got %+v", state)
+	}
+
+	// Mixed an hour ago, folded ten minutes ago with a dough reading
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	folded := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	mixed := models.NewEvent(models.EventMixed).WithTemp(72)
+	mixed.Timestamp = start
+	fold := models.NewEvent(models.EventFold).WithDoughTemp(77.5).WithFoldCount(1)
+	fold.Timestamp = folded
+	for _, e := range []*models.Event{mixed, fold} {
+		if err := server.storage.AppendEvent(e); err != nil {
+			t.Fatalf("AppendEvent failed: %v", err)
+		}
+	}
+
+	state := get()
+	if !state.Active || state.Stage != "bulk" || state.Folds != 1 || state.TargetFolds != 4 {
+		t.Errorf("Expected bulk with 1 of 4 folds, got %+v", state)
+	}
+	if state.StartedAt == nil || !state.StartedAt.Equal(start) || state.LastEvent == nil || state.LastEvent.Event != models.EventFold {
+		t.Errorf("Expected the bake start and the fold as the last event, got %+v", state)
+	}
+	if r := state.NextReminder; r == nil || r.Action != "fold 2" || !r.Due.Equal(folded.Add(30*time.Minute)) {
+		t.Errorf("Expected fold 2 due 30m after the fold, got %+v", r)
+	}
+	if k := state.Temps["kitchen"]; k.TempF != 72 || k.Source != "logged" {
+		t.Errorf("Expected the logged kitchen temperature, got %+v", k)
+	}
+	if d := state.Temps["dough"]; d.TempF != 77.5 || d.Source != "logged" || !d.At.Equal(folded) {
+		t.Errorf("Expected the logged dough temperature, got %+v", d)
+	}
+
+	// A configured sensor replaces the logged kitchen reading
+	kitchen := fakeSensor("70.2")
+	defer kitchen.Close()
+	server.ecobee = ecobee.New(kitchen.URL, "token", "sensor.kitchen")
+	if k := get().Temps["kitchen"]; k.TempF != 70.2 || k.Source != "sensor" {
+		t.Errorf("Expected the live kitchen reading, got %+v", k)
+	}
+
+	// An unreachable sensor falls back to the logged reading
+	down := fakeSensor("unavailable")
+	defer down.Close()
+	server.ecobee = ecobee.New(down.URL, "token", "sensor.kitchen")
+	if k := get().Temps["kitchen"]; k.TempF != 72 || k.Source != "logged" {
+		t.Errorf("Expected the logged kitchen temperature while the sensor is down, got %+v", k)
+	}
+}
+
+func TestKioskPage(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/kiosk", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	for _, want := range []string{"/api/kiosk", "/api/events/stream", `data-event="fold"`, `data-event="shaped"`, `data-event="fridge-in"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %q in the kiosk page", want)
+		}
+	}
+}
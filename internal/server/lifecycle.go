@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long shutdown waits for in-flight requests
+const DefaultShutdownTimeout = 15 * time.Second
+
+// readHeaderTimeout drops connections that never finish sending headers
+const readHeaderTimeout = 10 * time.Second
+
+// SetShutdownTimeout sets how long Run waits for in-flight requests when stopping
+func (s *Server) SetShutdownTimeout(d time.Duration) {
+	s.shutdownTimeout = d
+}
+
+// Run serves HTTP (or HTTPS) and the background workers until ctx is
+// cancelled. It then stops accepting connections, lets in-flight requests and
+// the current auto-log or backup finish, and returns. The caller closes the
+// store afterwards.
+func (s *Server) Run(ctx context.Context) error {
+	addr := fmt.Sprintf(":%s", s.port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return s.serve(ctx, ln)
+}
+
+// serve runs the server on ln until ctx is cancelled
+func (s *Server) serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: readHeaderTimeout}
+	// Event streams never finish on their own, so end them when draining starts
+	srv.RegisterOnShutdown(s.stream.disconnectAll)
+	if s.tls != nil {
+		config, err := s.tlsConfig()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		srv.TLSConfig = config
+	}
+
+	// Background workers stop between runs once workerCtx is cancelled
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	if s.autoLogEnabled() {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.autoLogTemperature(workerCtx)
+		}()
+	}
+	if s.publisher.IsEnabled() {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.publishBakeState(workerCtx)
+		}()
+	}
+	if s.mqtt != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.runMQTT(workerCtx)
+		}()
+	}
+	if s.webhooks != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.webhooks.Run(workerCtx)
+		}()
+	}
+	if s.backupSchedule != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.scheduledBackups(workerCtx)
+		}()
+	}
+
+	servers := []*http.Server{srv}
+	if s.tls != nil && s.tls.RedirectPort != "" {
+		redirect := &http.Server{
+			Addr:              fmt.Sprintf(":%s", s.tls.RedirectPort),
+			Handler:           s.redirectHandler(),
+			ReadHeaderTimeout: readHeaderTimeout,
+		}
+		servers = append(servers, redirect)
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", redirect.Addr)
+			if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Warning: HTTP redirect stopped: %v", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.tls != nil {
+			log.Printf("Starting HTTPS server on %s", ln.Addr())
+			serveErr <- srv.ServeTLS(ln, "", "")
+		} else {
+			log.Printf("Starting server on %s", ln.Addr())
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+
+	var runErr error
+	select {
+	case err := <-serveErr:
+		runErr = err
+	case <-ctx.Done():
+	}
+
+	// Tell load balancers and monitors to stop sending traffic, then drain
+	s.draining.Store(true)
+	log.Printf("Shutting down: waiting up to %s for in-flight requests", s.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil && runErr == nil {
+			runErr = fmt.Errorf("failed to drain requests: %w", err)
+		}
+	}
+
+	// A worker only notices cancellation between runs, so a write it started finishes
+	stopWorkers()
+	workers.Wait()
+	return runErr
+}
+
+// sleepContext waits for d, returning false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// handleLiveness reports that the process is up and answering requests
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadiness reports whether the server should get traffic: not while
+// shutting down, or when storage can't be read
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	response := map[string]string{"status": "ready"}
+	status := http.StatusOK
+
+	if s.draining.Load() {
+		response["status"] = "shutting down"
+		status = http.StatusServiceUnavailable
+	} else if _, err := s.storage.HasCurrentBake(); err != nil {
+		response["status"] = "unavailable"
+		response["error"] = fmt.Sprintf("storage: %v", err)
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
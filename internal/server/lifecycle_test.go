@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadinessAndLiveness(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+	handler := server.Handler()
+
+	for _, path := range []string{"/health/live", "/health/ready"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected 200 from %s, got %d", path, w.Code)
+		}
+	}
+
+	// Once shutdown starts the server is alive but no longer ready
+	server.draining.Store(true)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 from /health/ready while draining, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 from /health/live while draining, got %d", w.Code)
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- server.serve(ctx, ln) }()
+
+	// Start a request but hold back the end of its body
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	body := `{"note":"still uploading"}`
+	fmt.Fprintf(conn, "POST /log/note HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body[:5])
+	time.Sleep(100 * time.Millisecond)
+
+	// Shutting down now must wait for the request to finish
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.draining.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Server stopped with a request in flight: %v", err)
+	default:
+	}
+
+	fmt.Fprint(conn, body[5:])
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for the drained request, got %d", resp.StatusCode)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop after draining")
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if len(bake.Events) != 1 || bake.Events[0].Note != "still uploading" {
+		t.Errorf("Expected the drained request to be saved, got %v", bake.Events)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+)
+
+// LinkMode controls what a GET without a valid signature does on the logging
+// URLs that QR codes point at
+type LinkMode string
+
+const (
+	// LinkOpen logs unsigned GETs, so codes printed before signing keep working
+	LinkOpen LinkMode = "open"
+	// LinkConfirm asks before logging an unsigned GET, so link previews and
+	// crawlers fetching a URL can't log events
+	LinkConfirm LinkMode = "confirm"
+)
+
+// ParseLinkMode parses a link mode name
+func ParseLinkMode(s string) (LinkMode, error) {
+	switch LinkMode(s) {
+	case LinkOpen, LinkConfirm:
+		return LinkMode(s), nil
+	}
+	return "", fmt.Errorf("unknown link mode %q (use open or confirm)", s)
+}
+
+// SetLinkMode sets how unsigned GET requests to logging URLs are handled
+func (s *Server) SetLinkMode(mode LinkMode) {
+	s.linkMode = mode
+}
+
+// confirmField marks a POST from the confirm page
+const confirmField = "confirmed"
+
+// isConfirmPost reports whether a request comes from the confirm page's button
+func isConfirmPost(r *http.Request) bool {
+	return r.Method == http.MethodPost &&
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") &&
+		r.PostFormValue(confirmField) == "1"
+}
+
+// wantsPage reports whether to answer with an HTML page rather than JSON
+func wantsPage(r *http.Request) bool {
+	return r.Method == http.MethodGet || isConfirmPost(r)
+}
+
+// checkLogLink verifies the signature of a GET that would log something. When
+// the request may not go ahead it writes a confirm or error page and returns false.
+func (s *Server) checkLogLink(w http.ResponseWriter, r *http.Request, action string) bool {
+	if r.Method != http.MethodGet {
+		return true
+	}
+
+	err := auth.ErrUnsigned
+	if s.auth != nil {
+		_, err = s.auth.CheckLink(r.URL)
+	}
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrUnsigned) && s.linkMode != LinkConfirm:
+		return true
+	case s.linkMode == LinkConfirm:
+		s.renderConfirm(w, r, action, err)
+	default:
+		// A signature that doesn't check out is never logged silently
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, undoPageHTML, "Link Not Valid", "#ef4444", "⛔", "Link Not Valid",
+			html.EscapeString("This QR "+err.Error()+". Print new codes with qrgen."), navDropdownHTML)
+	}
+	return false
+}
+
+// renderConfirm shows a page with a button that posts the action back
+func (s *Server) renderConfirm(w http.ResponseWriter, r *http.Request, action string, err error) {
+	// Keep parameters like temp or note, but not the signature
+	q := r.URL.Query()
+	q.Del(auth.SignatureParam)
+	q.Del(auth.UserParam)
+	q.Del(auth.ExpiresParam)
+	target := r.URL.Path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+
+	reason := ""
+	if !errors.Is(err, auth.ErrUnsigned) {
+		reason = "This QR " + err.Error() + "."
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, confirmPageHTML, html.EscapeString(action), html.EscapeString(reason),
+		html.EscapeString(target), confirmField, html.EscapeString(action))
+}
+
+// confirmPageHTML asks before logging from a link without a valid signature
+const confirmPageHTML = `<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><meta name="robots" content="noindex"><title>Confirm</title><style>body{font-family:sans-serif;background:#667eea;color:white;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0;padding:20px;text-align:center;}h1{font-size:36px;margin:0 0 10px 0;}p{font-size:18px;margin:0 0 20px 0;}button{font-size:24px;padding:16px 40px;border:none;border-radius:12px;background:white;color:#667eea;font-weight:600;}</style></head><body><div><h1>%s?</h1><p>%s</p><form method="POST" action="%s"><input type="hidden" name="%s" value="1"><button type="submit">✅ %s</button></form></div></body></html>`
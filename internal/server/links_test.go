@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// setupLinkServer returns a server in confirm mode with a signing key but no PIN
+func setupLinkServer(t *testing.T) (*Server, *auth.Auth, string) {
+	server, tmpDir := setupTestServer(t)
+	a, err := auth.New(tmpDir, "")
+	if err != nil {
+		cleanup(tmpDir)
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+	server.EnableAuth(a)
+	server.SetLinkMode(LinkConfirm)
+	return server, a, tmpDir
+}
+
+func TestConfirmUnsignedLink(t *testing.T) {
+	server, _, tmpDir := setupLinkServer(t)
+	defer cleanup(tmpDir)
+	handler := server.Handler()
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	// A link preview fetching the URL only gets the confirm page
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/log/fold?note=first", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `action="/log/fold?note=first"`) {
+		t.Fatalf("Expected confirm page, got %d: %s", w.Code, w.Body.String())
+	}
+	if bake, _ := server.storage.ReadCurrentBake(); len(bake.Events) != 1 {
+		t.Fatalf("Expected nothing logged before confirming, got %d events", len(bake.Events))
+	}
+
+	// Tapping the button logs the event and shows the usual success page
+	form := url.Values{confirmField: {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/log/fold?note=first", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Event logged successfully") {
+		t.Fatalf("Expected success page, got %d: %s", w.Code, w.Body.String())
+	}
+	last, _ := server.storage.GetLastEvent()
+	if last.Event != models.EventFold || last.Note != "first" {
+		t.Errorf("Expected fold with note logged, got %+v", last)
+	}
+}
+
+func TestSignedLinkSkipsConfirm(t *testing.T) {
+	server, a, tmpDir := setupLinkServer(t)
+	defer cleanup(tmpDir)
+	handler := server.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, a.SignPath("/loaf/start", "bob", time.Now().Add(time.Hour)), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Loaf Started") {
+		t.Fatalf("Expected signed link to start the loaf, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// In confirm mode an expired code asks first
+	expired := a.SignPath("/log/fed", "", time.Now().Add(-time.Minute))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, expired, nil))
+	if !strings.Contains(w.Body.String(), "expired") || strings.Contains(w.Body.String(), "sig=") {
+		t.Errorf("Expected confirm page mentioning expiry without the signature, got %s", w.Body.String())
+	}
+
+	server.SetLinkMode(LinkOpen)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, expired, nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected expired link rejected in open mode, got %d", w.Code)
+	}
+
+	// Unsigned links still log in open mode
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/log/fed", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected unsigned link logged in open mode, got %d", w.Code)
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if eventNames(bake) != "starter-out,fed" {
+		t.Errorf("Expected start and fed logged, got %s", eventNames(bake))
+	}
+	if bake.Events[0].User != "bob" {
+		t.Errorf("Expected start attributed to the link's user, got %q", bake.Events[0].User)
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/metrics"
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// serverMetrics are the counters and histograms served at /metrics
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	requests        *metrics.Counter   // method, route, status
+	requestDuration *metrics.Histogram // route
+	ecobeeFetches   *metrics.Counter   // result: success or failure
+	autoLogRuns     *metrics.Counter   // result: logged, skipped or failed
+	haPublishes     *metrics.Counter   // result: success or failure
+	mqttMessages    *metrics.Counter   // direction: in or out; result
+	streamDropped   *metrics.Counter   // Live update clients dropped for falling behind
+	storageDuration *metrics.Histogram // op
+	storageErrors   *metrics.Counter   // op
+	temperature     *metrics.Gauge     // sensor: kitchen, dough, oven or fridge
+}
+
+// newServerMetrics registers the server's metrics
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry:        r,
+		requests:        r.Counter("sourdough_http_requests_total", "HTTP requests served.", "method", "route", "status"),
+		requestDuration: r.Histogram("sourdough_http_request_duration_seconds", "Time to serve HTTP requests.", metrics.DefaultBuckets, "route"),
+		ecobeeFetches:   r.Counter("sourdough_ecobee_fetches_total", "Kitchen temperature fetches from Home Assistant.", "result"),
+		autoLogRuns:     r.Counter("sourdough_autolog_runs_total", "Scheduled kitchen temperature logs.", "result"),
+		haPublishes:     r.Counter("sourdough_ha_publishes_total", "Bake state updates sent to Home Assistant.", "result"),
+		mqttMessages:    r.Counter("sourdough_mqtt_messages_total", "MQTT commands received and events published.", "direction", "result"),
+		streamDropped:   r.Counter("sourdough_stream_dropped_total", "Live update clients dropped for falling behind."),
+		storageDuration: r.Histogram("sourdough_storage_operation_duration_seconds", "Time taken by storage operations.", metrics.DefaultBuckets, "op"),
+		storageErrors:   r.Counter("sourdough_storage_errors_total", "Storage operations that failed.", "op"),
+		temperature:     r.Gauge("sourdough_temperature_fahrenheit", "Most recently logged temperature.", "sensor"),
+	}
+}
+
+// watchTemperatures keeps the temperature gauges at the latest logged readings,
+// so Prometheus builds the kitchen temperature history for Grafana
+func (s *Server) watchTemperatures(store storage.Store) {
+	store.Subscribe(func(change storage.Change) {
+		if change.Op != storage.OpAppend || change.Event == nil {
+			return
+		}
+		if change.Event.TempF != nil {
+			s.metrics.temperature.Set(*change.Event.TempF, "kitchen")
+		}
+		if change.Event.DoughTempF != nil {
+			s.metrics.temperature.Set(*change.Event.DoughTempF, "dough")
+		}
+		if change.Event.OvenTempF != nil {
+			s.metrics.temperature.Set(*change.Event.OvenTempF, "oven")
+		}
+		if change.Event.FridgeTempF != nil {
+			s.metrics.temperature.Set(*change.Event.FridgeTempF, "fridge")
+		}
+	})
+}
+
+// activeBakeAge is how long the active bake has been going, NaN without one
+func (s *Server) activeBakeAge() float64 {
+	bake, err := s.storage.ReadCurrentBake()
+	if err != nil || len(bake.Events) == 0 {
+		return math.NaN()
+	}
+	return time.Since(bake.Events[0].Timestamp).Seconds()
+}
+
+// fetchKitchenTemp reads the kitchen sensor, counting successes and failures
+func (s *Server) fetchKitchenTemp(ctx context.Context) (float64, error) {
+	if !s.ecobee.IsEnabled() {
+		return 0, nil
+	}
+	temp, err := s.ecobee.GetTemperature(ctx)
+	if err != nil {
+		s.metrics.ecobeeFetches.Inc("failure")
+		return 0, err
+	}
+	s.metrics.ecobeeFetches.Inc("success")
+	return temp, nil
+}
+
+// handleMetrics serves the metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	s.metrics.registry.WriteText(w)
+}
+
+// requestInfoKey is the request context key for what a handler adds to the request log
+type requestInfoKey struct{}
+
+// requestInfo is filled in by handlers and logged once the request finishes
+type requestInfo struct {
+	bakeID string
+	user   string
+}
+
+// setRequestBake records which bake a request worked on, for the request log
+func setRequestBake(r *http.Request, bakeID string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.bakeID = bakeID
+	}
+}
+
+// statusRecorder remembers the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers push partial responses through the recorder
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// loggingMiddleware writes a structured log line and records metrics for every
+// request. Routes are the mux patterns, so /log/fold and /log/temp/76 both count as /log/.
+func (s *Server) loggingMiddleware(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		duration := time.Since(start)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		_, route := routes.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		s.metrics.requests.Inc(r.Method, route, strconv.Itoa(rec.status))
+		s.metrics.requestDuration.Observe(duration.Seconds(), route)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", duration),
+			slog.Int("bytes", rec.bytes),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if info.bakeID != "" {
+			attrs = append(attrs, slog.String("bake_id", info.bakeID))
+		}
+		// The user is only known inside authMiddleware, so read it from info;
+		// the baker cookie is on the outer request too
+		user := info.user
+		if user == "" {
+			user = validBakerCookie(r)
+		}
+		if user != "" {
+			attrs = append(attrs, slog.String("user", user))
+		}
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// timedStore records the latency and failures of every storage operation
+type timedStore struct {
+	storage.Store
+	metrics *serverMetrics
+}
+
+// observe records one operation that started at start
+func (t *timedStore) observe(op string, start time.Time, err error) {
+	t.metrics.storageDuration.Observe(time.Since(start).Seconds(), op)
+	if err != nil {
+		t.metrics.storageErrors.Inc(op)
+	}
+}
+
+// backend returns the store behind the timing wrapper, for optional
+// interfaces such as storage.Snapshotter that the wrapper doesn't forward
+func (s *Server) backend() storage.Store {
+	if t, ok := s.storage.(*timedStore); ok {
+		return t.Store
+	}
+	return s.storage
+}
+
+func (t *timedStore) ForBaker(baker string) storage.Store {
+	return &timedStore{Store: t.Store.ForBaker(baker), metrics: t.metrics}
+}
+
+func (t *timedStore) AppendEvent(event *models.Event) (err error) {
+	defer func(start time.Time) { t.observe("append_event", start, err) }(time.Now())
+	return t.Store.AppendEvent(event)
+}
+
+func (t *timedStore) ReadCurrentBake() (bake *models.Bake, err error) {
+	defer func(start time.Time) { t.observe("read_current_bake", start, err) }(time.Now())
+	return t.Store.ReadCurrentBake()
+}
+
+func (t *timedStore) ReadBake(date string) (bake *models.Bake, err error) {
+	defer func(start time.Time) { t.observe("read_bake", start, err) }(time.Now())
+	return t.Store.ReadBake(date)
+}
+
+func (t *timedStore) ListBakes() (ids []string, err error) {
+	defer func(start time.Time) { t.observe("list_bakes", start, err) }(time.Now())
+	return t.Store.ListBakes()
+}
+
+func (t *timedStore) HasCurrentBake() (has bool, err error) {
+	defer func(start time.Time) { t.observe("has_current_bake", start, err) }(time.Now())
+	return t.Store.HasCurrentBake()
+}
+
+func (t *timedStore) GetLastEvent() (event *models.Event, err error) {
+	defer func(start time.Time) { t.observe("get_last_event", start, err) }(time.Now())
+	return t.Store.GetLastEvent()
+}
+
+func (t *timedStore) DeleteBake(date string) (err error) {
+	defer func(start time.Time) { t.observe("delete_bake", start, err) }(time.Now())
+	return t.Store.DeleteBake(date)
+}
+
+func (t *timedStore) ListTrash() (entries []storage.TrashEntry, err error) {
+	defer func(start time.Time) { t.observe("list_trash", start, err) }(time.Now())
+	return t.Store.ListTrash()
+}
+
+func (t *timedStore) RestoreBake(trashID string) (id string, err error) {
+	defer func(start time.Time) { t.observe("restore_bake", start, err) }(time.Now())
+	return t.Store.RestoreBake(trashID)
+}
+
+func (t *timedStore) PurgeTrash(olderThan time.Duration) (purged []string, err error) {
+	defer func(start time.Time) { t.observe("purge_trash", start, err) }(time.Now())
+	return t.Store.PurgeTrash(olderThan)
+}
+
+func (t *timedStore) DeleteEvent(index int, timestamp string) (err error) {
+	defer func(start time.Time) { t.observe("delete_event", start, err) }(time.Now())
+	return t.Store.DeleteEvent(index, timestamp)
+}
+
+func (t *timedStore) DeleteBakeEvent(id string, index int, timestamp string) (err error) {
+	defer func(start time.Time) { t.observe("delete_bake_event", start, err) }(time.Now())
+	return t.Store.DeleteBakeEvent(id, index, timestamp)
+}
+
+func (t *timedStore) InsertEvent(index int, event *models.Event) (err error) {
+	defer func(start time.Time) { t.observe("insert_event", start, err) }(time.Now())
+	return t.Store.InsertEvent(index, event)
+}
+
+func (t *timedStore) InsertEventByTime(event *models.Event) (id string, err error) {
+	defer func(start time.Time) { t.observe("insert_event_by_time", start, err) }(time.Now())
+	return t.Store.InsertEventByTime(event)
+}
+
+func (t *timedStore) ImportBake(bake *models.Bake) (id string, err error) {
+	defer func(start time.Time) { t.observe("import_bake", start, err) }(time.Now())
+	return t.Store.ImportBake(bake)
+}
+
+func (t *timedStore) WriteBake(id string, events []models.Event) (err error) {
+	defer func(start time.Time) { t.observe("write_bake", start, err) }(time.Now())
+	return t.Store.WriteBake(id, events)
+}
+
+func (t *timedStore) ReplaceBake(id string, events []models.Event) (err error) {
+	defer func(start time.Time) { t.observe("replace_bake", start, err) }(time.Now())
+	return t.Store.ReplaceBake(id, events)
+}
+
+func (t *timedStore) UpdateBake(id string, update func([]models.Event) []models.Event) (changed bool, err error) {
+	defer func(start time.Time) { t.observe("update_bake", start, err) }(time.Now())
+	return t.Store.UpdateBake(id, update)
+}
+
+func (t *timedStore) SaveImage(filename string, data io.Reader) (err error) {
+	defer func(start time.Time) { t.observe("save_image", start, err) }(time.Now())
+	return t.Store.SaveImage(filename, data)
+}
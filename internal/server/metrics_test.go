@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mdeckert/sourdough/internal/ecobee"
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+func TestMetrics(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	// Fake Home Assistant whose sensor goes offline once it's marked down
+	var down atomic.Bool
+	ha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.Write([]byte(`{"state": "unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"state": "72.5"}`))
+	}))
+	defer ha.Close()
+	server.ecobee = ecobee.New(ha.URL, "token", "sensor.kitchen")
+	handler := server.Handler()
+
+	for _, path := range []string{"/log/fold", "/log/temp/76", "/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+	server.logTemperature(context.Background())
+	// A fresh client, so the cached reading doesn't stand in
+	down.Store(true)
+	server.ecobee = ecobee.New(ha.URL, "token", "sensor.kitchen")
+	server.logTemperature(context.Background())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	out := w.Body.String()
+
+	for _, want := range []string{
+		`sourdough_http_requests_total{method="POST",route="/log/",status="200"} 2`,
+		`sourdough_http_requests_total{method="POST",route="unmatched",status="404"} 1`,
+		`sourdough_http_request_duration_seconds_count{route="/log/"} 2`,
+		`sourdough_storage_operation_duration_seconds_count{op="insert_event_by_time"} 2`,
+		`sourdough_storage_operation_duration_seconds_count{op="append_event"} 1`,
+		`sourdough_temperature_fahrenheit{sensor="kitchen"} 72.5`,
+		"sourdough_active_bake_age_seconds ",
+		`sourdough_ecobee_fetches_total{result="failure"} 1`,
+		`sourdough_ecobee_fetches_total{result="success"} 2`,
+		`sourdough_autolog_runs_total{result="failed"} 1`,
+		`sourdough_autolog_runs_total{result="logged"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/log/fold", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	bake, _ := server.storage.ReadCurrentBake()
+	bakeID := strings.TrimPrefix(bake.Filename, "bake_")
+
+	line := buf.String()
+	for _, want := range []string{"msg=request", "method=POST", "path=/log/fold", "status=200", "duration=", "bake_id=" + bakeID} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected %q in log line %q", want, line)
+		}
+	}
+
+	// Requests that don't touch a bake leave bake_id out
+	buf.Reset()
+	server.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if !strings.Contains(buf.String(), "status=404") || strings.Contains(buf.String(), "bake_id") || strings.Contains(buf.String(), "user=") {
+		t.Errorf("Unexpected log line %q", buf.String())
+	}
+}
+
+func TestRequestLogUser(t *testing.T) {
+	server, a, tmpDir := setupAuthServer(t)
+	defer cleanup(tmpDir)
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	token, _ := a.CreateToken("bob")
+	req := httptest.NewRequest(http.MethodPost, "/log/fold", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.Contains(buf.String(), "user=bob") {
+		t.Errorf("Expected the authenticated user in log line %q", buf.String())
+	}
+}
+
+func TestStorageErrorsCounted(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	// Deleting an event of a bake that doesn't exist fails in storage
+	server.storage.DeleteEvent(3, "2024-01-01T00:00:00Z")
+	server.storage.AppendEvent(models.NewEvent(models.EventFold))
+
+	var buf bytes.Buffer
+	server.metrics.registry.WriteText(&buf)
+	out := buf.String()
+	if !strings.Contains(out, `sourdough_storage_errors_total{op="delete_event"} 1`) {
+		t.Errorf("Expected a counted delete_event error in:\n%s", out)
+	}
+	if strings.Contains(out, `sourdough_storage_errors_total{op="append_event"}`) {
+		t.Errorf("Expected no append_event errors in:\n%s", out)
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/mqtt"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+const (
+	mqttDialTimeout = 10 * time.Second
+	mqttMaxBackoff  = time.Minute // Longest wait between reconnects
+	mqttQueueSize   = 64          // Events held for publishing while disconnected
+)
+
+// MQTTConfig connects the server to an MQTT broker. Commands arrive on
+// <prefix>/log/<event> and <prefix>/temp/<kitchen|dough|oven>; every saved
+// event is published as JSON to <prefix>/events.
+type MQTTConfig struct {
+	Broker   string // e.g. mqtt://broker.local:1883
+	Prefix   string // Topic prefix, "sourdough" by default
+	ClientID string
+	Username string
+	Password string
+}
+
+// SetMQTT enables the MQTT client
+func (s *Server) SetMQTT(cfg MQTTConfig) {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "sourdough"
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "sourdough-server"
+	}
+	s.mqtt = &cfg
+}
+
+// watchEvents queues every appended event for publishing over MQTT
+func (s *Server) watchEvents(store storage.Store) {
+	store.Subscribe(func(change storage.Change) {
+		if s.mqtt == nil || change.Op != storage.OpAppend || change.Event == nil {
+			return
+		}
+		payload, err := json.Marshal(change.Event)
+		if err != nil {
+			return
+		}
+		select {
+		case s.mqttOut <- payload:
+		default:
+			s.metrics.mqttMessages.Inc("out", "dropped")
+		}
+	})
+}
+
+// runMQTT keeps a connection to the broker until ctx is cancelled,
+// reconnecting with backoff when it drops
+func (s *Server) runMQTT(ctx context.Context) {
+	log.Printf("MQTT enabled: %s, topics %s/log/+ and %s/temp/+", s.mqtt.Broker, s.mqtt.Prefix, s.mqtt.Prefix)
+
+	delay := time.Second
+	for {
+		connected, err := s.mqttSession(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = time.Second
+		}
+		log.Printf("Warning: MQTT: %v; reconnecting in %s", err, delay)
+		if !sleepContext(ctx, delay) {
+			return
+		}
+		delay = min(delay*2, mqttMaxBackoff)
+	}
+}
+
+// mqttSession connects, subscribes and handles messages until the connection
+// ends. It reports whether it got connected, to reset the backoff.
+func (s *Server) mqttSession(ctx context.Context) (bool, error) {
+	incoming := make(chan mqtt.Message, 16)
+	dialCtx, cancel := context.WithTimeout(ctx, mqttDialTimeout)
+	defer cancel()
+	client, err := mqtt.Dial(dialCtx, s.mqtt.Broker, mqtt.Options{
+		ClientID:  s.mqtt.ClientID,
+		Username:  s.mqtt.Username,
+		Password:  s.mqtt.Password,
+		OnMessage: func(m mqtt.Message) { incoming <- m },
+	})
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	if err := client.Subscribe(dialCtx, s.mqtt.Prefix+"/log/+", s.mqtt.Prefix+"/temp/+"); err != nil {
+		return true, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	log.Printf("Connected to MQTT broker %s", s.mqtt.Broker)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true, nil
+		case <-client.Done():
+			return true, client.Err()
+		case m := <-incoming:
+			s.handleMQTTCommand(ctx, client, m)
+		case payload := <-s.mqttOut:
+			if err := client.Publish(s.mqtt.Prefix+"/events", payload); err != nil {
+				s.metrics.mqttMessages.Inc("out", "dropped")
+				return true, err
+			}
+			s.metrics.mqttMessages.Inc("out", "published")
+		}
+	}
+}
+
+// handleMQTTCommand logs the event a command asks for. Rejected commands are
+// answered on <prefix>/error, since the sender can't see the server log.
+func (s *Server) handleMQTTCommand(ctx context.Context, client *mqtt.Client, m mqtt.Message) {
+	event, err := s.mqttEvent(m)
+	result := "rejected"
+	if err == nil {
+		if _, err = s.saveLogEvent(ctx, event, ""); err != nil {
+			result = "failed"
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: MQTT %s: %v", m.Topic, err)
+		s.metrics.mqttMessages.Inc("in", result)
+		payload, _ := json.Marshal(map[string]string{"topic": m.Topic, "error": err.Error()})
+		client.Publish(s.mqtt.Prefix+"/error", payload)
+		return
+	}
+	log.Printf("Logged %s from MQTT %s", event.Event, m.Topic)
+	s.metrics.mqttMessages.Inc("in", "logged")
+}
+
+// mqttEvent turns a command into an event with the same rules as /log:
+//
+//	<prefix>/log/fold              empty payload, a note, or {"temp", "dough_temp", "note"}
+//	<prefix>/log/note              the note text
+//	<prefix>/temp/dough            the temperature, e.g. 78.5; also kitchen and oven
+func (s *Server) mqttEvent(m mqtt.Message) (*models.Event, error) {
+	kind, name, _ := strings.Cut(strings.TrimPrefix(m.Topic, s.mqtt.Prefix+"/"), "/")
+	payload := strings.TrimSpace(string(m.Payload))
+	params := url.Values{}
+
+	switch kind {
+	case "temp":
+		switch name {
+		case "kitchen":
+		case "dough", "oven":
+			params.Set("type", name)
+		default:
+			return nil, fmt.Errorf("Invalid temperature type: %s", name)
+		}
+		return s.newLogEvent([]string{"temp", payload}, params, "")
+
+	case "log":
+		if strings.HasPrefix(payload, "{") {
+			var fields map[string]interface{}
+			if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+				return nil, fmt.Errorf("Invalid JSON payload")
+			}
+			for _, key := range []string{"temp", "dough_temp", "note"} {
+				if value, ok := fields[key]; ok {
+					params.Set(key, fmt.Sprint(value))
+				}
+			}
+		} else if payload != "" {
+			params.Set("note", payload)
+		}
+
+		if name == "note" {
+			if params.Get("note") == "" {
+				return nil, fmt.Errorf("Note cannot be empty")
+			}
+			return models.NewEvent(models.EventNote).WithNote(params.Get("note")), nil
+		}
+		return s.newLogEvent([]string{name}, params, "")
+	}
+	return nil, fmt.Errorf("Unknown topic: %s", m.Topic)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/mqtt"
+	"github.com/mdeckert/sourdough/internal/mqtt/mqtttest"
+)
+
+func TestMQTT(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+	server.SetMQTT(MQTTConfig{Broker: broker.URL()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.runMQTT(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Watch what the server publishes
+	received := make(chan mqtt.Message, 10)
+	watcher, err := mqtt.Dial(context.Background(), broker.URL(), mqtt.Options{
+		ClientID:  "watcher",
+		OnMessage: func(m mqtt.Message) { received <- m },
+	})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Subscribe(context.Background(), "sourdough/events", "sourdough/error"); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	next := func() mqtt.Message {
+		t.Helper()
+		select {
+		case m := <-received:
+			return m
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for a message")
+			return mqtt.Message{}
+		}
+	}
+	waitSubscribed := func() {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for broker.Subscriptions("sourdough/log/+") == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if broker.Subscriptions("sourdough/log/+") == 0 {
+			t.Fatal("Server didn't subscribe")
+		}
+	}
+	waitSubscribed()
+
+	tests := []struct {
+		topic   string
+		payload string
+		check   func(e models.Event) bool
+	}{
+		{"sourdough/log/fold", "", func(e models.Event) bool {
+			return e.Event == models.EventFold && e.FoldCount != nil && *e.FoldCount == 1
+		}},
+		{"sourdough/log/fold", `{"dough_temp": 77.5, "note": "jiggly"}`, func(e models.Event) bool {
+			return e.FoldCount != nil && *e.FoldCount == 2 && e.DoughTempF != nil && *e.DoughTempF == 77.5 && e.Note == "jiggly"
+		}},
+		{"sourdough/temp/dough", "78.5", func(e models.Event) bool {
+			return e.Event == models.EventTemperature && e.DoughTempF != nil && *e.DoughTempF == 78.5
+		}},
+		{"sourdough/log/note", "smells sour", func(e models.Event) bool {
+			return e.Event == models.EventNote && e.Note == "smells sour"
+		}},
+	}
+	for _, tt := range tests {
+		broker.Publish(tt.topic, []byte(tt.payload), 1)
+
+		// The saved event is published back
+		m := next()
+		var event models.Event
+		if m.Topic != "sourdough/events" || json.Unmarshal(m.Payload, &event) != nil || !tt.check(event) {
+			t.Errorf("%s %q: unexpected %s %s", tt.topic, tt.payload, m.Topic, m.Payload)
+		}
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if len(bake.Events) != len(tests) {
+		t.Errorf("Expected %d events, got %d", len(tests), len(bake.Events))
+	}
+
+	// Invalid commands are rejected with the same messages as /log
+	for _, tt := range []struct{ topic, payload, want string }{
+		{"sourdough/log/bogus", "", "Invalid event type: bogus"},
+		{"sourdough/temp/dough", "hot", "Invalid temperature value"},
+		{"sourdough/temp/attic", "70", "Invalid temperature type: attic"},
+		{"sourdough/log/note", "", "Note cannot be empty"},
+		{"sourdough/log/fold", "{broken", "Invalid JSON payload"},
+	} {
+		broker.Publish(tt.topic, []byte(tt.payload), 0)
+		m := next()
+		if m.Topic != "sourdough/error" || !strings.Contains(string(m.Payload), tt.want) {
+			t.Errorf("%s %q: expected error %q, got %s %s", tt.topic, tt.payload, tt.want, m.Topic, m.Payload)
+		}
+	}
+	if bake, _ := server.storage.ReadCurrentBake(); len(bake.Events) != len(tests) {
+		t.Errorf("Expected rejected commands not to be saved, got %d events", len(bake.Events))
+	}
+
+	// The server reconnects after the broker drops it
+	broker.DropClients()
+	for broker.Subscriptions("sourdough/log/+") != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitSubscribed()
+}
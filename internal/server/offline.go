@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// Headers set by the service worker on /log/* requests, so queued events keep
+// the time they were logged and replays never log twice
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	EventTimeHeader      = "X-Event-Time" // RFC 3339
+)
+
+const (
+	maxEventAge  = 7 * 24 * time.Hour // Oldest queued event accepted
+	maxClockSkew = 5 * time.Minute    // Phone clocks ahead of the server by less are clamped
+)
+
+// validIdempotencyKey matches keys the service worker generates
+var validIdempotencyKey = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// replay is what a /log/* request says about the event it logs: the key it
+// was queued under and when it happened. Both are empty for a live request.
+type replay struct {
+	Key string
+	At  time.Time
+}
+
+// parseReplay reads the idempotency key and event time headers
+func parseReplay(r *http.Request, now time.Time) (replay, error) {
+	var rp replay
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		if !validIdempotencyKey.MatchString(key) {
+			return rp, fmt.Errorf("Invalid %s", IdempotencyKeyHeader)
+		}
+		rp.Key = key
+	}
+	if at := r.Header.Get(EventTimeHeader); at != "" {
+		t, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			return rp, fmt.Errorf("Invalid %s", EventTimeHeader)
+		}
+		switch {
+		case t.After(now.Add(maxClockSkew)):
+			return rp, fmt.Errorf("%s is in the future", EventTimeHeader)
+		case t.Before(now.Add(-maxEventAge)):
+			return rp, fmt.Errorf("%s is more than %s ago", EventTimeHeader, maxEventAge)
+		case t.After(now):
+			t = now
+		}
+		rp.At = t
+	}
+	return rp, nil
+}
+
+// apply gives the event its key as ID, so a replay can find it, and its original time
+func (rp replay) apply(event *models.Event) {
+	if rp.Key != "" {
+		event.ID = rp.Key
+	}
+	if !rp.At.IsZero() {
+		event.Timestamp = rp.At
+	}
+}
+
+// keyLocks serializes requests that share a key, without holding up the rest
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is the lock for one key and how many requests hold or wait for it
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock waits for key and returns the func that releases it
+func (k *keyLocks) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyLock)
+	}
+	l := k.locks[key]
+	if l == nil {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// beginReplay checks a /log/* request's replay headers. It returns false after
+// writing the response when there's nothing more to do: the headers are invalid,
+// or the event was already logged. Otherwise the caller must call the returned
+// func once the event is saved, or when it gives up. Only replays of the same
+// key wait for each other, so a slow upload doesn't hold up other events.
+func (s *Server) beginReplay(w http.ResponseWriter, r *http.Request) (replay, func(), bool) {
+	rp, err := parseReplay(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return rp, nil, false
+	}
+	if rp.Key == "" {
+		return rp, func() {}, true
+	}
+
+	// Hold the key until the event is saved so a concurrent replay sees it
+	unlock := s.replayLocks.lock(rp.Key)
+	existing, err := s.findLoggedEvent(s.storeFor(requestUser(r)), rp.Key)
+	if err != nil {
+		unlock()
+		http.Error(w, fmt.Sprintf("Error checking for duplicates: %v", err), http.StatusInternalServerError)
+		return rp, nil, false
+	}
+	if existing != nil {
+		unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "duplicate",
+			"event":  existing,
+		})
+		return rp, nil, false
+	}
+	return rp, unlock, true
+}
+
+// findLoggedEvent returns the event saved under an ID in the store's active bake
+// or the most recent one, which a replay may have completed, or nil
+func (s *Server) findLoggedEvent(store storage.Store, id string) (*models.Event, error) {
+	bakes := []*models.Bake{}
+	current, err := store.ReadCurrentBake()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current bake: %w", err)
+	}
+	bakes = append(bakes, current)
+	ids, err := s.storage.ListBakes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bakes: %w", err)
+	}
+	if len(ids) > 0 && "bake_"+ids[0] != current.Filename {
+		latest, err := s.storage.ReadBake(ids[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bake %s: %w", ids[0], err)
+		}
+		bakes = append(bakes, latest)
+	}
+
+	for _, bake := range bakes {
+		for i := range bake.Events {
+			if bake.Events[i].ID == id {
+				return &bake.Events[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// storeEvent saves an event to the active bake of its user in time order, so
+// one that waited in a phone's offline queue goes before events logged since.
+// It returns the ID of the bake the event went into.
+func (s *Server) storeEvent(event *models.Event) (string, error) {
+	return s.storeFor(event.User).InsertEventByTime(event)
+}
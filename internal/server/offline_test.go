@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// replayRequest is a /log/* POST as the service worker replays it
+func replayRequest(path, key string, at time.Time) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.Header.Set(IdempotencyKeyHeader, key)
+	req.Header.Set(EventTimeHeader, at.Format(time.RFC3339Nano))
+	return req
+}
+
+func TestLogReplay(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	at := time.Now().Add(-20 * time.Minute).Truncate(time.Millisecond)
+	for i, want := range []string{"", "duplicate"} {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, replayRequest("/log/fold", "3f1c9a0e-replay-key", at))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replay %d: expected status 200, got %d: %s", i, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Status string        `json:"status"`
+			Event  *models.Event `json:"event"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if want != "" && (resp.Status != want || resp.Event == nil || resp.Event.ID != "3f1c9a0e-replay-key") {
+			t.Errorf("Replay %d: expected a duplicate of the logged fold, got %+v", i, resp)
+		}
+	}
+
+	bake, err := server.storage.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("ReadCurrentBake failed: %v", err)
+	}
+	if len(bake.Events) != 1 {
+		t.Fatalf("Expected the fold logged once, got %d events", len(bake.Events))
+	}
+	if e := bake.Events[0]; e.ID != "3f1c9a0e-replay-key" || !e.Timestamp.Equal(at) {
+		t.Errorf("Expected the fold saved with its key and original time, got %+v", e)
+	}
+}
+
+func TestLogLateEvent(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	now := time.Now().Truncate(time.Second)
+	mixed := models.NewEvent(models.EventMixed)
+	mixed.Timestamp = now.Add(-2 * time.Hour)
+	fold1 := models.NewEvent(models.EventFold).WithFoldCount(1)
+	fold1.Timestamp = now.Add(-90 * time.Minute)
+	fold2 := models.NewEvent(models.EventFold).WithFoldCount(2)
+	fold2.Timestamp = now.Add(-30 * time.Minute)
+	shaped := models.NewEvent(models.EventShaped)
+	shaped.Timestamp = now.Add(-10 * time.Minute)
+	for _, e := range []*models.Event{mixed, fold1, fold2, shaped} {
+		if err := server.storage.AppendEvent(e); err != nil {
+			t.Fatalf("AppendEvent failed: %v", err)
+		}
+	}
+
+	// A fold queued on a phone an hour ago arrives after shaping was logged
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, replayRequest("/log/fold", "late-fold-0001", now.Add(-time.Hour)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if len(bake.Events) != 5 {
+		t.Fatalf("Expected 5 events, got %d", len(bake.Events))
+	}
+	late := bake.Events[2]
+	if late.ID != "late-fold-0001" || late.FoldCount == nil || *late.FoldCount != 2 {
+		t.Errorf("Expected fold 2 between the first two folds, got %+v", late)
+	}
+	if next := bake.Events[3]; next.FoldCount == nil || *next.FoldCount != 3 {
+		t.Errorf("Expected the later fold renumbered 3, got %+v", next)
+	}
+	if bake.CurrentStage() != models.StageShaped {
+		t.Errorf("Expected the late fold not to rewind the stage, got %s", bake.CurrentStage())
+	}
+}
+
+func TestLogReplayInvalid(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	tests := []struct {
+		name string
+		key  string
+		at   string
+	}{
+		{"short key", "abc", ""},
+		{"key with spaces", "not a valid key", ""},
+		{"bad time", "valid-key-0001", "yesterday"},
+		{"future time", "valid-key-0002", time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{"too old", "valid-key-0003", time.Now().Add(-maxEventAge - time.Hour).Format(time.RFC3339)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/log/fold", nil)
+			req.Header.Set(IdempotencyKeyHeader, tt.key)
+			if tt.at != "" {
+				req.Header.Set(EventTimeHeader, tt.at)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+		})
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if len(bake.Events) != 0 {
+		t.Errorf("Expected nothing logged, got %d events", len(bake.Events))
+	}
+}
+
+func TestOvenInReplay(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	if err := server.storage.AppendEvent(models.NewEvent(models.EventMixed)); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, replayRequest("/log/oven-in?temp=475", "oven-in-key-01", time.Now()))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replay %d: expected status 200, got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if len(bake.Events) != 2 || bake.Events[1].Event != models.EventOvenIn {
+		t.Errorf("Expected oven-in logged once after mixing, got %+v", bake.Events)
+	}
+}
+
+func TestPWAAssets(t *testing.T) {
+	server, _, tmpDir := setupAuthServer(t)
+	defer cleanup(tmpDir)
+
+	// Everything needed to install the app and queue events loads before login
+	for path, contentType := range map[string]string{
+		"/manifest.webmanifest": "application/manifest+json",
+		"/sw.js":                "application/javascript",
+		"/pwa.js":               "application/javascript",
+		"/icon-512.png":         "image/png",
+	} {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != contentType {
+			t.Errorf("%s: expected 200 %s, got %d %s", path, contentType, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/manifest.webmanifest", nil))
+	var manifest struct {
+		StartURL string `json:"start_url"`
+		Icons    []struct {
+			Src string `json:"src"`
+		} `json:"icons"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&manifest); err != nil || manifest.StartURL != "/view/status" || len(manifest.Icons) != len(iconSizes) {
+		t.Errorf("Expected a manifest starting at the status page with every icon, got %+v (%v)", manifest, err)
+	}
+	for _, icon := range manifest.Icons {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, icon.Src, nil))
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Errorf("%s: invalid PNG: %v", icon.Src, err)
+			continue
+		}
+		if size := img.Bounds().Dx(); size != iconSizes[icon.Src] {
+			t.Errorf("%s: expected %dpx, got %dpx", icon.Src, iconSizes[icon.Src], size)
+		}
+	}
+
+	// Pages link the manifest and register the service worker
+	plain, plainDir := setupTestServer(t)
+	defer cleanup(plainDir)
+	w = httptest.NewRecorder()
+	plain.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/view/status", nil))
+	for _, want := range []string{`rel="manifest"`, `src="/pwa.js"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %q in the status page", want)
+		}
+	}
+}
+
+func TestReplayLocksPerKey(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	// A replay still uploading its photo holds only its own key
+	unlock := server.replayLocks.lock("slow-upload-key")
+
+	done := make(chan int, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, replayRequest("/log/fold", "other-event-key", time.Now()))
+		done <- w.Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a replay with another key not to wait")
+	}
+
+	// The same key waits
+	go func() {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, replayRequest("/log/fold", "slow-upload-key", time.Now()))
+		done <- w.Code
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected a replay of the same key to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("Expected status 200 once the key was released, got %d", code)
+	}
+	if len(server.replayLocks.locks) != 0 {
+		t.Errorf("Expected released keys forgotten, got %v", server.replayLocks.locks)
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/profiles"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// BakerCookie remembers the profile picked on /profile, for households without a PIN
+const BakerCookie = "sourdough_baker"
+
+// bakerCookieLifetime is how long a browser remembers its baker, in seconds
+const bakerCookieLifetime = 365 * 24 * 60 * 60
+
+// SetProfiles enables per-baker profiles
+func (s *Server) SetProfiles(reg *profiles.Registry) {
+	s.profiles = reg
+}
+
+// profileFor returns the profile of user, or nil if profiles are off or it has none
+func (s *Server) profileFor(user string) *profiles.Profile {
+	if s.profiles == nil || user == "" {
+		return nil
+	}
+	p, _ := s.profiles.Get(user)
+	return p
+}
+
+// storeFor returns the store user logs to: a view of their own active bake if
+// they have a profile, else the household's
+func (s *Server) storeFor(user string) storage.Store {
+	if s.profileFor(user) == nil {
+		return s.storage
+	}
+	return s.storage.ForBaker(user)
+}
+
+// withProfile records the baker's starter and recipe on the event that starts a bake
+func (s *Server) withProfile(event *models.Event) {
+	p := s.profileFor(event.User)
+	if p == nil {
+		return
+	}
+	if event.Data == nil {
+		event.Data = make(map[string]interface{})
+	}
+	if p.Starter != "" {
+		event.Data["starter"] = p.Starter
+	}
+	if p.Recipe != "" {
+		event.Data["recipe"] = p.Recipe
+	}
+}
+
+// handleAPIProfiles manages the household's profiles:
+//
+//	GET    /api/profiles          list profiles
+//	POST   /api/profiles          add or update {"name", "starter", "recipe"}
+//	DELETE /api/profiles/{name}   remove a profile (its bakes are kept)
+func (s *Server) handleAPIProfiles(w http.ResponseWriter, r *http.Request) {
+	if s.profiles == nil {
+		http.Error(w, "Profiles not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/profiles"), "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		list, err := s.profiles.List()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read profiles: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case name == "" && r.Method == http.MethodPost:
+		var p profiles.Profile
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		saved, err := s.profiles.Save(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(saved)
+
+	case name != "" && r.Method == http.MethodDelete:
+		if err := s.profiles.Remove(name); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "removed"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProfilePage lets a browser pick which baker it logs for. With a PIN
+// set, the name used to log in decides instead.
+func (s *Server) handleProfilePage(w http.ResponseWriter, r *http.Request) {
+	if s.profiles == nil {
+		http.Error(w, "Profiles not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	if name, ok := r.URL.Query()["name"]; ok {
+		baker := name[0]
+		if baker != "" {
+			if p, _ := s.profiles.Get(baker); p == nil {
+				http.Error(w, "Profile not found", http.StatusNotFound)
+				return
+			}
+		}
+		cookie := &http.Cookie{Name: BakerCookie, Value: baker, Path: "/", MaxAge: bakerCookieLifetime, SameSite: http.SameSiteLaxMode}
+		if baker == "" {
+			cookie.MaxAge = -1
+		}
+		http.SetCookie(w, cookie)
+		http.Redirect(w, r, "/view/history?user="+url.QueryEscape(baker), http.StatusSeeOther)
+		return
+	}
+
+	list, err := s.profiles.List()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read profiles: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	current := requestUser(r)
+	var buttons strings.Builder
+	for _, p := range list {
+		class := "baker"
+		if p.Name == current {
+			class += " current"
+		}
+		var details []string
+		for _, d := range []string{p.Starter, p.Recipe} {
+			if d != "" {
+				details = append(details, d)
+			}
+		}
+		fmt.Fprintf(&buttons, `<a class="%s" href="/profile?name=%s">👩‍🍳 %s<small>%s</small></a>`,
+			class, url.QueryEscape(p.Name), html.EscapeString(p.Name), html.EscapeString(strings.Join(details, " · ")))
+	}
+	if len(list) == 0 {
+		buttons.WriteString(`<p>No profiles yet. Add one with: sourdough profile add &lt;name&gt;</p>`)
+	}
+	fmt.Fprint(&buttons, `<a class="baker" href="/profile?name=">🏠 Household<small>Shared view of every bake</small></a>`)
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, profilePageHTML, buttons.String(), navDropdownHTML)
+}
+
+// validBakerCookie returns the baker remembered by the browser, if any
+func validBakerCookie(r *http.Request) string {
+	c, err := r.Cookie(BakerCookie)
+	if err != nil || auth.ValidUser(c.Value) != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// profilePageHTML lists the household's bakers
+const profilePageHTML = `<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>Who's Baking?</title><style>body{font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,sans-serif;background:linear-gradient(135deg,#667eea 0%%,#764ba2 100%%);min-height:100vh;margin:0;padding:20px;display:flex;align-items:center;justify-content:center;}.container{background:white;border-radius:20px;padding:30px;max-width:500px;width:100%%;box-shadow:0 20px 60px rgba(0,0,0,0.3);}h1{margin:0 0 20px 0;text-align:center;}.baker{display:block;padding:16px;margin-bottom:12px;border:2px solid #e0e0e0;border-radius:12px;color:#333;text-decoration:none;font-size:20px;}.baker small{display:block;color:#666;font-size:14px;margin-top:4px;}.current{border-color:#667eea;background:#eef2ff;}</style></head><body><div class="container"><h1>Who's Baking?</h1>%s%s</div></body></html>`
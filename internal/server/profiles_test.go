@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/profiles"
+)
+
+func TestProfilesScopeBakes(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+	reg := profiles.New(tmpDir)
+	server.SetProfiles(reg)
+	handler := server.Handler()
+
+	reg.Save(profiles.Profile{Name: "alice", Starter: "Clint", Recipe: "Country loaf"})
+	reg.Save(profiles.Profile{Name: "bob", Starter: "Audrey"})
+
+	// Bob's finished bake, and one from before profiles existed
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	server.storage.WriteBake("2024-05-01_08-00-00", []models.Event{
+		{Timestamp: start, Event: models.EventStarterOut, User: "bob"},
+		{Timestamp: start.Add(time.Hour), Event: models.EventLoafComplete, User: "bob"},
+	})
+	server.storage.WriteBake("2024-04-01_08-00-00", []models.Event{
+		{Timestamp: start.AddDate(0, -1, 0), Event: models.EventLoafComplete},
+	})
+
+	// Alice picks her profile in the browser and starts a loaf
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile?name=alice", nil))
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || len(cookies) != 1 || cookies[0].Name != BakerCookie {
+		t.Fatalf("Expected baker cookie and redirect, got %d %+v", w.Code, cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/loaf/start", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected loaf started, got %d", w.Code)
+	}
+
+	current, _ := server.storage.ReadCurrentBake()
+	start0 := current.Events[0]
+	if start0.User != "alice" || start0.Data["starter"] != "Clint" || start0.Data["recipe"] != "Country loaf" {
+		t.Errorf("Expected alice's starter and recipe on the start event, got %+v", start0)
+	}
+
+	list := func(query string) []map[string]interface{} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/bakes"+query, nil))
+		var bakes []map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&bakes)
+		return bakes
+	}
+
+	if bakes := list(""); len(bakes) != 3 {
+		t.Errorf("Expected the household view to list all 3 bakes, got %d", len(bakes))
+	}
+	if bakes := list("?user=alice"); len(bakes) != 1 || bakes[0]["baker"] != "alice" {
+		t.Errorf("Expected only alice's bake, got %v", bakes)
+	}
+	if bakes := list("?user=bob"); len(bakes) != 1 || bakes[0]["date"] != "2024-05-01_08-00-00" {
+		t.Errorf("Expected only bob's bake, got %v", bakes)
+	}
+
+	// Unknown profiles can't be picked
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile?name=mallory", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown profile rejected, got %d", w.Code)
+	}
+}
+
+func TestProfilesBakeAtOnce(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+	reg := profiles.New(tmpDir)
+	server.SetProfiles(reg)
+	handler := server.Handler()
+
+	reg.Save(profiles.Profile{Name: "alice"})
+	reg.Save(profiles.Profile{Name: "bob"})
+
+	as := func(baker, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: BakerCookie, Value: baker})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Alice's bake is in progress; bob's fold must not land in it
+	if w := as("alice", http.MethodPost, "/loaf/start"); w.Code != http.StatusOK {
+		t.Fatalf("Expected alice's loaf started, got %d", w.Code)
+	}
+	as("alice", http.MethodPost, "/log/mixed")
+	if w := as("bob", http.MethodPost, "/loaf/start"); w.Code != http.StatusOK {
+		t.Fatalf("Expected bob to start his own loaf while alice bakes, got %d: %s", w.Code, w.Body.String())
+	}
+	as("bob", http.MethodPost, "/log/fold")
+
+	current := func(baker string) *models.Bake {
+		var bake models.Bake
+		json.NewDecoder(as(baker, http.MethodGet, "/api/bake/current").Body).Decode(&bake)
+		return &bake
+	}
+	alice, bob := current("alice"), current("bob")
+	if alice.Filename == bob.Filename {
+		t.Fatalf("Expected separate bakes, both got %s", alice.Filename)
+	}
+	if len(alice.Events) != 2 || alice.Events[1].Event != models.EventMixed {
+		t.Errorf("Expected alice's bake to be start and mix, got %+v", alice.Events)
+	}
+	if len(bob.Events) != 2 || bob.Events[1].Event != models.EventFold || *bob.Events[1].FoldCount != 1 {
+		t.Errorf("Expected bob's bake to be start and his first fold, got %+v", bob.Events)
+	}
+
+	// A second start for alice is still refused
+	if w := as("alice", http.MethodPost, "/loaf/start"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected alice's second start refused, got %d", w.Code)
+	}
+
+	// Once alice finishes, her status shows her own last bake, not bob's
+	as("alice", http.MethodPost, "/log/loaf-complete")
+	as("bob", http.MethodPost, "/log/fold")
+	if recent := current("alice"); recent.Filename != alice.Filename {
+		t.Errorf("Expected alice's finished bake %s, got %s", alice.Filename, recent.Filename)
+	}
+	reg.Save(profiles.Profile{Name: "carol"})
+	if recent := current("carol"); len(recent.Events) != 0 {
+		t.Errorf("Expected no bake for carol, got %s", recent.Filename)
+	}
+}
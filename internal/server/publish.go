@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/homeassistant"
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// publishInterval is how often the bake state is published without a change,
+// keeping "minutes since" current and restoring entities after HA restarts
+const publishInterval = time.Minute
+
+// Reminders configures when the next step of a bake is due
+type Reminders struct {
+	FoldInterval time.Duration // Time between folds during bulk, 0 for no fold reminders
+	Folds        int           // Folds per bake; no reminder after the last
+}
+
+// DefaultReminders is a fold every 30 minutes, four times
+var DefaultReminders = Reminders{FoldInterval: 30 * time.Minute, Folds: 4}
+
+// SetReminders changes when reminders are due
+func (s *Server) SetReminders(r Reminders) {
+	s.reminders = r
+}
+
+// SetPublisher publishes the bake state to Home Assistant while the server runs
+func (s *Server) SetPublisher(c *homeassistant.Client) {
+	s.publisher = c
+}
+
+// reminder is the next step due in the active bake
+type reminder struct {
+	Action string // e.g. "fold 3"
+	Due    time.Time
+}
+
+// nextReminder returns the next fold during bulk, or nil when nothing is due:
+// outside bulk, after the last fold, or with fold reminders off
+func (r Reminders) nextReminder(bake *models.Bake) *reminder {
+	if r.FoldInterval <= 0 || bake.CurrentStage() != models.StageBulk {
+		return nil
+	}
+
+	// Count from the latest of mixing, kneading and the last fold
+	folds := 0
+	var since time.Time
+	for _, e := range bake.Events {
+		if e.Event == models.EventFold {
+			folds++
+		}
+		if models.StageOf(e.Event) == models.StageBulk {
+			since = e.Timestamp
+		}
+	}
+	if folds >= r.Folds {
+		return nil
+	}
+	return &reminder{Action: fmt.Sprintf("fold %d", folds+1), Due: since.Add(r.FoldInterval)}
+}
+
+// watchBakeState wakes the publisher after every write
+func (s *Server) watchBakeState(store storage.Store) {
+	store.Subscribe(func(storage.Change) {
+		select {
+		case s.publishWake <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// publishBakeState sends the bake state to Home Assistant after every write and
+// every publishInterval, until ctx is cancelled
+func (s *Server) publishBakeState(ctx context.Context) {
+	log.Printf("Publishing bake state every %s and after each event", publishInterval)
+
+	var failing bool
+	for {
+		err := s.publishOnce(ctx)
+		switch {
+		case err != nil && !failing:
+			// Log once per outage rather than every minute
+			log.Printf("Warning: Failed to publish bake state to Home Assistant: %v", err)
+			failing = true
+		case err == nil && failing:
+			log.Printf("Publishing bake state to Home Assistant again")
+			failing = false
+		}
+
+		timer := time.NewTimer(publishInterval)
+		select {
+		case <-ctx.Done():
+		case <-s.publishWake:
+		case <-timer.C:
+		}
+		timer.Stop()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// publishOnce sets every bake entity, stopping at the first failure
+func (s *Server) publishOnce(ctx context.Context) error {
+	states, err := s.bakeStates(time.Now())
+	if err != nil {
+		s.metrics.haPublishes.Inc("failure")
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sensorTimeout)
+	defer cancel()
+	for _, entity := range bakeEntities {
+		if err := s.publisher.SetState(ctx, entity, states[entity]); err != nil {
+			s.metrics.haPublishes.Inc("failure")
+			return err
+		}
+	}
+	s.metrics.haPublishes.Inc("success")
+	return nil
+}
+
+// Entities published to Home Assistant
+const (
+	entityStage          = "sensor.sourdough_stage"
+	entitySinceLastEvent = "sensor.sourdough_since_last_event"
+	entityFolds          = "sensor.sourdough_folds"
+	entityNextReminder   = "sensor.sourdough_next_reminder"
+	entityFoldDue        = "binary_sensor.sourdough_fold_due"
+	entityLastScore      = "sensor.sourdough_last_score"
+)
+
+// bakeEntities lists the entities in the order they are published
+var bakeEntities = []string{entityStage, entitySinceLastEvent, entityFolds, entityNextReminder, entityFoldDue, entityLastScore}
+
+// bakeStates describes the active bake as Home Assistant entity states. Values
+// that don't apply, like the next reminder between bakes, are "unknown".
+func (s *Server) bakeStates(now time.Time) (map[string]homeassistant.State, error) {
+	bake, err := s.storage.ReadCurrentBake()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current bake: %w", err)
+	}
+	active := len(bake.Events) > 0
+
+	stage := homeassistant.State{State: "idle", Attributes: map[string]interface{}{
+		"friendly_name": "Sourdough stage",
+		"icon":          "mdi:bread-slice",
+	}}
+	since := homeassistant.State{State: "unknown", Attributes: map[string]interface{}{
+		"friendly_name":       "Sourdough time since last event",
+		"icon":                "mdi:timer-outline",
+		"unit_of_measurement": "min",
+	}}
+	folds := 0
+	for _, e := range bake.Events {
+		if e.Event == models.EventFold {
+			folds++
+		}
+	}
+	foldCount := homeassistant.State{State: "0", Attributes: map[string]interface{}{
+		"friendly_name": "Sourdough folds",
+		"icon":          "mdi:layers-outline",
+		"target":        s.reminders.Folds,
+	}}
+	if active {
+		last := bake.Events[len(bake.Events)-1]
+		stage.State = string(bake.CurrentStage())
+		stage.Attributes["bake_id"] = strings.TrimPrefix(bake.Filename, "bake_")
+		stage.Attributes["started_at"] = bake.Events[0].Timestamp.Format(time.RFC3339)
+		if baker := bake.Baker(); baker != "" {
+			stage.Attributes["baker"] = baker
+		}
+		since.State = strconv.Itoa(int(now.Sub(last.Timestamp).Minutes()))
+		since.Attributes["last_event"] = string(last.Event)
+		since.Attributes["last_event_at"] = last.Timestamp.Format(time.RFC3339)
+		foldCount.State = strconv.Itoa(folds)
+	}
+
+	next := homeassistant.State{State: "unknown", Attributes: map[string]interface{}{
+		"friendly_name": "Sourdough next reminder",
+		"icon":          "mdi:bell-outline",
+		"device_class":  "timestamp",
+	}}
+	due := homeassistant.State{State: "off", Attributes: map[string]interface{}{
+		"friendly_name": "Sourdough fold due",
+		"icon":          "mdi:hand-back-left-outline",
+	}}
+	if r := s.reminders.nextReminder(bake); r != nil {
+		next.State = r.Due.Format(time.RFC3339)
+		next.Attributes["reminder"] = r.Action
+		due.Attributes["due_at"] = r.Due.Format(time.RFC3339)
+		due.Attributes["reminder"] = r.Action
+		if !now.Before(r.Due) {
+			due.State = "on"
+		}
+	}
+
+	score, err := s.lastScore()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]homeassistant.State{
+		entityStage:          stage,
+		entitySinceLastEvent: since,
+		entityFolds:          foldCount,
+		entityNextReminder:   next,
+		entityFoldDue:        due,
+		entityLastScore:      score,
+	}, nil
+}
+
+// lastScore is the score of the most recently assessed bake
+func (s *Server) lastScore() (homeassistant.State, error) {
+	state := homeassistant.State{State: "unknown", Attributes: map[string]interface{}{
+		"friendly_name": "Sourdough last score",
+		"icon":          "mdi:star-outline",
+	}}
+
+	ids, err := s.storage.ListBakes()
+	if err != nil {
+		return state, fmt.Errorf("failed to list bakes: %w", err)
+	}
+	for _, id := range ids {
+		bake, err := s.storage.ReadBake(id)
+		if err != nil {
+			return state, fmt.Errorf("failed to read bake %s: %w", id, err)
+		}
+		if bake.Assessment != nil && bake.Assessment.Score > 0 {
+			state.State = strconv.Itoa(bake.Assessment.Score)
+			state.Attributes["bake_id"] = id
+			state.Attributes["proof_level"] = string(bake.Assessment.ProofLevel)
+			break
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/homeassistant"
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// fakeStates is a Home Assistant that records the states posted to it
+type fakeStates struct {
+	mu     sync.Mutex
+	states map[string]homeassistant.State
+}
+
+func (f *fakeStates) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var state homeassistant.State
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&state) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[strings.TrimPrefix(r.URL.Path, "/api/states/")] = state
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *fakeStates) get(entity string) homeassistant.State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.states[entity]
+}
+
+func TestBakeStates(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+	server.SetReminders(Reminders{FoldInterval: 30 * time.Minute, Folds: 2})
+
+	// Nothing going on yet
+	states, err := server.bakeStates(time.Now())
+	if err != nil {
+		t.Fatalf("bakeStates failed: %v", err)
+	}
+	if states[entityStage].State != "idle" || states[entityNextReminder].State != "unknown" || states[entityLastScore].State != "unknown" {
+		t.Errorf("Unexpected idle states %+v", states)
+	}
+
+	// A finished bake with a score, then a new one in bulk
+	start := time.Date(2026, 3, 14, 9, 0, 0, 0, time.Local)
+	logAt := func(eventType models.EventType, at time.Time) *models.Event {
+		event := models.NewEvent(eventType)
+		event.Timestamp = at
+		return event
+	}
+	complete := logAt(models.EventLoafComplete, start.Add(-24*time.Hour))
+	complete.Data = map[string]interface{}{"assessment": models.Assessment{ProofLevel: models.ProofGood, Score: 8}}
+	if _, err := server.storage.ImportBake(&models.Bake{Events: []models.Event{*logAt(models.EventMixed, start.Add(-48*time.Hour)), *complete}}); err != nil {
+		t.Fatalf("ImportBake failed: %v", err)
+	}
+	server.storage.AppendEvent(logAt(models.EventMixed, start))
+	server.storage.AppendEvent(logAt(models.EventFold, start.Add(40*time.Minute)))
+
+	tests := []struct {
+		now     time.Time
+		since   string
+		foldDue string
+	}{
+		{start.Add(50 * time.Minute), "10", "off"},
+		{start.Add(75 * time.Minute), "35", "on"},
+	}
+	for _, tt := range tests {
+		states, err := server.bakeStates(tt.now)
+		if err != nil {
+			t.Fatalf("bakeStates failed: %v", err)
+		}
+		if states[entityStage].State != "bulk" || states[entityFolds].State != "1" {
+			t.Errorf("Expected bulk with 1 fold, got %q and %q", states[entityStage].State, states[entityFolds].State)
+		}
+		if states[entitySinceLastEvent].State != tt.since || states[entitySinceLastEvent].Attributes["last_event"] != "fold" {
+			t.Errorf("Expected %s minutes since the fold, got %+v", tt.since, states[entitySinceLastEvent])
+		}
+		next := states[entityNextReminder]
+		if next.State != start.Add(70*time.Minute).Format(time.RFC3339) || next.Attributes["reminder"] != "fold 2" {
+			t.Errorf("Expected fold 2 due 30m after fold 1, got %+v", next)
+		}
+		if states[entityFoldDue].State != tt.foldDue {
+			t.Errorf("At %s expected fold due %s, got %s", tt.now.Format("15:04"), tt.foldDue, states[entityFoldDue].State)
+		}
+		if states[entityLastScore].State != "8" {
+			t.Errorf("Expected last score 8, got %+v", states[entityLastScore])
+		}
+	}
+
+	// No reminder after the last fold
+	server.storage.AppendEvent(logAt(models.EventFold, start.Add(80*time.Minute)))
+	states, _ = server.bakeStates(start.Add(3 * time.Hour))
+	if states[entityNextReminder].State != "unknown" || states[entityFoldDue].State != "off" {
+		t.Errorf("Expected no reminder after the last fold, got %+v %+v", states[entityNextReminder], states[entityFoldDue])
+	}
+}
+
+func TestPublishBakeState(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	fake := &fakeStates{states: make(map[string]homeassistant.State)}
+	ha := httptest.NewServer(fake)
+	defer ha.Close()
+	server.SetPublisher(homeassistant.New(ha.URL, "token"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.publishBakeState(ctx)
+		close(done)
+	}()
+
+	// waitFor polls until the fake has seen the entity's state
+	waitFor := func(entity string, ok func(string) bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !ok(fake.get(entity).State) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := fake.get(entity).State; !ok(got) {
+			t.Fatalf("Unexpected %s state %q", entity, got)
+		}
+	}
+	is := func(want string) func(string) bool {
+		return func(got string) bool { return got == want }
+	}
+
+	// Every entity is published at startup, and again right after a write
+	waitFor(entityLastScore, is("unknown"))
+	for _, entity := range bakeEntities {
+		if fake.get(entity).Attributes["friendly_name"] == nil {
+			t.Errorf("Expected %s to be published with a name", entity)
+		}
+	}
+	if fake.get(entityStage).State != "idle" {
+		t.Errorf("Expected idle before the bake, got %+v", fake.get(entityStage))
+	}
+
+	server.storage.AppendEvent(models.NewEvent(models.EventMixed))
+	waitFor(entityStage, is("bulk"))
+	waitFor(entityNextReminder, func(got string) bool {
+		due, err := time.Parse(time.RFC3339, got)
+		return err == nil && time.Until(due) > 29*time.Minute
+	})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publisher didn't stop")
+	}
+}
@@ -0,0 +1,408 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"sync"
+)
+
+// iconSizes are the app icon sizes listed in the manifest
+var iconSizes = map[string]int{
+	"/icon-192.png": 192,
+	"/icon-512.png": 512,
+}
+
+var (
+	iconsOnce sync.Once
+	iconPNGs  map[string][]byte
+)
+
+// handleManifest serves the web app manifest that makes the UI installable
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	w.Write([]byte(manifestJSON))
+}
+
+// handleServiceWorker serves the service worker that caches pages and queues
+// events logged while the server is unreachable
+func (s *Server) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Service-Worker-Allowed", "/")
+	w.Write([]byte(serviceWorkerJS))
+}
+
+// handlePWAScript serves the script every page loads to register the service
+// worker and show queued events
+func (s *Server) handlePWAScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(pwaJS))
+}
+
+// handleIcon serves an app icon
+func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
+	iconsOnce.Do(func() {
+		iconPNGs = make(map[string][]byte)
+		for path, size := range iconSizes {
+			data, err := drawIcon(size)
+			if err != nil {
+				continue
+			}
+			iconPNGs[path] = data
+		}
+	})
+	data, ok := iconPNGs[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(data)
+}
+
+// drawIcon draws a scored loaf on the UI's purple, kept inside the middle 80%
+// so it survives being masked to a circle
+func drawIcon(size int) ([]byte, error) {
+	background := color.RGBA{0x76, 0x4b, 0xa2, 0xff}
+	crust := color.RGBA{0xd9, 0x8e, 0x3a, 0xff}
+	score := color.RGBA{0xf6, 0xd8, 0xa8, 0xff}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	s := float64(size)
+	cx, cy := s/2, s*0.54
+	rx, ry := s*0.34, s*0.24
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			dx, dy := (px-cx)/rx, (py-cy)/ry
+			c := background
+			if dx*dx+dy*dy <= 1 {
+				c = crust
+				// Three diagonal slashes across the top of the loaf
+				for _, offset := range []float64{-0.45, 0, 0.45} {
+					d := (dx - offset) + (dy+0.2)*0.6
+					if d > -0.06 && d < 0.06 && dy < 0.35 && dy > -0.75 {
+						c = score
+					}
+				}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode icon: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// pwaHeadHTML goes in every page's <head>
+const pwaHeadHTML = `<link rel="manifest" href="/manifest.webmanifest">
+    <meta name="theme-color" content="#764ba2">
+    <link rel="apple-touch-icon" href="/icon-192.png">
+    <script src="/pwa.js" defer></script>`
+
+const manifestJSON = `{
+  "name": "Sourdough Tracker",
+  "short_name": "Sourdough",
+  "start_url": "/view/status",
+  "scope": "/",
+  "display": "standalone",
+  "background_color": "#764ba2",
+  "theme_color": "#764ba2",
+  "icons": [
+    {"src": "/icon-192.png", "sizes": "192x192", "type": "image/png", "purpose": "any maskable"},
+    {"src": "/icon-512.png", "sizes": "512x512", "type": "image/png", "purpose": "any maskable"}
+  ],
+  "shortcuts": [
+    {"name": "Kitchen Kiosk", "url": "/kiosk"},
+    {"name": "Log Temperature", "url": "/temp"},
+    {"name": "Add Note", "url": "/notes"}
+  ]
+}
+`
+
+const pwaJS = `// Registers the service worker and shows how many offline events are
+// waiting to be sent to the server
+(function() {
+    if (!('serviceWorker' in navigator)) return;
+
+    // Service workers need HTTPS (or localhost); plain-HTTP LAN pages just skip this
+    navigator.serviceWorker.register('/sw.js', { scope: '/' }).catch(error => {
+        console.warn('Offline logging unavailable:', error.message);
+    });
+
+    const badge = document.createElement('div');
+    badge.style.cssText = 'position:fixed;left:12px;bottom:12px;z-index:1000;display:none;' +
+        'padding:8px 14px;border-radius:20px;background:#f59e0b;color:#fff;cursor:pointer;' +
+        'font:600 14px -apple-system,BlinkMacSystemFont,"Segoe UI",Roboto,sans-serif;' +
+        'box-shadow:0 2px 8px rgba(0,0,0,0.25)';
+    badge.title = 'Tap to retry now';
+
+    function showQueue(count) {
+        if (!document.body.contains(badge)) document.body.appendChild(badge);
+        badge.textContent = '⏳ ' + count + (count === 1 ? ' event' : ' events') + ' waiting to sync';
+        badge.style.display = count > 0 ? 'block' : 'none';
+    }
+
+    function replay() {
+        navigator.serviceWorker.ready.then(reg => {
+            if (reg.active) reg.active.postMessage({ type: 'replay' });
+        });
+    }
+
+    navigator.serviceWorker.addEventListener('message', event => {
+        if (event.data && event.data.type === 'queue') showQueue(event.data.count);
+    });
+    badge.addEventListener('click', replay);
+    window.addEventListener('online', replay);
+    document.addEventListener('visibilitychange', () => {
+        if (document.visibilityState === 'visible') replay();
+    });
+    replay();
+})();
+`
+
+const serviceWorkerJS = `// Sourdough service worker. Pages are served network-first with a cached
+// fallback. Events logged while the server is unreachable are queued in
+// IndexedDB with the time they were logged, then replayed oldest first with
+// an Idempotency-Key so a replay that already got through is never logged twice.
+const CACHE = 'sourdough-v1';
+const PAGES = ['/view/status', '/view/history', '/temp', '/notes', '/complete', '/ingredients',
+    '/kiosk', '/log/oven-in', '/log/remove-lid', '/pwa.js', '/manifest.webmanifest', '/icon-192.png'];
+// Never cached: live streams and anything that changes data
+const NO_CACHE = ['/api/events/stream', '/metrics', '/undo', '/loaf/start', '/login', '/logout'];
+// /log/* paths that are pages rather than events
+const LOG_PAGES = ['/log/oven-in', '/log/remove-lid'];
+const DB_NAME = 'sourdough';
+const STORE = 'queue';
+const SYNC_TAG = 'sourdough-replay';
+
+self.addEventListener('install', event => {
+    event.waitUntil(caches.open(CACHE)
+        .then(cache => Promise.all(PAGES.map(path =>
+            fetch(path, { credentials: 'same-origin' })
+                // Skip pages behind the login redirect; they're cached once visited
+                .then(response => response.ok && !response.redirected ? cache.put(path, response) : null)
+                .catch(() => null))))
+        .then(() => self.skipWaiting()));
+});
+
+self.addEventListener('activate', event => {
+    event.waitUntil(caches.keys()
+        .then(keys => Promise.all(keys.filter(key => key !== CACHE).map(key => caches.delete(key))))
+        .then(() => self.clients.claim())
+        .then(replay));
+});
+
+self.addEventListener('sync', event => {
+    if (event.tag === SYNC_TAG) event.waitUntil(replay());
+});
+
+self.addEventListener('message', event => {
+    if (event.data && event.data.type === 'replay') event.waitUntil(replay());
+});
+
+self.addEventListener('fetch', event => {
+    const request = event.request;
+    const url = new URL(request.url);
+    if (url.origin !== self.location.origin) return;
+
+    if (url.pathname.startsWith('/log/')) {
+        if (request.method === 'POST' && request.mode !== 'navigate') {
+            event.respondWith(logOrQueue(request));
+        } else if (request.mode === 'navigate' && !LOG_PAGES.includes(url.pathname)) {
+            // A scanned QR code, or a confirm page's form
+            event.respondWith(navigateOrQueue(request));
+        }
+        return;
+    }
+    if (request.method !== 'GET' || NO_CACHE.includes(url.pathname)) return;
+    event.respondWith(networkFirst(request));
+});
+
+// IndexedDB queue of {key, url, method, contentType, body, time}, keyed by idempotency key
+
+function openDB() {
+    return new Promise((resolve, reject) => {
+        const req = indexedDB.open(DB_NAME, 1);
+        req.onupgradeneeded = () => req.result.createObjectStore(STORE, { keyPath: 'key' });
+        req.onsuccess = () => resolve(req.result);
+        req.onerror = () => reject(req.error);
+    });
+}
+
+async function withStore(mode, fn) {
+    const db = await openDB();
+    return new Promise((resolve, reject) => {
+        const tx = db.transaction(STORE, mode);
+        const req = fn(tx.objectStore(STORE));
+        tx.oncomplete = () => { db.close(); resolve(req.result); };
+        tx.onerror = tx.onabort = () => { db.close(); reject(tx.error); };
+    });
+}
+
+const queuePut = item => withStore('readwrite', store => store.put(item));
+const queueDelete = key => withStore('readwrite', store => store.delete(key));
+const queueCount = () => withStore('readonly', store => store.count());
+const queueAll = () => withStore('readonly', store => store.getAll())
+    .then(items => items.sort((a, b) => a.time.localeCompare(b.time)));
+
+async function queueItem(request) {
+    return {
+        key: self.crypto.randomUUID(),
+        url: request.url,
+        method: request.method,
+        contentType: request.headers.get('Content-Type'),
+        body: request.method === 'POST' ? await request.clone().blob() : null,
+        time: new Date().toISOString()
+    };
+}
+
+// send posts a queued event with its key and original time. Signed QR links
+// replay as GETs, since the signature is their login; everything else is a POST.
+function send(item) {
+    const url = new URL(item.url);
+    const method = item.method === 'GET' && !url.searchParams.has('sig') ? 'POST' : item.method;
+    const headers = { 'Idempotency-Key': item.key, 'X-Event-Time': item.time, 'Accept': 'application/json' };
+    if (item.contentType && method === 'POST') headers['Content-Type'] = item.contentType;
+    return fetch(item.url, {
+        method: method,
+        headers: headers,
+        body: method === 'POST' ? item.body : undefined,
+        credentials: 'same-origin',
+        cache: 'no-store'
+    });
+}
+
+// unreachable says whether a response means the server itself is down, as
+// opposed to it rejecting the event
+function unreachable(response) {
+    return response.status === 502 || response.status === 503 || response.status === 504;
+}
+
+async function enqueue(item) {
+    await queuePut(item);
+    if (self.registration.sync) {
+        self.registration.sync.register(SYNC_TAG).catch(() => {});
+    }
+    notify();
+}
+
+async function logOrQueue(request) {
+    const item = await queueItem(request);
+    try {
+        const response = await send(item);
+        if (!unreachable(response)) {
+            replay();
+            return response;
+        }
+    } catch (error) {
+        // Offline; queue it below
+    }
+    await enqueue(item);
+    return new Response(JSON.stringify({ status: 'queued', time: item.time }), {
+        status: 202,
+        headers: { 'Content-Type': 'application/json' }
+    });
+}
+
+async function navigateOrQueue(request) {
+    const item = await queueItem(request);
+    try {
+        const response = await fetch(request);
+        if (!unreachable(response)) {
+            replay();
+            return response;
+        }
+    } catch (error) {
+        // Offline; queue it below
+    }
+    await enqueue(item);
+    const event = new URL(item.url).pathname.replace('/log/', '');
+    const time = new Date(item.time).toLocaleTimeString([], { hour: 'numeric', minute: '2-digit' });
+    return offlinePage('📴 Saved Offline',
+        'The server can\'t be reached, so <strong>' + escapeHTML(event) + '</strong> at ' + time +
+        ' is saved on this phone. It will be logged with its original time once you\'re back on Wi-Fi.');
+}
+
+let replaying = null;
+
+// replay sends queued events oldest first. Events the server accepts, already
+// has, or rejects outright are removed; it stops at the first one that can't
+// get through yet and leaves the rest for later.
+function replay() {
+    if (!replaying) {
+        replaying = replayQueue().catch(error => console.error('Replay failed:', error))
+            .finally(() => { replaying = null; notify(); });
+    }
+    return replaying;
+}
+
+async function replayQueue() {
+    const items = await queueAll();
+    for (const item of items) {
+        let response;
+        try {
+            response = await send(item);
+        } catch (error) {
+            return;
+        }
+        // Waiting on a login, or the server is struggling: try again later
+        if (response.status === 401 || response.status === 408 || response.status === 429 || response.status >= 500) {
+            return;
+        }
+        if (!response.ok) {
+            console.warn('Dropping queued event the server rejected:', item.url, response.status, await response.text());
+        }
+        await queueDelete(item.key);
+    }
+}
+
+async function notify() {
+    const count = await queueCount().catch(() => 0);
+    const clients = await self.clients.matchAll({ includeUncontrolled: true });
+    clients.forEach(client => client.postMessage({ type: 'queue', count: count }));
+}
+
+async function networkFirst(request) {
+    const cache = await caches.open(CACHE);
+    try {
+        const response = await fetch(request);
+        if (response.ok && !response.redirected) cache.put(request, response.clone());
+        return response;
+    } catch (error) {
+        const cached = await cache.match(request) || await cache.match(new URL(request.url).pathname);
+        if (cached) return cached;
+        if (request.mode === 'navigate') {
+            return offlinePage('📴 Offline', 'This page hasn\'t been saved on this phone yet. Try again once you\'re back on Wi-Fi.');
+        }
+        return new Response('Offline', { status: 503, headers: { 'Content-Type': 'text/plain' } });
+    }
+}
+
+function escapeHTML(text) {
+    return text.replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' })[c]);
+}
+
+function offlinePage(title, message) {
+    const html = '<!DOCTYPE html><html><head><meta charset="UTF-8">' +
+        '<meta name="viewport" content="width=device-width, initial-scale=1.0">' +
+        '<title>' + title + '</title><style>' +
+        'body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Roboto,sans-serif;' +
+        'background:linear-gradient(135deg,#667eea 0%,#764ba2 100%);min-height:100vh;margin:0;' +
+        'display:flex;align-items:center;justify-content:center;padding:20px;box-sizing:border-box}' +
+        '.card{background:#fff;border-radius:20px;padding:32px;max-width:420px;text-align:center;' +
+        'box-shadow:0 20px 60px rgba(0,0,0,0.3)}h1{color:#333;margin-top:0}p{color:#555;line-height:1.5}' +
+        'a{color:#764ba2}</style></head><body><div class="card"><h1>' + title + '</h1><p>' + message +
+        '</p><p><a href="/view/status">View status</a></p></div></body></html>';
+    return new Response(html, { status: 200, headers: { 'Content-Type': 'text/html; charset=utf-8' } });
+}
+`
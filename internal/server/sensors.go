@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/ecobee"
+)
+
+// sensorTimeout is the longest a request waits for Home Assistant, retries included
+const sensorTimeout = 5 * time.Second
+
+// handleAPISensors reports the health of the kitchen and fridge sensors,
+// refreshing readings that are older than the cache lifetime
+func (s *Server) handleAPISensors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sensorTimeout)
+	defer cancel()
+
+	healthy := true
+	sensors := make(map[string]ecobee.Status)
+	for name, sensor := range map[string]*ecobee.Client{"kitchen": s.ecobee, "fridge": s.fridge} {
+		if sensor.IsEnabled() {
+			// Failures show up in the status
+			sensor.Read(ctx)
+		}
+		status := sensor.Status()
+		if sensor.IsEnabled() && !status.Healthy {
+			healthy = false
+		}
+		sensors[name] = status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"healthy": healthy,
+		"sensors": sensors,
+	})
+}
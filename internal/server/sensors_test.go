@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdeckert/sourdough/internal/ecobee"
+)
+
+func TestAPISensors(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	get := func() (bool, map[string]ecobee.Status) {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sensors", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Healthy bool                     `json:"healthy"`
+			Sensors map[string]ecobee.Status `json:"sensors"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.Healthy, response.Sensors
+	}
+
+	// Unconfigured sensors don't count against health
+	healthy, sensors := get()
+	if !healthy || sensors["kitchen"].State != "disabled" || sensors["fridge"].State != "disabled" {
+		t.Errorf("Expected healthy with both sensors disabled, got %v %+v", healthy, sensors)
+	}
+
+	kitchen := fakeSensor("71.5")
+	defer kitchen.Close()
+	fridge := fakeSensor("unavailable")
+	defer fridge.Close()
+	server.ecobee = ecobee.New(kitchen.URL, "token", "sensor.kitchen")
+	server.SetFridgeSensor(ecobee.New(fridge.URL, "token", "sensor.fridge"))
+
+	healthy, sensors = get()
+	if healthy {
+		t.Error("Expected unhealthy with the fridge unavailable")
+	}
+	if k := sensors["kitchen"]; k.State != "ok" || !k.Healthy || k.Reading == nil || k.Reading.TempF != 71.5 {
+		t.Errorf("Unexpected kitchen status %+v", k)
+	}
+	if f := sensors["fridge"]; f.State != "error" || f.Healthy || f.LastError == "" {
+		t.Errorf("Unexpected fridge status %+v", f)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sensors", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
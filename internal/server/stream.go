@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+const (
+	streamBuffer    = 32               // Messages a client may fall behind before it is dropped
+	streamHeartbeat = 25 * time.Second // Keeps proxies and idle phones from closing the stream
+	streamRetry     = 3 * time.Second  // How long browsers wait before reconnecting
+)
+
+// streamMessage is one server-sent event
+type streamMessage struct {
+	ID    uint64
+	Event string
+	Data  []byte
+}
+
+// hub fans messages out to every subscriber. Publishing never blocks: a
+// subscriber whose buffer is full is dropped and its channel closed, so the
+// client reconnects and reloads rather than holding up storage writes.
+type hub struct {
+	mu     sync.Mutex
+	subs   map[chan streamMessage]struct{}
+	buffer int
+	nextID uint64
+}
+
+// newHub creates a hub whose subscribers buffer up to buffer messages
+func newHub(buffer int) *hub {
+	return &hub{subs: make(map[chan streamMessage]struct{}), buffer: buffer}
+}
+
+// subscribe registers a subscriber; call the returned func when done. The
+// channel is closed if the subscriber falls behind or the hub disconnects it.
+func (h *hub) subscribe() (<-chan streamMessage, func()) {
+	ch := make(chan streamMessage, h.buffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() { h.remove(ch) }
+}
+
+// remove closes a subscriber's channel unless it's already gone
+func (h *hub) remove(ch chan streamMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// publish sends a message to every subscriber, returning how many were
+// dropped for being too slow
+func (h *hub) publish(event string, data []byte) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	msg := streamMessage{ID: h.nextID, Event: event, Data: data}
+	dropped := 0
+	for ch := range h.subs {
+		select {
+		case ch <- msg:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// disconnectAll closes every subscriber, letting streams end for shutdown
+func (h *hub) disconnectAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// count is the number of subscribers
+func (h *hub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// watchStream broadcasts every storage change, including auto-logged
+// temperatures, to the live pages
+func (s *Server) watchStream(store storage.Store) {
+	store.Subscribe(func(change storage.Change) {
+		data, err := json.Marshal(change)
+		if err != nil {
+			return
+		}
+		if dropped := s.stream.publish(string(change.Op), data); dropped > 0 {
+			s.metrics.streamDropped.Add(float64(dropped))
+		}
+	})
+}
+
+// streamClients is the number of open event streams, for /metrics
+func (s *Server) streamClients() float64 {
+	return float64(s.stream.count())
+}
+
+// handleEventStream streams bake changes as server-sent events. Each event is
+// named after the storage op (append, delete-event, delete-bake, ...) and
+// carries the change as JSON: {"op", "bake_id", "event"}.
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	messages, unsubscribe := s.stream.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				// Too slow or shutting down; the browser reconnects
+				return
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event, msg.Data)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+func TestHubSlowClient(t *testing.T) {
+	h := newHub(4)
+	fast, unsubscribeFast := h.subscribe()
+	defer unsubscribeFast()
+	slow, unsubscribeSlow := h.subscribe()
+
+	// The slow subscriber never reads; publishing must not wait for it
+	done := make(chan []int)
+	go func() {
+		var dropped []int
+		for i := 0; i < 10; i++ {
+			dropped = append(dropped, h.publish("append", []byte{byte(i)}))
+			<-fast
+		}
+		done <- dropped
+	}()
+	var dropped []int
+	select {
+	case dropped = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+	// The fifth message overflows the slow subscriber's buffer
+	for i, n := range dropped {
+		want := 0
+		if i == 4 {
+			want = 1
+		}
+		if n != want {
+			t.Errorf("Publish %d: expected %d dropped, got %d", i, want, n)
+		}
+	}
+
+	// The slow subscriber gets what fit in its buffer, then its channel closes
+	var got []uint64
+	for msg := range slow {
+		got = append(got, msg.ID)
+	}
+	if len(got) != 4 || got[0] != 1 || got[3] != 4 {
+		t.Errorf("Expected messages 1-4 before the close, got %v", got)
+	}
+	if h.count() != 1 {
+		t.Errorf("Expected 1 subscriber left, got %d", h.count())
+	}
+
+	// Unsubscribing after being dropped is harmless
+	unsubscribeSlow()
+
+	h.disconnectAll()
+	if _, ok := <-fast; ok || h.count() != 0 {
+		t.Error("Expected disconnectAll to close every subscriber")
+	}
+}
+
+// readEvent reads the next server-sent event, skipping comments and retry hints
+func readEvent(t *testing.T, r *bufio.Reader) (string, storage.Change) {
+	t.Helper()
+	var name string
+	var change storage.Change
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &change); err != nil {
+				t.Fatalf("Invalid data %q: %v", line, err)
+			}
+		case line == "" && name != "":
+			return name, change
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- server.serve(ctx, ln) }()
+	base := "http://" + ln.Addr().String()
+
+	resp, err := http.Get(base + "/api/events/stream")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+	stream := bufio.NewReader(resp.Body)
+	if line, _ := stream.ReadString('\n'); line != "retry: 3000\n" {
+		t.Errorf("Expected a retry hint first, got %q", line)
+	}
+
+	// Events logged from another phone show up on the stream
+	if _, err := http.Post(base+"/log/fold", "", nil); err != nil {
+		t.Fatalf("Failed to log: %v", err)
+	}
+	name, change := readEvent(t, stream)
+	if name != "append" || change.Event == nil || change.Event.Event != models.EventFold || change.BakeID == "" {
+		t.Errorf("Expected the fold, got %s %+v", name, change)
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	server.storage.DeleteEvent(0, bake.Events[0].Timestamp.Format(time.RFC3339Nano))
+	if name, change = readEvent(t, stream); name != "delete-event" || change.Event == nil {
+		t.Errorf("Expected the delete, got %s %+v", name, change)
+	}
+	if server.streamClients() != 1 {
+		t.Errorf("Expected 1 stream client, got %v", server.streamClients())
+	}
+
+	// Open streams don't hold up shutdown
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown waited for the open stream")
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mdeckert/sourdough/internal/replica"
+)
+
+// EnableSync serves /api/sync so other servers can sync with this one. POST
+// /api/sync only starts a sync with one of peers.
+func (s *Server) EnableSync(node *replica.Node, peers []string) {
+	s.replica = node
+	s.syncPeers = nil
+	for _, peer := range peers {
+		s.syncPeers = append(s.syncPeers, strings.TrimSuffix(peer, "/"))
+	}
+}
+
+// allowedPeer reports whether peer is in the sync allowlist
+func (s *Server) allowedPeer(peer string) bool {
+	peer = strings.TrimSuffix(peer, "/")
+	for _, p := range s.syncPeers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAPISync serves the sync protocol:
+//
+//	GET  /api/sync                         snapshot of bakes and delete registers
+//	POST /api/sync {"peer": url}           sync with an allowed peer now (used by `sourdough sync`)
+//	POST /api/sync/registers               merge a peer's delete registers
+//	GET  /api/sync/bake/{id}               a bake's events
+//	PUT  /api/sync/bake/{id}               merge a peer's copy of a bake
+//	GET  /api/sync/image/{id}/{name}       download an image
+//	PUT  /api/sync/image/{id}/{name}       upload an image
+func (s *Server) handleAPISync(w http.ResponseWriter, r *http.Request) {
+	if s.replica == nil {
+		http.Error(w, "Sync not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sync"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		snap, err := s.replica.Snapshot()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read bakes: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snap)
+
+	case path == "" && r.Method == http.MethodPost:
+		var req struct {
+			Peer string `json:"peer"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Peer == "" {
+			http.Error(w, "Peer URL required", http.StatusBadRequest)
+			return
+		}
+		if !s.allowedPeer(req.Peer) {
+			http.Error(w, fmt.Sprintf("Peer %s is not in sync.peers", req.Peer), http.StatusForbidden)
+			return
+		}
+		report, err := s.replica.SyncWith(req.Peer)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Sync failed: %v", err), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+
+	case path == "registers" && r.Method == http.MethodPost:
+		var regs replica.Registers
+		if err := json.NewDecoder(r.Body).Decode(&regs); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := s.replica.MergeRegisters(regs); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to apply registers: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "merged"})
+
+	case len(parts) == 2 && parts[0] == "bake":
+		s.handleSyncBake(w, r, parts[1])
+
+	case len(parts) == 3 && parts[0] == "image":
+		s.handleSyncImage(w, r, parts[1], parts[2])
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// handleSyncBake sends or merges one bake
+func (s *Server) handleSyncBake(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		events, err := s.replica.Events(id)
+		if err != nil || len(events) == 0 {
+			http.Error(w, "Bake not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(replica.BakePayload{ID: id, Events: events})
+
+	case http.MethodPut:
+		var payload replica.BakePayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		changed, err := s.replica.MergeBake(id, payload.Events)
+		if errors.Is(err, replica.ErrInvalidName) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to merge bake: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"changed": changed})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSyncImage sends or stores one image
+func (s *Server) handleSyncImage(w http.ResponseWriter, r *http.Request, id, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		f, err := s.replica.OpenImage(id, name)
+		if os.IsNotExist(err) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.Copy(w, f)
+
+	case http.MethodPut:
+		// Same limit as photo uploads from the notes page
+		if err := s.replica.SaveImage(id, name, http.MaxBytesReader(w, r.Body, 10<<20)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save image: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "saved"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/replica"
+)
+
+// setupSyncServer starts a server with sync enabled on its own data directory
+func setupSyncServer(t *testing.T) (*Server, *httptest.Server, string) {
+	server, tmpDir := setupTestServer(t)
+	node, err := replica.New(server.storage, tmpDir)
+	if err != nil {
+		cleanup(tmpDir)
+		t.Fatalf("Failed to create sync node: %v", err)
+	}
+	server.EnableSync(node, nil)
+	return server, httptest.NewServer(server.Handler()), tmpDir
+}
+
+// eventNames lists a bake's event types
+func eventNames(bake *models.Bake) string {
+	var names []string
+	for _, e := range bake.Events {
+		names = append(names, string(e.Event))
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSyncBetweenServers(t *testing.T) {
+	kitchen, kitchenHTTP, kitchenDir := setupSyncServer(t)
+	defer cleanup(kitchenDir)
+	defer kitchenHTTP.Close()
+	cabin, cabinHTTP, cabinDir := setupSyncServer(t)
+	defer cleanup(cabinDir)
+	defer cabinHTTP.Close()
+
+	// Kitchen has an active bake with a photo, the cabin an old finished bake
+	kitchen.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+	kitchen.storage.AppendEvent(models.NewEvent(models.EventFed))
+	kitchen.storage.SaveImage("1.jpg", strings.NewReader("jpeg"))
+	kitchen.storage.AppendEvent(models.NewEvent(models.EventNote).WithImage("1.jpg"))
+
+	start := time.Date(2024, 3, 9, 8, 0, 0, 0, time.Local)
+	cabin.storage.WriteBake("2024-03-09_08-00-00", []models.Event{
+		{Timestamp: start, Event: models.EventStarterOut, ID: "a1"},
+		{Timestamp: start.Add(time.Hour), Event: models.EventLoafComplete, ID: "a2"},
+	})
+
+	report, err := kitchen.replica.SyncWith(cabinHTTP.URL)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Pulled != 1 || report.Pushed != 1 || report.ImagesPushed != 1 {
+		t.Errorf("Expected one bake each way and one image pushed, got %+v", report)
+	}
+
+	kitchenBakes, _ := kitchen.storage.ListBakes()
+	cabinBakes, _ := cabin.storage.ListBakes()
+	if len(kitchenBakes) != 2 || len(cabinBakes) != 2 {
+		t.Fatalf("Expected both bakes on both servers, got %v and %v", kitchenBakes, cabinBakes)
+	}
+	current, _ := cabin.storage.ReadCurrentBake()
+	if eventNames(current) != "starter-out,fed,note" {
+		t.Errorf("Expected kitchen bake active on cabin, got %s", eventNames(current))
+	}
+	if data, err := os.ReadFile(cabin.storage.GetImagePath(kitchenBakes[0], "1.jpg")); err != nil || string(data) != "jpeg" {
+		t.Errorf("Expected photo copied to cabin, got %q (err %v)", data, err)
+	}
+
+	// Offline on both sides: the cabin deletes fed while the kitchen logs mixed
+	cabin.storage.DeleteEvent(1, current.Events[1].Timestamp.Format(time.RFC3339Nano))
+	kitchen.storage.AppendEvent(models.NewEvent(models.EventMixed))
+	kitchen.storage.DeleteBake("2024-03-09_08-00-00")
+
+	// Sync from the cabin's side, the way `sourdough sync <peer>` does, once
+	// the kitchen is in its sync.peers
+	body, _ := json.Marshal(map[string]string{"peer": kitchenHTTP.URL})
+	resp, err := http.Post(cabinHTTP.URL+"/api/sync", "application/json", bytes.NewReader(body))
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected a peer outside sync.peers refused, got %v %v", err, resp.Status)
+	}
+	resp.Body.Close()
+	cabin.EnableSync(cabin.replica, []string{kitchenHTTP.URL + "/"})
+	resp, err = http.Post(cabinHTTP.URL+"/api/sync", "application/json", bytes.NewReader(body))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Sync request failed: %v %v", err, resp.Status)
+	}
+	resp.Body.Close()
+
+	for name, server := range map[string]*Server{"kitchen": kitchen, "cabin": cabin} {
+		bake, _ := server.storage.ReadCurrentBake()
+		if eventNames(bake) != "starter-out,note,mixed" {
+			t.Errorf("%s: expected merged events, got %s", name, eventNames(bake))
+		}
+		if bakes, _ := server.storage.ListBakes(); len(bakes) != 1 {
+			t.Errorf("%s: expected deleted bake gone, got %v", name, bakes)
+		}
+	}
+	if trash, _ := cabin.storage.ListTrash(); len(trash) != 1 {
+		t.Errorf("Expected bake deleted by sync to be in the cabin's trash, got %v", trash)
+	}
+
+	// Nothing left to exchange
+	report, err = kitchen.replica.SyncWith(cabinHTTP.URL)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Pulled+report.Pushed+report.ImagesPulled+report.ImagesPushed != 0 {
+		t.Errorf("Expected nothing to sync, got %+v", report)
+	}
+}
+
+func TestSyncRejectsSelf(t *testing.T) {
+	server, httpServer, tmpDir := setupSyncServer(t)
+	defer cleanup(tmpDir)
+	defer httpServer.Close()
+
+	if _, err := server.replica.SyncWith(httpServer.URL); err == nil {
+		t.Error("Expected error syncing with itself")
+	}
+}
@@ -28,6 +28,8 @@ const navDropdownHTML = `
             <option value="/ingredients">📋 Ingredients Reference</option>
             <option value="/view/status">📊 View Status</option>
             <option value="/view/history">📚 View History</option>
+            <option value="/kiosk">🖥️ Kitchen Kiosk</option>
+            <option value="/profile">👩‍🍳 Switch Baker</option>
             <option value="/qrcodes.pdf">📱 Get QR Codes</option>
         </optgroup>
     </select>
@@ -39,6 +41,7 @@ const ingredientsPageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Ingredients Reference</title>
     <style>
         * { margin: 0; padding: 0; box-sizing: border-box; }
@@ -198,6 +201,7 @@ const completePageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Complete Bake</title>
     <style>
         * { margin: 0; padding: 0; box-sizing: border-box; }
@@ -421,6 +425,7 @@ const notesPageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Add Note</title>
     <style>
         * {
@@ -827,6 +832,7 @@ const tempPageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Log Temperature</title>
     <style>
         * {
@@ -1136,6 +1142,7 @@ const ovenInPageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Oven In</title>
     <style>
         * { margin: 0; padding: 0; box-sizing: border-box; }
@@ -1243,6 +1250,7 @@ const removeLidPageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Remove Lid</title>
     <style>
         * { margin: 0; padding: 0; box-sizing: border-box; }
@@ -1350,6 +1358,7 @@ const historyViewPageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Bake History</title>
     <style>
         * { margin: 0; padding: 0; box-sizing: border-box; }
@@ -1512,6 +1521,15 @@ const historyViewPageHTML = `<!DOCTYPE html>
             color: #666;
             margin-top: 4px;
         }
+        .trash-row {
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+            gap: 10px;
+            padding: 12px 0;
+            border-bottom: 1px solid #e5e7eb;
+            flex-wrap: wrap;
+        }
     </style>
 </head>
 <body>
@@ -1521,13 +1539,23 @@ const historyViewPageHTML = `<!DOCTYPE html>
                 <h1>📚 Bake History</h1>
                 <p class="subtitle" id="subtitle">Loading bakes...</p>
             </div>
+            <a class="filter-btn" href="/api/bakes/export?format=csv" style="text-decoration: none; color: #333;">⬇️ Export CSV</a>
         </div>
         <div class="content">
             <div class="loading" id="loading">Loading bake history...</div>
             <div id="history-content" style="display: none;">
                 <div class="stats-summary" id="stats-summary"></div>
                 <div class="search-filter">
-                    <input type="text" class="search-input" id="searchInput" placeholder="Search bakes by date or notes...">
+                    <input type="text" class="search-input" id="searchInput" placeholder="Search notes, events, assessments... (e.g. 80% hydration)">
+                    <select class="filter-btn" id="baker" onchange="changeBaker()">
+                        <option value="">🏠 Household</option>
+                    </select>
+                    <select class="filter-btn" id="minScore" onchange="applyFilters()">
+                        <option value="">Any score</option>
+                        <option value="6">Score 6+</option>
+                        <option value="8">Score 8+</option>
+                        <option value="10">Score 10</option>
+                    </select>
                     <button class="filter-btn active" onclick="filterBakes('all')">All</button>
                     <button class="filter-btn" onclick="filterBakes('complete')">Completed</button>
                     <button class="filter-btn" onclick="filterBakes('in-progress')">In Progress</button>
@@ -1541,24 +1569,64 @@ const historyViewPageHTML = `<!DOCTYPE html>
         </div>
     </div>
 
+    <div class="container" id="trash-section" style="display: none;">
+        <div class="header">
+            <div>
+                <h1>🗑️ Trash</h1>
+                <p class="subtitle" id="trash-subtitle">Deleted bakes can be restored</p>
+            </div>
+            <button class="filter-btn" onclick="purgeTrash()">Empty items older than 30 days</button>
+        </div>
+        <div class="content" id="trashList"></div>
+    </div>
+
     <script>
         let allBakes = [];
         let currentFilter = 'all';
 
+        const currentBaker = new URLSearchParams(window.location.search).get('user') || '';
+
+        async function loadBakers() {
+            try {
+                const response = await fetch('/api/profiles');
+                if (!response.ok) return;
+                const profiles = await response.json();
+                const select = document.getElementById('baker');
+                profiles.forEach(p => {
+                    const option = document.createElement('option');
+                    option.value = p.name;
+                    option.textContent = '👩‍🍳 ' + p.name;
+                    select.appendChild(option);
+                });
+                select.value = currentBaker;
+            } catch (error) {
+                console.error('Error loading profiles:', error);
+            }
+        }
+
+        function changeBaker() {
+            const baker = document.getElementById('baker').value;
+            window.location.href = '/view/history' + (baker ? '?user=' + encodeURIComponent(baker) : '');
+        }
+
         async function loadHistory() {
             try {
-                const response = await fetch('/api/bakes');
+                const response = await fetch('/api/bakes' + (currentBaker ? '?user=' + encodeURIComponent(currentBaker) : ''));
                 allBakes = await response.json();
 
                 if (!allBakes || allBakes.length === 0) {
                     document.getElementById('loading').style.display = 'none';
                     document.getElementById('no-bakes').style.display = 'block';
+                    if (currentBaker) {
+                        document.querySelector('#no-bakes p').innerHTML = 'No bakes by this baker yet. <a href="/view/history">Show the whole household</a>';
+                    }
                     return;
                 }
 
                 document.getElementById('loading').style.display = 'none';
                 document.getElementById('history-content').style.display = 'block';
-                document.getElementById('subtitle').textContent = 'Viewing ' + allBakes.length + ' bakes';
+                document.getElementById('subtitle').textContent = 'Viewing ' + allBakes.length + ' bakes' +
+                    (currentBaker ? ' by ' + currentBaker : '');
 
                 displayStatsSummary();
                 displayBakes(allBakes);
@@ -1592,6 +1660,13 @@ const historyViewPageHTML = `<!DOCTYPE html>
             document.getElementById('stats-summary').innerHTML = html;
         }
 
+        // escapeHTML makes logged text (notes, snippets, names) safe to put in innerHTML
+        function escapeHTML(text) {
+            const span = document.createElement('span');
+            span.textContent = text;
+            return span.innerHTML;
+        }
+
         function displayBakes(bakes) {
             const grid = document.getElementById('bakeGrid');
             grid.innerHTML = '';
@@ -1605,6 +1680,9 @@ const historyViewPageHTML = `<!DOCTYPE html>
                 html += '<div class="bake-title">' + bake.start_time + '</div>';
                 html += '<div class="bake-stats">';
                 html += '<span class="stat"><strong>' + bake.event_count + '</strong> events</span>';
+                if (bake.baker) {
+                    html += '<span class="stat">👩‍🍳 ' + escapeHTML(bake.baker) + '</span>';
+                }
                 html += '</div>';
 
                 if (bake.completed) {
@@ -1624,14 +1702,22 @@ const historyViewPageHTML = `<!DOCTYPE html>
                     if (bake.assessment.proof_level) {
                         const proofClass = bake.assessment.proof_level === 'good' ? 'proof-good' :
                                          bake.assessment.proof_level === 'underproofed' ? 'proof-under' : 'proof-over';
-                        html += '<span class="proof-badge ' + proofClass + '">' + bake.assessment.proof_level + '</span>';
+                        html += '<span class="proof-badge ' + proofClass + '">' + escapeHTML(bake.assessment.proof_level) + '</span>';
                     }
                     if (bake.assessment.notes) {
-                        html += '<div class="bake-date" style="margin-top: 8px;">📝 ' + bake.assessment.notes + '</div>';
+                        html += '<div class="bake-date" style="margin-top: 8px;">📝 ' + escapeHTML(bake.assessment.notes) + '</div>';
                     }
                     html += '</div>';
                 }
 
+                if (bake.snippets && bake.snippets.length > 0) {
+                    html += '<div class="assessment">';
+                    bake.snippets.slice(0, 3).forEach(snippet => {
+                        html += '<div class="bake-date">🔍 ' + escapeHTML(snippet) + '</div>';
+                    });
+                    html += '</div>';
+                }
+
                 card.innerHTML = html;
                 grid.appendChild(card);
             });
@@ -1649,12 +1735,17 @@ const historyViewPageHTML = `<!DOCTYPE html>
             applyFilters();
         }
 
+        let searchTimer = null;
+
         function handleSearch() {
-            applyFilters();
+            // Debounce so we don't query the server on every keystroke
+            clearTimeout(searchTimer);
+            searchTimer = setTimeout(applyFilters, 250);
         }
 
-        function applyFilters() {
-            const searchTerm = document.getElementById('searchInput').value.toLowerCase();
+        async function applyFilters() {
+            const searchTerm = document.getElementById('searchInput').value.trim();
+            const minScore = document.getElementById('minScore').value;
 
             let filtered = allBakes;
 
@@ -1665,20 +1756,130 @@ const historyViewPageHTML = `<!DOCTYPE html>
                 filtered = filtered.filter(b => !b.completed);
             }
 
-            // Apply search filter
-            if (searchTerm) {
-                filtered = filtered.filter(b => {
-                    return b.date.toLowerCase().includes(searchTerm) ||
-                           b.start_time.toLowerCase().includes(searchTerm) ||
-                           (b.assessment && b.assessment.notes && b.assessment.notes.toLowerCase().includes(searchTerm));
-                });
+            // Apply full-text search and score filter via the server-side index
+            if (searchTerm || minScore) {
+                try {
+                    let url = '/api/search?q=' + encodeURIComponent(searchTerm);
+                    if (minScore) {
+                        url += '&min_score=' + minScore;
+                    }
+                    const response = await fetch(url);
+                    const data = await response.json();
+
+                    const byDate = {};
+                    filtered.forEach(b => byDate[b.date] = b);
+
+                    filtered = data.results
+                        .filter(r => byDate[r.date])
+                        .map(r => Object.assign({}, byDate[r.date], { snippets: r.snippets }));
+                } catch (error) {
+                    console.error('Error searching bakes:', error);
+                    // Fall back to matching dates and assessment notes locally
+                    const term = searchTerm.toLowerCase();
+                    filtered = filtered.filter(b => {
+                        return b.date.toLowerCase().includes(term) ||
+                               (b.assessment && b.assessment.notes && b.assessment.notes.toLowerCase().includes(term));
+                    });
+                }
             }
 
             displayBakes(filtered);
         }
 
-        // Load history on page load
+        async function loadTrash() {
+            try {
+                const response = await fetch('/api/trash');
+                const entries = await response.json();
+                const section = document.getElementById('trash-section');
+
+                if (!entries || entries.length === 0) {
+                    section.style.display = 'none';
+                    return;
+                }
+
+                section.style.display = 'block';
+                document.getElementById('trash-subtitle').textContent =
+                    entries.length + ' deleted bake' + (entries.length === 1 ? '' : 's') + ' can be restored';
+
+                let html = '';
+                entries.forEach(entry => {
+                    html += '<div class="trash-row">';
+                    html += '<div><div class="bake-title" style="margin-bottom: 4px;">' + entry.bake_id + '</div>';
+                    html += '<div class="bake-date">Deleted ' + new Date(entry.deleted_at).toLocaleString() +
+                            ' · ' + entry.events + ' events' +
+                            (entry.images > 0 ? ' · ' + entry.images + ' photos' : '') + '</div></div>';
+                    html += '<button class="filter-btn" onclick="restoreBake(\'' + encodeURIComponent(entry.id) + '\')">↩️ Restore</button>';
+                    html += '</div>';
+                });
+                document.getElementById('trashList').innerHTML = html;
+            } catch (error) {
+                console.error('Error loading trash:', error);
+            }
+        }
+
+        async function restoreBake(trashId) {
+            const response = await fetch('/api/trash/' + trashId + '/restore', { method: 'POST' });
+            const data = await response.json();
+            if (!response.ok) {
+                alert('Could not restore bake: ' + data.error);
+                return;
+            }
+            loadHistory();
+            loadTrash();
+        }
+
+        async function purgeTrash() {
+            if (!confirm('Permanently delete bakes that have been in the trash for more than 30 days?')) {
+                return;
+            }
+            const response = await fetch('/api/trash/purge?older_than=30d', { method: 'POST' });
+            const data = await response.json();
+            if (!response.ok) {
+                alert('Could not empty trash: ' + data.error);
+                return;
+            }
+            alert(data.purged.length === 0 ? 'Nothing older than 30 days' : 'Permanently deleted ' + data.purged.length + ' bakes');
+            loadTrash();
+        }
+
+        // Refresh the list as bakes are logged, deleted or restored elsewhere
+        function watchHistory() {
+            if (!window.EventSource) return;
+            let refreshTimer = null;
+            const refresh = () => {
+                clearTimeout(refreshTimer);
+                refreshTimer = setTimeout(refreshHistory, 500);
+            };
+            const source = new EventSource('/api/events/stream');
+            ['append', 'delete-event', 'insert-event', 'delete-bake', 'import', 'restore', 'replace'].forEach(op => {
+                source.addEventListener(op, refresh);
+            });
+        }
+
+        async function refreshHistory() {
+            if (allBakes.length === 0) {
+                loadHistory();
+                loadTrash();
+                return;
+            }
+            try {
+                const response = await fetch('/api/bakes' + (currentBaker ? '?user=' + encodeURIComponent(currentBaker) : ''));
+                allBakes = await response.json() || [];
+                document.getElementById('subtitle').textContent = 'Viewing ' + allBakes.length + ' bakes' +
+                    (currentBaker ? ' by ' + currentBaker : '');
+                if (allBakes.length > 0) displayStatsSummary();
+                applyFilters();
+                loadTrash();
+            } catch (error) {
+                console.error('Error refreshing history:', error);
+            }
+        }
+
+        // Load history and trash on page load
+        loadBakers();
         loadHistory();
+        loadTrash();
+        watchHistory();
     </script>
 </body>
 </html>`
@@ -1688,6 +1889,7 @@ const statusViewPageHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    ` + pwaHeadHTML + `
     <title>Bake Status</title>
     <script src="https://cdn.jsdelivr.net/npm/chart.js@4.4.0/dist/chart.umd.min.js"></script>
     <script src="https://cdn.jsdelivr.net/npm/chartjs-adapter-date-fns@3.0.0/dist/chartjs-adapter-date-fns.bundle.min.js"></script>
@@ -1715,6 +1917,8 @@ const statusViewPageHTML = `<!DOCTYPE html>
         }
         h1 { color: #333; font-size: 32px; margin-bottom: 10px; }
         .subtitle { color: #666; font-size: 16px; }
+        .live { display: none; font-size: 14px; font-weight: 600; color: #10b981; vertical-align: middle; margin-left: 8px; }
+        .live.on { display: inline; }
         .content { padding: 30px; }
         .loading { text-align: center; padding: 40px; color: #666; font-size: 18px; }
         .chart-container { position: relative; height: 400px; margin-bottom: 30px; }
@@ -1846,7 +2050,7 @@ const statusViewPageHTML = `<!DOCTYPE html>
 <body>
     <div class="container">
         <div class="header">
-            <h1>📊 Bake Status</h1>
+            <h1>📊 Bake Status <span id="live" class="live" title="Updates as events are logged">● Live</span></h1>
             <p class="subtitle" id="subtitle">Loading current bake...</p>
         </div>
         <div class="content">
@@ -1915,6 +2119,7 @@ const statusViewPageHTML = `<!DOCTYPE html>
 
         function displayBake(bake) {
             document.getElementById('loading').style.display = 'none';
+            document.getElementById('no-data').style.display = 'none';
             document.getElementById('bake-content').style.display = 'block';
 
             // Update subtitle
@@ -2222,6 +2427,7 @@ const statusViewPageHTML = `<!DOCTYPE html>
                 if (event.temp_f) details.push('Kitchen: ' + event.temp_f + '°F');
                 if (event.dough_temp_f) details.push('Dough: ' + event.dough_temp_f + '°F');
                 if (event.oven_temp_f) details.push('Oven: ' + event.oven_temp_f + '°F');
+                if (event.fridge_temp_f) details.push('Fridge: ' + event.fridge_temp_f + '°F');
                 if (event.fold_count) details.push('Fold #' + event.fold_count);
 
                 if (details.length > 0) {
@@ -2357,7 +2563,7 @@ const statusViewPageHTML = `<!DOCTYPE html>
             // Confirm deletion
             const confirmMsg = 'Are you sure you want to delete this bake?\n\n' +
                               'Date: ' + date + '\n\n' +
-                              'This will move it to the trash directory.';
+                              'It can be restored from the trash on the History page.';
 
             if (!confirm(confirmMsg)) {
                 return;
@@ -2382,8 +2588,377 @@ const statusViewPageHTML = `<!DOCTYPE html>
             }
         }
 
+        // Reload when this bake changes, e.g. a QR code scanned on another phone
+        function watchBake() {
+            if (!window.EventSource) return;
+            const date = new URLSearchParams(window.location.search).get('date');
+            const live = document.getElementById('live');
+            let reloadTimer = null;
+            let connected = false;
+            const reload = () => {
+                // Several changes can arrive at once; reload after the burst
+                clearTimeout(reloadTimer);
+                reloadTimer = setTimeout(loadBake, 250);
+            };
+
+            const source = new EventSource('/api/events/stream');
+            source.onopen = () => {
+                live.classList.add('on');
+                // Catch up on anything missed while disconnected
+                if (connected) reload();
+                connected = true;
+            };
+            source.onerror = () => live.classList.remove('on');
+            ['append', 'delete-event', 'insert-event', 'delete-bake', 'import', 'restore', 'replace'].forEach(op => {
+                source.addEventListener(op, e => {
+                    const change = JSON.parse(e.data);
+                    if (!date || change.bake_id === date) reload();
+                });
+            });
+        }
+
         // Load bake on page load
         loadBake();
+        watchBake();
+    </script>
+</body>
+</html>`
+
+const kioskPageHTML = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0, user-scalable=no">
+    ` + pwaHeadHTML + `
+    <meta name="mobile-web-app-capable" content="yes">
+    <meta name="apple-mobile-web-app-capable" content="yes">
+    <title>Sourdough Kiosk</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        html, body { height: 100%; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            background: #111827;
+            color: #f9fafb;
+            padding: 24px;
+            display: flex;
+            flex-direction: column;
+            gap: 24px;
+            user-select: none;
+            -webkit-user-select: none;
+        }
+        .top { display: flex; justify-content: space-between; align-items: baseline; gap: 16px; }
+        .stage { font-size: 56px; font-weight: 800; text-transform: capitalize; }
+        .meta { font-size: 22px; color: #9ca3af; text-align: right; }
+        .live { color: #10b981; }
+        .live.off { color: #f87171; }
+        .panels { display: grid; grid-template-columns: 2fr 1fr; gap: 24px; }
+        .panel { background: #1f2937; border-radius: 20px; padding: 24px; }
+        .label { font-size: 20px; color: #9ca3af; text-transform: uppercase; letter-spacing: 1px; }
+        .timer { font-size: 120px; font-weight: 800; font-variant-numeric: tabular-nums; line-height: 1.1; }
+        .sub { font-size: 26px; color: #d1d5db; margin-top: 4px; }
+        .reminder { margin-top: 20px; font-size: 34px; font-weight: 700; font-variant-numeric: tabular-nums; }
+        .reminder.due { color: #fbbf24; }
+        .temps { display: flex; flex-direction: column; gap: 18px; }
+        .temp-value { font-size: 64px; font-weight: 800; font-variant-numeric: tabular-nums; }
+        .temp-source { font-size: 18px; color: #9ca3af; }
+        .actions { display: grid; grid-template-columns: repeat(3, 1fr); gap: 20px; flex: 1; }
+        .actions button {
+            font-size: 40px;
+            font-weight: 800;
+            border: none;
+            border-radius: 24px;
+            background: #374151;
+            color: #f9fafb;
+            min-height: 140px;
+            touch-action: manipulation;
+        }
+        .actions button:active { background: #4b5563; }
+        .actions button.suggested { background: #2563eb; }
+        .actions button.due { background: #d97706; animation: pulse 1.5s infinite; }
+        .actions button:disabled { opacity: 0.5; }
+        @keyframes pulse { 50% { opacity: 0.75; } }
+        .toast {
+            position: fixed;
+            left: 50%;
+            bottom: 32px;
+            transform: translateX(-50%);
+            background: #10b981;
+            color: white;
+            font-size: 30px;
+            font-weight: 700;
+            padding: 20px 28px;
+            border-radius: 20px;
+            display: none;
+            align-items: center;
+            gap: 24px;
+            box-shadow: 0 10px 40px rgba(0,0,0,0.5);
+        }
+        .toast.error { background: #dc2626; }
+        .toast button {
+            font-size: 26px;
+            font-weight: 700;
+            background: rgba(255,255,255,0.2);
+            color: white;
+            border: 2px solid white;
+            border-radius: 14px;
+            padding: 12px 24px;
+        }
+        @media (max-width: 800px) {
+            .panels { grid-template-columns: 1fr; }
+            .timer { font-size: 80px; }
+            .actions { grid-template-columns: repeat(2, 1fr); }
+        }
+    </style>
+</head>
+<body>
+    <div class="top">
+        <div class="stage" id="stage">Loading…</div>
+        <div class="meta"><span id="baker"></span> <span id="live" class="live off">●</span> <span id="clock"></span></div>
+    </div>
+
+    <div class="panels">
+        <div class="panel">
+            <div class="label">Since last event</div>
+            <div class="timer" id="sinceLast">--:--</div>
+            <div class="sub" id="lastEvent"></div>
+            <div class="sub" id="elapsed"></div>
+            <div class="reminder" id="reminder"></div>
+        </div>
+        <div class="panel temps">
+            <div>
+                <div class="label">Kitchen</div>
+                <div class="temp-value" id="kitchenTemp">--</div>
+                <div class="temp-source" id="kitchenSource"></div>
+            </div>
+            <div>
+                <div class="label">Dough</div>
+                <div class="temp-value" id="doughTemp">--</div>
+                <div class="temp-source" id="doughSource"></div>
+            </div>
+            <div id="fridgeBox" style="display: none;">
+                <div class="label">Fridge</div>
+                <div class="temp-value" id="fridgeTemp">--</div>
+                <div class="temp-source" id="fridgeSource"></div>
+            </div>
+        </div>
+    </div>
+
+    <div class="actions">
+        <button data-event="fed" id="firstBtn">Fed</button>
+        <button data-event="mixed">Mixed</button>
+        <button data-event="fold">Fold</button>
+        <button data-event="shaped">Shaped</button>
+        <button data-event="fridge-in">Fridge In</button>
+        <button data-event="fridge-out">Fridge Out</button>
+    </div>
+
+    <div class="toast" id="toast"><span id="toastText"></span><button id="undoBtn">Undo</button></div>
+
+    <script>
+        let state = null;
+        let clockOffset = 0; // Server time minus tablet time
+        let toastTimer = null;
+        let undoId = null; // Journal id of the last event logged here
+
+        // The event that usually comes next in each stage
+        const suggestedEvent = {
+            idle: 'starter-out', starter: 'mixed', bulk: 'fold', shaped: 'fridge-in', retard: 'fridge-out'
+        };
+
+        function now() {
+            return new Date(Date.now() + clockOffset);
+        }
+
+        function formatDuration(ms) {
+            const total = Math.max(0, Math.floor(ms / 1000));
+            const h = Math.floor(total / 3600);
+            const m = Math.floor((total % 3600) / 60);
+            const s = total % 60;
+            const mm = String(m).padStart(2, '0');
+            const ss = String(s).padStart(2, '0');
+            return h > 0 ? h + ':' + mm + ':' + ss : m + ':' + ss;
+        }
+
+        async function refresh() {
+            try {
+                const response = await fetch('/api/kiosk');
+                if (!response.ok) throw new Error(await response.text());
+                state = await response.json();
+                clockOffset = new Date(state.now) - Date.now();
+                render();
+            } catch (error) {
+                console.error('Error loading kiosk state:', error);
+            }
+        }
+
+        function render() {
+            document.getElementById('stage').textContent = state.active ? state.stage : 'No bake in progress';
+            document.getElementById('baker').textContent = state.baker ? '👩‍🍳 ' + state.baker : '';
+
+            const last = state.last_event;
+            document.getElementById('lastEvent').textContent = last
+                ? last.event + (last.fold_count ? ' #' + last.fold_count : '') + ' at ' + new Date(last.timestamp).toLocaleTimeString([], { hour: 'numeric', minute: '2-digit' })
+                : '';
+
+            showTemp('kitchen', state.temperatures.kitchen);
+            showTemp('dough', state.temperatures.dough);
+            document.getElementById('fridgeBox').style.display = state.temperatures.fridge ? 'block' : 'none';
+            showTemp('fridge', state.temperatures.fridge);
+
+            // Between bakes the first button starts one
+            const first = document.getElementById('firstBtn');
+            first.dataset.event = state.active ? 'fed' : 'starter-out';
+            first.textContent = state.active ? 'Fed' : 'Start Loaf';
+
+            const suggested = suggestedEvent[state.active ? state.stage : 'idle'];
+            document.querySelectorAll('.actions button').forEach(btn => {
+                btn.classList.toggle('suggested', btn.dataset.event === suggested);
+            });
+            tick();
+        }
+
+        // The source and age are filled in by tick
+        function showTemp(name, temp) {
+            document.getElementById(name + 'Temp').textContent = temp ? temp.temp_f.toFixed(1) + '°F' : '--';
+            document.getElementById(name + 'Source').textContent = '';
+        }
+
+        // Runs every second so the timers count without asking the server
+        function tick() {
+            const t = now();
+            document.getElementById('clock').textContent = t.toLocaleTimeString([], { hour: 'numeric', minute: '2-digit' });
+            if (!state) return;
+
+            const last = state.last_event;
+            document.getElementById('sinceLast').textContent = last ? formatDuration(t - new Date(last.timestamp)) : '--:--';
+            document.getElementById('elapsed').textContent = state.started_at
+                ? 'Bake running ' + formatDuration(t - new Date(state.started_at))
+                : '';
+
+            const reminder = document.getElementById('reminder');
+            const foldBtn = document.querySelector('button[data-event="fold"]');
+            const next = state.next_reminder;
+            if (next) {
+                const left = new Date(next.due) - t;
+                const due = left <= 0;
+                reminder.textContent = due
+                    ? '⏰ ' + next.action + ' due ' + formatDuration(-left) + ' ago'
+                    : '⏳ ' + next.action + ' in ' + formatDuration(left);
+                reminder.classList.toggle('due', due);
+                foldBtn.classList.toggle('due', due && next.action.startsWith('fold'));
+            } else {
+                reminder.textContent = state.stage === 'bulk' && state.folds > 0
+                    ? state.folds + ' of ' + state.target_folds + ' folds done'
+                    : '';
+                reminder.classList.remove('due');
+                foldBtn.classList.remove('due');
+            }
+            ['kitchen', 'dough', 'fridge'].forEach(name => {
+                const temp = state.temperatures[name];
+                if (temp) {
+                    document.getElementById(name + 'Source').textContent =
+                        (temp.source === 'sensor' ? 'Sensor' : 'Logged') + ' · ' + formatDuration(t - new Date(temp.at)) + ' ago';
+                }
+            });
+        }
+
+        async function logEvent(event) {
+            // Floury hands tap twice; ignore taps until this one is done
+            const buttons = document.querySelectorAll('.actions button');
+            buttons.forEach(btn => btn.disabled = true);
+            try {
+                const path = event === 'starter-out' ? '/loaf/start' : '/log/' + event;
+                const response = await fetch(path, { method: 'POST' });
+                if (!response.ok) throw new Error(await response.text());
+                if (response.status === 202) {
+                    // Queued by the service worker; nothing on the server to undo yet
+                    showToast('📴 ' + event + ' saved offline, will log when back online', false, true);
+                    return;
+                }
+                undoId = (await response.json()).undo_id;
+                showToast('✓ ' + event + ' logged', true);
+                refresh();
+            } catch (error) {
+                showToast('Could not log ' + event + ': ' + error.message, false);
+            } finally {
+                setTimeout(() => buttons.forEach(btn => btn.disabled = false), 1000);
+            }
+        }
+
+        async function undo() {
+            try {
+                const response = await fetch('/undo?id=' + encodeURIComponent(undoId), { method: 'POST' });
+                const data = await response.json();
+                if (!response.ok) throw new Error(data.error);
+                showToast('↩️ Removed ' + data.event.event, false, true);
+                refresh();
+            } catch (error) {
+                showToast('Could not undo: ' + error.message, false);
+            }
+        }
+
+        function showToast(text, canUndo, ok) {
+            const toast = document.getElementById('toast');
+            document.getElementById('toastText').textContent = text;
+            document.getElementById('undoBtn').style.display = canUndo ? 'inline-block' : 'none';
+            toast.classList.toggle('error', !canUndo && !ok);
+            toast.style.display = 'flex';
+            clearTimeout(toastTimer);
+            toastTimer = setTimeout(() => toast.style.display = 'none', canUndo ? 10000 : 4000);
+        }
+
+        // Update as soon as anything is logged, from here or anywhere else
+        function watchEvents() {
+            if (!window.EventSource) {
+                setInterval(refresh, 30000);
+                return;
+            }
+            const live = document.getElementById('live');
+            let refreshTimer = null;
+            const soon = () => {
+                clearTimeout(refreshTimer);
+                refreshTimer = setTimeout(refresh, 250);
+            };
+            const source = new EventSource('/api/events/stream');
+            source.onopen = () => {
+                live.classList.remove('off');
+                soon();
+            };
+            source.onerror = () => live.classList.add('off');
+            ['append', 'delete-event', 'insert-event', 'delete-bake', 'import', 'restore', 'replace'].forEach(op => {
+                source.addEventListener(op, soon);
+            });
+        }
+
+        // Keep the tablet's screen on while the page is visible
+        let wakeLock = null;
+        async function keepAwake() {
+            if (!navigator.wakeLock || document.visibilityState !== 'visible') return;
+            try {
+                wakeLock = await navigator.wakeLock.request('screen');
+            } catch (error) {
+                console.error('Wake lock unavailable:', error);
+            }
+        }
+        document.addEventListener('visibilitychange', () => {
+            if (document.visibilityState === 'visible') {
+                keepAwake();
+                refresh();
+            }
+        });
+
+        document.querySelectorAll('.actions button').forEach(btn => {
+            btn.addEventListener('click', () => logEvent(btn.dataset.event));
+        });
+        document.getElementById('undoBtn').addEventListener('click', undo);
+
+        refresh();
+        watchEvents();
+        keepAwake();
+        setInterval(tick, 1000);
+        // Sensor readings change without events being logged
+        setInterval(refresh, 60000);
     </script>
 </body>
 </html>`
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/certs"
+)
+
+// TLSConfig serves HTTPS instead of plain HTTP
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// CAFile is the local CA offered to phones at /ca, "" with a provided certificate
+	CAFile string
+
+	// RedirectPort also listens for plain HTTP and redirects it to HTTPS, "" to disable
+	RedirectPort string
+}
+
+// EnableTLS serves HTTPS with the given certificate
+func (s *Server) EnableTLS(cfg TLSConfig) {
+	s.tls = &cfg
+}
+
+// certReloader picks up a renewed certificate without a restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// getCertificate reloads the key pair when the certificate file changes
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.certFile)
+	if err != nil && c.cert != nil {
+		return c.cert, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	if c.cert != nil && info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// Mid-renewal the key may not match yet; keep the old pair
+			log.Printf("Warning: Failed to reload certificate: %v", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return c.cert, nil
+}
+
+// tlsConfig loads the certificate, reloading it when the file changes
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	reloader := &certReloader{certFile: s.tls.CertFile, keyFile: s.tls.KeyFile}
+	if _, err := reloader.getCertificate(nil); err != nil {
+		return nil, err
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: reloader.getCertificate}, nil
+}
+
+// redirectHandler sends plain HTTP requests to the HTTPS port. The CA stays
+// reachable over HTTP so phones can fetch it before they trust it.
+func (s *Server) redirectHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/ca", s.handleCAPage)
+	mux.HandleFunc("/ca.pem", s.handleCACert)
+	mux.HandleFunc("/ca.mobileconfig", s.handleCAProfile)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, s.httpsURL(r), http.StatusTemporaryRedirect)
+	})
+	return mux
+}
+
+// httpsURL is the request's URL on the HTTPS port
+func (s *Server) httpsURL(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	if s.port != "443" {
+		host = net.JoinHostPort(host, s.port)
+	} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+		host = "[" + host + "]"
+	}
+	return "https://" + host + r.URL.RequestURI()
+}
+
+// readCA returns the local CA certificate, or writes an error
+func (s *Server) readCA(w http.ResponseWriter) ([]byte, bool) {
+	if s.tls == nil || s.tls.CAFile == "" {
+		http.Error(w, "No local CA: the server uses a provided certificate or plain HTTP", http.StatusNotFound)
+		return nil, false
+	}
+	data, err := os.ReadFile(s.tls.CAFile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read CA certificate: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return data, true
+}
+
+// handleCACert downloads the local CA certificate (Android, desktop browsers)
+func (s *Server) handleCACert(w http.ResponseWriter, r *http.Request) {
+	data, ok := s.readCA(w)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	w.Header().Set("Content-Disposition", `attachment; filename="sourdough-ca.pem"`)
+	w.Write(data)
+}
+
+// handleCAProfile downloads the local CA as an iOS configuration profile
+func (s *Server) handleCAProfile(w http.ResponseWriter, r *http.Request) {
+	data, ok := s.readCA(w)
+	if !ok {
+		return
+	}
+	profile, err := certs.MobileConfig(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-apple-aspen-config")
+	w.Header().Set("Content-Disposition", `attachment; filename="sourdough-ca.mobileconfig"`)
+	w.Write(profile)
+}
+
+// handleCAPage explains how to trust the local CA on a phone
+func (s *Server) handleCAPage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.readCA(w); !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, caPageHTML)
+}
+
+// caPageHTML links the CA downloads with install steps for each platform
+const caPageHTML = `<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>Trust This Server</title><style>body{font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,sans-serif;background:linear-gradient(135deg,#667eea 0%,#764ba2 100%);min-height:100vh;margin:0;padding:20px;display:flex;align-items:center;justify-content:center;}.container{background:white;border-radius:20px;padding:30px;max-width:500px;width:100%;box-shadow:0 20px 60px rgba(0,0,0,0.3);}h1{margin:0 0 20px 0;text-align:center;}a.button{display:block;padding:16px;margin-bottom:12px;border-radius:12px;background:#667eea;color:white;text-decoration:none;font-size:20px;text-align:center;}ol{padding-left:20px;color:#333;line-height:1.5;}</style></head><body><div class="container"><h1>🔒 Trust This Server</h1><p>Install the kitchen server's certificate once so your phone opens the QR codes without warnings.</p><a class="button" href="/ca.mobileconfig">📱 iPhone / iPad</a><ol><li>Tap the button and allow the download</li><li>Settings → Profile Downloaded → Install</li><li>Settings → General → About → Certificate Trust Settings → turn on "Sourdough Local CA"</li></ol><a class="button" href="/ca.pem">🤖 Android / Computer</a><ol><li>Tap the button to download sourdough-ca.pem</li><li>Android: Settings → Security → Encryption &amp; credentials → Install a certificate → CA certificate</li><li>Computer: import it into the browser or system keychain as a trusted authority</li></ol></div></body></html>`
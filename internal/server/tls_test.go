@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/certs"
+)
+
+// setupTLSServer returns a server with a local CA certificate for 127.0.0.1
+func setupTLSServer(t *testing.T) (*Server, *certs.Local, string) {
+	server, tmpDir := setupTestServer(t)
+	local, err := certs.EnsureLocal(tmpDir, []string{"127.0.0.1", "localhost"})
+	if err != nil {
+		cleanup(tmpDir)
+		t.Fatalf("Failed to create certificates: %v", err)
+	}
+	server.EnableTLS(TLSConfig{CertFile: local.CertFile, KeyFile: local.KeyFile, CAFile: local.CAFile, RedirectPort: "8081"})
+	return server, local, tmpDir
+}
+
+func TestHTTPSWithLocalCA(t *testing.T) {
+	server, local, tmpDir := setupTLSServer(t)
+	defer cleanup(tmpDir)
+
+	a, err := auth.New(tmpDir, "1234")
+	if err != nil {
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+	server.EnableAuth(a)
+
+	reloader := &certReloader{certFile: local.CertFile, keyFile: local.KeyFile}
+	cert, err := reloader.getCertificate(nil)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(server.Handler())
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{*cert}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	// A client that installed the CA trusts the server
+	caPEM, err := os.ReadFile(local.CAFile)
+	if err != nil {
+		t.Fatalf("Failed to read CA: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	client := &http.Client{
+		Transport:     &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	resp, err := client.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 from /health, got %d", resp.StatusCode)
+	}
+
+	// The CA profile is reachable without logging in
+	resp, err = client.Get(ts.URL + "/ca.mobileconfig")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-apple-aspen-config" {
+		t.Errorf("Expected CA profile, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Session cookies are marked Secure over HTTPS
+	resp, err = client.PostForm(ts.URL+"/login", map[string][]string{"user": {"alice"}, "pin": {"1234"}})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	resp.Body.Close()
+	cookies := resp.Cookies()
+	if len(cookies) == 0 || !cookies[0].Secure {
+		t.Errorf("Expected a Secure session cookie, got %v", cookies)
+	}
+}
+
+func TestHTTPRedirect(t *testing.T) {
+	server, _, tmpDir := setupTLSServer(t)
+	defer cleanup(tmpDir)
+	handler := server.redirectHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://192.168.1.50:8081/log/fold?note=first", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Expected redirect, got %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "https://192.168.1.50:8080/log/fold?note=first" {
+		t.Errorf("Unexpected redirect target: %s", loc)
+	}
+
+	// Phones fetch the CA over plain HTTP before they trust the HTTPS port
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://192.168.1.50:8081/ca.pem", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "BEGIN CERTIFICATE") {
+		t.Errorf("Expected CA certificate over HTTP, got %d", w.Code)
+	}
+}
+
+func TestNoLocalCA(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ca.pem", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a local CA, got %d", w.Code)
+	}
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/auth"
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// DefaultUndoWindow is how long after an action it can still be undone
+const DefaultUndoWindow = 10 * time.Minute
+
+// journalSize is how many actions the undo journal remembers
+const journalSize = 20
+
+// UndoJournalFile is where the undo journal is kept in the data directory
+const UndoJournalFile = "undo.json"
+
+// Actions recorded in the undo journal
+const (
+	actionLog    = "log"    // Event logged via /log/*
+	actionStart  = "start"  // Loaf started via /loaf/start
+	actionDelete = "delete" // Event deleted via /api/event/delete
+	actionUndo   = "undo"   // An earlier action was undone
+)
+
+var (
+	errNothingToUndo = errors.New("nothing to undo")
+	errUndoExpired   = errors.New("too late to undo")
+	errUndoConflict  = errors.New("cannot undo")
+	errUndoForbidden = errors.New("that action isn't yours to undo")
+)
+
+// journalEntry is one user action that changed the current bake
+type journalEntry struct {
+	ID     int          `json:"id"`
+	Time   time.Time    `json:"time"`
+	Action string       `json:"action"`
+	BakeID string       `json:"bake_id"`
+	User   string       `json:"user,omitempty"` // Whose active bake it changed
+	Index  int          `json:"index"`          // Position of a deleted event
+	Event  models.Event `json:"event"`
+	Undone bool         `json:"undone,omitempty"`
+	UndoOf int          `json:"undo_of,omitempty"` // Entry reverted by an undo
+}
+
+// journal keeps the most recent actions so the latest one can be undone
+type journal struct {
+	mu      sync.Mutex
+	entries []journalEntry
+	nextID  int
+	path    string // Where the journal is saved, "" to keep it in memory only
+}
+
+// journalFile is the journal as saved in the data directory
+type journalFile struct {
+	NextID  int            `json:"next_id"`
+	Entries []journalEntry `json:"entries"`
+}
+
+// LoadUndoJournal keeps the undo journal in dataDir, so undo links on phones
+// still work after a restart
+func (s *Server) LoadUndoJournal(dataDir string) error {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+
+	path := filepath.Join(dataDir, UndoJournalFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read undo journal: %w", err)
+	}
+	if err == nil {
+		var f journalFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("failed to parse undo journal: %w", err)
+		}
+		s.journal.entries, s.journal.nextID = f.Entries, f.NextID
+	}
+	s.journal.path = path
+	return nil
+}
+
+// record adds an action to the journal and returns its ID
+func (j *journal) record(entry journalEntry) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.recordLocked(entry)
+}
+
+// recordLocked adds an action, dropping the oldest beyond journalSize, and
+// saves the journal
+func (j *journal) recordLocked(entry journalEntry) int {
+	j.nextID++
+	entry.ID = j.nextID
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	j.entries = append(j.entries, entry)
+	if len(j.entries) > journalSize {
+		j.entries = j.entries[len(j.entries)-journalSize:]
+	}
+	if err := j.saveLocked(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return entry.ID
+}
+
+// saveLocked writes the journal atomically; the caller holds j.mu
+func (j *journal) saveLocked() error {
+	if j.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(journalFile{NextID: j.nextID, Entries: j.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal undo journal: %w", err)
+	}
+	if err := os.WriteFile(j.path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write undo journal: %w", err)
+	}
+	if err := os.Rename(j.path+".tmp", j.path); err != nil {
+		return fmt.Errorf("failed to write undo journal: %w", err)
+	}
+	return nil
+}
+
+// get returns the action with an ID
+func (j *journal) get(id int) (journalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, entry := range j.entries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return journalEntry{}, false
+}
+
+// list returns the journal, newest first
+func (j *journal) list() []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]journalEntry, len(j.entries))
+	for i, entry := range j.entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return entries
+}
+
+// latestLocked returns the index of the newest action on user's active bake
+// that has not been undone
+func (j *journal) latestLocked(user string) int {
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].User == user && j.entries[i].Action != actionUndo && !j.entries[i].Undone {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordAction journals a successful action on the bake the write went into and
+// returns its ID. The bake also goes into the request log.
+func (s *Server) recordAction(r *http.Request, action, bakeID string, event *models.Event, index int) int {
+	user := s.actionUser(r)
+	setRequestBake(r, bakeID)
+	return s.journal.record(journalEntry{Action: action, BakeID: bakeID, User: user, Index: index, Event: *event})
+}
+
+// actionUser is whose actions a request makes and may undo: a baker with a
+// profile, else "" for the household
+func (s *Server) actionUser(r *http.Request) string {
+	user := requestUser(r)
+	if s.profileFor(user) == nil {
+		return "" // Logged to the household's active bake
+	}
+	return user
+}
+
+// undo reverts the action with id for user (see actionUser). It must be the
+// newest action of that user not undone yet, so tapping the same undo link
+// twice does nothing. Each baker with a profile undoes on their own bake.
+func (s *Server) undo(id int, user string) (journalEntry, error) {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+
+	found := false
+	for _, e := range s.journal.entries {
+		if e.ID == id {
+			if e.User != user {
+				return journalEntry{}, errUndoForbidden
+			}
+			if e.Undone {
+				return e, fmt.Errorf("%w: already undone", errUndoConflict)
+			}
+			found = true
+		}
+	}
+	if !found {
+		return journalEntry{}, errNothingToUndo
+	}
+
+	i := s.journal.latestLocked(user)
+	if i < 0 {
+		return journalEntry{}, errNothingToUndo
+	}
+	entry := s.journal.entries[i]
+	if id != entry.ID {
+		return entry, fmt.Errorf("%w: only the most recent action can be undone", errUndoConflict)
+	}
+	if time.Since(entry.Time) > s.undoWindow {
+		return entry, fmt.Errorf("%w: %s was more than %s ago", errUndoExpired, entry.Event.Event, s.undoWindow)
+	}
+
+	// A logged event is removed from the bake it went into, even one that
+	// loaf-complete has finished; a delete only happens on the active bake
+	store := s.storeFor(entry.User)
+	var bake *models.Bake
+	var err error
+	switch entry.Action {
+	case actionLog, actionStart:
+		bake, err = store.ReadBake(entry.BakeID)
+	case actionDelete:
+		bake, err = store.ReadCurrentBake()
+		if err == nil && strings.TrimPrefix(bake.Filename, "bake_") != entry.BakeID {
+			return entry, fmt.Errorf("%w: the bake is no longer active", errUndoConflict)
+		}
+	}
+	if err != nil {
+		return entry, fmt.Errorf("failed to read bake: %w", err)
+	}
+
+	switch entry.Action {
+	case actionLog, actionStart:
+		err = s.undoAppend(store, bake, entry)
+	case actionDelete:
+		index := entry.Index
+		if index > len(bake.Events) {
+			index = len(bake.Events)
+		}
+		err = store.InsertEvent(index, &entry.Event)
+	}
+	if err != nil {
+		return entry, err
+	}
+
+	s.journal.entries[i].Undone = true
+	s.journal.recordLocked(journalEntry{Action: actionUndo, BakeID: entry.BakeID, User: entry.User, Index: entry.Index, Event: entry.Event, UndoOf: entry.ID})
+	return entry, nil
+}
+
+// undoAppend removes a logged event; undoing a start with nothing logged since
+// moves the whole bake to the trash
+func (s *Server) undoAppend(store storage.Store, bake *models.Bake, entry journalEntry) error {
+	for i := len(bake.Events) - 1; i >= 0; i-- {
+		event := bake.Events[i]
+		if event.Event != entry.Event.Event || !event.Timestamp.Equal(entry.Event.Timestamp) {
+			continue
+		}
+		if entry.Action == actionStart && len(bake.Events) == 1 {
+			return store.DeleteBake(entry.BakeID)
+		}
+		return store.DeleteBakeEvent(entry.BakeID, i, event.Timestamp.Format(time.RFC3339Nano))
+	}
+	return fmt.Errorf("%w: %s is no longer in the bake", errUndoConflict, entry.Event.Event)
+}
+
+// handleUndo reverts the action named by the id parameter on POST. GET (the
+// link on success pages) only asks first, so a link preview can't undo
+// anything; the confirm page's POST gets a result page, other POSTs JSON.
+func (s *Server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, "Undo id required", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid undo id", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		entry, ok := s.journal.get(id)
+		if !ok || entry.User != s.actionUser(r) {
+			status, err := http.StatusNotFound, errNothingToUndo
+			if ok {
+				status, err = http.StatusForbidden, errUndoForbidden
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, undoPageHTML, "Can't Undo", "#f59e0b", "⚠️", "Can't Undo", html.EscapeString(err.Error()), navDropdownHTML)
+			return
+		}
+		s.renderConfirm(w, r, fmt.Sprintf("Undo %s from %s", entry.Event.Event, entry.Event.Timestamp.Format("3:04 PM")), auth.ErrUnsigned)
+		return
+	}
+
+	entry, err := s.undo(id, s.actionUser(r))
+	setRequestBake(r, entry.BakeID)
+	status := http.StatusOK
+	switch {
+	case err == nil:
+	case errors.Is(err, errNothingToUndo):
+		status = http.StatusNotFound
+	case errors.Is(err, errUndoForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, errUndoExpired):
+		status = http.StatusGone
+	case errors.Is(err, errUndoConflict):
+		status = http.StatusConflict
+	default:
+		status = http.StatusInternalServerError
+	}
+
+	if wantsPage(r) {
+		title, icon, msg, color := "Undone", "↩️", "", "#10b981"
+		if err == nil {
+			msg = fmt.Sprintf("Removed %s from %s", entry.Event.Event, entry.Event.Timestamp.Format("3:04 PM"))
+			if entry.Action == actionDelete {
+				msg = fmt.Sprintf("Restored %s from %s", entry.Event.Event, entry.Event.Timestamp.Format("3:04 PM"))
+			}
+		} else {
+			title, icon, msg, color = "Can't Undo", "⚠️", err.Error(), "#f59e0b"
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, undoPageHTML, title, color, icon, title, html.EscapeString(msg), navDropdownHTML)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "undone",
+		"action": entry.Action,
+		"event":  entry.Event,
+	})
+}
+
+// handleAPIUndo lists the undo journal, newest first
+func (s *Server) handleAPIUndo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":  s.undoWindow.String(),
+		"entries": s.journal.list(),
+	})
+}
+
+// undoPageHTML is the result page for the one-tap undo link
+const undoPageHTML = `<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>%s</title><style>body{font-family:sans-serif;background:%s;color:white;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0;padding:20px;text-align:center;}h1{font-size:48px;margin:0 0 10px 0;}p{font-size:20px;margin:0 0 20px 0;}</style></head><body><div><h1>%s</h1><h1>%s</h1><p>%s</p>%s</div></body></html>`
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/profiles"
+)
+
+// undoRequest posts to /undo and returns the status code
+func undoRequest(server *Server, query string) int {
+	req := httptest.NewRequest(http.MethodPost, "/undo"+query, nil)
+	w := httptest.NewRecorder()
+	server.handleUndo(w, req)
+	return w.Code
+}
+
+func TestUndoLog(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	req := httptest.NewRequest(http.MethodGet, "/log/fold", nil)
+	w := httptest.NewRecorder()
+	server.handleLog(w, req)
+	if !strings.Contains(w.Body.String(), `href="/undo?id=1"`) {
+		t.Fatal("Expected undo link on success page")
+	}
+
+	// Opening the link only asks; a link preview can't undo anything
+	req = httptest.NewRequest(http.MethodGet, "/undo?id=1", nil)
+	w = httptest.NewRecorder()
+	server.handleUndo(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Undo fold") || !strings.Contains(w.Body.String(), `action="/undo?id=1"`) {
+		t.Fatalf("Expected a confirm page, got %d: %s", w.Code, w.Body.String())
+	}
+	if bake, _ := server.storage.ReadCurrentBake(); len(bake.Events) != 2 {
+		t.Fatalf("Expected GET to leave the fold, got %v", bake.Events)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/undo?id=1", strings.NewReader(confirmField+"=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.handleUndo(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Removed fold") {
+		t.Fatalf("Expected fold undone, got %d: %s", w.Code, w.Body.String())
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if len(bake.Events) != 1 {
+		t.Errorf("Expected only starter-out left, got %v", bake.Events)
+	}
+
+	// Tapping the same link again does not undo anything else
+	if code := undoRequest(server, "?id=1"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for repeated undo, got %d", code)
+	}
+
+	// The undo itself is journaled
+	entries := server.journal.list()
+	if len(entries) != 2 || entries[0].Action != actionUndo || entries[0].UndoOf != 1 || !entries[1].Undone {
+		t.Errorf("Expected undo recorded in journal, got %+v", entries)
+	}
+}
+
+func TestUndoLoafComplete(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+	server.storage.AppendEvent(models.NewEvent(models.EventShaped))
+	before, _ := server.storage.ReadCurrentBake()
+
+	// A mis-scanned loaf-complete finishes the bake, so it's no longer active
+	w := httptest.NewRecorder()
+	server.handleLog(w, httptest.NewRequest(http.MethodPost, "/log/loaf-complete", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if has, _ := server.storage.HasCurrentBake(); has {
+		t.Fatal("Expected no active bake after loaf-complete")
+	}
+	if entries := server.journal.list(); len(entries) != 1 || entries[0].BakeID != strings.TrimPrefix(before.Filename, "bake_") {
+		t.Fatalf("Expected loaf-complete journaled on its bake, got %+v", entries)
+	}
+
+	if code := undoRequest(server, "?id=1"); code != http.StatusOK {
+		t.Fatalf("Expected loaf-complete undone, got %d", code)
+	}
+	bake, _ := server.storage.ReadCurrentBake()
+	if bake.Filename != before.Filename || len(bake.Events) != 2 || bake.Events[1].Event != models.EventShaped {
+		t.Errorf("Expected the bake active again as before, got %s %v", bake.Filename, bake.Events)
+	}
+}
+
+func TestUndoOwnActionsOnly(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+	reg := profiles.New(tmpDir)
+	server.SetProfiles(reg)
+	reg.Save(profiles.Profile{Name: "alice"})
+	reg.Save(profiles.Profile{Name: "bob"})
+	handler := server.Handler()
+
+	as := func(baker, method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if baker != "" {
+			req.AddCookie(&http.Cookie{Name: BakerCookie, Value: baker})
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	as("bob", http.MethodPost, "/loaf/start")
+	as("bob", http.MethodPost, "/log/fold")
+
+	// Journal IDs are easy to guess, so neither another baker nor the household
+	// can undo bob's fold
+	for _, baker := range []string{"alice", ""} {
+		if code := as(baker, http.MethodGet, "/undo?id=2"); code != http.StatusForbidden {
+			t.Errorf("%q: expected the confirm page refused, got %d", baker, code)
+		}
+		if code := as(baker, http.MethodPost, "/undo?id=2"); code != http.StatusForbidden {
+			t.Errorf("%q: expected status 403, got %d", baker, code)
+		}
+	}
+	if code := as("bob", http.MethodPost, "/undo?id=2"); code != http.StatusOK {
+		t.Errorf("Expected bob to undo his fold, got %d", code)
+	}
+}
+
+func TestUndoStart(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	req := httptest.NewRequest(http.MethodPost, "/loaf/start", nil)
+	w := httptest.NewRecorder()
+	server.handleLoafStart(w, req)
+
+	// An undo has to say what it undoes
+	if code := undoRequest(server, ""); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without an id, got %d", code)
+	}
+	if code := undoRequest(server, "?id=1"); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if hasBake, _ := server.storage.HasCurrentBake(); hasBake {
+		t.Error("Expected no active bake after undoing start")
+	}
+	if trash, _ := server.storage.ListTrash(); len(trash) != 1 {
+		t.Errorf("Expected started bake in trash, got %v", trash)
+	}
+
+	if code := undoRequest(server, "?id=3"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 with nothing left to undo, got %d", code)
+	}
+}
+
+func TestUndoDelete(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+	server.storage.AppendEvent(models.NewEvent(models.EventFed))
+	server.storage.AppendEvent(models.NewEvent(models.EventMixed))
+
+	bake, _ := server.storage.ReadCurrentBake()
+	body, _ := json.Marshal(map[string]interface{}{
+		"index":     1,
+		"timestamp": bake.Events[1].Timestamp.Format(time.RFC3339Nano),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/event/delete", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	server.handleDeleteEvent(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Delete failed: %s", w.Body.String())
+	}
+
+	if code := undoRequest(server, "?id=1"); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+
+	bake, _ = server.storage.ReadCurrentBake()
+	if len(bake.Events) != 3 || bake.Events[1].Event != models.EventFed {
+		t.Errorf("Expected fed restored in place, got %v", bake.Events)
+	}
+}
+
+func TestUndoWindow(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+
+	req := httptest.NewRequest(http.MethodPost, "/log/fed", nil)
+	w := httptest.NewRecorder()
+	server.handleLog(w, req)
+
+	server.SetUndoWindow(0)
+	if code := undoRequest(server, "?id=1"); code != http.StatusGone {
+		t.Errorf("Expected 410 after the undo window, got %d", code)
+	}
+
+	bake, _ := server.storage.ReadCurrentBake()
+	if len(bake.Events) != 2 {
+		t.Errorf("Expected fed kept, got %v", bake.Events)
+	}
+}
+
+func TestUndoJournalPersists(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+	if err := server.LoadUndoJournal(tmpDir); err != nil {
+		t.Fatalf("LoadUndoJournal failed: %v", err)
+	}
+
+	server.storage.AppendEvent(models.NewEvent(models.EventStarterOut))
+	req := httptest.NewRequest(http.MethodPost, "/log/fed", nil)
+	server.handleLog(httptest.NewRecorder(), req)
+
+	// After a restart the link from before still works, and new ids don't reuse it
+	restarted := New(server.backend(), server.ecobee, "8080")
+	if err := restarted.LoadUndoJournal(tmpDir); err != nil {
+		t.Fatalf("LoadUndoJournal failed: %v", err)
+	}
+	if code := undoRequest(restarted, "?id=1"); code != http.StatusOK {
+		t.Fatalf("Expected 200 undoing after a restart, got %d", code)
+	}
+	if entries := restarted.journal.list(); len(entries) != 2 || entries[0].ID != 2 {
+		t.Errorf("Expected the undo journaled as 2, got %+v", entries)
+	}
+	if bake, _ := restarted.storage.ReadCurrentBake(); len(bake.Events) != 1 {
+		t.Errorf("Expected fed removed, got %v", bake.Events)
+	}
+}
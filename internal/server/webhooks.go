@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/mdeckert/sourdough/internal/webhook"
+)
+
+// defaultDeliveryLimit is how many deliveries /api/webhooks lists by default
+const defaultDeliveryLimit = 50
+
+// SetWebhooks enables outbound webhooks, sent by d's worker while the server runs
+func (s *Server) SetWebhooks(d *webhook.Dispatcher) {
+	s.webhooks = d
+}
+
+// webhookQueueLength is how many deliveries are waiting to be sent
+func (s *Server) webhookQueueLength() float64 {
+	if s.webhooks == nil {
+		return 0
+	}
+	_, pending := s.webhooks.Deliveries(0)
+	return float64(pending)
+}
+
+// handleAPIWebhooks lists recent webhook deliveries, newest first
+//
+//	GET /api/webhooks?limit=50
+func (s *Server) handleAPIWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	response := map[string]interface{}{
+		"enabled":    s.webhooks != nil,
+		"urls":       []string{},
+		"pending":    0,
+		"deliveries": []webhook.Delivery{},
+	}
+	if s.webhooks != nil {
+		deliveries, pending := s.webhooks.Deliveries(limit)
+		response["urls"] = s.webhooks.URLs()
+		response["pending"] = pending
+		response["deliveries"] = deliveries
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
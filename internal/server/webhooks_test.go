@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdeckert/sourdough/internal/webhook"
+)
+
+func TestAPIWebhooks(t *testing.T) {
+	server, tmpDir := setupTestServer(t)
+	defer cleanup(tmpDir)
+
+	type response struct {
+		Enabled    bool               `json:"enabled"`
+		URLs       []string           `json:"urls"`
+		Pending    int                `json:"pending"`
+		Deliveries []webhook.Delivery `json:"deliveries"`
+	}
+	get := func(path string) response {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp response
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := get("/api/webhooks"); resp.Enabled || len(resp.Deliveries) != 0 {
+		t.Errorf("Expected webhooks disabled, got %+v", resp)
+	}
+
+	d, err := webhook.New(server.storage, tmpDir, webhook.Config{URLs: []string{"http://127.0.0.1:1/hook"}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("webhook.New failed: %v", err)
+	}
+	server.SetWebhooks(d)
+
+	// Logged events are queued; the worker isn't running, so they stay pending
+	for _, path := range []string{"/log/mixed", "/log/fold"} {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, w.Code)
+		}
+	}
+
+	resp := get("/api/webhooks?limit=1")
+	if !resp.Enabled || resp.Pending != 2 || len(resp.URLs) != 1 {
+		t.Errorf("Expected 2 pending deliveries to one URL, got %+v", resp)
+	}
+	if len(resp.Deliveries) != 1 || resp.Deliveries[0].Type != webhook.TypeEventLogged || resp.Deliveries[0].Status != webhook.StatusPending {
+		t.Errorf("Expected the newest pending delivery, got %+v", resp.Deliveries)
+	}
+	if server.webhookQueueLength() != 2 {
+		t.Errorf("Expected a queue length of 2, got %v", server.webhookQueueLength())
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/webhooks?limit=zero", http.StatusBadRequest},
+		{http.MethodPost, "/api/webhooks", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
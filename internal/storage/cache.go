@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// bakeEntry is the cached state of one bake file
+type bakeEntry struct {
+	id         string
+	baker      string // User of the first event that has one
+	start      time.Time
+	completed  bool // File ends with loaf-complete
+	lastEvent  *models.Event
+	assessment *models.Assessment
+	events     []models.Event
+	badLines   []badLine // Lines that failed to parse and were skipped
+	truncated  bool      // File doesn't end with a newline
+
+	// File state when the entry was built, used to detect external edits
+	modTime time.Time
+	size    int64
+}
+
+// newBakeEntry builds an entry from a bake file's events and its stat info
+func newBakeEntry(name string, events []models.Event, info os.FileInfo) *bakeEntry {
+	entry := &bakeEntry{
+		id:      bakeIDFromPath(name),
+		events:  events,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	if len(events) > 0 {
+		last := events[len(events)-1]
+		entry.baker = (&models.Bake{Events: events}).Baker()
+		entry.start = events[0].Timestamp
+		entry.completed = last.Event == models.EventLoafComplete
+		entry.lastEvent = &last
+		entry.assessment = assessmentFromEvent(last)
+	}
+	return entry
+}
+
+// copyEvents returns the entry's events in a slice the caller may modify
+func (e *bakeEntry) copyEvents() []models.Event {
+	return append([]models.Event{}, e.events...)
+}
+
+// bakeCache indexes the bake files of a data directory so that finding and reading
+// the active bake doesn't re-parse every file. Entries are refreshed when a file's
+// modification time or size changes, so edits made outside the server are picked up.
+type bakeCache struct {
+	dataDir string
+	mu      sync.Mutex
+	entries map[string]*bakeEntry // Keyed by file name
+}
+
+func newBakeCache(dataDir string) *bakeCache {
+	return &bakeCache{
+		dataDir: dataDir,
+		entries: make(map[string]*bakeEntry),
+	}
+}
+
+// isBakeFile reports whether a directory entry name is a bake file
+func isBakeFile(name string) bool {
+	return strings.HasPrefix(name, "bake_") && strings.HasSuffix(name, ".jsonl")
+}
+
+// readEventsFile parses a bake file, skipping malformed lines but returning them
+func readEventsFile(filePath string) ([]models.Event, []badLine, bool, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read bake file: %w", err)
+	}
+
+	events, bad, truncated := parseLines(data)
+	return events, bad, truncated, nil
+}
+
+// refresh rescans the data directory, re-parsing only new or changed files
+func (c *bakeCache) refresh() error {
+	files, err := os.ReadDir(c.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		if file.IsDir() || !isBakeFile(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		seen[file.Name()] = true
+		c.loadLocked(file.Name(), info)
+	}
+
+	for name := range c.entries {
+		if !seen[name] {
+			delete(c.entries, name)
+		}
+	}
+	return nil
+}
+
+// lookup returns the entry for one bake file, re-parsing it if it changed on disk.
+// It returns nil if the file doesn't exist or can't be read.
+func (c *bakeCache) lookup(name string) *bakeEntry {
+	info, err := os.Stat(filepath.Join(c.dataDir, name))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		delete(c.entries, name)
+		return nil
+	}
+	return c.loadLocked(name, info)
+}
+
+// loadLocked returns the cached entry if it matches info, otherwise re-parses the file
+func (c *bakeCache) loadLocked(name string, info os.FileInfo) *bakeEntry {
+	if entry, ok := c.entries[name]; ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry
+	}
+
+	events, bad, truncated, err := readEventsFile(filepath.Join(c.dataDir, name))
+	if err != nil {
+		delete(c.entries, name)
+		return nil
+	}
+
+	entry := newBakeEntry(name, events, info)
+	entry.badLines = bad
+	entry.truncated = truncated
+	c.entries[name] = entry
+	return entry
+}
+
+// current returns the file name of the most recently modified bake that doesn't
+// end with loaf-complete, or "" if there is none. Bakes modified at the same
+// time are ordered by name like ListBakes, so the newest ID wins. A non-empty
+// baker only considers that baker's bakes.
+func (c *bakeCache) current(baker string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best *bakeEntry
+	var bestName string
+	for name, entry := range c.entries {
+		if entry.completed || (baker != "" && entry.baker != baker) {
+			continue
+		}
+		if best == nil || entry.modTime.After(best.modTime) ||
+			(entry.modTime.Equal(best.modTime) && name > bestName) {
+			best, bestName = entry, name
+		}
+	}
+	return bestName
+}
+
+// update records the events just written to a bake file by this process
+func (c *bakeCache) update(name string, events []models.Event) {
+	info, err := os.Stat(filepath.Join(c.dataDir, name))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		delete(c.entries, name)
+		return
+	}
+	c.entries[name] = newBakeEntry(name, events, info)
+}
+
+// appendEvent records an event just appended to a bake file by this process
+func (c *bakeCache) appendEvent(name string, event models.Event) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	var events []models.Event
+	if ok && len(entry.badLines) == 0 && !entry.truncated {
+		events = append(entry.copyEvents(), event)
+	}
+	c.mu.Unlock()
+
+	if events == nil {
+		// Unknown, new or partly unparseable file: re-read it from disk
+		c.lookup(name)
+		return
+	}
+	c.update(name, events)
+}
+
+// ids returns the IDs of all cached bakes
+func (c *bakeCache) ids() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make([]string, 0, len(c.entries))
+	for _, entry := range c.entries {
+		ids = append(ids, entry.id)
+	}
+	return ids
+}
+
+// issues lists the corrupt and truncated lines in all cached bake files
+func (c *bakeCache) issues() []IntegrityIssue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var issues []IntegrityIssue
+	for name, entry := range c.entries {
+		for _, line := range entry.badLines {
+			issues = append(issues, IntegrityIssue{File: name, Line: line.Line, Problem: "corrupt line: " + line.Err})
+		}
+		if entry.truncated {
+			issues = append(issues, IntegrityIssue{File: name, Problem: "last line is not terminated (interrupted write)"})
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+// remove drops a bake file from the cache
+func (c *bakeCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+}
+
+// reset empties the cache so the next access re-parses every file
+func (c *bakeCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*bakeEntry)
+}
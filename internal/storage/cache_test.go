@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// writeBakeFile writes events to a bake file directly, as an external editor would
+func writeBakeFile(t testing.TB, dir, id string, events ...models.Event) string {
+	t.Helper()
+	filePath := filepath.Join(dir, "bake_"+id+".jsonl")
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open bake file: %v", err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			t.Fatalf("Failed to write event: %v", err)
+		}
+	}
+	return filePath
+}
+
+func TestCacheDetectsExternalEdits(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	store.AppendEvent(models.NewEvent(models.EventStarterOut))
+	if hasBake, _ := store.HasCurrentBake(); !hasBake {
+		t.Fatal("Expected active bake")
+	}
+
+	// Complete the bake behind the storage's back
+	filePath := store.getCurrentBakeFile()
+	writeBakeFile(t, tmpDir, bakeIDFromPath(filePath), models.Event{Timestamp: time.Now(), Event: models.EventLoafComplete})
+
+	if hasBake, _ := store.HasCurrentBake(); hasBake {
+		t.Error("Expected external loaf-complete to end the active bake")
+	}
+
+	// A new file dropped into the data directory becomes the active bake
+	writeBakeFile(t, tmpDir, "2030-01-01_08-00-00", models.Event{Timestamp: time.Now(), Event: models.EventFed})
+	last, err := store.GetLastEvent()
+	if err != nil || last == nil || last.Event != models.EventFed {
+		t.Errorf("Expected external bake to be picked up, got %v (err %v)", last, err)
+	}
+
+	// Removing it externally drops it from the index
+	os.Remove(filepath.Join(tmpDir, "bake_2030-01-01_08-00-00.jsonl"))
+	dates, _ := store.ListBakes()
+	if len(dates) != 1 {
+		t.Errorf("Expected 1 bake after external removal, got %v", dates)
+	}
+}
+
+func TestCacheUpdatedOnWrites(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	store.AppendEvent(models.NewEvent(models.EventStarterOut))
+	store.AppendEvent(models.NewEvent(models.EventFed))
+
+	name := filepath.Base(store.getCurrentBakeFile())
+	entry := store.cache.lookup(name)
+	if entry == nil || len(entry.events) != 2 || entry.lastEvent.Event != models.EventFed {
+		t.Fatalf("Expected cached entry with 2 events, got %+v", entry)
+	}
+
+	// The entry matches the file on disk, so it is reused rather than re-parsed
+	if again := store.cache.lookup(name); again != entry {
+		t.Error("Expected unchanged file to reuse the cached entry")
+	}
+
+	bake, _ := store.ReadCurrentBake()
+	store.DeleteEvent(1, bake.Events[1].Timestamp.Format(time.RFC3339Nano))
+	if entry := store.cache.lookup(name); len(entry.events) != 1 || entry.lastEvent.Event != models.EventStarterOut {
+		t.Errorf("Expected cache updated after delete, got %+v", entry)
+	}
+
+	store.DeleteBake(bakeIDFromPath(name))
+	if dates, _ := store.ListBakes(); len(dates) != 0 {
+		t.Errorf("Expected no bakes after delete, got %v", dates)
+	}
+}
+
+func TestCurrentBakeTieBreak(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	// Two active bakes written in the same instant, e.g. restored from a backup
+	modTime := time.Date(2025, 10, 7, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"2025-10-07_09-00-00", "2025-10-07_11-00-00", "2025-10-06_08-00-00"} {
+		path := writeBakeFile(t, tmpDir, id, models.Event{Timestamp: modTime, Event: models.EventStarterOut})
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		store.cache.reset()
+		if bake, _ := store.ReadCurrentBake(); bake.Filename != "bake_2025-10-07_11-00-00" {
+			t.Fatalf("Attempt %d: expected the newest bake ID to win the tie, got %s", i, bake.Filename)
+		}
+	}
+}
+
+func TestDeleteEventRefusesMalformedFile(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	store.AppendEvent(models.NewEvent(models.EventStarterOut))
+	filePath := store.getCurrentBakeFile()
+
+	f, _ := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("not json\n")
+	f.Close()
+
+	bake, _ := store.ReadCurrentBake()
+	if err := store.DeleteEvent(0, bake.Events[0].Timestamp.Format(time.RFC3339Nano)); err == nil {
+		t.Error("Expected delete to refuse rewriting a file with malformed lines")
+	}
+}
+
+// setupBenchStorage creates a data directory with n completed bakes and one active bake
+func setupBenchStorage(b *testing.B, n int) (*Storage, string) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-bench-*")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	start := time.Date(2020, 1, 1, 8, 0, 0, 0, time.Local)
+	types := []models.EventType{
+		models.EventStarterOut, models.EventFed, models.EventLevainReady, models.EventMixed,
+		models.EventFold, models.EventFold, models.EventFold, models.EventShaped,
+		models.EventFridgeIn, models.EventOvenIn, models.EventOvenOut,
+	}
+	for i := 0; i < n; i++ {
+		bakeStart := start.AddDate(0, 0, i*3)
+		var events []models.Event
+		for j, eventType := range types {
+			events = append(events, models.Event{Timestamp: bakeStart.Add(time.Duration(j) * time.Hour), Event: eventType})
+		}
+		events = append(events, models.Event{
+			Timestamp: bakeStart.Add(24 * time.Hour),
+			Event:     models.EventLoafComplete,
+			Data:      map[string]interface{}{"assessment": models.Assessment{Score: 7, ProofLevel: models.ProofGood}},
+		})
+		filePath := writeBakeFile(b, tmpDir, bakeStart.Format("2006-01-02_15-04-05"), events...)
+		last := events[len(events)-1].Timestamp
+		os.Chtimes(filePath, last, last)
+	}
+
+	store, err := New(tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		b.Fatalf("Failed to create storage: %v", err)
+	}
+	for _, eventType := range types[:5] {
+		store.AppendEvent(models.NewEvent(eventType))
+	}
+
+	return store, tmpDir
+}
+
+// benchmarkCache runs op against n bakes with a warm cache and, for comparison,
+// with the cache cleared before every call (the cost of re-parsing every file)
+func benchmarkCache(b *testing.B, op func(*Storage)) {
+	for _, n := range []int{100, 500} {
+		b.Run(fmt.Sprintf("bakes=%d/cold", n), func(b *testing.B) {
+			store, tmpDir := setupBenchStorage(b, n)
+			defer cleanup(tmpDir)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.cache.reset()
+				op(store)
+			}
+		})
+		b.Run(fmt.Sprintf("bakes=%d/cached", n), func(b *testing.B) {
+			store, tmpDir := setupBenchStorage(b, n)
+			defer cleanup(tmpDir)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				op(store)
+			}
+		})
+	}
+}
+
+func BenchmarkHasCurrentBake(b *testing.B) {
+	benchmarkCache(b, func(s *Storage) { s.HasCurrentBake() })
+}
+
+func BenchmarkReadCurrentBake(b *testing.B) {
+	benchmarkCache(b, func(s *Storage) { s.ReadCurrentBake() })
+}
+
+func BenchmarkGetLastEvent(b *testing.B) {
+	benchmarkCache(b, func(s *Storage) { s.GetLastEvent() })
+}
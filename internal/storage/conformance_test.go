@@ -0,0 +1,739 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// storeFactory creates an empty store and returns a function that removes it
+type storeFactory func(t *testing.T) (Store, func())
+
+var backends = map[string]storeFactory{
+	BackendJSONL: func(t *testing.T) (Store, func()) {
+		store, tmpDir := setupTestStorage(t)
+		return store, func() { cleanup(tmpDir) }
+	},
+	BackendSQLite: func(t *testing.T) (Store, func()) {
+		tmpDir, err := os.MkdirTemp("", "sourdough-sqlite-test-*")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		store, err := NewSQLite(tmpDir)
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		return store, func() {
+			store.Close()
+			cleanup(tmpDir)
+		}
+	},
+}
+
+// TestConformance runs the same behavioural checks against every backend
+func TestConformance(t *testing.T) {
+	tests := map[string]func(t *testing.T, store Store){
+		"ReadCurrentBake":     conformReadCurrentBake,
+		"HasCurrentBake":      conformHasCurrentBake,
+		"GetLastEvent":        conformGetLastEvent,
+		"EmptyBake":           conformEmptyBake,
+		"BakeWithAssessment":  conformBakeWithAssessment,
+		"ConcurrentWrites":    conformConcurrentWrites,
+		"DeleteEvent":         conformDeleteEvent,
+		"InsertEvent":         conformInsertEvent,
+		"InsertEventByTime":   conformInsertEventByTime,
+		"DeleteBake":          conformDeleteBake,
+		"Trash":               conformTrash,
+		"ImportBake":          conformImportBake,
+		"WriteBake":           conformWriteBake,
+		"ReplaceBake":         conformReplaceBake,
+		"UpdateBake":          conformUpdateBake,
+		"ImportKeepsActive":   conformImportKeepsActive,
+		"NotifiesListeners":   conformNotifies,
+		"SaveImage":           conformSaveImage,
+		"ListBakesDescending": conformListBakes,
+		"ForBaker":            conformForBaker,
+	}
+
+	for backend, factory := range backends {
+		for name, test := range tests {
+			t.Run(backend+"/"+name, func(t *testing.T) {
+				store, done := factory(t)
+				defer done()
+				test(t, store)
+			})
+		}
+	}
+}
+
+func appendEvents(t *testing.T, store Store, types ...models.EventType) {
+	t.Helper()
+	for _, eventType := range types {
+		if err := store.AppendEvent(models.NewEvent(eventType)); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+		time.Sleep(1 * time.Millisecond) // Ensure different timestamps
+	}
+}
+
+// pastBake returns a completed bake that started at the given time
+func pastBake(start time.Time, score int) *models.Bake {
+	return &models.Bake{
+		Events: []models.Event{
+			{Timestamp: start, Event: models.EventMixed},
+			{Timestamp: start.Add(4 * time.Hour), Event: models.EventShaped},
+			{Timestamp: start.Add(20 * time.Hour), Event: models.EventOvenOut},
+		},
+		Assessment: &models.Assessment{Score: score, ProofLevel: models.ProofGood},
+	}
+}
+
+func conformReadCurrentBake(t *testing.T, store Store) {
+	events := []models.EventType{models.EventStarterOut, models.EventFed, models.EventLevainReady, models.EventMixed}
+	appendEvents(t, store, events...)
+
+	bake, err := store.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("Failed to read current bake: %v", err)
+	}
+	if len(bake.Events) != len(events) {
+		t.Fatalf("Expected %d events, got %d", len(events), len(bake.Events))
+	}
+	for i, event := range bake.Events {
+		if event.Event != events[i] {
+			t.Errorf("Event %d: expected %s, got %s", i, events[i], event.Event)
+		}
+	}
+	if !strings.HasPrefix(bake.Filename, "bake_") {
+		t.Errorf("Expected filename with bake_ prefix, got %q", bake.Filename)
+	}
+}
+
+func conformHasCurrentBake(t *testing.T, store Store) {
+	if hasBake, _ := store.HasCurrentBake(); hasBake {
+		t.Error("Expected no bake initially")
+	}
+
+	appendEvents(t, store, models.EventStarterOut)
+	if hasBake, err := store.HasCurrentBake(); err != nil || !hasBake {
+		t.Errorf("Expected to have current bake (err %v)", err)
+	}
+
+	appendEvents(t, store, models.EventLoafComplete)
+	if hasBake, err := store.HasCurrentBake(); err != nil || hasBake {
+		t.Errorf("Expected no active bake after completion (err %v)", err)
+	}
+}
+
+func conformGetLastEvent(t *testing.T, store Store) {
+	lastEvent, err := store.GetLastEvent()
+	if err != nil || lastEvent != nil {
+		t.Fatalf("Expected no last event initially, got %v (err %v)", lastEvent, err)
+	}
+
+	appendEvents(t, store, models.EventStarterOut, models.EventFed, models.EventMixed)
+
+	lastEvent, err = store.GetLastEvent()
+	if err != nil {
+		t.Fatalf("GetLastEvent failed: %v", err)
+	}
+	if lastEvent == nil || lastEvent.Event != models.EventMixed {
+		t.Errorf("Expected last event to be %s, got %v", models.EventMixed, lastEvent)
+	}
+}
+
+func conformEmptyBake(t *testing.T, store Store) {
+	bake, err := store.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("Failed to read empty bake: %v", err)
+	}
+	if len(bake.Events) != 0 {
+		t.Errorf("Expected 0 events, got %d", len(bake.Events))
+	}
+
+	bake, err = store.ReadBake("2020-01-01_00-00-00")
+	if err != nil {
+		t.Fatalf("Failed to read unknown bake: %v", err)
+	}
+	if len(bake.Events) != 0 {
+		t.Errorf("Expected unknown bake to be empty, got %d events", len(bake.Events))
+	}
+}
+
+func conformBakeWithAssessment(t *testing.T, store Store) {
+	appendEvents(t, store, models.EventStarterOut)
+
+	completeEvent := models.NewEvent(models.EventLoafComplete)
+	completeEvent.Data = map[string]interface{}{
+		"assessment": models.Assessment{ProofLevel: "good", CrumbQuality: 8, Browning: "good", Score: 9},
+	}
+	if err := store.AppendEvent(completeEvent); err != nil {
+		t.Fatalf("Failed to append complete event: %v", err)
+	}
+
+	dates, err := store.ListBakes()
+	if err != nil || len(dates) != 1 {
+		t.Fatalf("Expected 1 bake, got %v (err %v)", dates, err)
+	}
+
+	bake, err := store.ReadBake(dates[0])
+	if err != nil {
+		t.Fatalf("Failed to read bake: %v", err)
+	}
+	if bake.Assessment == nil || bake.Assessment.Score != 9 || bake.Assessment.ProofLevel != "good" {
+		t.Errorf("Expected assessment with score 9, got %+v", bake.Assessment)
+	}
+}
+
+func conformConcurrentWrites(t *testing.T, store Store) {
+	var wg sync.WaitGroup
+	numGoroutines := 10
+
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.AppendEvent(models.NewEvent(models.EventFold))
+		}()
+	}
+	wg.Wait()
+
+	bake, err := store.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("Failed to read bake: %v", err)
+	}
+	if len(bake.Events) != numGoroutines {
+		t.Errorf("Expected %d events, got %d", numGoroutines, len(bake.Events))
+	}
+}
+
+func conformDeleteEvent(t *testing.T, store Store) {
+	appendEvents(t, store, models.EventStarterOut, models.EventFed, models.EventMixed)
+
+	bake, _ := store.ReadCurrentBake()
+	if err := store.DeleteEvent(1, "wrong"); err == nil {
+		t.Error("Expected timestamp mismatch error")
+	}
+	if err := store.DeleteEvent(5, bake.Events[1].Timestamp.Format(time.RFC3339Nano)); err == nil {
+		t.Error("Expected invalid index error")
+	}
+	if err := store.DeleteEvent(1, bake.Events[1].Timestamp.Format(time.RFC3339Nano)); err != nil {
+		t.Fatalf("DeleteEvent failed: %v", err)
+	}
+
+	bake, _ = store.ReadCurrentBake()
+	if len(bake.Events) != 2 || bake.Events[1].Event != models.EventMixed {
+		t.Errorf("Expected fed to be removed, got %v", bake.Events)
+	}
+
+	// Appending after a delete keeps order
+	appendEvents(t, store, models.EventFold)
+	bake, _ = store.ReadCurrentBake()
+	if len(bake.Events) != 3 || bake.Events[2].Event != models.EventFold {
+		t.Errorf("Expected fold appended last, got %v", bake.Events)
+	}
+
+	// A finished bake's loaf-complete can be removed by ID, making it active again
+	appendEvents(t, store, models.EventLoafComplete)
+	id := strings.TrimPrefix(bake.Filename, "bake_")
+	finished, _ := store.ReadBake(id)
+	last := len(finished.Events) - 1
+	if err := store.DeleteBakeEvent(id, last, finished.Events[last].Timestamp.Format(time.RFC3339Nano)); err != nil {
+		t.Fatalf("DeleteBakeEvent failed: %v", err)
+	}
+	bake, _ = store.ReadCurrentBake()
+	if bake.Filename != finished.Filename || len(bake.Events) != 3 {
+		t.Errorf("Expected the bake active again without loaf-complete, got %s %v", bake.Filename, bake.Events)
+	}
+}
+
+func conformInsertEvent(t *testing.T, store Store) {
+	if err := store.InsertEvent(0, models.NewEvent(models.EventFed)); err == nil {
+		t.Error("Expected error inserting without a current bake")
+	}
+
+	appendEvents(t, store, models.EventStarterOut, models.EventFed, models.EventMixed)
+
+	bake, _ := store.ReadCurrentBake()
+	deleted := bake.Events[1]
+	store.DeleteEvent(1, deleted.Timestamp.Format(time.RFC3339Nano))
+
+	if err := store.InsertEvent(4, &deleted); err == nil {
+		t.Error("Expected invalid index error")
+	}
+	if err := store.InsertEvent(1, &deleted); err != nil {
+		t.Fatalf("InsertEvent failed: %v", err)
+	}
+
+	bake, _ = store.ReadCurrentBake()
+	if len(bake.Events) != 3 || bake.Events[1].Event != models.EventFed || !bake.Events[1].Timestamp.Equal(deleted.Timestamp) {
+		t.Errorf("Expected fed back in place, got %v", bake.Events)
+	}
+
+	// Inserting at the end works like an append
+	if err := store.InsertEvent(3, models.NewEvent(models.EventFold)); err != nil {
+		t.Fatalf("InsertEvent failed: %v", err)
+	}
+	if last, _ := store.GetLastEvent(); last == nil || last.Event != models.EventFold {
+		t.Errorf("Expected fold last, got %v", last)
+	}
+}
+
+func conformDeleteBake(t *testing.T, store Store) {
+	id, err := store.ImportBake(pastBake(time.Date(2024, 3, 2, 8, 0, 0, 0, time.Local), 7))
+	if err != nil {
+		t.Fatalf("ImportBake failed: %v", err)
+	}
+
+	if err := store.DeleteBake(id); err != nil {
+		t.Fatalf("DeleteBake failed: %v", err)
+	}
+	if dates, _ := store.ListBakes(); len(dates) != 0 {
+		t.Errorf("Expected deleted bake to be hidden, got %v", dates)
+	}
+	if bake, _ := store.ReadBake(id); len(bake.Events) != 0 {
+		t.Errorf("Expected deleted bake to read as empty, got %d events", len(bake.Events))
+	}
+	if err := store.DeleteBake(id); err == nil {
+		t.Error("Expected error deleting a missing bake")
+	}
+}
+
+func conformTrash(t *testing.T, store Store) {
+	bake := pastBake(time.Date(2024, 3, 2, 8, 0, 0, 0, time.Local), 7)
+	id, _ := store.ImportBake(bake)
+
+	// The first copy has a photo
+	imagePath := store.GetImagePath(id, "crumb.jpg")
+	os.MkdirAll(filepath.Dir(imagePath), 0755)
+	os.WriteFile(imagePath, []byte("jpeg"), 0644)
+
+	if err := store.DeleteBake(id); err != nil {
+		t.Fatalf("DeleteBake failed: %v", err)
+	}
+	if _, err := os.Stat(imagePath); !os.IsNotExist(err) {
+		t.Error("Expected images to move to the trash")
+	}
+
+	// Deleting the same ID again keeps both entries
+	store.ImportBake(bake)
+	time.Sleep(1 * time.Millisecond)
+	if err := store.DeleteBake(id); err != nil {
+		t.Fatalf("DeleteBake failed: %v", err)
+	}
+
+	entries, err := store.ListTrash()
+	if err != nil {
+		t.Fatalf("ListTrash failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID == entries[1].ID || entries[0].BakeID != id {
+		t.Fatalf("Expected 2 distinct trash entries for %s, got %+v", id, entries)
+	}
+	if entries[1].Images != 1 || entries[1].Events != 4 {
+		t.Errorf("Expected oldest entry with 4 events and 1 image, got %+v", entries[1])
+	}
+
+	restoredID, err := store.RestoreBake(entries[1].ID)
+	if err != nil || restoredID != id {
+		t.Fatalf("RestoreBake failed: %s (err %v)", restoredID, err)
+	}
+	if restored, _ := store.ReadBake(id); len(restored.Events) != 4 || restored.Assessment == nil {
+		t.Errorf("Expected restored bake with assessment, got %+v", restored)
+	}
+	if data, err := os.ReadFile(imagePath); err != nil || string(data) != "jpeg" {
+		t.Errorf("Expected image restored, got %q (err %v)", data, err)
+	}
+	if hasBake, _ := store.HasCurrentBake(); hasBake {
+		t.Error("Restored finished bake should not become active")
+	}
+
+	if _, err := store.RestoreBake(entries[0].ID); !errors.Is(err, ErrBakeExists) {
+		t.Errorf("Expected ErrBakeExists restoring over an existing bake, got %v", err)
+	}
+	if _, err := store.RestoreBake("../escape"); !errors.Is(err, ErrInvalidTrashID) {
+		t.Errorf("Expected ErrInvalidTrashID, got %v", err)
+	}
+	if _, err := store.RestoreBake("2020-01-01_00-00-00@20200101-000000.000000000"); !errors.Is(err, ErrTrashNotFound) {
+		t.Errorf("Expected ErrTrashNotFound, got %v", err)
+	}
+
+	// Recent entries survive a 30 day purge; a zero age purges everything
+	if purged, _ := store.PurgeTrash(30 * 24 * time.Hour); len(purged) != 0 {
+		t.Errorf("Expected nothing purged, got %v", purged)
+	}
+	purged, err := store.PurgeTrash(0)
+	if err != nil || len(purged) != 1 {
+		t.Errorf("Expected 1 entry purged, got %v (err %v)", purged, err)
+	}
+	if entries, _ := store.ListTrash(); len(entries) != 0 {
+		t.Errorf("Expected empty trash, got %+v", entries)
+	}
+}
+
+func conformImportBake(t *testing.T, store Store) {
+	start := time.Date(2024, 3, 2, 8, 0, 0, 0, time.Local)
+	id, err := store.ImportBake(pastBake(start, 8))
+	if err != nil {
+		t.Fatalf("ImportBake failed: %v", err)
+	}
+	if id != "2024-03-02_08-00-00" {
+		t.Errorf("Expected ID from first event, got %s", id)
+	}
+
+	bake, err := store.ReadBake(id)
+	if err != nil {
+		t.Fatalf("ReadBake failed: %v", err)
+	}
+	if len(bake.Events) != 4 || bake.Events[3].Event != models.EventLoafComplete {
+		t.Errorf("Expected loaf-complete appended, got %v", bake.Events)
+	}
+	if bake.Assessment == nil || bake.Assessment.Score != 8 {
+		t.Errorf("Expected assessment, got %+v", bake.Assessment)
+	}
+
+	if _, err := store.ImportBake(pastBake(start, 8)); err == nil {
+		t.Error("Expected error importing the same bake twice")
+	}
+}
+
+func conformWriteBake(t *testing.T, store Store) {
+	start := time.Date(2024, 3, 9, 8, 0, 0, 0, time.Local)
+	events := []models.Event{
+		{Timestamp: start, Event: models.EventStarterOut},
+		{Timestamp: start.Add(time.Hour), Event: models.EventFed},
+	}
+	if err := store.WriteBake("custom-id", events); err != nil {
+		t.Fatalf("WriteBake failed: %v", err)
+	}
+	if err := store.WriteBake("custom-id", events); err == nil {
+		t.Error("Expected error writing an existing bake")
+	}
+	if err := store.WriteBake("empty", nil); err == nil {
+		t.Error("Expected error writing a bake without events")
+	}
+
+	bake, _ := store.ReadBake("custom-id")
+	if len(bake.Events) != 2 || !bake.Events[1].Timestamp.Equal(events[1].Timestamp) {
+		t.Errorf("Expected events written unchanged, got %v", bake.Events)
+	}
+
+	// An unfinished bake written as-is becomes the active bake
+	if hasBake, _ := store.HasCurrentBake(); !hasBake {
+		t.Error("Expected written unfinished bake to be active")
+	}
+}
+
+func conformReplaceBake(t *testing.T, store Store) {
+	start := time.Date(2024, 3, 9, 8, 0, 0, 0, time.Local)
+	events := []models.Event{
+		{Timestamp: start, Event: models.EventStarterOut},
+		{Timestamp: start.Add(time.Hour), Event: models.EventFed},
+	}
+	if err := store.ReplaceBake("2024-03-09_08-00-00", events[:1]); err != nil {
+		t.Fatalf("ReplaceBake create failed: %v", err)
+	}
+	if err := store.ReplaceBake("2024-03-09_08-00-00", events); err != nil {
+		t.Fatalf("ReplaceBake failed: %v", err)
+	}
+	if err := store.ReplaceBake("2024-03-09_08-00-00", nil); err == nil {
+		t.Error("Expected error replacing with no events")
+	}
+
+	bake, _ := store.ReadBake("2024-03-09_08-00-00")
+	if len(bake.Events) != 2 || bake.Events[1].Event != models.EventFed {
+		t.Errorf("Expected replaced events, got %v", bake.Events)
+	}
+
+	// Replacing with a finished bake completes it
+	events = append(events, models.Event{Timestamp: start.Add(2 * time.Hour), Event: models.EventLoafComplete})
+	store.ReplaceBake("2024-03-09_08-00-00", events)
+	if hasBake, _ := store.HasCurrentBake(); hasBake {
+		t.Error("Expected no active bake after replacing with a completed one")
+	}
+	if dates, _ := store.ListBakes(); len(dates) != 1 {
+		t.Errorf("Expected 1 bake, got %v", dates)
+	}
+}
+
+func conformInsertEventByTime(t *testing.T, store Store) {
+	now := time.Now().Truncate(time.Second)
+	at := func(eventType models.EventType, ago time.Duration) *models.Event {
+		event := models.NewEvent(eventType)
+		event.Timestamp = now.Add(-ago)
+		return event
+	}
+
+	// Folds 1-3, then shaping; the first event starts the bake
+	for _, event := range []*models.Event{
+		at(models.EventMixed, 3*time.Hour),
+		at(models.EventFold, 150*time.Minute),
+		at(models.EventFold, 120*time.Minute),
+		at(models.EventFold, 90*time.Minute),
+		at(models.EventShaped, 10*time.Minute),
+	} {
+		if _, err := store.InsertEventByTime(event); err != nil {
+			t.Fatalf("InsertEventByTime failed: %v", err)
+		}
+	}
+
+	// A fold that waited in a phone's queue goes between the first two, and
+	// is still announced as newly logged
+	var ops []ChangeOp
+	store.Subscribe(func(c Change) { ops = append(ops, c.Op) })
+	late := at(models.EventFold, 140*time.Minute)
+	id, err := store.InsertEventByTime(late)
+	if err != nil {
+		t.Fatalf("InsertEventByTime failed: %v", err)
+	}
+	if len(ops) != 1 || ops[0] != OpAppend {
+		t.Errorf("Expected one append change, got %v", ops)
+	}
+	if late.FoldCount == nil || *late.FoldCount != 2 {
+		t.Errorf("Expected the late fold numbered 2, got %v", late.FoldCount)
+	}
+
+	bake, _ := store.ReadCurrentBake()
+	if id != strings.TrimPrefix(bake.Filename, "bake_") {
+		t.Errorf("Expected the ID of the current bake, got %q", id)
+	}
+	var got []string
+	for _, e := range bake.Events {
+		name := string(e.Event)
+		if e.FoldCount != nil {
+			name += fmt.Sprint(*e.FoldCount)
+		}
+		got = append(got, name)
+	}
+	if want := "mixed,fold1,fold2,fold3,fold4,shaped"; strings.Join(got, ",") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func conformUpdateBake(t *testing.T, store Store) {
+	start := time.Date(2024, 3, 9, 8, 0, 0, 0, time.Local)
+	add := func(event models.Event) func([]models.Event) []models.Event {
+		return func(events []models.Event) []models.Event {
+			return append(events, event)
+		}
+	}
+
+	// A bake that doesn't exist starts empty
+	changed, err := store.UpdateBake("2024-03-09_08-00-00", add(models.Event{Timestamp: start, Event: models.EventStarterOut}))
+	if err != nil || !changed {
+		t.Fatalf("UpdateBake create failed: %v %v", changed, err)
+	}
+	if changed, err := store.UpdateBake("2024-03-09_08-00-00", func([]models.Event) []models.Event { return nil }); err != nil || changed {
+		t.Errorf("Expected no write when update returns nothing, got %v %v", changed, err)
+	}
+	bake, _ := store.ReadBake("2024-03-09_08-00-00")
+	if len(bake.Events) != 1 {
+		t.Fatalf("Expected 1 event, got %v", bake.Events)
+	}
+
+	// Updates and appends to the same bake never lose each other's events
+	appendEvents(t, store, models.EventStarterOut)
+	current, _ := store.ReadCurrentBake()
+	id := strings.TrimPrefix(current.Filename, "bake_")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.AppendEvent(models.NewEvent(models.EventFold))
+		}()
+		go func() {
+			defer wg.Done()
+			store.UpdateBake(id, add(*models.NewEvent(models.EventNote)))
+		}()
+	}
+	wg.Wait()
+	if bake, _ := store.ReadBake(id); len(bake.Events) != len(current.Events)+20 {
+		t.Errorf("Expected %d events, got %d", len(current.Events)+20, len(bake.Events))
+	}
+}
+
+func conformImportKeepsActive(t *testing.T, store Store) {
+	appendEvents(t, store, models.EventStarterOut)
+
+	if _, err := store.ImportBake(pastBake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local), 5)); err != nil {
+		t.Fatalf("ImportBake failed: %v", err)
+	}
+
+	appendEvents(t, store, models.EventFed)
+
+	bake, _ := store.ReadCurrentBake()
+	if len(bake.Events) != 2 || bake.Events[0].Event != models.EventStarterOut {
+		t.Errorf("Expected active bake to keep its events, got %v", bake.Events)
+	}
+}
+
+func conformNotifies(t *testing.T, store Store) {
+	var mu sync.Mutex
+	var ops []ChangeOp
+	store.Subscribe(func(c Change) {
+		mu.Lock()
+		ops = append(ops, c.Op)
+		mu.Unlock()
+	})
+
+	appendEvents(t, store, models.EventStarterOut, models.EventFed)
+	bake, _ := store.ReadCurrentBake()
+	store.DeleteEvent(1, bake.Events[1].Timestamp.Format(time.RFC3339Nano))
+	id, _ := store.ImportBake(pastBake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local), 5))
+	store.DeleteBake(id)
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []ChangeOp{OpAppend, OpAppend, OpDeleteEvent, OpImport, OpDeleteBake}
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, ops)
+	}
+	for i := range expected {
+		if ops[i] != expected[i] {
+			t.Errorf("Change %d: expected %s, got %s", i, expected[i], ops[i])
+		}
+	}
+}
+
+func conformSaveImage(t *testing.T, store Store) {
+	appendEvents(t, store, models.EventStarterOut)
+
+	if err := store.SaveImage("crumb.jpg", strings.NewReader("jpeg")); err != nil {
+		t.Fatalf("SaveImage failed: %v", err)
+	}
+
+	bake, _ := store.ReadCurrentBake()
+	data, err := os.ReadFile(store.GetImagePath(strings.TrimPrefix(bake.Filename, "bake_"), "crumb.jpg"))
+	if err != nil || string(data) != "jpeg" {
+		t.Errorf("Expected saved image at GetImagePath, got %q (err %v)", data, err)
+	}
+}
+
+func conformListBakes(t *testing.T, store Store) {
+	for i, day := range []int{5, 7, 6} {
+		if _, err := store.ImportBake(pastBake(time.Date(2025, 10, day, 8, 0, 0, 0, time.Local), i+1)); err != nil {
+			t.Fatalf("ImportBake failed: %v", err)
+		}
+	}
+
+	bakes, err := store.ListBakes()
+	if err != nil {
+		t.Fatalf("ListBakes failed: %v", err)
+	}
+	if len(bakes) != 3 || bakes[0] != "2025-10-07_08-00-00" || bakes[2] != "2025-10-05_08-00-00" {
+		t.Errorf("Expected bakes in descending order, got %v", bakes)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	for from, fromFactory := range backends {
+		for to, toFactory := range backends {
+			if from == to {
+				continue
+			}
+			t.Run(from+"_to_"+to, func(t *testing.T) {
+				src, doneSrc := fromFactory(t)
+				defer doneSrc()
+				dst, doneDst := toFactory(t)
+				defer doneDst()
+
+				pastID, _ := src.ImportBake(pastBake(time.Date(2024, 3, 2, 8, 0, 0, 0, time.Local), 8))
+				appendEvents(t, src, models.EventStarterOut, models.EventFed)
+
+				report, err := Migrate(src, dst)
+				if err != nil {
+					t.Fatalf("Migrate failed: %v", err)
+				}
+				if len(report.Copied) != 2 {
+					t.Errorf("Expected 2 bakes copied, got %v", report.Copied)
+				}
+
+				past, _ := dst.ReadBake(pastID)
+				if past.Assessment == nil || past.Assessment.Score != 8 {
+					t.Errorf("Expected assessment migrated, got %+v", past.Assessment)
+				}
+
+				// The unfinished bake is still the active one after migration
+				current, _ := dst.ReadCurrentBake()
+				if len(current.Events) != 2 || current.Events[1].Event != models.EventFed {
+					t.Errorf("Expected active bake migrated, got %v", current.Events)
+				}
+
+				// Rerunning skips everything
+				report, err = Migrate(src, dst)
+				if err != nil {
+					t.Fatalf("Migrate failed: %v", err)
+				}
+				if len(report.Copied) != 0 || len(report.Skipped) != 2 {
+					t.Errorf("Expected rerun to skip 2 bakes, got %+v", report)
+				}
+			})
+		}
+	}
+}
+
+func conformForBaker(t *testing.T, store Store) {
+	alice, bob := store.ForBaker("alice"), store.ForBaker("bob")
+
+	// Both start in the same second, so their bakes need different IDs
+	for _, baker := range []struct {
+		store Store
+		name  string
+	}{{alice, "alice"}, {bob, "bob"}} {
+		if err := baker.store.AppendEvent(models.NewEvent(models.EventStarterOut).WithUser(baker.name)); err != nil {
+			t.Fatalf("AppendEvent for %s failed: %v", baker.name, err)
+		}
+	}
+	if err := alice.AppendEvent(models.NewEvent(models.EventMixed).WithUser("alice")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	aliceBake, err := alice.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("ReadCurrentBake failed: %v", err)
+	}
+	bobBake, err := bob.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("ReadCurrentBake failed: %v", err)
+	}
+	if aliceBake.Filename == bobBake.Filename {
+		t.Fatalf("Expected separate bakes, both got %s", aliceBake.Filename)
+	}
+	if len(aliceBake.Events) != 2 || aliceBake.Baker() != "alice" {
+		t.Errorf("Expected alice's bake to have her 2 events, got %+v", aliceBake.Events)
+	}
+	if len(bobBake.Events) != 1 || bobBake.Baker() != "bob" {
+		t.Errorf("Expected bob's bake to have his 1 event, got %+v", bobBake.Events)
+	}
+
+	// The household sees one of them, whichever was updated last
+	household, err := store.ReadCurrentBake()
+	if err != nil {
+		t.Fatalf("ReadCurrentBake failed: %v", err)
+	}
+	if household.Filename != aliceBake.Filename && household.Filename != bobBake.Filename {
+		t.Errorf("Expected the household to see a bake in progress, got %s", household.Filename)
+	}
+
+	// Finishing one bake leaves the other in progress
+	if err := bob.AppendEvent(models.NewEvent(models.EventLoafComplete).WithUser("bob")); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	if has, _ := bob.HasCurrentBake(); has {
+		t.Error("Expected bob to have no bake in progress")
+	}
+	if has, _ := alice.HasCurrentBake(); !has {
+		t.Error("Expected alice's bake to still be in progress")
+	}
+	if has, _ := store.ForBaker("carol").HasCurrentBake(); has {
+		t.Error("Expected a baker without bakes to have none in progress")
+	}
+}
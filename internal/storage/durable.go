@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// SyncPolicy controls when the JSONL store forces writes to disk
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs the bake file after every write and the data directory
+	// after every file is created, renamed or removed. This is the default.
+	SyncAlways SyncPolicy = "always"
+	// SyncNone leaves flushing to the operating system; a power cut can lose
+	// the last few seconds of events.
+	SyncNone SyncPolicy = "none"
+)
+
+// ParseSyncPolicy parses a policy name; an empty name means SyncAlways
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch SyncPolicy(name) {
+	case "", SyncAlways:
+		return SyncAlways, nil
+	case SyncNone:
+		return SyncNone, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy: %s (use %s or %s)", name, SyncAlways, SyncNone)
+	}
+}
+
+// QuarantineDir is where corrupt lines are moved, relative to the data directory
+const QuarantineDir = "quarantine"
+
+// IntegrityIssue describes a data-integrity problem found in storage
+type IntegrityIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Problem string `json:"problem"`
+}
+
+func (i IntegrityIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s line %d: %s", i.File, i.Line, i.Problem)
+	}
+	return fmt.Sprintf("%s: %s", i.File, i.Problem)
+}
+
+// IntegrityChecker is implemented by stores that can report data-integrity problems
+type IntegrityChecker interface {
+	IntegrityIssues() ([]IntegrityIssue, error)
+}
+
+// badLine is a line of a bake file that isn't a valid event
+type badLine struct {
+	Line int
+	Text string
+	Err  string
+}
+
+// parseLines parses the contents of a bake file. Blank lines are ignored; lines
+// that aren't valid JSON are returned as bad lines. truncated reports that the
+// file doesn't end with a newline, which is what an interrupted append leaves.
+func parseLines(data []byte) (events []models.Event, bad []badLine, truncated bool) {
+	truncated = len(data) > 0 && data[len(data)-1] != '\n'
+
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var event models.Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			bad = append(bad, badLine{Line: i + 1, Text: string(line), Err: err.Error()})
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, bad, truncated
+}
+
+// syncFile fsyncs f if the policy asks for it
+func (p SyncPolicy) syncFile(f *os.File) error {
+	if p == SyncNone {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", filepath.Base(f.Name()), err)
+	}
+	return nil
+}
+
+// syncDir fsyncs a directory so that file creations, renames and removals in it are durable
+func (p SyncPolicy) syncDir(dir string) error {
+	if p == SyncNone {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory for sync: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path via a synced temp file and rename
+func (p SyncPolicy) writeFileAtomic(path string, data []byte) error {
+	tempFile := path + ".tmp"
+	f, err := os.Create(tempFile)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := p.syncFile(f); err != nil {
+		f.Close()
+		os.Remove(tempFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return p.syncDir(filepath.Dir(path))
+}
+
+// encodeEvents renders events as JSON Lines
+func encodeEvents(events []models.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return nil, fmt.Errorf("failed to marshal event: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// quarantine appends corrupt lines from a bake file to quarantine/<file>.corrupt,
+// each prefixed with its original line number and the time it was moved
+func (p SyncPolicy) quarantine(dataDir, fileName string, lines []badLine) (string, error) {
+	dir := filepath.Join(dataDir, QuarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	path := filepath.Join(dir, fileName+".corrupt")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open quarantine file: %w", err)
+	}
+	defer f.Close()
+
+	now := time.Now().Format(time.RFC3339)
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(f, "# %s line %d (%s)\n%s\n", now, line.Line, line.Err, line.Text); err != nil {
+			return "", fmt.Errorf("failed to write quarantine file: %w", err)
+		}
+	}
+	if err := p.syncFile(f); err != nil {
+		return "", err
+	}
+	return path, p.syncDir(dir)
+}
+
+// repairTail fixes a bake file whose last line was cut short by a crash, before
+// anything is appended after it. A tail that still parses just gets its missing
+// newline; otherwise it is quarantined and the file truncated to the last full line.
+// It returns a description of the repair, or "" if the file was intact.
+func (p SyncPolicy) repairTail(f *os.File, dataDir string) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat bake file: %w", err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return "", nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return "", fmt.Errorf("failed to read bake file: %w", err)
+	}
+	if last[0] == '\n' {
+		return "", nil
+	}
+
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read bake file: %w", err)
+	}
+	cut := bytes.LastIndexByte(data, '\n') + 1
+	tail := data[cut:]
+	name := filepath.Base(f.Name())
+
+	var event models.Event
+	if json.Unmarshal(tail, &event) == nil {
+		if _, err := f.Write([]byte("\n")); err != nil {
+			return "", fmt.Errorf("failed to terminate last line: %w", err)
+		}
+		return fmt.Sprintf("added missing newline at end of %s", name), nil
+	}
+
+	lineNum := bytes.Count(data[:cut], []byte("\n")) + 1
+	qPath, err := p.quarantine(dataDir, name, []badLine{{Line: lineNum, Text: string(tail), Err: "truncated"}})
+	if err != nil {
+		return "", err
+	}
+	if err := f.Truncate(int64(cut)); err != nil {
+		return "", fmt.Errorf("failed to truncate bake file: %w", err)
+	}
+	if err := p.syncFile(f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("moved truncated line %d of %s to %s", lineNum, name, filepath.Join(QuarantineDir, filepath.Base(qPath))), nil
+}
+
+// repairLog remembers repairs made while the process runs so /health can report them
+type repairLog struct {
+	mu      sync.Mutex
+	repairs []IntegrityIssue
+}
+
+// maxRepairs bounds how many repairs are remembered
+const maxRepairs = 20
+
+func (l *repairLog) add(issue IntegrityIssue) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.repairs = append(l.repairs, issue)
+	if len(l.repairs) > maxRepairs {
+		l.repairs = l.repairs[len(l.repairs)-maxRepairs:]
+	}
+}
+
+func (l *repairLog) list() []IntegrityIssue {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]IntegrityIssue(nil), l.repairs...)
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+func TestParseSyncPolicy(t *testing.T) {
+	if p, err := ParseSyncPolicy(""); err != nil || p != SyncAlways {
+		t.Errorf("Expected empty policy to mean always, got %s (err %v)", p, err)
+	}
+	if p, err := ParseSyncPolicy("none"); err != nil || p != SyncNone {
+		t.Errorf("Expected none, got %s (err %v)", p, err)
+	}
+	if _, err := ParseSyncPolicy("sometimes"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestCloseWaitsForWrites(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+	store.SetSyncPolicy(SyncNone)
+
+	if err := store.AppendEvent(models.NewEvent(models.EventStarterOut)); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	// Close must not flush while a rewrite holds the lock
+	store.mu.Lock()
+	done := make(chan error, 1)
+	go func() { done <- store.Close() }()
+	select {
+	case <-done:
+		t.Fatal("Expected Close to wait for the write in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	store.mu.Unlock()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+}
+
+func TestAppendRepairsTruncatedLine(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	store.AppendEvent(models.NewEvent(models.EventStarterOut))
+	filePath := store.getCurrentBakeFile()
+
+	// Simulate a crash halfway through writing the next event
+	f, _ := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"timestamp":"2025-10-07T19:1`)
+	f.Close()
+
+	issues, _ := store.IntegrityIssues()
+	if len(issues) == 0 {
+		t.Fatal("Expected truncated line to be reported")
+	}
+
+	if err := store.AppendEvent(models.NewEvent(models.EventFed)); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	bake, _ := store.ReadCurrentBake()
+	if len(bake.Events) != 2 || bake.Events[1].Event != models.EventFed {
+		t.Errorf("Expected new event after repaired line, got %v", bake.Events)
+	}
+
+	quarantined, err := os.ReadFile(filepath.Join(tmpDir, QuarantineDir, filepath.Base(filePath)+".corrupt"))
+	if err != nil || !strings.Contains(string(quarantined), `"2025-10-07T19:1`) {
+		t.Errorf("Expected truncated line in quarantine, got %q (err %v)", quarantined, err)
+	}
+
+	// Only the record of the repair remains
+	issues, _ = store.IntegrityIssues()
+	if len(issues) != 1 || !strings.HasPrefix(issues[0].Problem, "repaired:") {
+		t.Errorf("Expected only the repair to be reported, got %v", issues)
+	}
+}
+
+func TestAppendTerminatesCompleteLastLine(t *testing.T) {
+	store, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	// A complete event whose newline never made it to disk
+	filePath := filepath.Join(tmpDir, "bake_2030-01-01_08-00-00.jsonl")
+	os.WriteFile(filePath, []byte(`{"timestamp":"2030-01-01T08:00:00Z","event":"starter-out"}`), 0644)
+
+	store.AppendEvent(models.NewEvent(models.EventFed))
+
+	bake, _ := store.ReadCurrentBake()
+	if len(bake.Events) != 2 || bake.Events[0].Event != models.EventStarterOut {
+		t.Errorf("Expected both events kept, got %v", bake.Events)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, QuarantineDir)); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be quarantined")
+	}
+}
+
+func TestFsck(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sourdough-fsck-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	good := `{"timestamp":"2024-03-02T08:00:00Z","event":"starter-out"}` + "\n"
+	os.WriteFile(filepath.Join(tmpDir, "bake_2024-03-02_08-00-00.jsonl"), []byte(good), 0644)
+
+	corruptPath := filepath.Join(tmpDir, "bake_2024-03-09_08-00-00.jsonl")
+	corrupt := good + "garbage\n" + `{"timestamp":"2024-03-09T09:00:00Z","event":"fed"}` + "\n" + `{"times`
+	os.WriteFile(corruptPath, []byte(corrupt), 0644)
+	modTime := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(corruptPath, modTime, modTime)
+
+	report, err := Fsck(tmpDir, SyncAlways, false)
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.Files != 2 || report.Events != 3 {
+		t.Errorf("Expected 2 files and 3 events, got %d and %d", report.Files, report.Events)
+	}
+	// Line 2 is garbage, line 4 is both corrupt and unterminated
+	if len(report.Issues) != 3 || report.Issues[0].Line != 2 {
+		t.Errorf("Expected 3 issues starting at line 2, got %v", report.Issues)
+	}
+	if data, _ := os.ReadFile(corruptPath); string(data) != corrupt {
+		t.Error("Check without repair should not modify files")
+	}
+
+	report, err = Fsck(tmpDir, SyncAlways, true)
+	if err != nil {
+		t.Fatalf("Fsck repair failed: %v", err)
+	}
+	if len(report.Repaired) != 1 || len(report.Quarantined) != 1 {
+		t.Errorf("Expected 1 repaired file and 1 quarantine file, got %+v", report)
+	}
+
+	data, _ := os.ReadFile(corruptPath)
+	if strings.Contains(string(data), "garbage") || !strings.HasSuffix(string(data), "\n") || strings.Count(string(data), "\n") != 2 {
+		t.Errorf("Expected only valid lines left, got %q", data)
+	}
+	if info, _ := os.Stat(corruptPath); !info.ModTime().Equal(modTime) {
+		t.Errorf("Expected modification time kept, got %s", info.ModTime())
+	}
+
+	report, _ = Fsck(tmpDir, SyncAlways, false)
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected clean directory after repair, got %v", report.Issues)
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FsckReport is the result of checking a JSONL data directory
+type FsckReport struct {
+	Files       int              `json:"files"`
+	Events      int              `json:"events"`
+	Issues      []IntegrityIssue `json:"issues"`
+	Repaired    []string         `json:"repaired"`    // Bake files rewritten without their corrupt lines
+	Quarantined []string         `json:"quarantined"` // Quarantine files corrupt lines were moved to
+}
+
+// Fsck checks every bake file in a JSONL data directory for lines that aren't
+// valid events and for a last line cut short by a crash. With repair set, corrupt
+// lines are moved to the quarantine directory and the bake file is rewritten
+// without them, keeping its modification time so the active bake doesn't change.
+// Repair should not run while a server is writing to the same directory.
+func Fsck(dataDir string, policy SyncPolicy, repair bool) (*FsckReport, error) {
+	files, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() && isBakeFile(file.Name()) {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	report := &FsckReport{}
+	for _, name := range names {
+		filePath := filepath.Join(dataDir, name)
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			report.Issues = append(report.Issues, IntegrityIssue{File: name, Problem: fmt.Sprintf("unreadable: %v", err)})
+			continue
+		}
+
+		report.Files++
+		events, bad, truncated := parseLines(data)
+		report.Events += len(events)
+
+		for _, line := range bad {
+			report.Issues = append(report.Issues, IntegrityIssue{File: name, Line: line.Line, Problem: "corrupt line: " + line.Err})
+		}
+		if truncated {
+			report.Issues = append(report.Issues, IntegrityIssue{File: name, Problem: "last line is not terminated (interrupted write)"})
+		}
+
+		if !repair || (len(bad) == 0 && !truncated) {
+			continue
+		}
+
+		if len(bad) > 0 {
+			qPath, err := policy.quarantine(dataDir, name, bad)
+			if err != nil {
+				return report, err
+			}
+			report.Quarantined = appendUnique(report.Quarantined, qPath)
+		}
+
+		if err := rewriteWithout(filePath, data, bad, policy); err != nil {
+			return report, err
+		}
+		report.Repaired = append(report.Repaired, name)
+	}
+
+	return report, nil
+}
+
+// rewriteWithout rewrites a bake file keeping every line except the bad ones,
+// byte for byte, ending with a newline and with the original modification time
+func rewriteWithout(filePath string, data []byte, bad []badLine, policy SyncPolicy) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat bake file: %w", err)
+	}
+
+	skip := make(map[int]bool, len(bad))
+	for _, line := range bad {
+		skip[line.Line] = true
+	}
+
+	var buf bytes.Buffer
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if skip[i+1] || len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if err := policy.writeFileAtomic(filePath, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to rewrite %s: %w", filepath.Base(filePath), err)
+	}
+	if err := os.Chtimes(filePath, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to restore bake file time: %w", err)
+	}
+	return nil
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
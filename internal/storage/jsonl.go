@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,10 +14,23 @@ import (
 	"github.com/mdeckert/sourdough/internal/models"
 )
 
-// Storage handles reading and writing bake data
+// Storage handles reading and writing bake data as one JSON Lines file per bake.
+// Views from ForBaker share everything but which bake is active.
 type Storage struct {
+	*jsonlState
+
+	baker string // Whose active bake this view uses; "" for the household's
+}
+
+// jsonlState is shared by a Storage and its per-baker views
+type jsonlState struct {
+	notifier
+
 	dataDir string
 	mu      sync.RWMutex
+	cache   *bakeCache
+	sync    SyncPolicy
+	repairs repairLog
 }
 
 // New creates a new Storage instance
@@ -28,84 +40,83 @@ func New(dataDir string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	return &Storage{
+	return &Storage{jsonlState: &jsonlState{
 		dataDir: dataDir,
-	}, nil
+		cache:   newBakeCache(dataDir),
+		sync:    SyncAlways,
+	}}, nil
+}
+
+// ForBaker returns a view of the store whose active bake is baker's own
+func (s *Storage) ForBaker(baker string) Store {
+	return &Storage{jsonlState: s.jsonlState, baker: baker}
+}
+
+// SetSyncPolicy sets when writes are fsynced (SyncAlways by default)
+func (s *Storage) SetSyncPolicy(policy SyncPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync = policy
+}
+
+// Close waits for a write in progress and, under SyncNone, flushes the bake
+// files to disk. Call it once the server has stopped writing.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sync != SyncNone {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(s.dataDir, "bake_*.jsonl"))
+	if err != nil {
+		return fmt.Errorf("failed to list bake files: %w", err)
+	}
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open bake file: %w", err)
+		}
+		err = SyncAlways.syncFile(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return SyncAlways.syncDir(s.dataDir)
 }
 
 // getCurrentBakeFile returns the path to the current active bake file
-// An active bake is one that hasn't been completed (no loaf-complete event)
+// An active bake is one that hasn't been completed (no loaf-complete event).
+// A baker's view only considers bakes that baker started.
 func (s *Storage) getCurrentBakeFile() string {
 	// First, check if there's an active bake (most recent file without loaf-complete)
-	files, err := os.ReadDir(s.dataDir)
-	if err != nil {
+	if err := s.cache.refresh(); err != nil {
 		// If we can't read dir, fall back to today's date
 		date := time.Now().Format("2006-01-02")
 		return filepath.Join(s.dataDir, fmt.Sprintf("bake_%s.jsonl", date))
 	}
 
-	// Sort files by modification time (most recent first)
-	var bakeFiles []struct {
-		name    string
-		modTime time.Time
+	if name := s.cache.current(s.baker); name != "" {
+		return filepath.Join(s.dataDir, name)
 	}
 
-	for _, file := range files {
-		if file.IsDir() || !strings.HasPrefix(file.Name(), "bake_") || !strings.HasSuffix(file.Name(), ".jsonl") {
-			continue
+	// No active bake found, create new one with current timestamp (including seconds to prevent collisions).
+	// Skip a second if another baker's active bake already has this one.
+	t := time.Now()
+	for {
+		name := fmt.Sprintf("bake_%s.jsonl", t.Format("2006-01-02_15-04-05"))
+		if entry := s.cache.lookup(name); entry == nil || entry.completed {
+			return filepath.Join(s.dataDir, name)
 		}
-		info, err := file.Info()
-		if err != nil {
-			continue
-		}
-		bakeFiles = append(bakeFiles, struct {
-			name    string
-			modTime time.Time
-		}{file.Name(), info.ModTime()})
+		t = t.Add(time.Second)
 	}
-
-	sort.Slice(bakeFiles, func(i, j int) bool {
-		return bakeFiles[i].modTime.After(bakeFiles[j].modTime)
-	})
-
-	// Check most recent files for active bake (no loaf-complete event)
-	for _, bf := range bakeFiles {
-		filePath := filepath.Join(s.dataDir, bf.name)
-		if !s.isCompleted(filePath) {
-			return filePath
-		}
-	}
-
-	// No active bake found, create new one with current timestamp (including seconds to prevent collisions)
-	date := time.Now().Format("2006-01-02_15-04-05")
-	return filepath.Join(s.dataDir, fmt.Sprintf("bake_%s.jsonl", date))
 }
 
 // isCompleted checks if a bake file ENDS with a loaf-complete event (no events after)
 func (s *Storage) isCompleted(filePath string) bool {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return false
-	}
-	defer f.Close()
-
-	var events []models.Event
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		var event models.Event
-		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
-			continue
-		}
-		events = append(events, event)
-	}
-
-	// File is completed only if it ends with loaf-complete (no events after)
-	if len(events) == 0 {
-		return false
-	}
-
-	lastEvent := events[len(events)-1]
-	return lastEvent.Event == models.EventLoafComplete
+	entry := s.cache.lookup(filepath.Base(filePath))
+	return entry != nil && entry.completed
 }
 
 // getBakeFile returns the path to a specific bake file by date
@@ -115,25 +126,74 @@ func (s *Storage) getBakeFile(date string) string {
 
 // AppendEvent appends an event to the current bake file
 func (s *Storage) AppendEvent(event *models.Event) error {
+	filePath, err := s.appendEvent(event)
+	if err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpAppend, BakeID: bakeIDFromPath(filePath), Event: event})
+	return nil
+}
+
+// appendEvent writes the event under the storage lock and returns the bake file it was written to
+func (s *Storage) appendEvent(event *models.Event) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.appendEventLocked(event)
+}
 
+// appendEventLocked writes the event; the caller holds the storage lock
+func (s *Storage) appendEventLocked(event *models.Event) (string, error) {
 	filePath := s.getCurrentBakeFile()
+	_, statErr := os.Stat(filePath)
+	created := os.IsNotExist(statErr)
+
+	// Encode before opening so a marshal error leaves the file untouched
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+	data = append(data, '\n')
 
 	// Open file in append mode, create if doesn't exist
-	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to open bake file: %w", err)
+		return "", fmt.Errorf("failed to open bake file: %w", err)
 	}
 	defer f.Close()
 
-	// Encode event as JSON and write
-	encoder := json.NewEncoder(f)
-	if err := encoder.Encode(event); err != nil {
-		return fmt.Errorf("failed to write event: %w", err)
+	// Never append after a line cut short by a crash, or both events would be lost
+	repair, err := s.sync.repairTail(f, s.dataDir)
+	if err != nil {
+		return "", err
+	}
+	if repair != "" {
+		s.repairs.add(IntegrityIssue{File: filepath.Base(filePath), Problem: "repaired: " + repair})
 	}
 
-	return nil
+	// One write per event, so a crash can only cut the final line
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write event: %w", err)
+	}
+	if err := s.sync.syncFile(f); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to close bake file: %w", err)
+	}
+	if created {
+		if err := s.sync.syncDir(s.dataDir); err != nil {
+			return "", err
+		}
+	}
+	// A nil event is written as "null", which reads back as an empty event
+	var written models.Event
+	if event != nil {
+		written = *event
+	}
+	s.cache.appendEvent(filepath.Base(filePath), written)
+
+	return filePath, nil
 }
 
 // ReadCurrentBake reads all events from the current active bake
@@ -144,33 +204,14 @@ func (s *Storage) ReadCurrentBake() (*models.Bake, error) {
 	filePath := s.getCurrentBakeFile()
 
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	entry := s.cache.lookup(filepath.Base(filePath))
+	if entry == nil {
 		return &models.Bake{
 			Date:   time.Now().Format("2006-01-02"),
 			Events: []models.Event{},
 		}, nil
 	}
-
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open bake file: %w", err)
-	}
-	defer f.Close()
-
-	var events []models.Event
-	scanner := bufio.NewScanner(f)
-
-	for scanner.Scan() {
-		var event models.Event
-		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
-			continue
-		}
-		events = append(events, event)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading bake file: %w", err)
-	}
+	events := entry.copyEvents()
 
 	// Find the last loaf-complete event index
 	// If there are events after it, return only those (new bake started in same file)
@@ -186,29 +227,19 @@ func (s *Storage) ReadCurrentBake() (*models.Bake, error) {
 		events = events[lastCompleteIdx+1:]
 	} else if lastCompleteIdx >= 0 && lastCompleteIdx == len(events)-1 {
 		// File ends with loaf-complete, extract assessment but return empty events
-		var assessment *models.Assessment
-		lastEvent := events[len(events)-1]
-		if lastEvent.Data != nil {
-			if assessmentData, ok := lastEvent.Data["assessment"]; ok {
-				assessmentJSON, _ := json.Marshal(assessmentData)
-				var a models.Assessment
-				if json.Unmarshal(assessmentJSON, &a) == nil {
-					assessment = &a
-				}
-			}
-		}
-
 		return &models.Bake{
 			Date:       time.Now().Format("2006-01-02"),
 			Events:     []models.Event{},
-			Assessment: assessment,
+			Assessment: entry.assessment,
 		}, nil
 	}
 
 	// Extract date from first event or use today
 	date := time.Now().Format("2006-01-02")
-	if len(events) > 0 {
+	if lastCompleteIdx >= 0 {
 		date = events[0].Timestamp.Format("2006-01-02")
+	} else if len(events) > 0 {
+		date = entry.start.Format("2006-01-02")
 	}
 
 	// Extract filename without extension
@@ -238,156 +269,391 @@ func (s *Storage) ReadBake(date string) (*models.Bake, error) {
 		}, nil
 	}
 
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open bake file: %w", err)
+	entry := s.cache.lookup(filepath.Base(filePath))
+	if entry == nil {
+		return nil, fmt.Errorf("failed to read bake file: %s", filepath.Base(filePath))
 	}
-	defer f.Close()
 
-	var events []models.Event
-	scanner := bufio.NewScanner(f)
+	// Extract filename without extension
+	filename := strings.TrimSuffix(filepath.Base(filePath), ".jsonl")
 
-	for scanner.Scan() {
-		var event models.Event
-		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
-			// Skip malformed lines
-			continue
-		}
-		events = append(events, event)
+	// The assessment, if any, is on the final loaf-complete event
+	return &models.Bake{
+		Date:       date,
+		Filename:   filename,
+		Events:     entry.copyEvents(),
+		Assessment: entry.assessment,
+	}, nil
+}
+
+// ListBakes returns a list of all bake dates in descending order
+func (s *Storage) ListBakes() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.cache.refresh(); err != nil {
+		return nil, err
 	}
+	dates := s.cache.ids()
+
+	// Sort in descending order (most recent first)
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i] > dates[j]
+	})
+
+	return dates, nil
+}
+
+// HasCurrentBake checks if there's an active (uncompleted) bake
+func (s *Storage) HasCurrentBake() (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// The current bake file never ends with loaf-complete unless no active bake exists
+	entry := s.cache.lookup(filepath.Base(s.getCurrentBakeFile()))
+	return entry != nil && !entry.completed && len(entry.events) > 0, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading bake file: %w", err)
+// GetLastEvent returns the most recent event from the current bake
+func (s *Storage) GetLastEvent() (*models.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry := s.cache.lookup(filepath.Base(s.getCurrentBakeFile()))
+	if entry == nil || entry.completed || entry.lastEvent == nil {
+		return nil, nil
 	}
 
-	// Extract filename without extension
-	filename := strings.TrimSuffix(filepath.Base(filePath), ".jsonl")
+	last := *entry.lastEvent
+	return &last, nil
+}
 
-	bake := &models.Bake{
-		Date:     date,
-		Filename: filename,
-		Events:   events,
+// DeleteBake moves a bake file and its images to a timestamped entry in the trash directory
+func (s *Storage) DeleteBake(date string) error {
+	if err := s.deleteBake(date); err != nil {
+		return err
 	}
 
-	// Check if last event is an assessment (loaf-complete with assessment data)
-	if len(events) > 0 {
-		lastEvent := events[len(events)-1]
-		if lastEvent.Event == models.EventLoafComplete && lastEvent.Data != nil {
-			// Try to extract assessment from data
-			if assessmentData, ok := lastEvent.Data["assessment"]; ok {
-				assessmentJSON, _ := json.Marshal(assessmentData)
-				var assessment models.Assessment
-				if json.Unmarshal(assessmentJSON, &assessment) == nil {
-					bake.Assessment = &assessment
-				}
-			}
-		}
+	s.notify(Change{Op: OpDeleteBake, BakeID: date})
+	return nil
+}
+
+// deleteBake moves the bake file to trash under the storage lock
+func (s *Storage) deleteBake(date string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Get the source file path
+	srcPath := s.getBakeFile(date)
+
+	// Check if file exists
+	if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+		return fmt.Errorf("bake not found: %s", date)
 	}
 
-	return bake, nil
+	// Each deletion gets its own entry, so deleting the same ID twice keeps both
+	trashID := newTrashID(date)
+	entryDir := trashEntryDir(s.dataDir, trashID)
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+
+	// Move file to trash
+	if err := os.Rename(srcPath, filepath.Join(entryDir, filepath.Base(srcPath))); err != nil {
+		return fmt.Errorf("failed to move bake to trash: %w", err)
+	}
+	s.cache.remove(filepath.Base(srcPath))
+
+	if err := s.sync.moveImagesToTrash(s.dataDir, date, trashID); err != nil {
+		return err
+	}
+	if err := s.sync.syncDir(entryDir); err != nil {
+		return err
+	}
+	return s.sync.syncDir(s.dataDir)
 }
 
-// ListBakes returns a list of all bake dates in descending order
-func (s *Storage) ListBakes() ([]string, error) {
+// trashFile returns the bake file of a trash entry; entries trashed before
+// timestamped IDs are plain files in the trash directory
+func (s *Storage) trashFile(trashID string) string {
+	bakeID, _, timestamped := splitTrashID(trashID)
+	if !timestamped {
+		return filepath.Join(s.dataDir, TrashDir, fmt.Sprintf("bake_%s.jsonl", bakeID))
+	}
+	return filepath.Join(trashEntryDir(s.dataDir, trashID), fmt.Sprintf("bake_%s.jsonl", bakeID))
+}
+
+// ListTrash returns deleted bakes, most recently deleted first
+func (s *Storage) ListTrash() ([]TrashEntry, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	files, err := os.ReadDir(s.dataDir)
+	files, err := os.ReadDir(filepath.Join(s.dataDir, TrashDir))
+	if os.IsNotExist(err) {
+		return []TrashEntry{}, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to read data directory: %w", err)
+		return nil, fmt.Errorf("failed to read trash directory: %w", err)
 	}
 
-	var dates []string
+	entries := []TrashEntry{}
 	for _, file := range files {
-		if file.IsDir() {
+		name := file.Name()
+		if !strings.HasPrefix(name, "bake_") {
 			continue
 		}
 
-		name := file.Name()
-		if strings.HasPrefix(name, "bake_") && strings.HasSuffix(name, ".jsonl") {
-			// Extract date from filename: bake_2025-10-07.jsonl -> 2025-10-07
-			date := strings.TrimSuffix(strings.TrimPrefix(name, "bake_"), ".jsonl")
-			dates = append(dates, date)
+		var trashID string
+		switch {
+		case file.IsDir() && strings.Contains(name, "@"):
+			trashID = strings.TrimPrefix(name, "bake_")
+		case !file.IsDir() && isBakeFile(name):
+			trashID = bakeIDFromPath(name)
+		default:
+			continue
+		}
+
+		filePath := s.trashFile(trashID)
+		info, err := os.Stat(filePath)
+		if err != nil {
+			continue
+		}
+
+		bakeID, deletedAt, timestamped := splitTrashID(trashID)
+		if !timestamped {
+			deletedAt = info.ModTime()
 		}
+
+		events, _, _, _ := readEventsFile(filePath)
+		entries = append(entries, TrashEntry{
+			ID:        trashID,
+			BakeID:    bakeID,
+			DeletedAt: deletedAt,
+			Events:    len(events),
+			Images:    countImages(s.dataDir, trashID),
+		})
 	}
 
-	// Sort in descending order (most recent first)
-	sort.Slice(dates, func(i, j int) bool {
-		return dates[i] > dates[j]
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
 	})
+	return entries, nil
+}
 
-	return dates, nil
+// RestoreBake moves a trashed bake and its images back. It fails if a bake
+// with the same ID exists. Returns the restored bake ID.
+func (s *Storage) RestoreBake(trashID string) (string, error) {
+	bakeID, err := s.restoreBake(trashID)
+	if err != nil {
+		return "", err
+	}
+
+	s.notify(Change{Op: OpRestore, BakeID: bakeID})
+	return bakeID, nil
 }
 
-// HasCurrentBake checks if there's an active (uncompleted) bake
-func (s *Storage) HasCurrentBake() (bool, error) {
-	filePath := s.getCurrentBakeFile()
+// restoreBake moves the trash entry back under the storage lock
+func (s *Storage) restoreBake(trashID string) (string, error) {
+	if err := validTrashID(trashID); err != nil {
+		return "", err
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return false, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bakeID, _, timestamped := splitTrashID(trashID)
+	srcPath := s.trashFile(trashID)
+	if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s", ErrTrashNotFound, trashID)
 	}
 
-	// Check if it has events and isn't completed
-	bake, err := s.ReadCurrentBake()
-	if err != nil {
-		return false, err
+	dstPath := s.getBakeFile(bakeID)
+	if _, err := os.Stat(dstPath); err == nil {
+		return "", fmt.Errorf("%w: %s", ErrBakeExists, bakeID)
 	}
 
-	if len(bake.Events) == 0 {
-		return false, nil
+	if err := s.sync.restoreImages(s.dataDir, trashID, bakeID); err != nil {
+		return "", err
+	}
+	// Rename keeps the file's modification time, so a finished bake returns to history
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return "", fmt.Errorf("failed to restore bake: %w", err)
+	}
+	if timestamped {
+		os.RemoveAll(trashEntryDir(s.dataDir, trashID))
 	}
+	s.cache.lookup(filepath.Base(dstPath))
 
-	// Check if the bake is completed
-	for _, event := range bake.Events {
-		if event.Event == models.EventLoafComplete {
-			return false, nil
+	return bakeID, s.sync.syncDir(s.dataDir)
+}
+
+// PurgeTrash permanently removes trash entries deleted more than olderThan ago
+// and returns their IDs
+func (s *Storage) PurgeTrash(olderThan time.Duration) ([]string, error) {
+	entries, err := s.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	purged := []string{}
+	for _, entry := range entries {
+		if entry.DeletedAt.After(cutoff) {
+			continue
 		}
+
+		var err error
+		if _, _, timestamped := splitTrashID(entry.ID); timestamped {
+			err = os.RemoveAll(trashEntryDir(s.dataDir, entry.ID))
+		} else {
+			err = os.Remove(s.trashFile(entry.ID))
+		}
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge %s: %w", entry.ID, err)
+		}
+		purged = append(purged, entry.ID)
 	}
 
-	return true, nil
+	return purged, s.sync.syncDir(filepath.Join(s.dataDir, TrashDir))
 }
 
-// GetLastEvent returns the most recent event from the current bake
-func (s *Storage) GetLastEvent() (*models.Event, error) {
-	bake, err := s.ReadCurrentBake()
+// ImportBake writes a finished bake to a new file named after its first event.
+// Imported bakes always end with loaf-complete (one is added if missing) so they
+// never become the active bake; the assessment, if any, is stored on that event.
+// Returns the new bake ID, or an error if a bake with that ID exists.
+func (s *Storage) ImportBake(bake *models.Bake) (string, error) {
+	id, events, err := importEvents(bake)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	if len(bake.Events) == 0 {
-		return nil, nil
+	if err := s.writeNewBake(id, events); err != nil {
+		return "", err
 	}
 
-	return &bake.Events[len(bake.Events)-1], nil
+	s.notify(Change{Op: OpImport, BakeID: id})
+	return id, nil
 }
 
-// DeleteBake moves a bake file to the trash directory
-func (s *Storage) DeleteBake(date string) error {
+// WriteBake creates a bake file with exactly the given ID and events
+func (s *Storage) WriteBake(id string, events []models.Event) error {
+	if len(events) == 0 {
+		return fmt.Errorf("bake has no events")
+	}
+
+	if err := s.writeNewBake(id, events); err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpImport, BakeID: id})
+	return nil
+}
+
+// ReplaceBake creates a bake file or atomically overwrites it with exactly the given events
+func (s *Storage) ReplaceBake(id string, events []models.Event) error {
+	if len(events) == 0 {
+		return fmt.Errorf("bake has no events")
+	}
+
+	if err := s.replaceBake(id, events); err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpReplace, BakeID: id})
+	return nil
+}
+
+// replaceBake rewrites a bake file under the storage lock
+func (s *Storage) replaceBake(id string, events []models.Event) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.replaceBakeLocked(id, events)
+}
 
-	// Get the source file path
-	srcPath := s.getBakeFile(date)
+// UpdateBake rewrites a bake with what update returns for its events
+func (s *Storage) UpdateBake(id string, update func([]models.Event) []models.Event) (bool, error) {
+	changed, err := s.updateBake(id, update)
+	if err != nil || !changed {
+		return false, err
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(srcPath); os.IsNotExist(err) {
-		return fmt.Errorf("bake not found: %s", date)
+	s.notify(Change{Op: OpReplace, BakeID: id})
+	return true, nil
+}
+
+// updateBake reads and rewrites a bake file under one hold of the storage lock
+func (s *Storage) updateBake(id string, update func([]models.Event) []models.Event) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filePath := s.getBakeFile(id)
+	var events []models.Event
+	if _, err := os.Stat(filePath); err == nil {
+		entry := s.cache.lookup(filepath.Base(filePath))
+		if entry == nil {
+			return false, fmt.Errorf("failed to read bake file: %s", filepath.Base(filePath))
+		}
+		events = append([]models.Event{}, entry.events...)
 	}
 
-	// Create trash directory if it doesn't exist
-	trashDir := filepath.Join(s.dataDir, "trash")
-	if err := os.MkdirAll(trashDir, 0755); err != nil {
-		return fmt.Errorf("failed to create trash directory: %w", err)
+	updated := update(events)
+	if len(updated) == 0 {
+		return false, nil
+	}
+	if err := s.replaceBakeLocked(id, updated); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// replaceBakeLocked rewrites a bake file; the caller holds the storage lock
+func (s *Storage) replaceBakeLocked(id string, events []models.Event) error {
+	filePath := s.getBakeFile(id)
+	data, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+	if err := s.sync.writeFileAtomic(filePath, data); err != nil {
+		return fmt.Errorf("failed to replace bake file: %w", err)
 	}
 
-	// Destination path in trash
-	dstPath := filepath.Join(trashDir, fmt.Sprintf("bake_%s.jsonl", date))
+	// Date the file by its last event, as for imported bakes
+	last := events[len(events)-1].Timestamp
+	if err := os.Chtimes(filePath, last, last); err != nil {
+		return fmt.Errorf("failed to set bake file time: %w", err)
+	}
+	s.cache.update(filepath.Base(filePath), events)
 
-	// Move file to trash
-	if err := os.Rename(srcPath, dstPath); err != nil {
-		return fmt.Errorf("failed to move bake to trash: %w", err)
+	return nil
+}
+
+// writeNewBake writes events to a new bake file via a temp file under the storage lock
+func (s *Storage) writeNewBake(id string, events []models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filePath := s.getBakeFile(id)
+	if _, err := os.Stat(filePath); err == nil {
+		return fmt.Errorf("%w: %s", ErrBakeExists, id)
+	}
+
+	data, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+	if err := s.sync.writeFileAtomic(filePath, data); err != nil {
+		return fmt.Errorf("failed to create bake file: %w", err)
+	}
+
+	// Date the file by its last event so it sorts with history, not as the newest bake
+	last := events[len(events)-1].Timestamp
+	if err := os.Chtimes(filePath, last, last); err != nil {
+		return fmt.Errorf("failed to set bake file time: %w", err)
 	}
+	s.cache.update(filepath.Base(filePath), events)
 
 	return nil
 }
@@ -418,8 +684,11 @@ func (s *Storage) SaveImage(filename string, data io.Reader) error {
 	if _, err := io.Copy(outFile, data); err != nil {
 		return fmt.Errorf("failed to write image data: %w", err)
 	}
+	if err := s.sync.syncFile(outFile); err != nil {
+		return err
+	}
 
-	return nil
+	return s.sync.syncDir(imageDir)
 }
 
 // GetImagePath returns the full path to an image file for a given bake
@@ -430,85 +699,164 @@ func (s *Storage) GetImagePath(bakeDate, filename string) string {
 
 // DeleteEvent removes an event from the current bake by index and timestamp
 func (s *Storage) DeleteEvent(index int, timestamp string) error {
+	return s.DeleteBakeEvent("", index, timestamp)
+}
+
+// DeleteBakeEvent removes an event from a bake by ID ("" for the current bake), index and timestamp
+func (s *Storage) DeleteBakeEvent(id string, index int, timestamp string) error {
+	bakeFile, deleted, err := s.deleteEvent(id, index, timestamp)
+	if err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpDeleteEvent, BakeID: bakeIDFromPath(bakeFile), Event: deleted})
+	return nil
+}
+
+// deleteEvent rewrites a bake file without the given event under the storage lock.
+// It returns the bake file and the removed event.
+func (s *Storage) deleteEvent(id string, index int, timestamp string) (string, *models.Event, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Get current bake file
 	bakeFile := s.getCurrentBakeFile()
-
-	// Read all events
-	file, err := os.Open(bakeFile)
-	if err != nil {
-		return fmt.Errorf("failed to open bake file: %w", err)
+	if id != "" {
+		bakeFile = s.getBakeFile(id)
 	}
 
-	var events []models.Event
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var event models.Event
-		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
-			file.Close()
-			return fmt.Errorf("failed to parse event: %w", err)
-		}
-		events = append(events, event)
+	// Read all events
+	entry := s.cache.lookup(filepath.Base(bakeFile))
+	if entry == nil {
+		return "", nil, fmt.Errorf("failed to open bake file: %s", filepath.Base(bakeFile))
 	}
-	file.Close()
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading bake file: %w", err)
+	if len(entry.badLines) > 0 {
+		// Rewriting would silently drop the unparseable lines
+		return "", nil, fmt.Errorf("failed to parse event: bake file has %d corrupt lines (run sourdough fsck)", len(entry.badLines))
 	}
+	events := entry.copyEvents()
 
 	// Validate index
 	if index < 0 || index >= len(events) {
-		return fmt.Errorf("invalid event index: %d", index)
+		return "", nil, fmt.Errorf("invalid event index: %d", index)
 	}
 
 	// Verify timestamp matches as extra safety
 	if events[index].Timestamp.Format(time.RFC3339Nano) != timestamp {
-		return fmt.Errorf("timestamp mismatch - event may have changed")
+		return "", nil, fmt.Errorf("timestamp mismatch - event may have changed")
 	}
 
 	// Remove the event at the specified index
+	deleted := events[index]
 	events = append(events[:index], events[index+1:]...)
 
-	// Write back all events
-	tempFile := bakeFile + ".tmp"
-	f, err := os.Create(tempFile)
+	// Atomically replace the file with all remaining events
+	data, err := encodeEvents(events)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return "", nil, err
+	}
+	if err := s.sync.writeFileAtomic(bakeFile, data); err != nil {
+		return "", nil, fmt.Errorf("failed to replace bake file: %w", err)
 	}
+	s.cache.update(filepath.Base(bakeFile), events)
 
-	for _, event := range events {
-		data, err := json.Marshal(event)
-		if err != nil {
-			f.Close()
-			os.Remove(tempFile)
-			return fmt.Errorf("failed to marshal event: %w", err)
-		}
+	return bakeFile, &deleted, nil
+}
 
-		if _, err := f.Write(data); err != nil {
-			f.Close()
-			os.Remove(tempFile)
-			return fmt.Errorf("failed to write event: %w", err)
-		}
+// IntegrityIssues reports corrupt or truncated lines in bake files and any
+// repairs made since the store was opened
+func (s *Storage) IntegrityIssues() ([]IntegrityIssue, error) {
+	if err := s.cache.refresh(); err != nil {
+		return nil, err
+	}
+	return append(s.repairs.list(), s.cache.issues()...), nil
+}
 
-		if _, err := f.Write([]byte("\n")); err != nil {
-			f.Close()
-			os.Remove(tempFile)
-			return fmt.Errorf("failed to write newline: %w", err)
-		}
+// InsertEvent puts an event back into the current bake at index, e.g. to undo a delete
+func (s *Storage) InsertEvent(index int, event *models.Event) error {
+	bakeFile, err := s.insertEvent(index, event)
+	if err != nil {
+		return err
 	}
 
-	if err := f.Close(); err != nil {
-		os.Remove(tempFile)
-		return fmt.Errorf("failed to close temp file: %w", err)
+	s.notify(Change{Op: OpInsertEvent, BakeID: bakeIDFromPath(bakeFile), Event: event})
+	return nil
+}
+
+// InsertEventByTime adds an event to the current bake in time order
+func (s *Storage) InsertEventByTime(event *models.Event) (string, error) {
+	bakeFile, err := s.insertEventByTime(event)
+	if err != nil {
+		return "", err
 	}
 
-	// Atomically replace original file with temp file
-	if err := os.Rename(tempFile, bakeFile); err != nil {
-		os.Remove(tempFile)
-		return fmt.Errorf("failed to replace bake file: %w", err)
+	// A newly logged event is announced as appended wherever it went
+	id := bakeIDFromPath(bakeFile)
+	s.notify(Change{Op: OpAppend, BakeID: id, Event: event})
+	return id, nil
+}
+
+// insertEventByTime finds the event's place and writes it under one hold of
+// the storage lock. Appending stays a single write; anything earlier rewrites the file.
+func (s *Storage) insertEventByTime(event *models.Event) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bakeFile := s.getCurrentBakeFile()
+	var events []models.Event
+	entry := s.cache.lookup(filepath.Base(bakeFile))
+	if entry != nil {
+		events = entry.copyEvents()
+	}
+	index := eventIndex(events, event.Timestamp)
+	numberFolds(events, index, event)
+	if index == len(events) {
+		return s.appendEventLocked(event)
+	}
+	if len(entry.badLines) > 0 {
+		return "", fmt.Errorf("failed to parse event: bake file has %d corrupt lines (run sourdough fsck)", len(entry.badLines))
 	}
 
-	return nil
+	events = append(events[:index], append([]models.Event{*event}, events[index:]...)...)
+	data, err := encodeEvents(events)
+	if err != nil {
+		return "", err
+	}
+	if err := s.sync.writeFileAtomic(bakeFile, data); err != nil {
+		return "", fmt.Errorf("failed to replace bake file: %w", err)
+	}
+	s.cache.update(filepath.Base(bakeFile), events)
+
+	return bakeFile, nil
+}
+
+// insertEvent rewrites the current bake file with the event added under the storage lock
+func (s *Storage) insertEvent(index int, event *models.Event) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bakeFile := s.getCurrentBakeFile()
+	entry := s.cache.lookup(filepath.Base(bakeFile))
+	if entry == nil {
+		return "", fmt.Errorf("no current bake")
+	}
+	if len(entry.badLines) > 0 {
+		return "", fmt.Errorf("failed to parse event: bake file has %d corrupt lines (run sourdough fsck)", len(entry.badLines))
+	}
+
+	events := entry.copyEvents()
+	if index < 0 || index > len(events) {
+		return "", fmt.Errorf("invalid event index: %d", index)
+	}
+	events = append(events[:index], append([]models.Event{*event}, events[index:]...)...)
+
+	data, err := encodeEvents(events)
+	if err != nil {
+		return "", err
+	}
+	if err := s.sync.writeFileAtomic(bakeFile, data); err != nil {
+		return "", fmt.Errorf("failed to replace bake file: %w", err)
+	}
+	s.cache.update(filepath.Base(bakeFile), events)
+
+	return bakeFile, nil
 }
@@ -0,0 +1,54 @@
+package storage
+
+import "fmt"
+
+// MigrateReport summarizes a copy between two stores
+type MigrateReport struct {
+	Copied  []string `json:"copied"`
+	Skipped []string `json:"skipped"` // IDs already present in the destination
+}
+
+// Migrate copies every bake from src to dst, keeping bake IDs. Bakes that already
+// exist in dst are skipped, so an interrupted migration can simply be rerun.
+// Images are not copied; both backends keep them in the data directory.
+func Migrate(src, dst Store) (*MigrateReport, error) {
+	ids, err := src.ListBakes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source bakes: %w", err)
+	}
+
+	existing, err := dst.ListBakes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list destination bakes: %w", err)
+	}
+	have := make(map[string]bool, len(existing))
+	for _, id := range existing {
+		have[id] = true
+	}
+
+	report := &MigrateReport{}
+
+	// Oldest first, so the most recent bake is also the most recently written
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		if have[id] {
+			report.Skipped = append(report.Skipped, id)
+			continue
+		}
+
+		bake, err := src.ReadBake(id)
+		if err != nil {
+			return report, fmt.Errorf("failed to read bake %s: %w", id, err)
+		}
+		if len(bake.Events) == 0 {
+			continue
+		}
+
+		if err := dst.WriteBake(id, bake.Events); err != nil {
+			return report, fmt.Errorf("failed to write bake %s: %w", id, err)
+		}
+		report.Copied = append(report.Copied, id)
+	}
+
+	return report, nil
+}
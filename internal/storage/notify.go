@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// ChangeOp identifies the kind of mutation applied to a bake
+type ChangeOp string
+
+const (
+	OpAppend      ChangeOp = "append"
+	OpDeleteEvent ChangeOp = "delete-event"
+	OpInsertEvent ChangeOp = "insert-event"
+	OpDeleteBake  ChangeOp = "delete-bake"
+	OpImport      ChangeOp = "import"
+	OpRestore     ChangeOp = "restore"
+	OpReplace     ChangeOp = "replace"
+)
+
+// Change describes a mutation that was successfully written to the data directory
+type Change struct {
+	Op     ChangeOp      `json:"op"`
+	BakeID string        `json:"bake_id"`         // Bake file name without "bake_" prefix and extension
+	Event  *models.Event `json:"event,omitempty"` // Appended, inserted or deleted event (nil for bake-level changes)
+}
+
+// notifier fans out changes to subscribers; it is embedded by each Store implementation
+type notifier struct {
+	listeners   []func(Change)
+	listenersMu sync.RWMutex
+}
+
+// Subscribe registers a listener that is called after every successful mutation.
+// Listeners run synchronously after the storage lock is released, so they may
+// read from storage but should return quickly.
+func (n *notifier) Subscribe(fn func(Change)) {
+	n.listenersMu.Lock()
+	defer n.listenersMu.Unlock()
+	n.listeners = append(n.listeners, fn)
+}
+
+// notify delivers a change to all registered listeners
+func (n *notifier) notify(change Change) {
+	n.listenersMu.RLock()
+	listeners := n.listeners
+	n.listenersMu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(change)
+	}
+}
+
+// bakeIDFromPath extracts the bake ID from a bake file path
+func bakeIDFromPath(filePath string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(filePath), "bake_"), ".jsonl")
+}
@@ -0,0 +1,992 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver, registered as "sqlite"
+)
+
+// SQLiteFile is the database file name inside the data directory
+const SQLiteFile = "sourdough.db"
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how many have run
+var sqliteMigrations = []string{
+	`CREATE TABLE bakes (
+		id         TEXT PRIMARY KEY,
+		updated_at INTEGER NOT NULL,
+		completed  INTEGER NOT NULL DEFAULT 0,
+		deleted_at INTEGER
+	);
+	CREATE TABLE events (
+		bake_id   TEXT NOT NULL REFERENCES bakes(id) ON DELETE CASCADE,
+		seq       INTEGER NOT NULL,
+		timestamp TEXT NOT NULL,
+		event     TEXT NOT NULL,
+		body      TEXT NOT NULL,
+		PRIMARY KEY (bake_id, seq)
+	);
+	CREATE INDEX idx_bakes_active ON bakes(deleted_at, completed, updated_at);
+	CREATE INDEX idx_events_event ON events(event);
+	CREATE INDEX idx_events_timestamp ON events(timestamp);`,
+
+	// Trashed bakes move to a timestamped ID (bake@stamp) so the same ID can be deleted twice
+	`INSERT INTO bakes (id, updated_at, completed, deleted_at)
+		SELECT id || '@' || strftime('%Y%m%d-%H%M%S', deleted_at / 1000000000, 'unixepoch') || '.000000000',
+			updated_at, completed, deleted_at
+		FROM bakes WHERE deleted_at IS NOT NULL AND instr(id, '@') = 0;
+	UPDATE events SET bake_id = (
+		SELECT b.id FROM bakes b
+		WHERE b.deleted_at IS NOT NULL AND substr(b.id, 1, length(events.bake_id) + 1) = events.bake_id || '@')
+		WHERE bake_id IN (SELECT id FROM bakes WHERE deleted_at IS NOT NULL AND instr(id, '@') = 0);
+	DELETE FROM bakes WHERE deleted_at IS NOT NULL AND instr(id, '@') = 0;`,
+}
+
+// SQLiteStore stores bakes in an embedded SQLite database. Images stay on disk
+// in the same layout as the JSONL backend so both can share a data directory.
+// Views from ForBaker share everything but which bake is active.
+type SQLiteStore struct {
+	*sqliteState
+
+	baker string // Whose active bake this view uses; "" for the household's
+}
+
+// sqliteState is shared by a SQLiteStore and its per-baker views
+type sqliteState struct {
+	notifier
+
+	dataDir string
+	db      *sql.DB
+	mu      sync.RWMutex
+}
+
+// NewSQLite opens (creating if needed) the SQLite database in dataDir
+func NewSQLite(dataDir string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	dsn := "file:" + filepath.Join(dataDir, SQLiteFile) +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids busy errors between our own goroutines
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{sqliteState: &sqliteState{dataDir: dataDir, db: db}}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ForBaker returns a view of the store whose active bake is baker's own
+func (s *SQLiteStore) ForBaker(baker string) Store {
+	return &SQLiteStore{sqliteState: s.sqliteState, baker: baker}
+}
+
+// Close closes the underlying database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Snapshot writes a consistent copy of the database to path, which must not exist
+func (s *SQLiteStore) Snapshot(path string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return nil
+}
+
+// migrate brings the schema up to date
+func (s *SQLiteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration: %w", err)
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// currentBakeID returns the ID of the active bake, or a new ID from the current time
+// if there is none. The boolean reports whether the bake already exists. A
+// baker's view only considers bakes whose first event with a user is theirs.
+func (s *SQLiteStore) currentBakeID() (string, bool, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT id FROM bakes b
+		WHERE deleted_at IS NULL AND completed = 0
+		AND (?1 = '' OR COALESCE((SELECT json_extract(e.body, '$.user') FROM events e
+			WHERE e.bake_id = b.id AND COALESCE(json_extract(e.body, '$.user'), '') <> ''
+			ORDER BY e.seq LIMIT 1), '') = ?1)
+		ORDER BY updated_at DESC, id DESC LIMIT 1`, s.baker).Scan(&id)
+	if err == sql.ErrNoRows {
+		// Skip a second if another baker's active bake already has this one
+		for t := time.Now(); ; t = t.Add(time.Second) {
+			id = t.Format("2006-01-02_15-04-05")
+			var completed bool
+			err := s.db.QueryRow(`SELECT completed FROM bakes WHERE id = ? AND deleted_at IS NULL`, id).Scan(&completed)
+			if err == sql.ErrNoRows {
+				return id, false, nil
+			}
+			if err != nil {
+				return "", false, fmt.Errorf("failed to look up bake: %w", err)
+			}
+			if completed {
+				return id, true, nil
+			}
+		}
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to find current bake: %w", err)
+	}
+	return id, true, nil
+}
+
+// readEvents returns all events of a bake in order
+func (s *SQLiteStore) readEvents(id string) ([]models.Event, error) {
+	rows, err := s.db.Query(`SELECT body FROM events WHERE bake_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		var event models.Event
+		if err := json.Unmarshal([]byte(body), &event); err != nil {
+			// Skip malformed rows, as the JSONL backend skips malformed lines
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading events: %w", err)
+	}
+
+	return events, nil
+}
+
+// insertEvent adds an event at the end of a bake within a transaction
+func insertEvent(tx *sql.Tx, id string, event *models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO events (bake_id, seq, timestamp, event, body)
+		VALUES (?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM events WHERE bake_id = ?), ?, ?, ?)`,
+		id, id, event.Timestamp.Format(time.RFC3339Nano), string(event.Event), string(body))
+	if err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// AppendEvent appends an event to the current bake
+func (s *SQLiteStore) AppendEvent(event *models.Event) error {
+	id, err := s.appendEvent(event)
+	if err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpAppend, BakeID: id, Event: event})
+	return nil
+}
+
+// appendEvent writes the event under the storage lock and returns the bake it was written to
+func (s *SQLiteStore) appendEvent(event *models.Event) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendEventLocked(event)
+}
+
+// appendEventLocked writes the event; the caller holds the storage lock
+func (s *SQLiteStore) appendEventLocked(event *models.Event) (string, error) {
+	id, _, err := s.currentBakeID()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	completed := event.Event == models.EventLoafComplete
+	_, err = tx.Exec(`INSERT INTO bakes (id, updated_at, completed) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, completed = excluded.completed`,
+		id, time.Now().UnixNano(), completed)
+	if err != nil {
+		return "", fmt.Errorf("failed to update bake: %w", err)
+	}
+
+	if err := insertEvent(tx, id, event); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit event: %w", err)
+	}
+	return id, nil
+}
+
+// ReadCurrentBake reads all events from the current active bake
+func (s *SQLiteStore) ReadCurrentBake() (*models.Bake, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists, err := s.currentBakeID()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return &models.Bake{
+			Date:   time.Now().Format("2006-01-02"),
+			Events: []models.Event{},
+		}, nil
+	}
+
+	events, err := s.readEvents(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Same rules as the JSONL backend: only events after the last loaf-complete belong to the active bake
+	lastCompleteIdx := -1
+	for i, event := range events {
+		if event.Event == models.EventLoafComplete {
+			lastCompleteIdx = i
+		}
+	}
+
+	if lastCompleteIdx >= 0 && lastCompleteIdx < len(events)-1 {
+		events = events[lastCompleteIdx+1:]
+	} else if lastCompleteIdx >= 0 && lastCompleteIdx == len(events)-1 {
+		return &models.Bake{
+			Date:       time.Now().Format("2006-01-02"),
+			Events:     []models.Event{},
+			Assessment: assessmentFromEvent(events[len(events)-1]),
+		}, nil
+	}
+
+	date := time.Now().Format("2006-01-02")
+	if len(events) > 0 {
+		date = events[0].Timestamp.Format("2006-01-02")
+	}
+
+	return &models.Bake{
+		Date:     date,
+		Filename: "bake_" + id,
+		Events:   events,
+	}, nil
+}
+
+// ReadBake reads all events from a specific bake by ID
+func (s *SQLiteStore) ReadBake(date string) (*models.Bake, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM bakes WHERE id = ? AND deleted_at IS NULL)`, date).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up bake: %w", err)
+	}
+	if !exists {
+		return &models.Bake{
+			Date:   date,
+			Events: []models.Event{},
+		}, nil
+	}
+
+	events, err := s.readEvents(date)
+	if err != nil {
+		return nil, err
+	}
+
+	bake := &models.Bake{
+		Date:     date,
+		Filename: "bake_" + date,
+		Events:   events,
+	}
+	if len(events) > 0 {
+		bake.Assessment = assessmentFromEvent(events[len(events)-1])
+	}
+
+	return bake, nil
+}
+
+// ListBakes returns a list of all bake IDs in descending order
+func (s *SQLiteStore) ListBakes() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT id FROM bakes WHERE deleted_at IS NULL ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bakes: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan bake: %w", err)
+		}
+		dates = append(dates, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing bakes: %w", err)
+	}
+
+	return dates, nil
+}
+
+// HasCurrentBake checks if there's an active (uncompleted) bake
+func (s *SQLiteStore) HasCurrentBake() (bool, error) {
+	bake, err := s.ReadCurrentBake()
+	if err != nil {
+		return false, err
+	}
+	return len(bake.Events) > 0, nil
+}
+
+// GetLastEvent returns the most recent event from the current bake
+func (s *SQLiteStore) GetLastEvent() (*models.Event, error) {
+	bake, err := s.ReadCurrentBake()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bake.Events) == 0 {
+		return nil, nil
+	}
+
+	return &bake.Events[len(bake.Events)-1], nil
+}
+
+// DeleteBake moves a bake to a timestamped trash ID and its images to the trash directory
+func (s *SQLiteStore) DeleteBake(date string) error {
+	if err := s.deleteBake(date); err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpDeleteBake, BakeID: date})
+	return nil
+}
+
+// deleteBake renames the bake to its trash ID under the storage lock
+func (s *SQLiteStore) deleteBake(date string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trashID := newTrashID(date)
+	if err := s.renameBake(date, trashID, sql.NullInt64{Int64: time.Now().UnixNano(), Valid: true}); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("bake not found: %s", date)
+		}
+		return err
+	}
+
+	return SyncAlways.moveImagesToTrash(s.dataDir, date, trashID)
+}
+
+// renameBake moves a bake and its events to a new ID and sets deleted_at.
+// Returns sql.ErrNoRows if from doesn't exist.
+func (s *SQLiteStore) renameBake(from, to string, deletedAt sql.NullInt64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO bakes (id, updated_at, completed, deleted_at)
+		SELECT ?, updated_at, completed, ? FROM bakes WHERE id = ? AND (deleted_at IS NULL) = ?`,
+		to, deletedAt, from, deletedAt.Valid)
+	if err != nil {
+		return fmt.Errorf("failed to move bake: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`UPDATE events SET bake_id = ? WHERE bake_id = ?`, to, from); err != nil {
+		return fmt.Errorf("failed to move events: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM bakes WHERE id = ?`, from); err != nil {
+		return fmt.Errorf("failed to move bake: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit move: %w", err)
+	}
+	return nil
+}
+
+// ListTrash returns deleted bakes, most recently deleted first
+func (s *SQLiteStore) ListTrash() ([]TrashEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT id, deleted_at, (SELECT COUNT(*) FROM events WHERE bake_id = bakes.id)
+		FROM bakes WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []TrashEntry{}
+	for rows.Next() {
+		var entry TrashEntry
+		var deletedAt int64
+		if err := rows.Scan(&entry.ID, &deletedAt, &entry.Events); err != nil {
+			return nil, fmt.Errorf("failed to scan trash entry: %w", err)
+		}
+		entry.BakeID, _, _ = splitTrashID(entry.ID)
+		entry.DeletedAt = time.Unix(0, deletedAt)
+		entry.Images = countImages(s.dataDir, entry.ID)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing trash: %w", err)
+	}
+
+	return entries, nil
+}
+
+// RestoreBake moves a trashed bake and its images back. It fails if a bake
+// with the same ID exists. Returns the restored bake ID.
+func (s *SQLiteStore) RestoreBake(trashID string) (string, error) {
+	bakeID, err := s.restoreBake(trashID)
+	if err != nil {
+		return "", err
+	}
+
+	s.notify(Change{Op: OpRestore, BakeID: bakeID})
+	return bakeID, nil
+}
+
+// restoreBake renames the trash entry back to its bake ID under the storage lock
+func (s *SQLiteStore) restoreBake(trashID string) (string, error) {
+	if err := validTrashID(trashID); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bakeID, _, _ := splitTrashID(trashID)
+
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM bakes WHERE id = ?)`, bakeID).Scan(&exists); err != nil {
+		return "", fmt.Errorf("failed to look up bake: %w", err)
+	}
+	if exists {
+		return "", fmt.Errorf("%w: %s", ErrBakeExists, bakeID)
+	}
+
+	if err := SyncAlways.restoreImages(s.dataDir, trashID, bakeID); err != nil {
+		return "", err
+	}
+	if err := s.renameBake(trashID, bakeID, sql.NullInt64{}); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w: %s", ErrTrashNotFound, trashID)
+		}
+		return "", err
+	}
+	os.RemoveAll(trashEntryDir(s.dataDir, trashID))
+
+	return bakeID, nil
+}
+
+// PurgeTrash permanently removes trash entries deleted more than olderThan ago
+// and returns their IDs
+func (s *SQLiteStore) PurgeTrash(olderThan time.Duration) ([]string, error) {
+	entries, err := s.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	purged := []string{}
+	for _, entry := range entries {
+		if entry.DeletedAt.After(cutoff) {
+			continue
+		}
+		// Events go with the bake via ON DELETE CASCADE
+		if _, err := s.db.Exec(`DELETE FROM bakes WHERE id = ?`, entry.ID); err != nil {
+			return purged, fmt.Errorf("failed to purge %s: %w", entry.ID, err)
+		}
+		if err := os.RemoveAll(trashEntryDir(s.dataDir, entry.ID)); err != nil {
+			return purged, fmt.Errorf("failed to purge images of %s: %w", entry.ID, err)
+		}
+		purged = append(purged, entry.ID)
+	}
+
+	return purged, nil
+}
+
+// ImportBake writes a finished bake under an ID derived from its first event.
+// See Storage.ImportBake for the rules applied to the events.
+func (s *SQLiteStore) ImportBake(bake *models.Bake) (string, error) {
+	id, events, err := importEvents(bake)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.writeNewBake(id, events); err != nil {
+		return "", err
+	}
+
+	s.notify(Change{Op: OpImport, BakeID: id})
+	return id, nil
+}
+
+// WriteBake creates a bake with exactly the given ID and events
+func (s *SQLiteStore) WriteBake(id string, events []models.Event) error {
+	if len(events) == 0 {
+		return fmt.Errorf("bake has no events")
+	}
+
+	if err := s.writeNewBake(id, events); err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpImport, BakeID: id})
+	return nil
+}
+
+// writeNewBake inserts a bake and its events in one transaction under the storage lock
+func (s *SQLiteStore) writeNewBake(id string, events []models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM bakes WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up bake: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrBakeExists, id)
+	}
+
+	// Date the bake by its last event so it sorts with history, not as the newest bake
+	last := events[len(events)-1]
+	_, err = tx.Exec(`INSERT INTO bakes (id, updated_at, completed) VALUES (?, ?, ?)`,
+		id, last.Timestamp.UnixNano(), last.Event == models.EventLoafComplete)
+	if err != nil {
+		return fmt.Errorf("failed to create bake: %w", err)
+	}
+
+	for i := range events {
+		if err := insertEvent(tx, id, &events[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit bake: %w", err)
+	}
+	return nil
+}
+
+// ReplaceBake creates a bake or overwrites all its events in one transaction
+func (s *SQLiteStore) ReplaceBake(id string, events []models.Event) error {
+	if len(events) == 0 {
+		return fmt.Errorf("bake has no events")
+	}
+
+	if err := s.replaceBake(id, events); err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpReplace, BakeID: id})
+	return nil
+}
+
+// replaceBake rewrites a bake's events under the storage lock
+func (s *SQLiteStore) replaceBake(id string, events []models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replaceBakeLocked(id, events)
+}
+
+// UpdateBake rewrites a bake with what update returns for its events
+func (s *SQLiteStore) UpdateBake(id string, update func([]models.Event) []models.Event) (bool, error) {
+	changed, err := s.updateBake(id, update)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	s.notify(Change{Op: OpReplace, BakeID: id})
+	return true, nil
+}
+
+// updateBake reads and rewrites a bake under one hold of the storage lock
+func (s *SQLiteStore) updateBake(id string, update func([]models.Event) []models.Event) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM bakes WHERE id = ? AND deleted_at IS NULL)`, id).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up bake: %w", err)
+	}
+	var events []models.Event
+	if exists {
+		var err error
+		if events, err = s.readEvents(id); err != nil {
+			return false, err
+		}
+	}
+
+	updated := update(events)
+	if len(updated) == 0 {
+		return false, nil
+	}
+	if err := s.replaceBakeLocked(id, updated); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// replaceBakeLocked rewrites a bake's events; the caller holds the storage lock
+func (s *SQLiteStore) replaceBakeLocked(id string, events []models.Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	last := events[len(events)-1]
+	_, err = tx.Exec(`INSERT INTO bakes (id, updated_at, completed) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, completed = excluded.completed`,
+		id, last.Timestamp.UnixNano(), last.Event == models.EventLoafComplete)
+	if err != nil {
+		return fmt.Errorf("failed to write bake: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM events WHERE bake_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear events: %w", err)
+	}
+	for i := range events {
+		if err := insertEvent(tx, id, &events[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit bake: %w", err)
+	}
+	return nil
+}
+
+// SaveImage saves an uploaded image file for the current bake
+func (s *SQLiteStore) SaveImage(filename string, data io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _, err := s.currentBakeID()
+	if err != nil {
+		return err
+	}
+
+	imageDir := filepath.Join(s.dataDir, "images", "bake_"+id)
+	if err := os.MkdirAll(imageDir, 0755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	outFile, err := os.Create(filepath.Join(imageDir, filename))
+	if err != nil {
+		return fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer outFile.Close()
+
+	if _, err := io.Copy(outFile, data); err != nil {
+		return fmt.Errorf("failed to write image data: %w", err)
+	}
+
+	return nil
+}
+
+// GetImagePath returns the full path to an image file for a given bake
+func (s *SQLiteStore) GetImagePath(bakeDate, filename string) string {
+	return filepath.Join(s.dataDir, "images", "bake_"+bakeDate, filename)
+}
+
+// DeleteEvent removes an event from the current bake by index and timestamp
+func (s *SQLiteStore) DeleteEvent(index int, timestamp string) error {
+	return s.DeleteBakeEvent("", index, timestamp)
+}
+
+// DeleteBakeEvent removes an event from a bake by ID ("" for the current bake), index and timestamp
+func (s *SQLiteStore) DeleteBakeEvent(id string, index int, timestamp string) error {
+	id, deleted, err := s.deleteEvent(id, index, timestamp)
+	if err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpDeleteEvent, BakeID: id, Event: deleted})
+	return nil
+}
+
+// deleteEvent removes the event at index (counted over the whole bake) under the storage lock.
+// It returns the bake ID and the removed event.
+func (s *SQLiteStore) deleteEvent(id string, index int, timestamp string) (string, *models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == "" {
+		current, exists, err := s.currentBakeID()
+		if err != nil {
+			return "", nil, err
+		}
+		if !exists {
+			return "", nil, fmt.Errorf("no current bake")
+		}
+		id = current
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var seq int64
+	var body string
+	err = tx.QueryRow(`SELECT seq, body FROM events WHERE bake_id = ? ORDER BY seq LIMIT 1 OFFSET ?`, id, index).Scan(&seq, &body)
+	if index < 0 || err == sql.ErrNoRows {
+		return "", nil, fmt.Errorf("invalid event index: %d", index)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read event: %w", err)
+	}
+
+	var deleted models.Event
+	if err := json.Unmarshal([]byte(body), &deleted); err != nil {
+		return "", nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+
+	// Verify timestamp matches as extra safety
+	if deleted.Timestamp.Format(time.RFC3339Nano) != timestamp {
+		return "", nil, fmt.Errorf("timestamp mismatch - event may have changed")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM events WHERE bake_id = ? AND seq = ?`, id, seq); err != nil {
+		return "", nil, fmt.Errorf("failed to delete event: %w", err)
+	}
+
+	// The bake may now end with (or no longer end with) loaf-complete
+	_, err = tx.Exec(`UPDATE bakes SET completed = COALESCE(
+		(SELECT event = ? FROM events WHERE bake_id = ? ORDER BY seq DESC LIMIT 1), 0)
+		WHERE id = ?`, string(models.EventLoafComplete), id, id)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to update bake: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", nil, fmt.Errorf("failed to commit delete: %w", err)
+	}
+	return id, &deleted, nil
+}
+
+// InsertEventByTime adds an event to the current bake in time order
+func (s *SQLiteStore) InsertEventByTime(event *models.Event) (string, error) {
+	id, err := s.insertEventByTime(event)
+	if err != nil {
+		return "", err
+	}
+
+	// A newly logged event is announced as appended wherever it went
+	s.notify(Change{Op: OpAppend, BakeID: id, Event: event})
+	return id, nil
+}
+
+// insertEventByTime finds the event's place and writes it under one hold of
+// the storage lock. Anything before the last event rewrites the bake's events
+// in one transaction.
+func (s *SQLiteStore) insertEventByTime(event *models.Event) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, exists, err := s.currentBakeID()
+	if err != nil {
+		return "", err
+	}
+	events := []models.Event{}
+	if exists {
+		if events, err = s.readEvents(id); err != nil {
+			return "", err
+		}
+	}
+	index := eventIndex(events, event.Timestamp)
+	numberFolds(events, index, event)
+	if index == len(events) {
+		return s.appendEventLocked(event)
+	}
+	events = append(events[:index], append([]models.Event{*event}, events[index:]...)...)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE bakes SET updated_at = ? WHERE id = ?`, time.Now().UnixNano(), id); err != nil {
+		return "", fmt.Errorf("failed to update bake: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM events WHERE bake_id = ?`, id); err != nil {
+		return "", fmt.Errorf("failed to clear events: %w", err)
+	}
+	for i := range events {
+		if err := insertEvent(tx, id, &events[i]); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit event: %w", err)
+	}
+	return id, nil
+}
+
+// InsertEvent puts an event back into the current bake at index, e.g. to undo a delete
+func (s *SQLiteStore) InsertEvent(index int, event *models.Event) error {
+	id, err := s.insertEventAt(index, event)
+	if err != nil {
+		return err
+	}
+
+	s.notify(Change{Op: OpInsertEvent, BakeID: id, Event: event})
+	return nil
+}
+
+// insertEventAt shifts later events up one place and inserts the event under the storage lock
+func (s *SQLiteStore) insertEventAt(index int, event *models.Event) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, exists, err := s.currentBakeID()
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("no current bake")
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	var maxSeq int64
+	if err := tx.QueryRow(`SELECT COUNT(*), COALESCE(MAX(seq), 0) FROM events WHERE bake_id = ?`, id).Scan(&count, &maxSeq); err != nil {
+		return "", fmt.Errorf("failed to count events: %w", err)
+	}
+	if index < 0 || index > count {
+		return "", fmt.Errorf("invalid event index: %d", index)
+	}
+
+	seq := maxSeq + 1
+	if index < count {
+		if err := tx.QueryRow(`SELECT seq FROM events WHERE bake_id = ? ORDER BY seq LIMIT 1 OFFSET ?`, id, index).Scan(&seq); err != nil {
+			return "", fmt.Errorf("failed to read event: %w", err)
+		}
+		// Shift through negative values so no two rows share a key mid-update
+		if _, err := tx.Exec(`UPDATE events SET seq = -(seq + 1) WHERE bake_id = ? AND seq >= ?`, id, seq); err != nil {
+			return "", fmt.Errorf("failed to shift events: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE events SET seq = -seq WHERE bake_id = ? AND seq < 0`, id); err != nil {
+			return "", fmt.Errorf("failed to shift events: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO events (bake_id, seq, timestamp, event, body) VALUES (?, ?, ?, ?, ?)`,
+		id, seq, event.Timestamp.Format(time.RFC3339Nano), string(event.Event), string(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to write event: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE bakes SET updated_at = ?, completed = COALESCE(
+		(SELECT event = ? FROM events WHERE bake_id = ? ORDER BY seq DESC LIMIT 1), 0)
+		WHERE id = ?`, time.Now().UnixNano(), string(models.EventLoafComplete), id, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to update bake: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit insert: %w", err)
+	}
+	return id, nil
+}
+
+// IntegrityIssues runs SQLite's quick_check and reports any problems it finds
+func (s *SQLiteStore) IntegrityIssues() ([]IntegrityIssue, error) {
+	rows, err := s.db.Query("PRAGMA quick_check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check database: %w", err)
+	}
+	defer rows.Close()
+
+	var issues []IntegrityIssue
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, fmt.Errorf("failed to read check result: %w", err)
+		}
+		if result != "ok" {
+			issues = append(issues, IntegrityIssue{File: SQLiteFile, Problem: result})
+		}
+	}
+	return issues, rows.Err()
+}
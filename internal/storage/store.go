@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+)
+
+// Store is the interface implemented by every storage backend.
+// Bakes are identified by an ID such as "2025-10-07_19-13-49"; the active bake
+// is the most recently updated one that does not end with loaf-complete. A
+// store acts for the household, whose active bake may be anyone's; ForBaker
+// gives a view whose active bake is one baker's own.
+type Store interface {
+	// ForBaker returns a view of the store whose active bake is the most recently
+	// updated uncompleted one baker started (see Bake.Baker). Appending with no
+	// such bake starts a new one, even while other bakers have bakes in progress.
+	ForBaker(baker string) Store
+	// AppendEvent appends an event to the active bake, starting a new bake if there is none
+	AppendEvent(event *models.Event) error
+	// ReadCurrentBake returns the active bake, or an empty bake if there is none
+	ReadCurrentBake() (*models.Bake, error)
+	// ReadBake returns all events of a bake; unknown IDs return an empty bake
+	ReadBake(date string) (*models.Bake, error)
+	// ListBakes returns all bake IDs, most recent first
+	ListBakes() ([]string, error)
+	// HasCurrentBake reports whether there is an active (uncompleted) bake
+	HasCurrentBake() (bool, error)
+	// GetLastEvent returns the most recent event of the active bake, or nil
+	GetLastEvent() (*models.Event, error)
+	// DeleteBake moves a bake and its images to a timestamped trash entry
+	DeleteBake(date string) error
+	// ListTrash returns deleted bakes, most recently deleted first
+	ListTrash() ([]TrashEntry, error)
+	// RestoreBake moves a trash entry back and returns its bake ID
+	RestoreBake(trashID string) (string, error)
+	// PurgeTrash permanently removes entries deleted more than olderThan ago
+	PurgeTrash(olderThan time.Duration) ([]string, error)
+	// DeleteEvent removes an event from the active bake by index and timestamp
+	DeleteEvent(index int, timestamp string) error
+	// DeleteBakeEvent removes an event from a bake by ID, e.g. the loaf-complete
+	// of a bake that is no longer active; "" means the active bake
+	DeleteBakeEvent(id string, index int, timestamp string) error
+	// InsertEvent puts an event back into the active bake at index (0..len)
+	InsertEvent(index int, event *models.Event) error
+	// InsertEventByTime adds an event to the active bake after every event
+	// logged at or before its timestamp, in one write under the storage lock. A
+	// fold is numbered after the fold before it and the folds right after it
+	// are renumbered. Subscribers see an OpAppend wherever the event went. It
+	// returns the ID of the bake the event went into.
+	InsertEventByTime(event *models.Event) (string, error)
+	// ImportBake writes a finished bake under an ID derived from its first event
+	ImportBake(bake *models.Bake) (string, error)
+	// WriteBake creates a bake with exactly the given ID and events
+	WriteBake(id string, events []models.Event) error
+	// ReplaceBake creates a bake or overwrites all its events, e.g. with a synced copy
+	ReplaceBake(id string, events []models.Event) error
+	// UpdateBake replaces a bake's events with what update returns for the
+	// current ones, holding the storage lock so no other write lands in between.
+	// A bake that doesn't exist has no events. If update returns no events the
+	// bake is left alone. It reports whether the bake was written.
+	UpdateBake(id string, update func(events []models.Event) []models.Event) (bool, error)
+	// SaveImage saves an uploaded image for the active bake
+	SaveImage(filename string, data io.Reader) error
+	// GetImagePath returns the path of an image on disk
+	GetImagePath(bakeDate, filename string) string
+	// Subscribe registers a listener for successful mutations
+	Subscribe(fn func(Change))
+}
+
+// ErrBakeExists is returned when writing or restoring a bake under an ID that is taken
+var ErrBakeExists = errors.New("bake already exists")
+
+// ValidName reports whether a bake ID or image file name stays inside its
+// directory, for names that come from peers or import files
+func ValidName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
+}
+
+// Backend names accepted by Open
+const (
+	BackendJSONL  = "jsonl"
+	BackendSQLite = "sqlite"
+)
+
+// Open creates a store of the named backend in dataDir. An empty backend means JSONL.
+func Open(backend, dataDir string) (Store, error) {
+	switch backend {
+	case "", BackendJSONL:
+		return New(dataDir)
+	case BackendSQLite:
+		return NewSQLite(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s (use %s or %s)", backend, BackendJSONL, BackendSQLite)
+	}
+}
+
+// Compile-time checks that both backends implement Store, IntegrityChecker and io.Closer
+var (
+	_ Store = (*Storage)(nil)
+	_ Store = (*SQLiteStore)(nil)
+
+	_ IntegrityChecker = (*Storage)(nil)
+	_ IntegrityChecker = (*SQLiteStore)(nil)
+
+	_ Snapshotter = (*SQLiteStore)(nil)
+
+	_ io.Closer = (*Storage)(nil)
+	_ io.Closer = (*SQLiteStore)(nil)
+)
+
+// Snapshotter is implemented by stores whose files can't be copied safely while open
+type Snapshotter interface {
+	// Snapshot writes a consistent copy of the database file to path
+	Snapshot(path string) error
+}
+
+// eventIndex returns where an event logged at t goes in time order: after
+// every event logged at or before t
+func eventIndex(events []models.Event, t time.Time) int {
+	index := len(events)
+	for index > 0 && events[index-1].Timestamp.After(t) {
+		index--
+	}
+	return index
+}
+
+// numberFolds numbers a fold going in at index after the fold before it, as
+// when logged live, and moves the run of folds that follows it up by one
+func numberFolds(events []models.Event, index int, event *models.Event) {
+	if event.Event != models.EventFold {
+		return
+	}
+	count := 1
+	if index > 0 {
+		if prev := events[index-1]; prev.Event == models.EventFold && prev.FoldCount != nil {
+			count = *prev.FoldCount + 1
+		}
+	}
+	event.WithFoldCount(count)
+	for i := index; i < len(events) && events[i].Event == models.EventFold; i++ {
+		count++
+		n := count
+		events[i].FoldCount = &n
+	}
+}
+
+// assessmentFromEvent extracts the assessment stored on a loaf-complete event, if any
+func assessmentFromEvent(event models.Event) *models.Assessment {
+	if event.Event != models.EventLoafComplete || event.Data == nil {
+		return nil
+	}
+
+	assessmentData, ok := event.Data["assessment"]
+	if !ok {
+		return nil
+	}
+
+	assessmentJSON, _ := json.Marshal(assessmentData)
+	var assessment models.Assessment
+	if json.Unmarshal(assessmentJSON, &assessment) != nil {
+		return nil
+	}
+	return &assessment
+}
+
+// importEvents sorts a bake's events, ensures it ends with loaf-complete (so it
+// never becomes the active bake) and stores the assessment on that event.
+// It returns the bake ID derived from the first event and the events to write.
+func importEvents(bake *models.Bake) (string, []models.Event, error) {
+	if len(bake.Events) == 0 {
+		return "", nil, fmt.Errorf("bake has no events")
+	}
+
+	events := append([]models.Event(nil), bake.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	if events[len(events)-1].Event != models.EventLoafComplete {
+		events = append(events, models.Event{Timestamp: events[len(events)-1].Timestamp, Event: models.EventLoafComplete})
+	}
+	if bake.Assessment != nil {
+		last := &events[len(events)-1]
+		if last.Data == nil {
+			last.Data = make(map[string]interface{})
+		}
+		last.Data["assessment"] = bake.Assessment
+	}
+
+	return events[0].Timestamp.Format("2006-01-02_15-04-05"), events, nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashDir is where deleted bakes are kept, relative to the data directory
+const TrashDir = "trash"
+
+// trashStampFormat timestamps trash entries (UTC) so deleting the same bake twice never collides
+const trashStampFormat = "20060102-150405.000000000"
+
+// Errors returned by RestoreBake
+var (
+	ErrInvalidTrashID = errors.New("invalid trash ID")
+	ErrTrashNotFound  = errors.New("trash entry not found")
+)
+
+// TrashEntry is a deleted bake that can still be restored
+type TrashEntry struct {
+	ID        string    `json:"id"`      // Trash ID, e.g. 2025-10-07_19-13-49@20251018-101500.123456789
+	BakeID    string    `json:"bake_id"` // ID the bake is restored under
+	DeletedAt time.Time `json:"deleted_at"`
+	Events    int       `json:"events"`
+	Images    int       `json:"images"`
+}
+
+// newTrashID returns the trash ID for a bake deleted now
+func newTrashID(bakeID string) string {
+	return bakeID + "@" + time.Now().UTC().Format(trashStampFormat)
+}
+
+// splitTrashID returns the bake ID and deletion time encoded in a trash ID.
+// Entries trashed before IDs were timestamped have no deletion time.
+func splitTrashID(trashID string) (string, time.Time, bool) {
+	bakeID, stamp, found := strings.Cut(trashID, "@")
+	if !found {
+		return trashID, time.Time{}, false
+	}
+	deletedAt, err := time.Parse(trashStampFormat, stamp)
+	if err != nil {
+		return bakeID, time.Time{}, false
+	}
+	return bakeID, deletedAt, true
+}
+
+// validTrashID rejects IDs that could escape the trash directory
+func validTrashID(trashID string) error {
+	if !ValidName(trashID) {
+		return fmt.Errorf("%w: %q", ErrInvalidTrashID, trashID)
+	}
+	return nil
+}
+
+// trashEntryDir is the directory holding one trashed bake's file and images
+func trashEntryDir(dataDir, trashID string) string {
+	return filepath.Join(dataDir, TrashDir, "bake_"+trashID)
+}
+
+// imagesDir is the live image directory of a bake
+func imagesDir(dataDir, bakeID string) string {
+	return filepath.Join(dataDir, "images", "bake_"+bakeID)
+}
+
+// moveImagesToTrash moves a bake's images, if any, into its trash entry
+func (p SyncPolicy) moveImagesToTrash(dataDir, bakeID, trashID string) error {
+	src := imagesDir(dataDir, bakeID)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	entryDir := trashEntryDir(dataDir, trashID)
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	if err := os.Rename(src, filepath.Join(entryDir, "images")); err != nil {
+		return fmt.Errorf("failed to move images to trash: %w", err)
+	}
+	return p.syncDir(entryDir)
+}
+
+// restoreImages moves a trash entry's images, if any, back to the bake's image directory
+func (p SyncPolicy) restoreImages(dataDir, trashID, bakeID string) error {
+	src := filepath.Join(trashEntryDir(dataDir, trashID), "images")
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	dst := imagesDir(dataDir, bakeID)
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("images already exist for bake %s", bakeID)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("failed to restore images: %w", err)
+	}
+	return p.syncDir(filepath.Dir(dst))
+}
+
+// countImages returns the number of files in a trash entry's image directory
+func countImages(dataDir, trashID string) int {
+	files, err := os.ReadDir(filepath.Join(trashEntryDir(dataDir, trashID), "images"))
+	if err != nil {
+		return 0
+	}
+	return len(files)
+}
+
+// ParseAge parses an age such as "30d", "12h" or "90m"; days are not
+// understood by time.ParseDuration so they are handled here
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age: %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age: %q (use e.g. 30d or 12h)", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,428 @@
+// Package webhook sends signed HTTP callbacks when bakes change. Deliveries
+// are queued on disk and retried with backoff, so a receiver that is down or
+// a server restart doesn't lose them. Receivers may see a delivery twice and
+// should use its ID to ignore repeats.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// Dir is where the delivery queue is kept, inside the data directory
+const Dir = "webhooks"
+
+const (
+	queueFile      = "deliveries.json"
+	requestTimeout = 10 * time.Second
+	firstRetry     = 30 * time.Second // Wait before the second attempt, doubled after each
+	maxRetryDelay  = time.Hour
+	keepFinished   = 100 // Delivered and failed deliveries kept for the admin endpoint
+
+	// DefaultMaxAttempts gives up after about an hour of retries
+	DefaultMaxAttempts = 8
+)
+
+// Delivery types
+const (
+	TypeEventLogged   = "event.logged"   // An event was appended to the active bake
+	TypeEventDeleted  = "event.deleted"  // An event was removed from the active bake
+	TypeBakeCompleted = "bake.completed" // loaf-complete was logged, also sent as event.logged
+	TypeBakeDeleted   = "bake.deleted"   // A bake was moved to the trash
+)
+
+// Types lists every delivery type
+var Types = []string{TypeEventLogged, TypeEventDeleted, TypeBakeCompleted, TypeBakeDeleted}
+
+// Signature headers. The signature is hex HMAC-SHA256 of "<timestamp>.<body>"
+// with the shared secret, so receivers can also reject old replays.
+const (
+	HeaderSignature = "X-Sourdough-Signature" // "sha256=<hex>"
+	HeaderTimestamp = "X-Sourdough-Timestamp" // Unix seconds
+	HeaderType      = "X-Sourdough-Event"
+	HeaderDelivery  = "X-Sourdough-Delivery"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Config says where to send which deliveries
+type Config struct {
+	URLs        []string
+	Secret      string   // Signs every payload; required
+	Types       []string // Types to send, empty for all
+	MaxAttempts int      // Attempts before a delivery is failed, DefaultMaxAttempts if 0
+}
+
+// Payload is the JSON body sent to each URL
+type Payload struct {
+	ID        string        `json:"id"` // Same as the delivery ID, for deduplication
+	Type      string        `json:"type"`
+	CreatedAt time.Time     `json:"created_at"`
+	BakeID    string        `json:"bake_id"`
+	Event     *models.Event `json:"event,omitempty"`
+}
+
+// Delivery is one payload on its way to one URL
+type Delivery struct {
+	ID          string          `json:"id"`
+	URL         string          `json:"url"`
+	Type        string          `json:"type"`
+	BakeID      string          `json:"bake_id"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	NextAttempt *time.Time      `json:"next_attempt,omitempty"` // While pending
+	LastAttempt *time.Time      `json:"last_attempt,omitempty"`
+	LastStatus  int             `json:"last_status_code,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// Dispatcher queues deliveries for bake changes and sends them
+type Dispatcher struct {
+	config  Config
+	dataDir string
+	client  *http.Client
+	backoff func(attempt int) time.Duration // Wait after a failed attempt
+	now     func() time.Time
+
+	mu         sync.Mutex
+	deliveries []*Delivery // Oldest first
+	wake       chan struct{}
+}
+
+// New loads the delivery queue from dataDir and starts queueing deliveries for changes to store
+func New(store storage.Store, dataDir string, config Config) (*Dispatcher, error) {
+	if config.Secret == "" {
+		return nil, fmt.Errorf("a secret is required to sign deliveries")
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	d := &Dispatcher{
+		config:  config,
+		dataDir: dataDir,
+		client:  &http.Client{Timeout: requestTimeout},
+		backoff: retryDelay,
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, Dir, queueFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read webhook queue: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &d.deliveries); err != nil {
+			return nil, fmt.Errorf("failed to parse webhook queue: %w", err)
+		}
+	}
+
+	store.Subscribe(d.watch)
+	return d, nil
+}
+
+// retryDelay doubles from firstRetry up to maxRetryDelay
+func retryDelay(attempt int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// URLs returns where deliveries are sent
+func (d *Dispatcher) URLs() []string {
+	return d.config.URLs
+}
+
+// watch turns a storage change into deliveries
+func (d *Dispatcher) watch(change storage.Change) {
+	switch change.Op {
+	case storage.OpAppend:
+		d.enqueue(TypeEventLogged, change)
+		if change.Event != nil && change.Event.Event == models.EventLoafComplete {
+			d.enqueue(TypeBakeCompleted, change)
+		}
+	case storage.OpDeleteEvent:
+		d.enqueue(TypeEventDeleted, change)
+	case storage.OpDeleteBake:
+		d.enqueue(TypeBakeDeleted, change)
+	}
+}
+
+// wants reports whether deliveries of a type are configured
+func (d *Dispatcher) wants(deliveryType string) bool {
+	if len(d.config.Types) == 0 {
+		return true
+	}
+	for _, t := range d.config.Types {
+		if t == deliveryType {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue adds a delivery per URL and saves the queue before returning
+func (d *Dispatcher) enqueue(deliveryType string, change storage.Change) {
+	if !d.wants(deliveryType) || len(d.config.URLs) == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	now := d.now()
+	for _, url := range d.config.URLs {
+		id := models.NewEventID()
+		payload, err := json.Marshal(Payload{ID: id, Type: deliveryType, CreatedAt: now, BakeID: change.BakeID, Event: change.Event})
+		if err != nil {
+			log.Printf("Warning: Failed to encode webhook payload: %v", err)
+			continue
+		}
+		next := now
+		d.deliveries = append(d.deliveries, &Delivery{
+			ID:          id,
+			URL:         url,
+			Type:        deliveryType,
+			BakeID:      change.BakeID,
+			Payload:     payload,
+			Status:      StatusPending,
+			CreatedAt:   now,
+			NextAttempt: &next,
+		})
+	}
+	err := d.saveLocked()
+	d.mu.Unlock()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// saveLocked writes the queue atomically, dropping the oldest finished
+// deliveries beyond keepFinished; the caller holds d.mu
+func (d *Dispatcher) saveLocked() error {
+	finished := 0
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].Status == StatusPending {
+			continue
+		}
+		finished++
+		if finished > keepFinished {
+			d.deliveries = append(d.deliveries[:i], d.deliveries[i+1:]...)
+		}
+	}
+
+	dir := filepath.Join(d.dataDir, Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create webhook directory: %w", err)
+	}
+	data, err := json.MarshalIndent(d.deliveries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook queue: %w", err)
+	}
+	path := filepath.Join(dir, queueFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write webhook queue: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write webhook queue: %w", err)
+	}
+	return nil
+}
+
+// Run sends due deliveries, oldest first, until ctx is cancelled. An attempt
+// cut short by cancellation is retried on the next run.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		for {
+			delivery := d.due()
+			if delivery == nil {
+				break
+			}
+			d.attempt(ctx, delivery)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		// Sleep until the next retry or a new delivery
+		var timer *time.Timer
+		var due <-chan time.Time
+		if next := d.nextAttempt(); next != nil {
+			timer = time.NewTimer(time.Until(*next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-d.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// due returns a copy of the oldest delivery whose next attempt has come, or nil
+func (d *Dispatcher) due() *Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	for _, delivery := range d.deliveries {
+		if delivery.Status == StatusPending && !delivery.NextAttempt.After(now) {
+			pending := *delivery
+			return &pending
+		}
+	}
+	return nil
+}
+
+// nextAttempt returns when the earliest pending delivery is due, or nil
+func (d *Dispatcher) nextAttempt() *time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var next *time.Time
+	for _, delivery := range d.deliveries {
+		if delivery.Status == StatusPending && (next == nil || delivery.NextAttempt.Before(*next)) {
+			t := *delivery.NextAttempt
+			next = &t
+		}
+	}
+	return next
+}
+
+// attempt sends a delivery once and records the outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	code, err := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var stored *Delivery
+	for _, candidate := range d.deliveries {
+		if candidate.ID == delivery.ID {
+			stored = candidate
+			break
+		}
+	}
+	if stored == nil {
+		return
+	}
+
+	now := d.now()
+	stored.Attempts++
+	stored.LastAttempt = &now
+	stored.LastStatus = code
+	stored.LastError = ""
+	switch {
+	case err == nil:
+		stored.Status, stored.NextAttempt = StatusDelivered, nil
+	case !retryable(code) || stored.Attempts >= d.config.MaxAttempts:
+		stored.Status, stored.NextAttempt, stored.LastError = StatusFailed, nil, err.Error()
+		log.Printf("Warning: Webhook %s to %s failed after %d attempts: %v", stored.Type, stored.URL, stored.Attempts, err)
+	default:
+		next := now.Add(d.backoff(stored.Attempts))
+		stored.NextAttempt, stored.LastError = &next, err.Error()
+	}
+	if err := d.saveLocked(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// retryable reports whether a failure may go away: no response, timeouts, rate limits and server errors
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// send POSTs the signed payload, returning the status code (0 without a response)
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sourdough-webhook")
+	req.Header.Set(HeaderType, delivery.Type)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(d.config.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for a payload sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header in constant time
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Deliveries returns up to limit deliveries, newest first, and how many are pending
+func (d *Dispatcher) Deliveries(limit int) ([]Delivery, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending := 0
+	list := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].Status == StatusPending {
+			pending++
+		}
+		list = append(list, *d.deliveries[i])
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, pending
+}
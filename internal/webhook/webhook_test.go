@@ -0,0 +1,232 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdeckert/sourdough/internal/models"
+	"github.com/mdeckert/sourdough/internal/storage"
+)
+
+// receiver records deliveries, answering with the queued status codes and then 200
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	codes    []int
+	received []Payload
+	requests int
+	badSig   int
+}
+
+func newReceiver(t *testing.T, secret string, codes ...int) *receiver {
+	rc := &receiver{codes: codes}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		rc.requests++
+		if secret != "" && !Verify(secret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			rc.badSig++
+		}
+		if len(rc.codes) > 0 {
+			code := rc.codes[0]
+			rc.codes = rc.codes[1:]
+			w.WriteHeader(code)
+			return
+		}
+		var p Payload
+		json.Unmarshal(body, &p)
+		if p.Type != r.Header.Get(HeaderType) || p.ID != r.Header.Get(HeaderDelivery) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rc.received = append(rc.received, p)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) payloads() []Payload {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Payload(nil), rc.received...)
+}
+
+func setup(t *testing.T, config Config) (*Dispatcher, storage.Store, string) {
+	tmpDir, err := os.MkdirTemp("", "webhook-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	store, err := storage.New(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	d, err := New(store, tmpDir, config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	d.backoff = func(int) time.Duration { return time.Millisecond }
+	return d, store, tmpDir
+}
+
+// run runs the dispatcher until every delivery is finished
+func run(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, pending := d.Deliveries(0); pending == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Deliveries still pending")
+}
+
+func TestDeliverSigned(t *testing.T) {
+	rc := newReceiver(t, "s3cret")
+	d, store, _ := setup(t, Config{URLs: []string{rc.URL}, Secret: "s3cret"})
+
+	store.AppendEvent(models.NewEvent(models.EventMixed))
+	store.AppendEvent(models.NewEvent(models.EventLoafComplete))
+	bakes, _ := store.ListBakes()
+	store.DeleteBake(bakes[0])
+	run(t, d)
+
+	var types []string
+	for _, p := range rc.payloads() {
+		types = append(types, p.Type)
+	}
+	want := []string{TypeEventLogged, TypeEventLogged, TypeBakeCompleted, TypeBakeDeleted}
+	if len(types) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, types)
+			break
+		}
+	}
+	if p := rc.payloads()[0]; p.Event == nil || p.Event.Event != models.EventMixed || p.BakeID != bakes[0] {
+		t.Errorf("Unexpected payload %+v", p)
+	}
+	if rc.badSig != 0 {
+		t.Errorf("Expected valid signatures, got %d bad", rc.badSig)
+	}
+
+	deliveries, _ := d.Deliveries(2)
+	if len(deliveries) != 2 || deliveries[0].Type != TypeBakeDeleted || deliveries[0].Status != StatusDelivered || deliveries[0].LastStatus != 200 {
+		t.Errorf("Expected the newest delivery first, got %+v", deliveries)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int
+		status   string
+		attempts int
+	}{
+		{"recovers", []int{500, 503}, StatusDelivered, 3},
+		{"rate limited", []int{429}, StatusDelivered, 2},
+		{"rejected", []int{400}, StatusFailed, 1},
+		{"gives up", []int{500, 500, 500, 500}, StatusFailed, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := newReceiver(t, "", tt.codes...)
+			d, store, _ := setup(t, Config{URLs: []string{rc.URL}, Secret: "s3cret", MaxAttempts: 3})
+
+			store.AppendEvent(models.NewEvent(models.EventFold))
+			run(t, d)
+
+			deliveries, _ := d.Deliveries(0)
+			if len(deliveries) != 1 || deliveries[0].Status != tt.status || deliveries[0].Attempts != tt.attempts {
+				t.Fatalf("Expected %s after %d attempts, got %+v", tt.status, tt.attempts, deliveries)
+			}
+			if tt.status == StatusFailed && deliveries[0].LastError == "" {
+				t.Error("Expected the last error to be recorded")
+			}
+		})
+	}
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	rc := newReceiver(t, "")
+	d, store, tmpDir := setup(t, Config{URLs: []string{rc.URL}, Secret: "s3cret", Types: []string{TypeEventLogged}})
+
+	// Queued but never sent, as if the server stopped
+	store.AppendEvent(models.NewEvent(models.EventFold))
+	store.AppendEvent(models.NewEvent(models.EventShaped))
+	if _, pending := d.Deliveries(0); pending != 2 {
+		t.Fatalf("Expected 2 pending, got %d", pending)
+	}
+
+	reopened, err := storage.New(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	restarted, err := New(reopened, tmpDir, Config{URLs: []string{rc.URL}, Secret: "s3cret", Types: []string{TypeEventLogged}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	run(t, restarted)
+
+	payloads := rc.payloads()
+	if len(payloads) != 2 || payloads[0].Event.Event != models.EventFold || payloads[1].Event.Event != models.EventShaped {
+		t.Errorf("Expected the queued fold and shaped in order, got %+v", payloads)
+	}
+
+	// Filtered types aren't queued
+	reopened.DeleteEvent(1, payloads[1].Event.Timestamp.Format(time.RFC3339Nano))
+	if _, pending := restarted.Deliveries(0); pending != 0 {
+		t.Errorf("Expected event.deleted to be filtered out, got %d pending", pending)
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	sig := Sign("secret", "1700000000", body)
+	if !Verify("secret", "1700000000", body, sig) {
+		t.Error("Expected the signature to verify")
+	}
+	if Verify("secret", "1700000001", body, sig) || Verify("other", "1700000000", body, sig) {
+		t.Error("Expected a different timestamp or secret to fail")
+	}
+}
+
+func TestNewRequiresSecret(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "webhook-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store, err := storage.New(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, err := New(store, tmpDir, Config{URLs: []string{"https://example.com/hook"}}); err == nil {
+		t.Error("Expected New to refuse unsigned deliveries")
+	}
+}